@@ -0,0 +1,124 @@
+// Copyright AGNTCY Contributors (https://github.com/agntcy)
+// SPDX-License-Identifier: Apache-2.0
+
+// slim-devpki generates a development PKI for mutual TLS: a CA, a server
+// certificate for the given hosts and a client certificate, with server and
+// client configuration files that load them.
+//
+// Usage:
+//
+//	go install github.com/agntcy/slim-bindings-go/cmd/slim-devpki@latest
+//	slim-devpki -dir ./pki -listen 0.0.0.0:46357 -connect https://localhost:46357 [host...]
+//
+// The server.json and client.json files written next to the certificates are
+// slimconfig files: slimconfig.Load("pki/server.json") gives a service with
+// the TLS server, and slimconfig.Load("pki/client.json") one with the client.
+//
+// It is a separate command from slim-bindings-setup, which must run before
+// the native library is installed.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/agntcy/slim-bindings-go/slimtls"
+)
+
+// errUsage reports invalid flags, which the flag package already printed.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("slim-devpki", flag.ContinueOnError)
+	dir := flags.String("dir", "pki", "Directory for the certificates, keys and configuration files.")
+	listen := flags.String("listen", "0.0.0.0:46357", "Endpoint of the server.")
+	connect := flags.String("connect", "https://localhost:46357", "Endpoint the client connects to.")
+	validity := flags.Duration("validity", slimtls.DefaultValidity, "How long the certificates are valid.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: slim-devpki [flags] [host...]\n\n")
+		fmt.Fprintf(flags.Output(), "The server certificate names the hosts of -listen and -connect, the given\nhosts, localhost, 127.0.0.1 and ::1.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return errUsage
+	}
+
+	abs, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	endpoints := append([]string{*listen, *connect}, flags.Args()...)
+	pki, err := slimtls.NewPKI(endpoints, slimtls.WithValidity(*validity))
+	if err != nil {
+		return err
+	}
+	files, err := pki.WriteFiles(abs)
+	if err != nil {
+		return err
+	}
+
+	serverFile := filepath.Join(abs, "server.json")
+	if err := writeConfig(serverFile, "servers", map[string]any{
+		"endpoint": *listen,
+		"tls": map[string]any{
+			"source":                       map[string]any{"file": map[string]any{"cert": files.ServerCert, "key": files.ServerKey}},
+			"client_ca":                    map[string]any{"file": files.CA},
+			"include_system_ca_certs_pool": false,
+			"tls_version":                  "tls1.3",
+		},
+	}); err != nil {
+		return err
+	}
+	clientFile := filepath.Join(abs, "client.json")
+	if err := writeConfig(clientFile, "clients", map[string]any{
+		"endpoint": *connect,
+		"tls": map[string]any{
+			"source":                       map[string]any{"file": map[string]any{"cert": files.ClientCert, "key": files.ClientKey}},
+			"ca_source":                    map[string]any{"file": files.CA},
+			"include_system_ca_certs_pool": false,
+			"tls_version":                  "tls1.3",
+		},
+	}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "✅ Development PKI written to %s\n", abs)
+	fmt.Fprintf(stdout, "   CA:      %s\n", files.CA)
+	fmt.Fprintf(stdout, "   Server:  %s, %s (%s)\n", files.ServerCert, files.ServerKey, serverFile)
+	fmt.Fprintf(stdout, "   Client:  %s, %s (%s)\n", files.ClientCert, files.ClientKey, clientFile)
+	fmt.Fprintf(stdout, "   Expires: %s\n", pki.Server.Leaf.NotAfter.Format("2006-01-02 15:04"))
+	return nil
+}
+
+// writeConfig writes a slimconfig file with a single service holding entry
+// in its dataplane servers or clients.
+func writeConfig(name, list string, entry map[string]any) error {
+	data, err := json.MarshalIndent(map[string]any{
+		"services": []any{
+			map[string]any{"dataplane": map[string]any{list: []any{entry}}},
+		},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(data, '\n'), 0o600)
+}
@@ -0,0 +1,67 @@
+// Copyright AGNTCY Contributors (https://github.com/agntcy)
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+	"github.com/agntcy/slim-bindings-go/slimconfig"
+)
+
+func TestRun(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "pki")
+	var stdout strings.Builder
+	if err := run([]string{"-dir", dir, "-connect", "https://slim.local:46357", "-validity", "1h", "10.0.0.1"}, &stdout); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !strings.Contains(stdout.String(), dir) {
+		t.Errorf("output = %q", stdout.String())
+	}
+
+	// The configuration files load and validate, certificates included.
+	defaults := slimconfig.WithDefaults(slimconfig.Config{})
+	server, err := slimconfig.Load(filepath.Join(dir, "server.json"), defaults)
+	if err != nil {
+		t.Fatalf("Load server.json: %v", err)
+	}
+	serverConfig := server.Services[0].Dataplane.Servers[0]
+	if serverConfig.Endpoint != "0.0.0.0:46357" {
+		t.Errorf("Endpoint = %q", serverConfig.Endpoint)
+	}
+	source := serverConfig.Tls.Source.(slim_bindings.TlsSourceFile)
+	cert, err := tls.LoadX509KeyPair(source.Cert, source.Key)
+	if err != nil {
+		t.Fatalf("server certificate: %v", err)
+	}
+	if !slices.Contains(cert.Leaf.DNSNames, "slim.local") || len(cert.Leaf.IPAddresses) != 3 {
+		t.Errorf("DNSNames = %q, IPAddresses = %v", cert.Leaf.DNSNames, cert.Leaf.IPAddresses)
+	}
+	if d := cert.Leaf.NotAfter.Sub(cert.Leaf.NotBefore); d.Hours() != 1 {
+		t.Errorf("validity = %v", d)
+	}
+
+	client, err := slimconfig.Load(filepath.Join(dir, "client.json"), defaults)
+	if err != nil {
+		t.Fatalf("Load client.json: %v", err)
+	}
+	clientConfig := client.Services[0].Dataplane.Clients[0]
+	if clientConfig.Endpoint != "https://slim.local:46357" || clientConfig.Tls.IncludeSystemCaCertsPool {
+		t.Errorf("client = %+v", clientConfig)
+	}
+	if ca := clientConfig.Tls.CaSource.(slim_bindings.CaSourceFile); ca.Path != filepath.Join(dir, "ca.pem") {
+		t.Errorf("CaSource = %+v", ca)
+	}
+}
+
+func TestRunBadFlag(t *testing.T) {
+	if err := run([]string{"-validity", "soon"}, &strings.Builder{}); !errors.Is(err, errUsage) {
+		t.Errorf("run with an invalid duration = %v", err)
+	}
+}
@@ -0,0 +1,706 @@
+package slim_bindings
+
+// #include <slim_bindings.h>
+import "C"
+
+import (
+	"context"
+	"reflect"
+	"runtime/cgo"
+	"time"
+)
+
+// The ...Context methods below are variants of blocking calls that give up
+// when ctx is done. They drive the same Rust futures as the ...Async
+// methods, and cancel and free the future on the way out instead of leaving
+// it running.
+
+// uniffiRustCallAsyncContext is uniffiRustCallAsync with cancellation: if
+// ctx is done before the future completes, the future is cancelled and
+// ctx.Err() is returned.
+func uniffiRustCallAsyncContext[E any, T any, F any](
+	ctx context.Context,
+	errConverter BufReader[E],
+	completeFunc rustFutureCompleteFunc[F],
+	liftFunc func(F) T,
+	rustFuture C.uint64_t,
+	pollFunc rustFuturePollFunc,
+	cancelFunc rustFutureFreeFunc,
+	freeFunc rustFutureFreeFunc,
+) (T, error) {
+	var goValue T
+	var ffiValue F
+	var err E
+	ctxErr := runFuture(ctx,
+		func(waiter cgo.Handle) {
+			pollFunc(
+				rustFuture,
+				(C.UniffiRustFutureContinuationCallback)(C.slim_bindings_uniffiFutureContinuationCallback),
+				C.uint64_t(waiter),
+			)
+		},
+		func() { cancelFunc(rustFuture) },
+		func() {
+			ffiValue, err = rustCallWithError(errConverter, func(status *C.RustCallStatus) F {
+				return completeFunc(rustFuture, status)
+			})
+		},
+		func() { freeFunc(rustFuture) },
+	)
+	if ctxErr != nil {
+		return goValue, ctxErr
+	}
+	if value := reflect.ValueOf(err); value.IsValid() && !value.IsZero() {
+		return goValue, any(err).(error)
+	}
+	return liftFunc(ffiValue), nil
+}
+
+// runFuture polls a future until it is ready and then completes it. poll is
+// passed the handle of the channel its continuation reports to. If ctx is
+// done first, the future is cancelled instead and ctx.Err() is returned.
+// Either way the future is freed on the way out.
+func runFuture(ctx context.Context, poll func(waiter cgo.Handle), cancel, complete, free func()) error {
+	defer free()
+
+	waiter := make(chan int8, 1)
+	waiterHandle := cgo.NewHandle(waiter)
+	defer waiterHandle.Delete()
+
+	for pollResult := int8(-1); pollResult != uniffiRustFuturePollReady; {
+		poll(waiterHandle)
+		select {
+		case pollResult = <-waiter:
+		case <-ctx.Done():
+			cancel()
+			// Cancelling wakes the pending continuation; wait for it so that
+			// the handle is not deleted under it.
+			<-waiter
+			return ctx.Err()
+		}
+	}
+	complete()
+	return nil
+}
+
+// timeoutFromContext returns the time left until the deadline of ctx, or nil
+// if it has none.
+func timeoutFromContext(ctx context.Context) *time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	timeout := max(time.Until(deadline), 0)
+	return &timeout
+}
+
+func completeU64(handle C.uint64_t, status *C.RustCallStatus) C.uint64_t {
+	return C.ffi_slim_bindings_rust_future_complete_u64(handle, status)
+}
+
+func pollU64(handle C.uint64_t, continuation C.UniffiRustFutureContinuationCallback, data C.uint64_t) {
+	C.ffi_slim_bindings_rust_future_poll_u64(handle, continuation, data)
+}
+
+func cancelU64(handle C.uint64_t) {
+	C.ffi_slim_bindings_rust_future_cancel_u64(handle)
+}
+
+func freeU64(handle C.uint64_t) {
+	C.ffi_slim_bindings_rust_future_free_u64(handle)
+}
+
+func completeVoid(handle C.uint64_t, status *C.RustCallStatus) struct{} {
+	C.ffi_slim_bindings_rust_future_complete_void(handle, status)
+	return struct{}{}
+}
+
+func pollVoid(handle C.uint64_t, continuation C.UniffiRustFutureContinuationCallback, data C.uint64_t) {
+	C.ffi_slim_bindings_rust_future_poll_void(handle, continuation, data)
+}
+
+func cancelVoid(handle C.uint64_t) {
+	C.ffi_slim_bindings_rust_future_cancel_void(handle)
+}
+
+func freeVoid(handle C.uint64_t) {
+	C.ffi_slim_bindings_rust_future_free_void(handle)
+}
+
+func completeRustBuffer(handle C.uint64_t, status *C.RustCallStatus) RustBufferI {
+	return GoRustBuffer{
+		inner: C.ffi_slim_bindings_rust_future_complete_rust_buffer(handle, status),
+	}
+}
+
+func pollRustBuffer(handle C.uint64_t, continuation C.UniffiRustFutureContinuationCallback, data C.uint64_t) {
+	C.ffi_slim_bindings_rust_future_poll_rust_buffer(handle, continuation, data)
+}
+
+func cancelRustBuffer(handle C.uint64_t) {
+	C.ffi_slim_bindings_rust_future_cancel_rust_buffer(handle)
+}
+
+func freeRustBuffer(handle C.uint64_t) {
+	C.ffi_slim_bindings_rust_future_free_rust_buffer(handle)
+}
+
+func liftVoid(struct{}) struct{} {
+	return struct{}{}
+}
+
+// ConnectContext is Connect with cancellation.
+func (_self *Service) ConnectContext(ctx context.Context, config ClientConfig) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*Service", "ConnectContext")
+	if err != nil {
+		return 0, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	return uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterSlimErrorINSTANCE,
+		completeU64,
+		FfiConverterUint64INSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_service_connect_async(
+			_pointer, FfiConverterClientConfigINSTANCE.Lower(config)),
+		pollU64,
+		cancelU64,
+		freeU64,
+	)
+}
+
+// CreateSessionAndWaitContext is CreateSessionAndWait with cancellation.
+func (_self *App) CreateSessionAndWaitContext(ctx context.Context, config SessionConfig, destination *Name) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*App", "CreateSessionAndWaitContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	object, err := uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterSlimErrorINSTANCE,
+		completeU64,
+		FfiConverterSessionINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_app_create_session_and_wait_async(
+			_pointer, FfiConverterSessionConfigINSTANCE.Lower(config), FfiConverterNameINSTANCE.Lower(destination)),
+		pollU64,
+		cancelU64,
+		freeU64,
+	)
+	return track(object, "*Session", (*Session).Destroy), err
+}
+
+// DeleteSessionAndWaitContext is DeleteSessionAndWait with cancellation.
+func (_self *App) DeleteSessionAndWaitContext(ctx context.Context, session *Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_pointer, err := _self.ffiObject.acquire("*App", "DeleteSessionAndWaitContext")
+	if err != nil {
+		return err
+	}
+	defer _self.ffiObject.decrementPointer()
+	_, err = uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterSlimErrorINSTANCE,
+		completeVoid,
+		liftVoid,
+		C.uniffi_slim_bindings_fn_method_app_delete_session_and_wait_async(
+			_pointer, FfiConverterSessionINSTANCE.Lower(session)),
+		pollVoid,
+		cancelVoid,
+		freeVoid,
+	)
+	return err
+}
+
+// ListenForSessionContext waits for an incoming session until ctx is done.
+func (_self *App) ListenForSessionContext(ctx context.Context) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*App", "ListenForSessionContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	object, err := uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterSlimErrorINSTANCE,
+		completeU64,
+		FfiConverterSessionINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_app_listen_for_session_async(
+			_pointer, FfiConverterOptionalDurationINSTANCE.Lower(nil)),
+		pollU64,
+		cancelU64,
+		freeU64,
+	)
+	return track(object, "*Session", (*Session).Destroy), err
+}
+
+// WaitContext is Wait with cancellation. Giving up does not cancel the
+// operation the handle tracks.
+func (_self *CompletionHandle) WaitContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_pointer, err := _self.ffiObject.acquire("*CompletionHandle", "WaitContext")
+	if err != nil {
+		return err
+	}
+	defer _self.ffiObject.decrementPointer()
+	_, err = uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterSlimErrorINSTANCE,
+		completeVoid,
+		liftVoid,
+		C.uniffi_slim_bindings_fn_method_completionhandle_wait_async(
+			_pointer),
+		pollVoid,
+		cancelVoid,
+		freeVoid,
+	)
+	return err
+}
+
+// GetMessageContext waits for the next message until ctx is done.
+func (_self *Session) GetMessageContext(ctx context.Context) (ReceivedMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return ReceivedMessage{}, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*Session", "GetMessageContext")
+	if err != nil {
+		return ReceivedMessage{}, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	return uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterSlimErrorINSTANCE,
+		completeRustBuffer,
+		FfiConverterReceivedMessageINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_session_get_message_async(
+			_pointer, FfiConverterOptionalDurationINSTANCE.Lower(nil)),
+		pollRustBuffer,
+		cancelRustBuffer,
+		freeRustBuffer,
+	)
+}
+
+// PublishAndWaitContext is PublishAndWait with cancellation. A message
+// already handed to the network may still be delivered.
+func (_self *Session) PublishAndWaitContext(ctx context.Context, data []byte, payloadType *string, metadata *map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_pointer, err := _self.ffiObject.acquire("*Session", "PublishAndWaitContext")
+	if err != nil {
+		return err
+	}
+	defer _self.ffiObject.decrementPointer()
+	_, err = uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterSlimErrorINSTANCE,
+		completeVoid,
+		liftVoid,
+		C.uniffi_slim_bindings_fn_method_session_publish_and_wait_async(
+			_pointer, FfiConverterBytesINSTANCE.Lower(data), FfiConverterOptionalStringINSTANCE.Lower(payloadType), FfiConverterOptionalMapStringStringINSTANCE.Lower(metadata)),
+		pollVoid,
+		cancelVoid,
+		freeVoid,
+	)
+	return err
+}
+
+// ServeContext is Serve until ctx is done, at which point the server is shut
+// down gracefully and ctx.Err() is returned.
+func (_self *Server) ServeContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := _self.ffiObject.enter("*Server", "ServeContext"); err != nil {
+		return err
+	}
+	defer _self.ffiObject.decrementPointer()
+	stop := context.AfterFunc(ctx, _self.Shutdown)
+	defer stop()
+
+	err := _self.ServeAsync()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// CallUnaryContext is CallUnary with the timeout taken from the deadline of
+// ctx, and cancellation.
+func (_self *Channel) CallUnaryContext(ctx context.Context, serviceName string, methodName string, request []byte, metadata *map[string]string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*Channel", "CallUnaryContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	return uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterRpcErrorINSTANCE,
+		completeRustBuffer,
+		FfiConverterBytesINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_channel_call_unary_async(
+			_pointer, FfiConverterStringINSTANCE.Lower(serviceName), FfiConverterStringINSTANCE.Lower(methodName), FfiConverterBytesINSTANCE.Lower(request), FfiConverterOptionalDurationINSTANCE.Lower(timeoutFromContext(ctx)), FfiConverterOptionalMapStringStringINSTANCE.Lower(metadata)),
+		pollRustBuffer,
+		cancelRustBuffer,
+		freeRustBuffer,
+	)
+}
+
+// InviteAndWaitContext is InviteAndWait with cancellation. Giving up does
+// not withdraw an invitation already sent.
+func (_self *Session) InviteAndWaitContext(ctx context.Context, participant *Name) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_pointer, err := _self.ffiObject.acquire("*Session", "InviteAndWaitContext")
+	if err != nil {
+		return err
+	}
+	defer _self.ffiObject.decrementPointer()
+	_, err = uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterSlimErrorINSTANCE,
+		completeVoid,
+		liftVoid,
+		C.uniffi_slim_bindings_fn_method_session_invite_and_wait_async(
+			_pointer, FfiConverterNameINSTANCE.Lower(participant)),
+		pollVoid,
+		cancelVoid,
+		freeVoid,
+	)
+	return err
+}
+
+// RemoveAndWaitContext is RemoveAndWait with cancellation. Giving up does
+// not stop a removal already sent.
+func (_self *Session) RemoveAndWaitContext(ctx context.Context, participant *Name) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_pointer, err := _self.ffiObject.acquire("*Session", "RemoveAndWaitContext")
+	if err != nil {
+		return err
+	}
+	defer _self.ffiObject.decrementPointer()
+	_, err = uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterSlimErrorINSTANCE,
+		completeVoid,
+		liftVoid,
+		C.uniffi_slim_bindings_fn_method_session_remove_and_wait_async(
+			_pointer, FfiConverterNameINSTANCE.Lower(participant)),
+		pollVoid,
+		cancelVoid,
+		freeVoid,
+	)
+	return err
+}
+
+// DisconnectContext is Disconnect until ctx is done. Disconnect has no
+// future to cancel: giving up leaves it running to completion.
+func (_self *Service) DisconnectContext(ctx context.Context, connId uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// The pointer is taken before returning, so that the Service can be
+	// destroyed while the call still runs.
+	_pointer, err := _self.ffiObject.acquire("*Service", "DisconnectContext")
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer _self.ffiObject.decrementPointer()
+		_, err := rustCallWithError[*SlimError](FfiConverterSlimError{}, func(status *C.RustCallStatus) bool {
+			C.uniffi_slim_bindings_fn_method_service_disconnect(
+				_pointer, FfiConverterUint64INSTANCE.Lower(connId), status)
+			return false
+		})
+		done <- err.AsError()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CallUnaryStreamContext is CallUnaryStream with the timeout taken from the
+// deadline of ctx, and cancellation. ctx only bounds opening the stream;
+// read it with ResponseStreamReader.NextContext.
+func (_self *Channel) CallUnaryStreamContext(ctx context.Context, serviceName string, methodName string, request []byte, metadata *map[string]string) (*ResponseStreamReader, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*Channel", "CallUnaryStreamContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	object, err := uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterRpcErrorINSTANCE,
+		completeU64,
+		FfiConverterResponseStreamReaderINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_channel_call_unary_stream_async(
+			_pointer, FfiConverterStringINSTANCE.Lower(serviceName), FfiConverterStringINSTANCE.Lower(methodName), FfiConverterBytesINSTANCE.Lower(request), FfiConverterOptionalDurationINSTANCE.Lower(timeoutFromContext(ctx)), FfiConverterOptionalMapStringStringINSTANCE.Lower(metadata)),
+		pollU64,
+		cancelU64,
+		freeU64,
+	)
+	return track(object, "*ResponseStreamReader", (*ResponseStreamReader).Destroy), err
+}
+
+// CallMulticastUnaryContext is CallMulticastUnary with the timeout taken
+// from the deadline of ctx, and cancellation.
+func (_self *Channel) CallMulticastUnaryContext(ctx context.Context, serviceName string, methodName string, request []byte, metadata *map[string]string) (*MulticastResponseReader, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*Channel", "CallMulticastUnaryContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	object, err := uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterRpcErrorINSTANCE,
+		completeU64,
+		FfiConverterMulticastResponseReaderINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_channel_call_multicast_unary_async(
+			_pointer, FfiConverterStringINSTANCE.Lower(serviceName), FfiConverterStringINSTANCE.Lower(methodName), FfiConverterBytesINSTANCE.Lower(request), FfiConverterOptionalDurationINSTANCE.Lower(timeoutFromContext(ctx)), FfiConverterOptionalMapStringStringINSTANCE.Lower(metadata)),
+		pollU64,
+		cancelU64,
+		freeU64,
+	)
+	return track(object, "*MulticastResponseReader", (*MulticastResponseReader).Destroy), err
+}
+
+// CallMulticastUnaryStreamContext is CallMulticastUnaryStream with the
+// timeout taken from the deadline of ctx, and cancellation.
+func (_self *Channel) CallMulticastUnaryStreamContext(ctx context.Context, serviceName string, methodName string, request []byte, metadata *map[string]string) (*MulticastResponseReader, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*Channel", "CallMulticastUnaryStreamContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	object, err := uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterRpcErrorINSTANCE,
+		completeU64,
+		FfiConverterMulticastResponseReaderINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_channel_call_multicast_unary_stream_async(
+			_pointer, FfiConverterStringINSTANCE.Lower(serviceName), FfiConverterStringINSTANCE.Lower(methodName), FfiConverterBytesINSTANCE.Lower(request), FfiConverterOptionalDurationINSTANCE.Lower(timeoutFromContext(ctx)), FfiConverterOptionalMapStringStringINSTANCE.Lower(metadata)),
+		pollU64,
+		cancelU64,
+		freeU64,
+	)
+	return track(object, "*MulticastResponseReader", (*MulticastResponseReader).Destroy), err
+}
+
+// NextContext is Next until ctx is done.
+func (_self *ResponseStreamReader) NextContext(ctx context.Context) (StreamMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*ResponseStreamReader", "NextContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	return uniffiRustCallAsyncContext[error](
+		ctx,
+		nil,
+		completeRustBuffer,
+		FfiConverterStreamMessageINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_responsestreamreader_next_async(
+			_pointer),
+		pollRustBuffer,
+		cancelRustBuffer,
+		freeRustBuffer,
+	)
+}
+
+// NextContext is Next until ctx is done.
+func (_self *MulticastResponseReader) NextContext(ctx context.Context) (MulticastStreamMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*MulticastResponseReader", "NextContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	return uniffiRustCallAsyncContext[error](
+		ctx,
+		nil,
+		completeRustBuffer,
+		FfiConverterMulticastStreamMessageINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_multicastresponsereader_next_async(
+			_pointer),
+		pollRustBuffer,
+		cancelRustBuffer,
+		freeRustBuffer,
+	)
+}
+
+// SendContext is Send with cancellation.
+func (_self *BidiStreamHandler) SendContext(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_pointer, err := _self.ffiObject.acquire("*BidiStreamHandler", "SendContext")
+	if err != nil {
+		return err
+	}
+	defer _self.ffiObject.decrementPointer()
+	_, err = uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterRpcErrorINSTANCE,
+		completeVoid,
+		liftVoid,
+		C.uniffi_slim_bindings_fn_method_bidistreamhandler_send_async(
+			_pointer, FfiConverterBytesINSTANCE.Lower(data)),
+		pollVoid,
+		cancelVoid,
+		freeVoid,
+	)
+	return err
+}
+
+// RecvContext is Recv until ctx is done.
+func (_self *BidiStreamHandler) RecvContext(ctx context.Context) (StreamMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*BidiStreamHandler", "RecvContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	return uniffiRustCallAsyncContext[error](
+		ctx,
+		nil,
+		completeRustBuffer,
+		FfiConverterStreamMessageINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_bidistreamhandler_recv_async(
+			_pointer),
+		pollRustBuffer,
+		cancelRustBuffer,
+		freeRustBuffer,
+	)
+}
+
+// SendContext is Send with cancellation.
+func (_self *MulticastBidiStreamHandler) SendContext(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_pointer, err := _self.ffiObject.acquire("*MulticastBidiStreamHandler", "SendContext")
+	if err != nil {
+		return err
+	}
+	defer _self.ffiObject.decrementPointer()
+	_, err = uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterRpcErrorINSTANCE,
+		completeVoid,
+		liftVoid,
+		C.uniffi_slim_bindings_fn_method_multicastbidistreamhandler_send_async(
+			_pointer, FfiConverterBytesINSTANCE.Lower(data)),
+		pollVoid,
+		cancelVoid,
+		freeVoid,
+	)
+	return err
+}
+
+// RecvContext is Recv until ctx is done.
+func (_self *MulticastBidiStreamHandler) RecvContext(ctx context.Context) (MulticastStreamMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*MulticastBidiStreamHandler", "RecvContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	return uniffiRustCallAsyncContext[error](
+		ctx,
+		nil,
+		completeRustBuffer,
+		FfiConverterMulticastStreamMessageINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_multicastbidistreamhandler_recv_async(
+			_pointer),
+		pollRustBuffer,
+		cancelRustBuffer,
+		freeRustBuffer,
+	)
+}
+
+// SendContext is Send with cancellation.
+func (_self *RequestStreamWriter) SendContext(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_pointer, err := _self.ffiObject.acquire("*RequestStreamWriter", "SendContext")
+	if err != nil {
+		return err
+	}
+	defer _self.ffiObject.decrementPointer()
+	_, err = uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterRpcErrorINSTANCE,
+		completeVoid,
+		liftVoid,
+		C.uniffi_slim_bindings_fn_method_requeststreamwriter_send_async(
+			_pointer, FfiConverterBytesINSTANCE.Lower(data)),
+		pollVoid,
+		cancelVoid,
+		freeVoid,
+	)
+	return err
+}
+
+// FinalizeStreamContext is FinalizeStream with cancellation.
+func (_self *RequestStreamWriter) FinalizeStreamContext(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_pointer, err := _self.ffiObject.acquire("*RequestStreamWriter", "FinalizeStreamContext")
+	if err != nil {
+		return nil, err
+	}
+	defer _self.ffiObject.decrementPointer()
+	return uniffiRustCallAsyncContext(
+		ctx,
+		FfiConverterRpcErrorINSTANCE,
+		completeRustBuffer,
+		FfiConverterBytesINSTANCE.Lift,
+		C.uniffi_slim_bindings_fn_method_requeststreamwriter_finalize_stream_async(
+			_pointer),
+		pollRustBuffer,
+		cancelRustBuffer,
+		freeRustBuffer,
+	)
+}
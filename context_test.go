@@ -0,0 +1,161 @@
+package slim_bindings
+
+import (
+	"context"
+	"errors"
+	"runtime/cgo"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestContextVariantsCheckContextFirst(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The zero objects are never passed to the native layer when ctx is
+	// already done.
+	if _, err := (&Service{}).ConnectContext(ctx, ClientConfig{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ConnectContext error = %v, want context.Canceled", err)
+	}
+	if _, err := (&App{}).ListenForSessionContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListenForSessionContext error = %v, want context.Canceled", err)
+	}
+	if err := (&CompletionHandle{}).WaitContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitContext error = %v, want context.Canceled", err)
+	}
+	if err := (&Server{}).ServeContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ServeContext error = %v, want context.Canceled", err)
+	}
+	if _, err := (&Channel{}).CallUnaryContext(ctx, "svc", "method", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("CallUnaryContext error = %v, want context.Canceled", err)
+	}
+	if _, err := (&Channel{}).CallUnaryStreamContext(ctx, "svc", "method", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("CallUnaryStreamContext error = %v, want context.Canceled", err)
+	}
+	if _, err := (&Channel{}).CallMulticastUnaryContext(ctx, "svc", "method", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("CallMulticastUnaryContext error = %v, want context.Canceled", err)
+	}
+	if _, err := (&Channel{}).CallMulticastUnaryStreamContext(ctx, "svc", "method", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("CallMulticastUnaryStreamContext error = %v, want context.Canceled", err)
+	}
+	if err := (&Session{}).InviteAndWaitContext(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("InviteAndWaitContext error = %v, want context.Canceled", err)
+	}
+	if err := (&Session{}).RemoveAndWaitContext(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("RemoveAndWaitContext error = %v, want context.Canceled", err)
+	}
+	if err := (&Service{}).DisconnectContext(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("DisconnectContext error = %v, want context.Canceled", err)
+	}
+	if _, err := (&ResponseStreamReader{}).NextContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ResponseStreamReader.NextContext error = %v, want context.Canceled", err)
+	}
+	if _, err := (&MulticastResponseReader{}).NextContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("MulticastResponseReader.NextContext error = %v, want context.Canceled", err)
+	}
+	if _, err := (&BidiStreamHandler{}).RecvContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("BidiStreamHandler.RecvContext error = %v, want context.Canceled", err)
+	}
+	if err := (&MulticastBidiStreamHandler{}).SendContext(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("MulticastBidiStreamHandler.SendContext error = %v, want context.Canceled", err)
+	}
+	if _, err := (&RequestStreamWriter{}).FinalizeStreamContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("FinalizeStreamContext error = %v, want context.Canceled", err)
+	}
+}
+
+// fakeFuture stands in for a native future: each poll is answered with
+// result on another goroutine, as the native continuation would. Once
+// cancelled, a pending poll is answered ready.
+type fakeFuture struct {
+	result    int8
+	block     bool
+	polled    chan struct{}
+	cancelled chan struct{}
+	completed atomic.Bool
+	freed     atomic.Bool
+}
+
+func newFakeFuture(result int8, block bool) *fakeFuture {
+	return &fakeFuture{result: result, block: block, polled: make(chan struct{}, 1), cancelled: make(chan struct{})}
+}
+
+func (f *fakeFuture) poll(waiter cgo.Handle) {
+	ch := waiter.Value().(chan int8)
+	select {
+	case f.polled <- struct{}{}:
+	default:
+	}
+	go func() {
+		if f.block {
+			<-f.cancelled
+			ch <- uniffiRustFuturePollReady
+			return
+		}
+		ch <- f.result
+	}()
+}
+
+func (f *fakeFuture) run(ctx context.Context) error {
+	return runFuture(ctx, f.poll, func() { close(f.cancelled) }, func() { f.completed.Store(true) }, func() { f.freed.Store(true) })
+}
+
+func TestRunFutureCompletes(t *testing.T) {
+	f := newFakeFuture(uniffiRustFuturePollReady, false)
+	if err := f.run(context.Background()); err != nil {
+		t.Fatalf("runFuture: %v", err)
+	}
+	if !f.completed.Load() || !f.freed.Load() {
+		t.Errorf("completed = %v, freed = %v, want both", f.completed.Load(), f.freed.Load())
+	}
+}
+
+func TestRunFutureCancelMidCall(t *testing.T) {
+	f := newFakeFuture(0, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- f.run(ctx) }()
+
+	// Cancel only once the future is pending.
+	<-f.polled
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("runFuture error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runFuture did not return after cancel")
+	}
+	select {
+	case <-f.cancelled:
+	default:
+		t.Error("the future was not cancelled")
+	}
+	if f.completed.Load() {
+		t.Error("a cancelled future was completed")
+	}
+	if !f.freed.Load() {
+		t.Error("the future was not freed")
+	}
+}
+
+func TestTimeoutFromContext(t *testing.T) {
+	if timeout := timeoutFromContext(context.Background()); timeout != nil {
+		t.Errorf("timeout without deadline = %v, want nil", *timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	timeout := timeoutFromContext(ctx)
+	if timeout == nil || *timeout <= 0 || *timeout > time.Minute {
+		t.Errorf("timeout = %v, want within (0, 1m]", timeout)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if timeout := timeoutFromContext(expired); timeout == nil || *timeout != 0 {
+		t.Errorf("timeout past deadline = %v, want 0", timeout)
+	}
+}
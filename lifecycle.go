@@ -0,0 +1,241 @@
+package slim_bindings
+
+// #include <slim_bindings.h>
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClosed matches every *ClosedError.
+var ErrClosed = errors.New("handle is closed")
+
+// ClosedError is returned when a handle is closed twice, and by the
+// ...Context methods for use after close. Package slim returns it for use
+// after close too; the other generated methods panic instead.
+type ClosedError struct {
+	// Kind is the type of the handle, such as "*App".
+	Kind string
+	// Op is the operation that was attempted.
+	Op string
+}
+
+func (e *ClosedError) Error() string {
+	return e.Op + " on closed " + e.Kind
+}
+
+func (e *ClosedError) Is(target error) bool {
+	return target == ErrClosed
+}
+
+// enter is the checked half of incrementPointer: it counts a call in
+// progress, or returns a *ClosedError for op once the object is closed or
+// destroyed. A successful enter must be paired with decrementPointer.
+func (ffiObject *FfiObject) enter(kind, op string) error {
+	for {
+		counter := ffiObject.callCounter.Load()
+		if counter <= -1 || ffiObject.destroyed.Load() {
+			return &ClosedError{Kind: kind, Op: op}
+		}
+		if counter == math.MaxInt64 {
+			panic(fmt.Errorf("%v object call counter would overflow", kind))
+		}
+		if ffiObject.callCounter.CompareAndSwap(counter, counter+1) {
+			return nil
+		}
+	}
+}
+
+// acquire is incrementPointer for the hand-written methods: it returns a
+// *ClosedError for op instead of panicking once the object is closed or
+// destroyed. A successful acquire must be paired with decrementPointer.
+func (ffiObject *FfiObject) acquire(kind, op string) (C.uint64_t, error) {
+	if err := ffiObject.enter(kind, op); err != nil {
+		return 0, err
+	}
+	return rustCall(func(status *C.RustCallStatus) C.uint64_t {
+		return ffiObject.cloneFunction(ffiObject.handle, status)
+	}), nil
+}
+
+// Leak describes an object that was garbage collected without being closed.
+type Leak struct {
+	// Kind is the type of the object, such as "*Session".
+	Kind string
+	// Stack is where the object was created. It is empty unless leak
+	// detection was enabled when the object was created.
+	Stack string
+}
+
+var (
+	leakDetection atomic.Bool
+	leakMu        sync.Mutex
+	leakReport    func(Leak)
+)
+
+// EnableLeakDetection records the creation stack of the objects returned by
+// the ...Context methods and calls report for each one that is garbage
+// collected without being closed or destroyed. A nil report prints to
+// standard error. Objects returned by the other generated methods are not
+// tracked. Leak detection is meant for debugging: capturing stacks is slow.
+//
+// Setting SLIM_DEBUG_HANDLES=1 in the environment enables it at startup.
+func EnableLeakDetection(report func(Leak)) {
+	leakMu.Lock()
+	leakReport = report
+	leakMu.Unlock()
+	leakDetection.Store(true)
+}
+
+// DisableLeakDetection stops recording stacks. Objects created while it was
+// enabled are still reported.
+func DisableLeakDetection() {
+	leakDetection.Store(false)
+}
+
+func init() {
+	if os.Getenv("SLIM_DEBUG_HANDLES") == "1" {
+		EnableLeakDetection(nil)
+	}
+}
+
+// track records where object was created, if leak detection is enabled, and
+// replaces its finalizer with one that reports the leak before destroying
+// it. Close and Destroy clear the finalizer.
+func track[T any](object *T, kind string, destroy func(*T)) *T {
+	if object == nil || !leakDetection.Load() {
+		return object
+	}
+	stack := string(debug.Stack())
+	runtime.SetFinalizer(object, func(object *T) {
+		reportLeak(Leak{Kind: kind, Stack: stack})
+		destroy(object)
+	})
+	return object
+}
+
+func reportLeak(leak Leak) {
+	leakMu.Lock()
+	report := leakReport
+	leakMu.Unlock()
+	if report != nil {
+		report(leak)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "slim_bindings: %s was not closed; created at:\n%s\n", leak.Kind, leak.Stack)
+}
+
+// closeFfiObject releases the native handle behind object. Unlike Destroy,
+// closing twice reports a *ClosedError. Calls in progress keep the handle
+// alive until they return; calls started afterwards fail with a
+// *ClosedError in the ...Context methods and panic in the others, as after
+// Destroy.
+func closeFfiObject(object any, ffiObject *FfiObject, kind string) error {
+	if !ffiObject.destroyed.CompareAndSwap(false, true) {
+		return &ClosedError{Kind: kind, Op: "Close"}
+	}
+	runtime.SetFinalizer(object, nil)
+	if ffiObject.callCounter.Add(-1) == -1 {
+		ffiObject.freeRustArcPtr()
+	}
+	return nil
+}
+
+// The Close methods below make the generated objects io.Closers and a
+// double close an error rather than a no-op. They only release the Go
+// handle: the App keeps its sessions, a Server keeps serving until Shutdown,
+// and a Service keeps its connections. Channel and ResponseSink already have
+// a Close method with protocol semantics and are released with Destroy.
+
+// Close releases the App handle.
+func (object *App) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*App")
+}
+
+// Close releases the Session handle. It does not end the session; use
+// App.DeleteSessionAndWait for that.
+func (object *Session) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*Session")
+}
+
+// Close releases the Server handle.
+func (object *Server) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*Server")
+}
+
+// Close releases the Name handle.
+func (object *Name) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*Name")
+}
+
+// Close releases the CompletionHandle handle.
+func (object *CompletionHandle) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*CompletionHandle")
+}
+
+// Close releases the BidiStreamHandler handle.
+func (object *BidiStreamHandler) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*BidiStreamHandler")
+}
+
+// Close releases the RequestStream handle.
+func (object *RequestStream) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*RequestStream")
+}
+
+// Close releases the RequestStreamWriter handle.
+func (object *RequestStreamWriter) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*RequestStreamWriter")
+}
+
+// Close releases the ResponseStreamReader handle.
+func (object *ResponseStreamReader) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*ResponseStreamReader")
+}
+
+// Close releases the MulticastBidiStreamHandler handle.
+func (object *MulticastBidiStreamHandler) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*MulticastBidiStreamHandler")
+}
+
+// Close releases the MulticastResponseReader handle.
+func (object *MulticastResponseReader) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*MulticastResponseReader")
+}
+
+// Close releases the Service handle.
+func (object *Service) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*Service")
+}
+
+// Close releases the Context handle.
+func (object *Context) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*Context")
+}
+
+// Close releases the StreamStreamHandlerImpl handle.
+func (object *StreamStreamHandlerImpl) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*StreamStreamHandlerImpl")
+}
+
+// Close releases the StreamUnaryHandlerImpl handle.
+func (object *StreamUnaryHandlerImpl) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*StreamUnaryHandlerImpl")
+}
+
+// Close releases the UnaryStreamHandlerImpl handle.
+func (object *UnaryStreamHandlerImpl) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*UnaryStreamHandlerImpl")
+}
+
+// Close releases the UnaryUnaryHandlerImpl handle.
+func (object *UnaryUnaryHandlerImpl) Close() error {
+	return closeFfiObject(object, &object.ffiObject, "*UnaryUnaryHandlerImpl")
+}
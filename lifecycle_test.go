@@ -0,0 +1,87 @@
+package slim_bindings
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCloseTwiceReturnsClosedError(t *testing.T) {
+	// A zero handle is never passed to the native layer.
+	name := &Name{}
+	if err := name.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	err := name.Close()
+	var closed *ClosedError
+	if !errors.As(err, &closed) || !errors.Is(err, ErrClosed) {
+		t.Fatalf("second Close error = %v, want *ClosedError", err)
+	}
+	if closed.Kind != "*Name" {
+		t.Errorf("Kind = %q, want *Name", closed.Kind)
+	}
+}
+
+func TestUseAfterCloseReturnsClosedError(t *testing.T) {
+	session := &Session{}
+	if err := session.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	_, err := session.GetMessageContext(context.Background())
+	var closed *ClosedError
+	if !errors.As(err, &closed) {
+		t.Fatalf("GetMessageContext after Close error = %v, want *ClosedError", err)
+	}
+	if closed.Kind != "*Session" || closed.Op != "GetMessageContext" {
+		t.Errorf("error = %v, want GetMessageContext on closed *Session", err)
+	}
+
+	service := &Service{}
+	service.Destroy()
+	if _, err := service.ConnectContext(context.Background(), ClientConfig{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("ConnectContext after Destroy error = %v, want ErrClosed", err)
+	}
+}
+
+func TestLeakDetection(t *testing.T) {
+	leaks := make(chan Leak, 1)
+	EnableLeakDetection(func(l Leak) { leaks <- l })
+	defer func() {
+		DisableLeakDetection()
+		leakMu.Lock()
+		leakReport = nil
+		leakMu.Unlock()
+	}()
+
+	closed := track(&Name{}, "*Name", (*Name).Destroy)
+	func() {
+		track(&Context{}, "*Context", (*Context).Destroy)
+	}()
+	if err := closed.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case leak := <-leaks:
+			if leak.Kind != "*Context" {
+				t.Fatalf("leak reported for %s", leak.Kind)
+			}
+			if !strings.Contains(leak.Stack, "TestLeakDetection") {
+				t.Errorf("leak stack does not show the creator:\n%s", leak.Stack)
+			}
+			runtime.KeepAlive(closed)
+			return
+		case <-deadline:
+			t.Fatal("leaked object was not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package slim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// ErrNoName is returned by Dial when no local name was given with WithName.
+var ErrNoName = errors.New("slim: Dial requires WithName")
+
+// DialOption configures Dial.
+type DialOption func(*dialOptions)
+
+type dialOptions struct {
+	name      Name
+	service   *slim_bindings.Service
+	secure    bool
+	configure []func(*slim_bindings.ClientConfig)
+	provider  slim_bindings.IdentityProviderConfig
+	verifier  slim_bindings.IdentityVerifierConfig
+	secret    string
+}
+
+// WithName sets the name the application is reachable at. It is required.
+func WithName(name Name) DialOption {
+	return func(o *dialOptions) {
+		o.name = name
+	}
+}
+
+// WithSharedSecret authenticates the application with a shared secret.
+func WithSharedSecret(secret string) DialOption {
+	return func(o *dialOptions) {
+		o.secret = secret
+	}
+}
+
+// WithIdentity authenticates the application with explicit identity
+// provider and verifier configurations, for JWT or SPIRE based identities.
+func WithIdentity(provider slim_bindings.IdentityProviderConfig, verifier slim_bindings.IdentityVerifierConfig) DialOption {
+	return func(o *dialOptions) {
+		o.provider = provider
+		o.verifier = verifier
+	}
+}
+
+// WithTLS connects with TLS using the native defaults. Use WithClientConfig
+// to customise certificates.
+func WithTLS() DialOption {
+	return func(o *dialOptions) {
+		o.secure = true
+	}
+}
+
+// WithClientConfig adjusts the client configuration before connecting.
+func WithClientConfig(configure func(*slim_bindings.ClientConfig)) DialOption {
+	return func(o *dialOptions) {
+		o.configure = append(o.configure, configure)
+	}
+}
+
+// WithService uses service instead of the global service.
+func WithService(service *slim_bindings.Service) DialOption {
+	return func(o *dialOptions) {
+		o.service = service
+	}
+}
+
+// App is an application connected to a SLIM node.
+type App struct {
+	app     *slim_bindings.App
+	service *slim_bindings.Service
+	connId  uint64
+	name    Name
+	handle  *handle
+}
+
+// Dial connects to the SLIM node at endpoint and registers an application
+// under the name given with WithName. The bindings are initialised with
+// their defaults if that has not happened yet.
+func Dial(ctx context.Context, endpoint string, opts ...DialOption) (*App, error) {
+	var o dialOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.name.IsZero() {
+		return nil, ErrNoName
+	}
+
+	service := o.service
+	if service == nil {
+		if !slim_bindings.IsInitialized() {
+			slim_bindings.InitializeWithDefaults()
+		}
+		service = slim_bindings.GetGlobalService()
+	}
+
+	config := slim_bindings.NewInsecureClientConfig(endpoint)
+	if o.secure {
+		config = slim_bindings.NewSecureClientConfig(endpoint)
+	}
+	for _, configure := range o.configure {
+		configure(&config)
+	}
+
+	connId, err := service.ConnectContext(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("slim: connect to %s: %w", endpoint, err)
+	}
+
+	// Creating and subscribing run as one call, so that an app abandoned
+	// when ctx is done is destroyed only once nothing uses it.
+	app, err := call(ctx, func() (*slim_bindings.App, error) {
+		name := o.name.native()
+		defer name.Destroy()
+
+		var app *slim_bindings.App
+		var err error
+		if o.provider != nil || o.verifier != nil {
+			app, err = service.CreateApp(name, o.provider, o.verifier)
+		} else {
+			app, err = service.CreateAppWithSecret(name, o.secret)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("slim: create app %s: %w", o.name, err)
+		}
+		if err := app.Subscribe(name, &connId); err != nil {
+			app.Destroy()
+			return nil, fmt.Errorf("slim: subscribe %s: %w", o.name, err)
+		}
+		return app, nil
+	}, (*slim_bindings.App).Destroy)
+	if err != nil {
+		_ = service.Disconnect(connId)
+		return nil, err
+	}
+
+	return newApp(app, service, connId), nil
+}
+
+func newApp(app *slim_bindings.App, service *slim_bindings.Service, connId uint64) *App {
+	a := &App{app: app, service: service, connId: connId, name: nameFromNative(app.Name())}
+	a.handle = newHandle(a, "*slim.App", func() error {
+		return service.Disconnect(connId)
+	}, app.Destroy)
+	return a
+}
+
+// Name returns the application's name, including the instance ID assigned
+// by the native layer.
+func (a *App) Name() Name {
+	return a.name
+}
+
+// ConnectionId returns the ID of the connection opened by Dial.
+func (a *App) ConnectionId() uint64 {
+	return a.connId
+}
+
+// Native returns the generated binding App, for features not covered here.
+func (a *App) Native() *slim_bindings.App {
+	return a.app
+}
+
+// Open establishes a session with dest. By default it is a point-to-point
+// session; pass WithGroup for a group session that dest names.
+func (a *App) Open(ctx context.Context, dest Name, opts ...SessionOption) (*Session, error) {
+	if err := a.handle.acquire("Open"); err != nil {
+		return nil, err
+	}
+	defer a.handle.release()
+	o := newSessionOptions(opts)
+
+	if err := callHeld(ctx, a.handle, "Open", func() error {
+		native := dest.native()
+		defer native.Destroy()
+		return a.app.SetRoute(native, a.connId)
+	}); err != nil {
+		return nil, fmt.Errorf("slim: route to %s: %w", dest, err)
+	}
+	native := dest.native()
+	defer native.Destroy()
+	session, err := a.app.CreateSessionAndWaitContext(ctx, o.config(), native)
+	if err != nil {
+		return nil, fmt.Errorf("slim: open session to %s: %w", dest, err)
+	}
+	return newSession(a, session, o), nil
+}
+
+// Accept waits for a peer to open a session with this application.
+func (a *App) Accept(ctx context.Context, opts ...SessionOption) (*Session, error) {
+	if err := a.handle.acquire("Accept"); err != nil {
+		return nil, err
+	}
+	defer a.handle.release()
+	o := newSessionOptions(opts)
+	session, err := a.app.ListenForSessionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newSession(a, session, o), nil
+}
+
+// Close disconnects from the node and releases the application. Closing
+// twice, or using the App afterwards, returns a *ClosedError. Sessions
+// opened by the App should be closed first.
+func (a *App) Close() error {
+	return a.handle.close()
+}
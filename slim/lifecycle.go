@@ -0,0 +1,199 @@
+package slim
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// ErrClosed matches every *ClosedError, from this package or from the
+// generated bindings.
+var ErrClosed = slim_bindings.ErrClosed
+
+// ClosedError is returned when an App or Session is closed twice or used
+// after it was closed.
+type ClosedError = slim_bindings.ClosedError
+
+var (
+	_ io.Closer = (*App)(nil)
+	_ io.Closer = (*Session)(nil)
+)
+
+// Leak describes a handle that was garbage collected without being closed.
+// Kind is the type of the handle, such as "*slim.Session".
+type Leak = slim_bindings.Leak
+
+var (
+	leakDetection atomic.Bool
+	leakMu        sync.Mutex
+	leakReport    func(Leak)
+	// live holds every open handle while leak detection is enabled.
+	live = make(map[*handle]struct{})
+)
+
+// EnableLeakDetection records the creation stack of every App and Session
+// and calls report for each one that is garbage collected without being
+// closed. It also enables slim_bindings.EnableLeakDetection with the same
+// report. A nil report prints to standard error. Leak detection is meant
+// for debugging: capturing stacks is slow.
+//
+// Setting SLIM_DEBUG_HANDLES=1 in the environment enables it at startup.
+func EnableLeakDetection(report func(Leak)) {
+	leakMu.Lock()
+	leakReport = report
+	leakMu.Unlock()
+	leakDetection.Store(true)
+	slim_bindings.EnableLeakDetection(report)
+}
+
+// DisableLeakDetection stops recording stacks, here and in the generated
+// bindings. Handles created while it was enabled are still reported.
+func DisableLeakDetection() {
+	leakDetection.Store(false)
+	slim_bindings.DisableLeakDetection()
+}
+
+// OpenHandles returns the handles created while leak detection was enabled
+// that are not closed yet, oldest first.
+func OpenHandles() []Leak {
+	leakMu.Lock()
+	defer leakMu.Unlock()
+	handles := make([]*handle, 0, len(live))
+	for h := range live {
+		handles = append(handles, h)
+	}
+	sort.Slice(handles, func(i, j int) bool { return handles[i].serial < handles[j].serial })
+
+	leaks := make([]Leak, len(handles))
+	for i, h := range handles {
+		leaks[i] = Leak{Kind: h.kind, Stack: h.stack}
+	}
+	return leaks
+}
+
+func init() {
+	if os.Getenv("SLIM_DEBUG_HANDLES") == "1" {
+		EnableLeakDetection(nil)
+	}
+}
+
+func reportLeak(leak Leak) {
+	leakMu.Lock()
+	report := leakReport
+	leakMu.Unlock()
+	if report != nil {
+		report(leak)
+		return
+	}
+	if leak.Stack == "" {
+		fmt.Fprintf(os.Stderr, "slim: %s was not closed\n", leak.Kind)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "slim: %s was not closed; created at:\n%s\n", leak.Kind, leak.Stack)
+}
+
+var handleSerial atomic.Uint64
+
+// handle tracks the lifecycle of a native-backed object.
+//
+// Methods acquire the handle for the duration of a native call. Close runs
+// shutdown right away, so that blocked calls can return, but defers free
+// until the last call in progress has released the handle. A handle must not
+// reference the object that owns it, or the owner's finalizer never runs.
+type handle struct {
+	kind     string
+	shutdown func() error
+	free     func()
+	stack    string
+	serial   uint64
+
+	mu       sync.Mutex
+	refs     int
+	closed   bool
+	released bool
+}
+
+// newHandle returns a handle for owner and installs a finalizer that closes
+// it, and reports a leak, if owner is collected while still open.
+func newHandle[T any](owner *T, kind string, shutdown func() error, free func()) *handle {
+	h := &handle{kind: kind, shutdown: shutdown, free: free, serial: handleSerial.Add(1)}
+	if leakDetection.Load() {
+		h.stack = string(debug.Stack())
+		leakMu.Lock()
+		live[h] = struct{}{}
+		leakMu.Unlock()
+	}
+	runtime.SetFinalizer(owner, func(*T) {
+		h.mu.Lock()
+		closed := h.closed
+		h.mu.Unlock()
+		if closed {
+			return
+		}
+		reportLeak(Leak{Kind: h.kind, Stack: h.stack})
+		// Shutting down may block on the network; keep it off the
+		// finalizer goroutine.
+		go h.close()
+	})
+	return h
+}
+
+// acquire marks the start of op, failing if the handle is closed.
+func (h *handle) acquire(op string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return &ClosedError{Kind: h.kind, Op: op}
+	}
+	h.refs++
+	return nil
+}
+
+// release marks the end of an operation started with acquire.
+func (h *handle) release() {
+	h.mu.Lock()
+	h.refs--
+	free := h.closed && h.refs == 0 && !h.released
+	if free {
+		h.released = true
+	}
+	h.mu.Unlock()
+	if free && h.free != nil {
+		h.free()
+	}
+}
+
+// close shuts the handle down. Closing twice returns a *ClosedError.
+func (h *handle) close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return &ClosedError{Kind: h.kind, Op: "Close"}
+	}
+	h.closed = true
+	h.mu.Unlock()
+
+	leakMu.Lock()
+	delete(live, h)
+	leakMu.Unlock()
+
+	var err error
+	if h.shutdown != nil {
+		err = h.shutdown()
+	}
+
+	// Hold a reference across the check so that free runs exactly once,
+	// here or in the last release.
+	h.mu.Lock()
+	h.refs++
+	h.mu.Unlock()
+	h.release()
+	return err
+}
@@ -0,0 +1,93 @@
+package slim
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+type owner struct{ _ [16]byte }
+
+func TestHandleCloseTwice(t *testing.T) {
+	shutdowns := 0
+	h := newHandle(&owner{}, "*slim.Test", func() error { shutdowns++; return nil }, nil)
+
+	if err := h.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	err := h.close()
+	var closed *ClosedError
+	if !errors.As(err, &closed) || !errors.Is(err, ErrClosed) {
+		t.Fatalf("second close error = %v, want *ClosedError", err)
+	}
+	if closed.Kind != "*slim.Test" || closed.Op != "Close" {
+		t.Errorf("ClosedError = %+v", closed)
+	}
+	if shutdowns != 1 {
+		t.Errorf("shutdown ran %d times, want 1", shutdowns)
+	}
+	if err := h.acquire("Publish"); !errors.Is(err, ErrClosed) {
+		t.Errorf("acquire after close error = %v, want ErrClosed", err)
+	}
+}
+
+func TestHandleDefersFreeUntilReleased(t *testing.T) {
+	freed := false
+	h := newHandle(&owner{}, "*slim.Test", nil, func() { freed = true })
+
+	if err := h.acquire("Receive"); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if err := h.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if freed {
+		t.Fatal("handle freed while a call was in progress")
+	}
+	h.release()
+	if !freed {
+		t.Fatal("handle not freed after the last call returned")
+	}
+}
+
+func TestLeakDetection(t *testing.T) {
+	leaks := make(chan Leak, 1)
+	EnableLeakDetection(func(l Leak) { leaks <- l })
+	defer func() {
+		DisableLeakDetection()
+		leakMu.Lock()
+		leakReport = nil
+		leakMu.Unlock()
+	}()
+
+	closedOwner := &owner{}
+	closed := newHandle(closedOwner, "*slim.Closed", nil, nil)
+	func() {
+		newHandle(&owner{}, "*slim.Leaked", nil, nil)
+	}()
+	if got := len(OpenHandles()); got != 2 {
+		t.Fatalf("OpenHandles returned %d handles, want 2", got)
+	}
+	closed.close()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case leak := <-leaks:
+			if leak.Kind != "*slim.Leaked" {
+				t.Fatalf("leak reported for %s", leak.Kind)
+			}
+			if !strings.Contains(leak.Stack, "TestLeakDetection") {
+				t.Errorf("leak stack does not show the creator:\n%s", leak.Stack)
+			}
+			runtime.KeepAlive(closedOwner)
+			return
+		case <-deadline:
+			t.Fatal("leaked handle was not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package slim
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// noId is the ID the native layer reports for names created without one.
+const noId = math.MaxUint64
+
+// Name identifies an application on the SLIM network as
+// "org/namespace/agent", optionally narrowed to a single instance by ID.
+//
+// Name is a plain value: it can be compared with ==, used as a map key and
+// copied freely.
+type Name struct {
+	Org       string
+	Namespace string
+	Agent     string
+	// Id selects a specific instance. Zero means any instance.
+	Id uint64
+}
+
+// NewName returns the name org/namespace/agent.
+func NewName(org, namespace, agent string) Name {
+	return Name{Org: org, Namespace: namespace, Agent: agent}
+}
+
+// WithId returns a copy of n narrowed to the instance id.
+func (n Name) WithId(id uint64) Name {
+	n.Id = id
+	return n
+}
+
+// ParseName parses "org/namespace/agent" or "org/namespace/agent/id".
+func ParseName(s string) (Name, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 && len(parts) != 4 {
+		return Name{}, fmt.Errorf("slim: invalid name %q: want org/namespace/agent[/id]", s)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return Name{}, fmt.Errorf("slim: invalid name %q: empty component", s)
+		}
+	}
+
+	n := Name{Org: parts[0], Namespace: parts[1], Agent: parts[2]}
+	if len(parts) == 4 {
+		id, err := strconv.ParseUint(parts[3], 10, 64)
+		if err != nil {
+			return Name{}, fmt.Errorf("slim: invalid name %q: bad id: %w", s, err)
+		}
+		n.Id = id
+	}
+	return n, nil
+}
+
+// MustParseName is like ParseName but panics on error. It is meant for
+// names known at compile time.
+func MustParseName(s string) Name {
+	n, err := ParseName(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// String formats n so that ParseName returns it unchanged.
+func (n Name) String() string {
+	s := n.Org + "/" + n.Namespace + "/" + n.Agent
+	if n.Id != 0 {
+		s += "/" + strconv.FormatUint(n.Id, 10)
+	}
+	return s
+}
+
+// IsZero reports whether n is the zero Name.
+func (n Name) IsZero() bool {
+	return n == Name{}
+}
+
+// native returns the generated binding type for n.
+func (n Name) native() *slim_bindings.Name {
+	if n.Id == 0 {
+		return slim_bindings.NewName(n.Org, n.Namespace, n.Agent)
+	}
+	return slim_bindings.NameNewWithId(n.Org, n.Namespace, n.Agent, n.Id)
+}
+
+// nameFromNative converts a generated binding name. A nil name converts to
+// the zero Name.
+func nameFromNative(n *slim_bindings.Name) Name {
+	if n == nil {
+		return Name{}
+	}
+	var name Name
+	components := n.Components()
+	if len(components) == 3 {
+		name = Name{Org: components[0], Namespace: components[1], Agent: components[2]}
+	}
+	if id := n.Id(); id != noId {
+		name.Id = id
+	}
+	return name
+}
+
+func namesFromNative(names []*slim_bindings.Name) []Name {
+	out := make([]Name, len(names))
+	for i, n := range names {
+		out[i] = nameFromNative(n)
+	}
+	return out
+}
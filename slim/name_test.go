@@ -0,0 +1,43 @@
+package slim
+
+import "testing"
+
+func TestParseName(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Name
+	}{
+		{"acme/default/alice", Name{Org: "acme", Namespace: "default", Agent: "alice"}},
+		{"acme/default/alice/42", Name{Org: "acme", Namespace: "default", Agent: "alice", Id: 42}},
+	} {
+		got, err := ParseName(tc.in)
+		if err != nil {
+			t.Fatalf("ParseName(%q): %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Errorf("ParseName(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+		if got.String() != tc.in {
+			t.Errorf("String() = %q, want %q", got.String(), tc.in)
+		}
+	}
+}
+
+func TestParseNameRejectsMalformed(t *testing.T) {
+	for _, in := range []string{"", "acme/alice", "acme//alice", "a/b/c/d/e", "a/b/c/x"} {
+		if _, err := ParseName(in); err == nil {
+			t.Errorf("ParseName(%q) succeeded", in)
+		}
+	}
+}
+
+func TestNameIsComparable(t *testing.T) {
+	alice := NewName("acme", "default", "alice")
+	seen := map[Name]bool{alice: true}
+	if !seen[MustParseName("acme/default/alice")] {
+		t.Error("equal names are different map keys")
+	}
+	if seen[alice.WithId(1)] {
+		t.Error("WithId did not produce a distinct name")
+	}
+}
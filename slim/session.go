@@ -0,0 +1,322 @@
+package slim
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+	"github.com/agntcy/slim-bindings-go/slimsession"
+)
+
+// SessionOption configures App.Open and App.Accept.
+type SessionOption func(*sessionOptions)
+
+type sessionOptions struct {
+	group    bool
+	mls      bool
+	retries  *uint32
+	interval *time.Duration
+	metadata map[string]string
+	wrap     []slimsession.Option
+}
+
+func newSessionOptions(opts []SessionOption) sessionOptions {
+	var o sessionOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o sessionOptions) config() slim_bindings.SessionConfig {
+	config := slim_bindings.SessionConfig{
+		SessionType: slim_bindings.SessionTypePointToPoint,
+		EnableMls:   o.mls,
+		MaxRetries:  o.retries,
+		Interval:    o.interval,
+		Metadata:    o.metadata,
+	}
+	if o.group {
+		config.SessionType = slim_bindings.SessionTypeGroup
+	}
+	if config.Metadata == nil {
+		config.Metadata = map[string]string{}
+	}
+	return config
+}
+
+// WithGroup opens a group session instead of a point-to-point one.
+func WithGroup() SessionOption {
+	return func(o *sessionOptions) {
+		o.group = true
+	}
+}
+
+// WithMLS encrypts the session end to end with MLS.
+func WithMLS() SessionOption {
+	return func(o *sessionOptions) {
+		o.mls = true
+	}
+}
+
+// WithRetries sets how many times a message is retransmitted before the
+// native layer reports it as lost.
+func WithRetries(n int) SessionOption {
+	return func(o *sessionOptions) {
+		retries := uint32(max(n, 0))
+		o.retries = &retries
+	}
+}
+
+// WithRetryInterval sets the delay between retransmissions.
+func WithRetryInterval(d time.Duration) SessionOption {
+	return func(o *sessionOptions) {
+		o.interval = &d
+	}
+}
+
+// WithSessionMetadata attaches metadata to the session itself, visible to
+// the peer when it accepts.
+func WithSessionMetadata(metadata map[string]string) SessionOption {
+	return func(o *sessionOptions) {
+		o.metadata = maps.Clone(metadata)
+	}
+}
+
+// WithSessionOptions enables slimsession delivery features, such as
+// chunking limits or ordered delivery, on the session.
+func WithSessionOptions(opts ...slimsession.Option) SessionOption {
+	return func(o *sessionOptions) {
+		o.wrap = append(o.wrap, opts...)
+	}
+}
+
+// MessageOption configures a published message.
+type MessageOption func(*messageOptions)
+
+type messageOptions struct {
+	payloadType *string
+	metadata    map[string]string
+}
+
+func newMessageOptions(opts []MessageOption) messageOptions {
+	var o messageOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// metadataPtr adapts the metadata to the generated API.
+func (o messageOptions) metadataPtr() *map[string]string {
+	if o.metadata == nil {
+		return nil
+	}
+	return &o.metadata
+}
+
+// WithPayloadType sets the payload type of a message.
+func WithPayloadType(payloadType string) MessageOption {
+	return func(o *messageOptions) {
+		o.payloadType = &payloadType
+	}
+}
+
+// WithMetadata attaches key/value pairs to a message.
+func WithMetadata(metadata map[string]string) MessageOption {
+	return func(o *messageOptions) {
+		o.metadata = maps.Clone(metadata)
+	}
+}
+
+// Message is a received message.
+type Message struct {
+	Payload     []byte
+	PayloadType string
+	Metadata    map[string]string
+	// Source is the sender of the message.
+	Source Name
+	// Destination is the name the message was addressed to, or the zero
+	// Name when there is none.
+	Destination Name
+	// Identity is the sender identity carried by the message.
+	Identity string
+
+	context slim_bindings.MessageContext
+}
+
+func messageFromNative(msg slim_bindings.ReceivedMessage) Message {
+	m := Message{
+		Payload:     msg.Payload,
+		PayloadType: msg.Context.PayloadType,
+		Metadata:    msg.Context.Metadata,
+		Source:      nameFromNative(msg.Context.SourceName),
+		Identity:    msg.Context.Identity,
+		context:     msg.Context,
+	}
+	if msg.Context.DestinationName != nil {
+		m.Destination = nameFromNative(*msg.Context.DestinationName)
+	}
+	return m
+}
+
+// Session is an established session.
+type Session struct {
+	app     *App
+	native  *slim_bindings.Session
+	session *slimsession.Session
+	handle  *handle
+}
+
+func newSession(app *App, native *slim_bindings.Session, o sessionOptions) *Session {
+	s := &Session{
+		app:     app,
+		native:  native,
+		session: slimsession.Wrap(native, o.wrap...),
+	}
+	nativeApp := app.app
+	session := s.session
+	s.handle = newHandle(s, "*slim.Session", func() error {
+		// Stop redeliveries, polling and outbox replay before the native
+		// session goes away under them.
+		_ = session.Close()
+		if err := nativeApp.DeleteSessionAndWait(native); err != nil {
+			return fmt.Errorf("slim: close session: %w", err)
+		}
+		return nil
+	}, native.Destroy)
+	return s
+}
+
+// use acquires the session handle for op and returns its release function.
+func (s *Session) use(op string) (func(), error) {
+	if err := s.handle.acquire(op); err != nil {
+		return nil, err
+	}
+	return s.handle.release, nil
+}
+
+// Id returns the session ID.
+func (s *Session) Id() (uint32, error) {
+	release, err := s.use("Id")
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return s.native.SessionId()
+}
+
+// Destination returns the peer or group the session was opened with.
+func (s *Session) Destination() (Name, error) {
+	release, err := s.use("Destination")
+	if err != nil {
+		return Name{}, err
+	}
+	defer release()
+	dest, err := s.native.Destination()
+	if err != nil {
+		return Name{}, err
+	}
+	return nameFromNative(dest), nil
+}
+
+// Metadata returns the session metadata.
+func (s *Session) Metadata() (map[string]string, error) {
+	release, err := s.use("Metadata")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return s.native.Metadata()
+}
+
+// Delivery returns the slimsession layer of the session, for streams,
+// acknowledgements and the other delivery features it provides.
+func (s *Session) Delivery() *slimsession.Session {
+	return s.session
+}
+
+// Publish sends payload to the session destination and waits until it is
+// delivered, or until the deadline of ctx. With flow control it also stops
+// waiting for credit when ctx is cancelled.
+func (s *Session) Publish(ctx context.Context, payload []byte, opts ...MessageOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	release, err := s.use("Publish")
+	if err != nil {
+		return err
+	}
+	defer release()
+	o := newMessageOptions(opts)
+	return s.session.PublishAndWaitContext(ctx, payload, o.payloadType, o.metadataPtr())
+}
+
+// Reply sends payload back to the sender of msg and waits until it is
+// delivered.
+func (s *Session) Reply(ctx context.Context, msg Message, payload []byte, opts ...MessageOption) error {
+	o := newMessageOptions(opts)
+	return callHeld(ctx, s.handle, "Reply", func() error {
+		return s.session.PublishToAndWait(msg.context, payload, o.payloadType, o.metadataPtr())
+	})
+}
+
+// Receive returns the next message.
+func (s *Session) Receive(ctx context.Context) (Message, error) {
+	release, err := s.use("Receive")
+	if err != nil {
+		return Message{}, err
+	}
+	defer release()
+	msg, err := s.session.Receive(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	return messageFromNative(msg.ReceivedMessage), nil
+}
+
+// Invite adds participant to a group session.
+func (s *Session) Invite(ctx context.Context, participant Name) error {
+	release, err := s.use("Invite")
+	if err != nil {
+		return err
+	}
+	defer release()
+	name := participant.native()
+	defer name.Destroy()
+	return s.session.InviteAndWaitContext(ctx, name)
+}
+
+// Remove removes participant from a group session.
+func (s *Session) Remove(ctx context.Context, participant Name) error {
+	release, err := s.use("Remove")
+	if err != nil {
+		return err
+	}
+	defer release()
+	name := participant.native()
+	defer name.Destroy()
+	return s.session.RemoveAndWaitContext(ctx, name)
+}
+
+// Participants returns the current members of the session.
+func (s *Session) Participants() ([]Name, error) {
+	release, err := s.use("Participants")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	names, err := s.native.ParticipantsList()
+	if err != nil {
+		return nil, err
+	}
+	return namesFromNative(names), nil
+}
+
+// Close stops the delivery features of the session, then ends it. Closing
+// twice, or using the Session afterwards, returns a *ClosedError.
+func (s *Session) Close() error {
+	return s.handle.close()
+}
@@ -0,0 +1,100 @@
+// Package slim is an idiomatic Go API for SLIM.
+//
+// It is a hand-written layer over the generated slim_bindings package:
+// names and message contexts are plain values, metadata is passed as
+// options instead of *map[string]string, and every blocking call takes a
+// context.Context in place of the generated Foo/FooAsync pairs.
+//
+//	app, err := slim.Dial(ctx, "http://localhost:46357",
+//		slim.WithName(slim.NewName("acme", "default", "alice")),
+//		slim.WithSharedSecret(secret))
+//	if err != nil {
+//		return err
+//	}
+//	defer app.Close()
+//
+//	session, err := app.Open(ctx, slim.NewName("acme", "default", "bob"),
+//		slim.WithMLS(), slim.WithRetries(3))
+//
+// Errors from the native layer are returned unchanged, so the sentinels
+// below (and the generated ones) match with errors.Is.
+package slim
+
+import (
+	"context"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// Sentinels for the error kinds reported by the native layer.
+var (
+	ErrTimeout         = slim_bindings.ErrSlimErrorTimeout
+	ErrSession         = slim_bindings.ErrSlimErrorSessionError
+	ErrSend            = slim_bindings.ErrSlimErrorSendError
+	ErrReceive         = slim_bindings.ErrSlimErrorReceiveError
+	ErrAuth            = slim_bindings.ErrSlimErrorAuthError
+	ErrConfig          = slim_bindings.ErrSlimErrorConfigError
+	ErrInvalidArgument = slim_bindings.ErrSlimErrorInvalidArgument
+)
+
+// call runs a blocking native call and returns early if ctx is done. The
+// call itself cannot be interrupted; if it completes after ctx is done, its
+// result is handed to cleanup, if any, so that nothing leaks.
+func call[T any](ctx context.Context, fn func() (T, error), cleanup func(T)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	return start(ctx, fn, cleanup)
+}
+
+// start is call without the initial check of ctx: fn always runs.
+func start[T any](ctx context.Context, fn func() (T, error), cleanup func(T)) (T, error) {
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := fn()
+		done <- result{v, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil && cleanup != nil {
+				cleanup(r.v)
+			}
+		}()
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// callErr is call for native calls that only return an error.
+func callErr(ctx context.Context, fn func() error) error {
+	_, err := call(ctx, func() (struct{}, error) {
+		return struct{}{}, fn()
+	}, nil)
+	return err
+}
+
+// callHeld is callErr for a native call on the object behind h. h stays
+// acquired for op until the call returns, even if ctx is done first, so
+// that Close cannot destroy the object while the call still uses it.
+func callHeld(ctx context.Context, h *handle, op string, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := h.acquire(op); err != nil {
+		return err
+	}
+	_, err := start(ctx, func() (struct{}, error) {
+		defer h.release()
+		return struct{}{}, fn()
+	}, nil)
+	return err
+}
@@ -0,0 +1,100 @@
+package slim
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+func TestSessionOptionsConfig(t *testing.T) {
+	config := newSessionOptions([]SessionOption{
+		WithGroup(),
+		WithMLS(),
+		WithRetries(3),
+		WithRetryInterval(time.Second),
+		WithSessionMetadata(map[string]string{"k": "v"}),
+	}).config()
+
+	if config.SessionType != slim_bindings.SessionTypeGroup || !config.EnableMls {
+		t.Errorf("SessionType = %v, EnableMls = %v", config.SessionType, config.EnableMls)
+	}
+	if config.MaxRetries == nil || *config.MaxRetries != 3 {
+		t.Errorf("MaxRetries = %v, want 3", config.MaxRetries)
+	}
+	if config.Interval == nil || *config.Interval != time.Second {
+		t.Errorf("Interval = %v, want 1s", config.Interval)
+	}
+	if config.Metadata["k"] != "v" {
+		t.Errorf("Metadata = %v", config.Metadata)
+	}
+
+	defaults := newSessionOptions(nil).config()
+	if defaults.SessionType != slim_bindings.SessionTypePointToPoint || defaults.MaxRetries != nil || defaults.Metadata == nil {
+		t.Errorf("default config = %+v", defaults)
+	}
+}
+
+func TestCallReturnsOnCancel(t *testing.T) {
+	release := make(chan struct{})
+	cleaned := make(chan int, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := call(ctx, func() (int, error) {
+		<-release
+		return 7, nil
+	}, func(v int) { cleaned <- v })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("call error = %v, want DeadlineExceeded", err)
+	}
+
+	// The abandoned result is cleaned up once the call completes.
+	close(release)
+	select {
+	case v := <-cleaned:
+		if v != 7 {
+			t.Errorf("cleanup got %d, want 7", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cleanup was not called")
+	}
+}
+
+func TestCallHeldKeepsHandleUntilReturn(t *testing.T) {
+	freed := make(chan struct{})
+	h := newHandle(&owner{}, "*slim.Test", nil, func() { close(freed) })
+	release := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := callHeld(ctx, h, "Publish", func() error {
+		<-release
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("callHeld error = %v, want DeadlineExceeded", err)
+	}
+
+	// Closing while the abandoned call still runs defers the free.
+	if err := h.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	select {
+	case <-freed:
+		t.Fatal("handle freed while the call was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-freed:
+	case <-time.After(time.Second):
+		t.Fatal("handle not freed once the call returned")
+	}
+
+	if err := callHeld(context.Background(), h, "Publish", func() error { return nil }); !errors.Is(err, ErrClosed) {
+		t.Errorf("callHeld after close error = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,58 @@
+package slimauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// The paths Handler serves. Resolving keys starts from the OpenID discovery
+// document of the issuer and falls back to the JWKS at its well-known path.
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	JWKSPath      = "/.well-known/jwks.json"
+)
+
+// Handler returns an HTTP handler that serves the verifying keys of keys as
+// a JWKS at JWKSPath, and at DiscoveryPath a discovery document pointing to
+// it. A JwtKeyTypeAutoresolve with the URL of the handler as its issuer
+// fetches the keys from there, so tokens minted with the issuer set to that
+// URL verify:
+//
+//	handler, err := slimauth.Handler(key)
+//	server := httptest.NewServer(handler)
+//	token, err := key.Mint(slimauth.Claims{Issuer: server.URL})
+//
+// The issuer in the discovery document is the scheme and host of the
+// request. HS secrets cannot be published, so keys must be asymmetric.
+func Handler(keys ...*Key) (http.Handler, error) {
+	document, err := JWKS(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		switch strings.TrimSuffix(r.URL.Path, "/") {
+		case JWKSPath:
+			w.Header().Set("Content-Type", "application/jwk-set+json")
+			_, _ = w.Write(document)
+		case DiscoveryPath:
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			issuer := scheme + "://" + r.Host
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"issuer":   issuer,
+				"jwks_uri": issuer + JWKSPath,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}), nil
+}
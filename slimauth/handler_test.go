@@ -0,0 +1,74 @@
+package slimauth
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+func get(t *testing.T, url string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestHandler(t *testing.T) {
+	es, ed := keys[slim_bindings.JwtAlgorithmEs384], keys[slim_bindings.JwtAlgorithmEdDsa]
+	handler, err := Handler(es, ed)
+	if err != nil {
+		t.Fatalf("Handler: %v", err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// The keys are found from the issuer, as autoresolve does.
+	resp, body := get(t, server.URL+DiscoveryPath)
+	var discovery map[string]string
+	if err := json.Unmarshal(body, &discovery); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("discovery = %d %s, %v", resp.StatusCode, body, err)
+	}
+	if discovery["issuer"] != server.URL || discovery["jwks_uri"] != server.URL+JWKSPath {
+		t.Errorf("discovery = %v", discovery)
+	}
+	resp, set := get(t, discovery["jwks_uri"])
+	if resp.Header.Get("Content-Type") != "application/jwk-set+json" {
+		t.Errorf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+	for _, key := range []*Key{es, ed} {
+		token, err := key.Mint(Claims{Issuer: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, claims := verify(t, token, set); claims["iss"] != server.URL {
+			t.Errorf("claims = %v", claims)
+		}
+	}
+
+	if resp, _ := get(t, server.URL+"/keys"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown path: %d", resp.StatusCode)
+	}
+	resp, err = http.Post(server.URL+JWKSPath, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: %d", resp.StatusCode)
+	}
+
+	if _, err := Handler(es, keys[slim_bindings.JwtAlgorithmHs256]); err == nil {
+		t.Error("Handler publishing a secret succeeded")
+	}
+}
@@ -0,0 +1,118 @@
+package slimauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// jwks is a JSON Web Key Set (RFC 7517).
+type jwks struct {
+	Keys []map[string]string `json:"keys"`
+}
+
+// JWKS returns the JSON Web Key Set of the verifying keys of keys, the
+// document served by Handler. HS secrets cannot be published, so keys must
+// be asymmetric.
+func JWKS(keys ...*Key) ([]byte, error) {
+	set := jwks{Keys: make([]map[string]string, 0, len(keys))}
+	for _, key := range keys {
+		if _, ok := key.secret(); ok {
+			return nil, fmt.Errorf("slimauth: the %s key %s is a secret and cannot be published", AlgorithmName(key.Algorithm), key.ID)
+		}
+		jwk, err := key.jwk(false)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return marshalJSON(set)
+}
+
+// jwk returns the key as a JWK (RFC 7517), with its private members if
+// private is set.
+func (k *Key) jwk(private bool) (map[string]string, error) {
+	jwk, err := k.publicJWK()
+	if err != nil {
+		return nil, err
+	}
+	jwk["kid"] = k.ID
+	jwk["alg"] = AlgorithmName(k.Algorithm)
+	jwk["use"] = "sig"
+	if !private {
+		return jwk, nil
+	}
+	switch key := k.Private.(type) {
+	case *ecdsa.PrivateKey:
+		jwk["d"] = b64(key.D.FillBytes(make([]byte, (key.Curve.Params().BitSize+7)/8)))
+	case *rsa.PrivateKey:
+		key.Precompute()
+		jwk["d"] = b64(key.D.Bytes())
+		jwk["p"] = b64(key.Primes[0].Bytes())
+		jwk["q"] = b64(key.Primes[1].Bytes())
+		jwk["dp"] = b64(key.Precomputed.Dp.Bytes())
+		jwk["dq"] = b64(key.Precomputed.Dq.Bytes())
+		jwk["qi"] = b64(key.Precomputed.Qinv.Bytes())
+	case ed25519.PrivateKey:
+		jwk["d"] = b64(key.Seed())
+	}
+	return jwk, nil
+}
+
+// publicJWK returns the members of the JWK of the verifying key that its
+// thumbprint covers.
+func (k *Key) publicJWK() (map[string]string, error) {
+	switch key := k.Public().(type) {
+	case []byte:
+		return map[string]string{"kty": "oct", "k": b64(key)}, nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"kty": "EC",
+			"crv": key.Curve.Params().Name,
+			"x":   b64(key.X.FillBytes(make([]byte, size))),
+			"y":   b64(key.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   b64(key.N.Bytes()),
+			"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "crv": "Ed25519", "x": b64(key)}, nil
+	}
+	return nil, fmt.Errorf("slimauth: unsupported key %T", k.Private)
+}
+
+// thumbprint returns the JWK thumbprint of the key (RFC 7638): the SHA-256
+// of its required members, in JSON with sorted keys and no whitespace.
+func (k *Key) thumbprint() (string, error) {
+	jwk, err := k.publicJWK()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(jwk)
+	if err != nil {
+		return "", fmt.Errorf("slimauth: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return b64(sum[:]), nil
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func marshalJSON(v any) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("slimauth: %w", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,272 @@
+// Package slimauth generates the keys and tokens of the JWT settings of
+// slim_bindings.
+//
+// JwtKeyConfig takes keys in PEM, as a JWK or as a JWKS, for twelve
+// JwtAlgorithms. A Key is generated for one of them and gives its signing
+// (encoding) and verifying (decoding) halves in any of these formats:
+//
+//	key, err := slimauth.GenerateKey(slim_bindings.JwtAlgorithmEs256)
+//	signing, err := key.EncodingConfig(slim_bindings.JwtKeyFormatPem)
+//	verifying, err := key.DecodingConfig(slim_bindings.JwtKeyFormatJwks)
+//	provider := slim_bindings.IdentityProviderConfigJwt{Config: slim_bindings.ClientJwtAuth{
+//		Key: slim_bindings.JwtKeyTypeEncoding{Key: signing}, Duration: time.Hour,
+//	}}
+//	verifier := slim_bindings.IdentityVerifierConfigJwt{Config: slim_bindings.JwtAuth{
+//		Key: slim_bindings.JwtKeyTypeDecoding{Key: verifying}, Duration: time.Hour,
+//	}}
+//
+// Key.Mint signs tokens, for example for the token file of a StaticJwtAuth,
+// and Handler serves the public keys as a JWKS for JwtKeyTypeAutoresolve.
+//
+// The keys are meant for development and tests; production keys belong in a
+// key management system.
+package slimauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// RSABits is the size of generated RSA keys.
+const RSABits = 2048
+
+// Option configures GenerateKey.
+type Option func(*options)
+
+type options struct {
+	keyID string
+}
+
+// WithKeyID sets the key ID, the "kid" of the JWKs and of the header of the
+// tokens. It defaults to the JWK thumbprint of the key (RFC 7638).
+func WithKeyID(id string) Option {
+	return func(o *options) {
+		o.keyID = id
+	}
+}
+
+// algorithm describes a JwtAlgorithm.
+type algorithm struct {
+	name string
+	hash crypto.Hash
+	pss  bool
+}
+
+var algorithms = map[slim_bindings.JwtAlgorithm]algorithm{
+	slim_bindings.JwtAlgorithmHs256: {"HS256", crypto.SHA256, false},
+	slim_bindings.JwtAlgorithmHs384: {"HS384", crypto.SHA384, false},
+	slim_bindings.JwtAlgorithmHs512: {"HS512", crypto.SHA512, false},
+	slim_bindings.JwtAlgorithmEs256: {"ES256", crypto.SHA256, false},
+	slim_bindings.JwtAlgorithmEs384: {"ES384", crypto.SHA384, false},
+	slim_bindings.JwtAlgorithmRs256: {"RS256", crypto.SHA256, false},
+	slim_bindings.JwtAlgorithmRs384: {"RS384", crypto.SHA384, false},
+	slim_bindings.JwtAlgorithmRs512: {"RS512", crypto.SHA512, false},
+	slim_bindings.JwtAlgorithmPs256: {"PS256", crypto.SHA256, true},
+	slim_bindings.JwtAlgorithmPs384: {"PS384", crypto.SHA384, true},
+	slim_bindings.JwtAlgorithmPs512: {"PS512", crypto.SHA512, true},
+	slim_bindings.JwtAlgorithmEdDsa: {"EdDSA", 0, false},
+}
+
+// AlgorithmName returns the JWS name of algorithm, such as "ES256", or ""
+// for an unknown algorithm.
+func AlgorithmName(algorithm slim_bindings.JwtAlgorithm) string {
+	return algorithms[algorithm].name
+}
+
+// Key is a key for a JwtAlgorithm.
+type Key struct {
+	// Algorithm is the algorithm the key signs with.
+	Algorithm slim_bindings.JwtAlgorithm
+	// ID is the key ID.
+	ID string
+	// Private is the signing key: the secret as []byte for the HS
+	// algorithms, else an *ecdsa.PrivateKey, *rsa.PrivateKey or
+	// ed25519.PrivateKey.
+	Private any
+}
+
+// GenerateKey generates a key for algorithm: a random secret as long as the
+// hash for HS256, HS384 and HS512, a P-256 or P-384 key for ES256 and ES384,
+// an RSA key of RSABits for the RS and PS algorithms and an Ed25519 key for
+// EdDSA.
+func GenerateKey(algorithm slim_bindings.JwtAlgorithm, opts ...Option) (*Key, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var private any
+	var err error
+	switch algorithm {
+	case slim_bindings.JwtAlgorithmHs256, slim_bindings.JwtAlgorithmHs384, slim_bindings.JwtAlgorithmHs512:
+		random := make([]byte, algorithms[algorithm].hash.Size())
+		_, err = rand.Read(random)
+		// The secret is text, so that it reads the same in PEM format.
+		private = []byte(base64.RawURLEncoding.EncodeToString(random))
+	case slim_bindings.JwtAlgorithmEs256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case slim_bindings.JwtAlgorithmEs384:
+		private, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case slim_bindings.JwtAlgorithmRs256, slim_bindings.JwtAlgorithmRs384, slim_bindings.JwtAlgorithmRs512,
+		slim_bindings.JwtAlgorithmPs256, slim_bindings.JwtAlgorithmPs384, slim_bindings.JwtAlgorithmPs512:
+		private, err = rsa.GenerateKey(rand.Reader, RSABits)
+	case slim_bindings.JwtAlgorithmEdDsa:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("slimauth: unknown algorithm %d", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("slimauth: %w", err)
+	}
+
+	key := &Key{Algorithm: algorithm, ID: o.keyID, Private: private}
+	if key.ID == "" {
+		if key.ID, err = key.thumbprint(); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Public returns the verifying key: the secret for the HS algorithms, else
+// the public key.
+func (k *Key) Public() any {
+	if signer, ok := k.Private.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return k.Private
+}
+
+// secret reports whether the key is an HS secret, whose signing and
+// verifying halves are the same.
+func (k *Key) secret() ([]byte, bool) {
+	secret, ok := k.Private.([]byte)
+	return secret, ok
+}
+
+// Encoding returns the signing key in format: a PKCS #8 PEM block, or the
+// secret itself for the HS algorithms, a private JWK or a JWKS holding it.
+func (k *Key) Encoding(format slim_bindings.JwtKeyFormat) ([]byte, error) {
+	return k.marshal(format, true)
+}
+
+// Decoding returns the verifying key in format: a PKIX PEM block, or the
+// secret itself for the HS algorithms, a public JWK or a JWKS holding it.
+func (k *Key) Decoding(format slim_bindings.JwtKeyFormat) ([]byte, error) {
+	return k.marshal(format, false)
+}
+
+func (k *Key) marshal(format slim_bindings.JwtKeyFormat, private bool) ([]byte, error) {
+	switch format {
+	case slim_bindings.JwtKeyFormatPem:
+		if secret, ok := k.secret(); ok {
+			return secret, nil
+		}
+		if private {
+			der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+			if err != nil {
+				return nil, fmt.Errorf("slimauth: %w", err)
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+		}
+		der, err := x509.MarshalPKIXPublicKey(k.Public())
+		if err != nil {
+			return nil, fmt.Errorf("slimauth: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	case slim_bindings.JwtKeyFormatJwk:
+		jwk, err := k.jwk(private)
+		if err != nil {
+			return nil, err
+		}
+		return marshalJSON(jwk)
+	case slim_bindings.JwtKeyFormatJwks:
+		jwk, err := k.jwk(private)
+		if err != nil {
+			return nil, err
+		}
+		return marshalJSON(jwks{Keys: []map[string]string{jwk}})
+	}
+	return nil, fmt.Errorf("slimauth: unknown key format %d", format)
+}
+
+// EncodingConfig returns the JwtKeyConfig of the signing key in format, with
+// the key inlined. It goes in a JwtKeyTypeEncoding.
+func (k *Key) EncodingConfig(format slim_bindings.JwtKeyFormat) (slim_bindings.JwtKeyConfig, error) {
+	data, err := k.Encoding(format)
+	return k.config(format, slim_bindings.JwtKeyDataData{Value: string(data)}), err
+}
+
+// DecodingConfig returns the JwtKeyConfig of the verifying key in format,
+// with the key inlined. It goes in a JwtKeyTypeDecoding.
+func (k *Key) DecodingConfig(format slim_bindings.JwtKeyFormat) (slim_bindings.JwtKeyConfig, error) {
+	data, err := k.Decoding(format)
+	return k.config(format, slim_bindings.JwtKeyDataData{Value: string(data)}), err
+}
+
+// WriteEncoding writes the signing key in format to the file at name, which
+// only the owner can read, and returns its JwtKeyConfig.
+func (k *Key) WriteEncoding(name string, format slim_bindings.JwtKeyFormat) (slim_bindings.JwtKeyConfig, error) {
+	data, err := k.Encoding(format)
+	if err == nil {
+		err = writeFile(name, data, 0o600)
+	}
+	return k.config(format, slim_bindings.JwtKeyDataFile{Path: name}), err
+}
+
+// WriteDecoding writes the verifying key in format to the file at name and
+// returns its JwtKeyConfig. Public keys can be read by anyone; an HS secret,
+// like a signing key, only by the owner.
+func (k *Key) WriteDecoding(name string, format slim_bindings.JwtKeyFormat) (slim_bindings.JwtKeyConfig, error) {
+	data, err := k.Decoding(format)
+	if err == nil {
+		perm := os.FileMode(0o644)
+		if _, ok := k.secret(); ok {
+			perm = 0o600
+		}
+		err = writeFile(name, data, perm)
+	}
+	return k.config(format, slim_bindings.JwtKeyDataFile{Path: name}), err
+}
+
+func (k *Key) config(format slim_bindings.JwtKeyFormat, data slim_bindings.JwtKeyData) slim_bindings.JwtKeyConfig {
+	return slim_bindings.JwtKeyConfig{Algorithm: k.Algorithm, Format: format, Key: data}
+}
+
+// writeFile replaces the file at name atomically with one that has exactly
+// the permissions perm, whatever those of an existing file.
+func writeFile(name string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("slimauth: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("slimauth: %w", err)
+	}
+	// CreateTemp gives 0600; Chmod is not subject to the umask.
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("slimauth: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("slimauth: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("slimauth: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package slimauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+var allAlgorithms = []slim_bindings.JwtAlgorithm{
+	slim_bindings.JwtAlgorithmHs256, slim_bindings.JwtAlgorithmHs384, slim_bindings.JwtAlgorithmHs512,
+	slim_bindings.JwtAlgorithmEs256, slim_bindings.JwtAlgorithmEs384,
+	slim_bindings.JwtAlgorithmRs256, slim_bindings.JwtAlgorithmRs384, slim_bindings.JwtAlgorithmRs512,
+	slim_bindings.JwtAlgorithmPs256, slim_bindings.JwtAlgorithmPs384, slim_bindings.JwtAlgorithmPs512,
+	slim_bindings.JwtAlgorithmEdDsa,
+}
+
+// keys generates a key per algorithm once, as RSA keys are slow to generate.
+var keys = func() map[slim_bindings.JwtAlgorithm]*Key {
+	keys := make(map[slim_bindings.JwtAlgorithm]*Key)
+	for _, algorithm := range allAlgorithms {
+		key, err := GenerateKey(algorithm)
+		if err != nil {
+			panic(err)
+		}
+		keys[algorithm] = key
+	}
+	return keys
+}()
+
+// parseJWK returns the key of a JWK: the secret, the public key, or the
+// private key when the JWK has one.
+func parseJWK(t *testing.T, jwk map[string]string) any {
+	t.Helper()
+	field := func(name string) []byte {
+		data, err := base64.RawURLEncoding.DecodeString(jwk[name])
+		if err != nil || len(data) == 0 {
+			t.Fatalf("JWK member %s = %q", name, jwk[name])
+		}
+		return data
+	}
+	number := func(name string) *big.Int { return new(big.Int).SetBytes(field(name)) }
+	switch jwk["kty"] {
+	case "oct":
+		return field("k")
+	case "EC":
+		curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384()}[jwk["crv"]]
+		public := ecdsa.PublicKey{Curve: curve, X: number("x"), Y: number("y")}
+		if _, ok := jwk["d"]; ok {
+			return &ecdsa.PrivateKey{PublicKey: public, D: number("d")}
+		}
+		return &public
+	case "RSA":
+		public := rsa.PublicKey{N: number("n"), E: int(number("e").Int64())}
+		if _, ok := jwk["d"]; ok {
+			private := &rsa.PrivateKey{PublicKey: public, D: number("d"), Primes: []*big.Int{number("p"), number("q")}}
+			if err := private.Validate(); err != nil {
+				t.Fatalf("RSA JWK: %v", err)
+			}
+			return private
+		}
+		return &public
+	case "OKP":
+		if _, ok := jwk["d"]; ok {
+			return ed25519.NewKeyFromSeed(field("d"))
+		}
+		return ed25519.PublicKey(field("x"))
+	}
+	t.Fatalf("unknown JWK %v", jwk)
+	return nil
+}
+
+// equal reports whether the keys a and b are equal.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case interface{ Equal(crypto.PrivateKey) bool }:
+		return a.Equal(b)
+	case interface{ Equal(crypto.PublicKey) bool }:
+		return a.Equal(b)
+	}
+	return false
+}
+
+func TestKeyFormats(t *testing.T) {
+	for _, algorithm := range allAlgorithms {
+		key := keys[algorithm]
+		t.Run(AlgorithmName(algorithm), func(t *testing.T) {
+			_, secret := key.Private.([]byte)
+
+			// PEM: the secret itself, or PKCS #8 and PKIX blocks.
+			private, _ := key.Encoding(slim_bindings.JwtKeyFormatPem)
+			public, _ := key.Decoding(slim_bindings.JwtKeyFormatPem)
+			if secret {
+				if string(private) != string(key.Private.([]byte)) || string(public) != string(private) {
+					t.Errorf("PEM of a secret = %q, %q", private, public)
+				}
+			} else {
+				block, _ := pem.Decode(private)
+				if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil || !equal(parsed, key.Private) {
+					t.Errorf("PKCS #8 key: %v", err)
+				}
+				block, _ = pem.Decode(public)
+				if parsed, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil || !equal(parsed, key.Public()) {
+					t.Errorf("PKIX key: %v", err)
+				}
+			}
+
+			// JWK and JWKS, with the private members only in the encoding.
+			var jwk map[string]string
+			data, _ := key.Encoding(slim_bindings.JwtKeyFormatJwk)
+			if err := json.Unmarshal(data, &jwk); err != nil {
+				t.Fatal(err)
+			}
+			if jwk["kid"] != key.ID || jwk["alg"] != AlgorithmName(algorithm) {
+				t.Errorf("JWK = %v", jwk)
+			}
+			parsed := parseJWK(t, jwk)
+			if secret {
+				if string(parsed.([]byte)) != string(key.Private.([]byte)) {
+					t.Error("the JWK holds another secret")
+				}
+			} else if !equal(parsed, key.Private) {
+				t.Error("the private JWK holds another key")
+			}
+			var set jwks
+			data, _ = key.Decoding(slim_bindings.JwtKeyFormatJwks)
+			if err := json.Unmarshal(data, &set); err != nil || len(set.Keys) != 1 {
+				t.Fatalf("JWKS = %s, %v", data, err)
+			}
+			if _, ok := set.Keys[0]["d"]; ok {
+				t.Error("the public JWKS holds the private key")
+			}
+
+			// The configurations validate.
+			encoding, err := key.EncodingConfig(slim_bindings.JwtKeyFormatPem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoding, err := key.DecodingConfig(slim_bindings.JwtKeyFormatJwk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, config := range []slim_bindings.JwtAuth{
+				{Key: slim_bindings.JwtKeyTypeEncoding{Key: encoding}},
+				{Key: slim_bindings.JwtKeyTypeDecoding{Key: decoding}},
+			} {
+				if err := config.Validate(); err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	// The thumbprint of the RFC 7638 example key.
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	key := &Key{Algorithm: slim_bindings.JwtAlgorithmRs256, Private: &rsa.PrivateKey{PublicKey: rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}}}
+	if thumbprint, err := key.thumbprint(); err != nil || thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("thumbprint = %q, %v", thumbprint, err)
+	}
+
+	key, err := GenerateKey(slim_bindings.JwtAlgorithmEdDsa, WithKeyID("signer-1"))
+	if err != nil || key.ID != "signer-1" {
+		t.Errorf("GenerateKey = %+v, %v", key, err)
+	}
+	if _, err := GenerateKey(slim_bindings.JwtAlgorithm(99)); err == nil {
+		t.Error("GenerateKey of an unknown algorithm succeeded")
+	}
+}
+
+func TestWriteKeys(t *testing.T) {
+	dir := t.TempDir()
+	for _, algorithm := range []slim_bindings.JwtAlgorithm{slim_bindings.JwtAlgorithmHs256, slim_bindings.JwtAlgorithmEs256} {
+		key := keys[algorithm]
+		name := AlgorithmName(algorithm)
+		encoding, err := key.WriteEncoding(filepath.Join(dir, name+".key"), slim_bindings.JwtKeyFormatPem)
+		if err != nil {
+			t.Fatalf("WriteEncoding: %v", err)
+		}
+		decoding, err := key.WriteDecoding(filepath.Join(dir, name+".jwks"), slim_bindings.JwtKeyFormatJwks)
+		if err != nil {
+			t.Fatalf("WriteDecoding: %v", err)
+		}
+		config := slim_bindings.JwtAuth{Key: slim_bindings.JwtKeyTypeDecoding{Key: decoding}}
+		if err := config.Validate(); err != nil {
+			t.Errorf("Validate: %v", err)
+		}
+
+		wantPublic := os.FileMode(0o644)
+		if algorithm == slim_bindings.JwtAlgorithmHs256 {
+			wantPublic = 0o600
+		}
+		for file, want := range map[string]os.FileMode{
+			encoding.Key.(slim_bindings.JwtKeyDataFile).Path: 0o600,
+			decoding.Key.(slim_bindings.JwtKeyDataFile).Path: wantPublic,
+		} {
+			if info, err := os.Stat(file); err != nil || info.Mode().Perm() != want {
+				t.Errorf("%s mode = %v, %v, want %v", file, info.Mode(), err, want)
+			}
+		}
+	}
+}
+
+func TestWriteKeysTightensExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := keys[slim_bindings.JwtAlgorithmHs256]
+	encoding, decoding, token := filepath.Join(dir, "hs.key"), filepath.Join(dir, "hs.jwk"), filepath.Join(dir, "token.jwt")
+	for _, name := range []string{encoding, decoding, token} {
+		if err := os.WriteFile(name, []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := key.WriteEncoding(encoding, slim_bindings.JwtKeyFormatPem); err != nil {
+		t.Fatalf("WriteEncoding: %v", err)
+	}
+	if _, err := key.WriteDecoding(decoding, slim_bindings.JwtKeyFormatJwk); err != nil {
+		t.Fatalf("WriteDecoding: %v", err)
+	}
+	if _, err := key.WriteToken(token, Claims{}); err != nil {
+		t.Fatalf("WriteToken: %v", err)
+	}
+	for _, name := range []string{encoding, decoding, token} {
+		if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0o600 {
+			t.Errorf("%s mode = %v, %v, want 0600", name, info.Mode(), err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("%d files left in the directory, want 3", len(entries))
+	}
+}
@@ -0,0 +1,136 @@
+package slimauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha512" // SHA-384 and SHA-512 for the algorithms
+	"encoding/json"
+	"fmt"
+	"maps"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// DefaultTokenDuration is how long minted tokens are valid, the default
+// duration of the JWT settings.
+const DefaultTokenDuration = time.Hour
+
+// Claims are the claims of a minted token.
+type Claims struct {
+	// Issuer, Subject and Audience are the iss, sub and aud claims, omitted
+	// when empty.
+	Issuer   string
+	Subject  string
+	Audience []string
+	// Duration is how long the token is valid, DefaultTokenDuration if zero.
+	Duration time.Duration
+	// Extra holds further claims. They must not name the registered claims
+	// set from the fields above, nor iat and exp.
+	Extra map[string]any
+}
+
+// Mint returns a token with claims signed by the key, with the key ID in its
+// header. It is issued now.
+func (k *Key) Mint(claims Claims) (string, error) {
+	alg, ok := algorithms[k.Algorithm]
+	if !ok {
+		return "", fmt.Errorf("slimauth: unknown algorithm %d", k.Algorithm)
+	}
+	duration := claims.Duration
+	if duration == 0 {
+		duration = DefaultTokenDuration
+	}
+	now := time.Now()
+	payload := map[string]any{"iat": now.Unix(), "exp": now.Add(duration).Unix()}
+	if claims.Issuer != "" {
+		payload["iss"] = claims.Issuer
+	}
+	if claims.Subject != "" {
+		payload["sub"] = claims.Subject
+	}
+	switch len(claims.Audience) {
+	case 0:
+	case 1:
+		payload["aud"] = claims.Audience[0]
+	default:
+		payload["aud"] = claims.Audience
+	}
+	for name := range claims.Extra {
+		if _, ok := payload[name]; ok {
+			return "", fmt.Errorf("slimauth: extra claim %q is set from Claims", name)
+		}
+	}
+	maps.Copy(payload, claims.Extra)
+
+	header, err := json.Marshal(map[string]string{"alg": alg.name, "typ": "JWT", "kid": k.ID})
+	if err != nil {
+		return "", fmt.Errorf("slimauth: %w", err)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("slimauth: claims: %w", err)
+	}
+	input := b64(header) + "." + b64(body)
+	signature, err := k.sign(alg, []byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + b64(signature), nil
+}
+
+// WriteToken mints a token with claims and writes it to the file at name,
+// which only the owner can read. It returns the StaticJwtAuth that reads it.
+func (k *Key) WriteToken(name string, claims Claims) (slim_bindings.StaticJwtAuth, error) {
+	config := slim_bindings.StaticJwtAuth{TokenFile: name, Duration: DefaultTokenDuration}
+	token, err := k.Mint(claims)
+	if err != nil {
+		return config, err
+	}
+	return config, writeFile(name, []byte(token), 0o600)
+}
+
+// sign returns the JWS signature of input (RFC 7518).
+func (k *Key) sign(alg algorithm, input []byte) ([]byte, error) {
+	if key, ok := k.Private.(ed25519.PrivateKey); ok {
+		return ed25519.Sign(key, input), nil
+	}
+	if secret, ok := k.secret(); ok {
+		mac := hmac.New(alg.hash.New, secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	}
+
+	h := alg.hash.New()
+	h.Write(input)
+	digest := h.Sum(nil)
+	switch key := k.Private.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return nil, fmt.Errorf("slimauth: %w", err)
+		}
+		// JWS signatures are the fixed-size r and s, not ASN.1.
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+		return signature, nil
+	case *rsa.PrivateKey:
+		var signature []byte
+		var err error
+		if alg.pss {
+			signature, err = rsa.SignPSS(rand.Reader, key, alg.hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, key, alg.hash, digest)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("slimauth: %w", err)
+		}
+		return signature, nil
+	}
+	return nil, fmt.Errorf("slimauth: %s cannot sign with %T", alg.name, k.Private)
+}
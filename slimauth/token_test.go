@@ -0,0 +1,185 @@
+package slimauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// verify checks the signature of token with the keys of a JWKS and returns
+// its header and claims.
+func verify(t *testing.T, token string, set []byte) (header map[string]string, claims map[string]any) {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q", token)
+	}
+	decode := func(part string, v any) {
+		data, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			return
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decode(parts[0], &header)
+	decode(parts[1], &claims)
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+
+	var keys jwks
+	if err := json.Unmarshal(set, &keys); err != nil {
+		t.Fatal(err)
+	}
+	var jwk map[string]string
+	for _, key := range keys.Keys {
+		if key["kid"] == header["kid"] {
+			jwk = key
+		}
+	}
+	if jwk == nil || jwk["alg"] != header["alg"] {
+		t.Fatalf("no key for header %v in %s", header, set)
+	}
+
+	input := []byte(parts[0] + "." + parts[1])
+	alg := header["alg"]
+	hash := map[byte]crypto.Hash{'2': crypto.SHA256, '3': crypto.SHA384, '5': crypto.SHA512}[alg[2]]
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(input)
+		digest = h.Sum(nil)
+	}
+	var err error
+	switch key := parseJWK(t, jwk).(type) {
+	case []byte:
+		mac := hmac.New(hash.New, key)
+		mac.Write(input)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			err = errors.New("HMAC mismatch")
+		}
+	case *ecdsa.PublicKey:
+		size := len(signature) / 2
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			err = errors.New("ECDSA mismatch")
+		}
+	case *rsa.PublicKey:
+		if alg[0] == 'P' {
+			err = rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			err = rsa.VerifyPKCS1v15(key, hash, digest, signature)
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, input, signature) {
+			err = errors.New("Ed25519 mismatch")
+		}
+	}
+	if err != nil {
+		t.Fatalf("%s signature: %v", alg, err)
+	}
+	return header, claims
+}
+
+func TestMint(t *testing.T) {
+	for _, algorithm := range allAlgorithms {
+		key := keys[algorithm]
+		t.Run(AlgorithmName(algorithm), func(t *testing.T) {
+			token, err := key.Mint(Claims{
+				Issuer:   "https://issuer.example.com",
+				Subject:  "agntcy/ns/app",
+				Audience: []string{"slim"},
+				Duration: time.Minute,
+				Extra:    map[string]any{"role": "tester"},
+			})
+			if err != nil {
+				t.Fatalf("Mint: %v", err)
+			}
+			set, _ := key.Decoding(slim_bindings.JwtKeyFormatJwks)
+			header, claims := verify(t, token, set)
+			if header["typ"] != "JWT" || header["kid"] != key.ID {
+				t.Errorf("header = %v", header)
+			}
+			if claims["iss"] != "https://issuer.example.com" || claims["sub"] != "agntcy/ns/app" || claims["aud"] != "slim" || claims["role"] != "tester" {
+				t.Errorf("claims = %v", claims)
+			}
+			if exp, iat := claims["exp"].(float64), claims["iat"].(float64); exp-iat != 60 {
+				t.Errorf("exp - iat = %v", exp-iat)
+			}
+		})
+	}
+}
+
+func TestMintClaims(t *testing.T) {
+	key := keys[slim_bindings.JwtAlgorithmEs256]
+	set, _ := key.Decoding(slim_bindings.JwtKeyFormatJwks)
+	token, err := key.Mint(Claims{Audience: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("Mint: %v", err)
+	}
+	_, claims := verify(t, token, set)
+	if _, ok := claims["iss"]; ok {
+		t.Errorf("empty issuer set: %v", claims)
+	}
+	if aud, _ := claims["aud"].([]any); len(aud) != 2 {
+		t.Errorf("aud = %v", claims["aud"])
+	}
+	if exp, iat := claims["exp"].(float64), claims["iat"].(float64); exp-iat != DefaultTokenDuration.Seconds() {
+		t.Errorf("exp - iat = %v", exp-iat)
+	}
+
+	if _, err := key.Mint(Claims{Extra: map[string]any{"exp": 0}}); err == nil {
+		t.Error("Mint overriding exp succeeded")
+	}
+}
+
+func TestWriteToken(t *testing.T) {
+	key := keys[slim_bindings.JwtAlgorithmEdDsa]
+	name := filepath.Join(t.TempDir(), "token.jwt")
+	config, err := key.WriteToken(name, Claims{Subject: "app"})
+	if err != nil {
+		t.Fatalf("WriteToken: %v", err)
+	}
+	if config.TokenFile != name || config.Duration != DefaultTokenDuration {
+		t.Errorf("config = %+v", config)
+	}
+	token, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, _ := key.Decoding(slim_bindings.JwtKeyFormatJwks)
+	if _, claims := verify(t, string(token), set); claims["sub"] != "app" {
+		t.Errorf("claims = %v", claims)
+	}
+
+	var auth slim_bindings.ClientAuthenticationConfig = slim_bindings.ClientAuthenticationConfigStaticJwt{Config: config}
+	clientConfig := slim_bindings.ClientConfig{
+		Endpoint: "http://localhost:46357",
+		Tls: slim_bindings.TlsClientConfig{
+			Insecure:   true,
+			Source:     slim_bindings.TlsSourceNone{},
+			CaSource:   slim_bindings.CaSourceNone{},
+			TlsVersion: "tls1.3",
+		},
+		Auth: &auth,
+	}
+	if err := clientConfig.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
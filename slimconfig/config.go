@@ -0,0 +1,236 @@
+// Package slimconfig loads the configuration of the native SLIM library from
+// YAML or JSON files.
+//
+// A file holds the arguments of InitializeWithConfigs: the runtime, the
+// tracing settings and the services with their dataplane servers and clients.
+//
+//	runtime:
+//	  n_cores: 4
+//	  drain_timeout: 10s
+//	tracing:
+//	  log_level: ${LOG_LEVEL:-info}
+//	services:
+//	  - dataplane:
+//	      clients:
+//	        - endpoint: https://slim.example.com:46357
+//	          tls:
+//	            ca_source:
+//	              file: /etc/slim/ca.pem
+//	          auth:
+//	            basic:
+//	              username: app
+//	              password: ${SLIM_PASSWORD}
+//
+// Keys are the snake_case names of the fields of the generated types.
+// Durations are strings such as "500ms", enums are written by name and enums
+// with data name their variant: either as a plain string when the variant
+// has no data, such as "none", or as a mapping with the variant as its only
+// key. Omitted fields keep their defaults.
+//
+// Strings may reference environment variables as ${VAR} or ${VAR:-default};
+// $${ stands for a literal ${. Variables starting with SLIM_ then override
+// single fields, with the path of the field in upper case joined by
+// underscores, list entries by index:
+//
+//	SLIM_TRACING_LOG_LEVEL=debug
+//	SLIM_SERVICES_0_DATAPLANE_CLIENTS_0_ENDPOINT=http://localhost:46357
+//	SLIM_SERVICES_0_DATAPLANE_CLIENTS_0_TLS_INSECURE=true
+//
+// The servers and clients are then checked with their Validate methods. Every
+// problem, whether in decoding or validation, is reported at once in an
+// Errors value, each with the path of its field:
+//
+//	slimconfig: 2 problems:
+//	  services[0].dataplane.clients[0].connect_timeout: invalid duration "10" (use a duration such as "500ms" or "10s")
+//	  services[0].dataplane.clients[0].tls.ca_source: unknown ca_source "files" (one of file, pem, spire, none)
+//
+// A Reloader applies later changes to the servers and clients of the file to
+// the running services.
+package slimconfig
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables that override
+// fields of a configuration.
+const DefaultEnvPrefix = "SLIM_"
+
+// Config is the configuration of the native library.
+type Config struct {
+	Runtime  slim_bindings.RuntimeConfig
+	Tracing  slim_bindings.TracingConfig
+	Services []slim_bindings.ServiceConfig
+}
+
+// Initialize initializes the native library with the configuration.
+func (c *Config) Initialize() error {
+	return slim_bindings.InitializeWithConfigs(c.Runtime, c.Tracing, c.Services)
+}
+
+// Validate reports the problems of the servers and clients of every service,
+// with paths from the root of the file.
+func (c *Config) Validate() error {
+	var errs errorList
+	c.validate(&errs)
+	return errs.err()
+}
+
+func (c *Config) validate(errs *errorList) {
+	for i := range c.Services {
+		dataplane := &c.Services[i].Dataplane
+		path := join(index("services", i), "dataplane")
+		for j := range dataplane.Servers {
+			errs.validated(index(join(path, "servers"), j), dataplane.Servers[j].Validate())
+		}
+		for j := range dataplane.Clients {
+			errs.validated(index(join(path, "clients"), j), dataplane.Clients[j].Validate())
+		}
+	}
+}
+
+// Option configures Load and Parse.
+type Option func(*options)
+
+type options struct {
+	prefix   string
+	environ  []string
+	lookup   func(string) (string, bool)
+	defaults *Config
+	validate bool
+
+	// Reloader options.
+	interval time.Duration
+	signals  []os.Signal
+	onReload func(Event)
+}
+
+// WithEnvPrefix sets the prefix of the variables that override fields.
+// The default is DefaultEnvPrefix; an empty prefix disables overrides.
+func WithEnvPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithEnv replaces the process environment, for ${VAR} expansion and
+// overrides alike, with environ in the form of os.Environ.
+func WithEnv(environ []string) Option {
+	return func(o *options) {
+		env := make(map[string]string, len(environ))
+		for _, kv := range environ {
+			if name, value, ok := strings.Cut(kv, "="); ok {
+				env[name] = value
+			}
+		}
+		o.environ = environ
+		o.lookup = func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		}
+	}
+}
+
+// WithDefaults sets the configuration the file is applied to. By default it
+// is the runtime and tracing configuration of NewRuntimeConfig and
+// NewTracingConfig, without services.
+func WithDefaults(defaults Config) Option {
+	return func(o *options) {
+		o.defaults = &defaults
+	}
+}
+
+// WithValidation sets whether the servers and clients are checked with their
+// Validate methods, which also requires the files they name to exist. It is
+// enabled by default.
+func WithValidation(validate bool) Option {
+	return func(o *options) {
+		o.validate = validate
+	}
+}
+
+// Load reads the configuration in the YAML or JSON file at path.
+func Load(path string, opts ...Option) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("slimconfig: %w", err)
+	}
+	return load(path, data, opts)
+}
+
+func load(path string, data []byte, opts []Option) (*Config, error) {
+	config, err := parse(data, opts)
+	if err != nil {
+		if _, ok := err.(Errors); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("slimconfig: %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Parse parses a configuration in YAML or JSON.
+func Parse(data []byte, opts ...Option) (*Config, error) {
+	config, err := parse(data, opts)
+	if err != nil {
+		if _, ok := err.(Errors); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("slimconfig: %w", err)
+	}
+	return config, nil
+}
+
+func parse(data []byte, opts []Option) (*Config, error) {
+	o := options{prefix: DefaultEnvPrefix, lookup: os.LookupEnv, validate: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.environ == nil && o.prefix != "" {
+		o.environ = os.Environ()
+	}
+
+	var tree map[string]any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	if tree == nil {
+		tree = map[string]any{}
+	}
+
+	var config *Config
+	if o.defaults != nil {
+		// Decode into a copy, so that the defaults serve every load.
+		defaults := *o.defaults
+		defaults.Services = slices.Clone(defaults.Services)
+		config = &defaults
+	} else {
+		config = &Config{
+			Runtime: slim_bindings.NewRuntimeConfig(),
+			Tracing: slim_bindings.NewTracingConfig(),
+		}
+	}
+	d := decoder{lookup: o.lookup}
+	if o.prefix != "" {
+		d.overrides(tree, o.prefix, o.environ)
+	}
+	value := reflect.ValueOf(config).Elem()
+	d.decode("", tree, value)
+	d.complete("", value)
+	if o.validate && d.errs.err() == nil {
+		config.validate(&d.errs)
+	}
+	if err := d.errs.err(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
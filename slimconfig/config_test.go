@@ -0,0 +1,356 @@
+package slimconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+func defaults() Option {
+	return WithDefaults(Config{
+		Runtime: slim_bindings.RuntimeConfig{NCores: 0, ThreadName: "slim", DrainTimeout: 10 * time.Second},
+		Tracing: slim_bindings.TracingConfig{LogLevel: "info", DisplayThreadNames: true},
+	})
+}
+
+func fieldErrors(t *testing.T, err error) map[string]*FieldError {
+	t.Helper()
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error = %v, want Errors", err)
+	}
+	byPath := make(map[string]*FieldError, len(errs))
+	for _, err := range errs {
+		byPath[err.Path] = err
+	}
+	return byPath
+}
+
+const sample = `
+runtime:
+  n_cores: 4
+tracing:
+  log_level: ${LOG_LEVEL:-warn}
+  filters: [slim_session=debug]
+services:
+  - node_id: node-1
+    dataplane:
+      servers:
+        - endpoint: 0.0.0.0:46357
+          tls:
+            source:
+              file: {cert: /etc/slim/cert.pem, key: /etc/slim/key.pem}
+          auth:
+            jwt:
+              key:
+                decoding:
+                  algorithm: ES256
+                  format: pem
+                  key: {file: /etc/slim/jwt.pub}
+              duration: 1h
+      clients:
+        - endpoint: https://slim.example.com:46357
+          transport: websocket
+          compression: zstd
+          connect_timeout: 5s
+          headers: {x-tenant: "${TENANT}"}
+          tls:
+            ca_source: {file: /etc/slim/ca.pem}
+          auth:
+            basic: {username: app, password: "$${literal}"}
+          backoff:
+            exponential: {base: 100ms, factor: 2, max_delay: 10s, max_attempts: 5, jitter: true}
+`
+
+func TestParseYAML(t *testing.T) {
+	config, err := Parse([]byte(sample), defaults(), WithValidation(false), WithEnv([]string{"TENANT=acme"}))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if config.Runtime.NCores != 4 || config.Runtime.ThreadName != "slim" || config.Runtime.DrainTimeout != 10*time.Second {
+		t.Errorf("Runtime = %+v", config.Runtime)
+	}
+	if config.Tracing.LogLevel != "warn" || !config.Tracing.DisplayThreadNames || !reflect.DeepEqual(config.Tracing.Filters, []string{"slim_session=debug"}) {
+		t.Errorf("Tracing = %+v", config.Tracing)
+	}
+	if len(config.Services) != 1 {
+		t.Fatalf("Services = %+v", config.Services)
+	}
+	service := config.Services[0]
+	if service.NodeId == nil || *service.NodeId != "node-1" || service.GroupName != nil {
+		t.Errorf("NodeId = %v, GroupName = %v", service.NodeId, service.GroupName)
+	}
+
+	server := service.Dataplane.Servers[0]
+	if source, ok := server.Tls.Source.(slim_bindings.TlsSourceFile); !ok || source.Cert != "/etc/slim/cert.pem" || source.Key != "/etc/slim/key.pem" {
+		t.Errorf("server Tls.Source = %#v", server.Tls.Source)
+	}
+	if _, ok := server.Tls.ClientCa.(slim_bindings.CaSourceNone); !ok {
+		t.Errorf("server Tls.ClientCa = %#v, want none", server.Tls.ClientCa)
+	}
+	jwt, ok := (*server.Auth).(slim_bindings.ServerAuthenticationConfigJwt)
+	if !ok || jwt.Config.Duration != time.Hour {
+		t.Fatalf("server Auth = %#v", *server.Auth)
+	}
+	want := slim_bindings.JwtKeyTypeDecoding{Key: slim_bindings.JwtKeyConfig{
+		Algorithm: slim_bindings.JwtAlgorithmEs256,
+		Format:    slim_bindings.JwtKeyFormatPem,
+		Key:       slim_bindings.JwtKeyDataFile{Path: "/etc/slim/jwt.pub"},
+	}}
+	if !reflect.DeepEqual(jwt.Config.Key, want) {
+		t.Errorf("jwt key = %#v", jwt.Config.Key)
+	}
+
+	client := service.Dataplane.Clients[0]
+	if *client.Transport != slim_bindings.TransportProtocolWebsocket || *client.Compression != slim_bindings.CompressionTypeZstd {
+		t.Errorf("Transport = %v, Compression = %v", *client.Transport, *client.Compression)
+	}
+	if *client.ConnectTimeout != 5*time.Second || (*client.Headers)["x-tenant"] != "acme" {
+		t.Errorf("ConnectTimeout = %v, Headers = %v", *client.ConnectTimeout, *client.Headers)
+	}
+	if !client.Tls.IncludeSystemCaCertsPool || client.Tls.TlsVersion != "tls1.3" || client.Tls.Insecure {
+		t.Errorf("client Tls = %+v", client.Tls)
+	}
+	if _, ok := client.Tls.Source.(slim_bindings.TlsSourceNone); !ok {
+		t.Errorf("client Tls.Source = %#v, want none", client.Tls.Source)
+	}
+	if basic := (*client.Auth).(slim_bindings.ClientAuthenticationConfigBasic); basic.Config.Password != "${literal}" {
+		t.Errorf("password = %q", basic.Config.Password)
+	}
+	backoff := (*client.Backoff).(slim_bindings.BackoffConfigExponential).Config
+	if backoff.Base != 100*time.Millisecond || backoff.Factor != 2 || backoff.MaxDelay != 10*time.Second || !backoff.Jitter {
+		t.Errorf("backoff = %+v", backoff)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	data := `{
+		"tracing": {"log_level": "debug"},
+		"services": [{"dataplane": {"clients": [{"endpoint": "http://localhost:46357", "tls": {"insecure": true}}]}}]
+	}`
+	config, err := Parse([]byte(data), defaults(), WithEnv(nil))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if config.Tracing.LogLevel != "debug" {
+		t.Errorf("LogLevel = %q", config.Tracing.LogLevel)
+	}
+	client := config.Services[0].Dataplane.Clients[0]
+	if client.Endpoint != "http://localhost:46357" || !client.Tls.Insecure {
+		t.Errorf("client = %+v", client)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	environ := []string{
+		"SLIM_TRACING_LOG_LEVEL=trace",
+		"SLIM_RUNTIME_N_CORES=8",
+		"SLIM_SERVICES_0_DATAPLANE_CLIENTS_0_TLS_INSECURE=true",
+		"SLIM_SERVICES_0_DATAPLANE_CLIENTS_0_CONNECT_TIMEOUT=2s",
+		"SLIM_SERVICES_0_DATAPLANE_CLIENTS_1_ENDPOINT=http://backup:46357",
+		"SLIM_SERVICES_0_DATAPLANE_SERVERS_0_TLS_SOURCE_FILE_KEY=/run/key.pem",
+		"SLIM_SERVICES_0_DATAPLANE_CLIENTS_0_TLS_CA_SOURCE=none",
+		"SLIM_SERVICES_0_DATAPLANE_CLIENTS_0_HEADERS_X_API_KEY=secret",
+		"SLIM_UNKNOWN=ignored",
+		"TENANT=acme",
+	}
+	config, err := Parse([]byte(sample), defaults(), WithValidation(false), WithEnv(environ))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if config.Tracing.LogLevel != "trace" || config.Runtime.NCores != 8 {
+		t.Errorf("Tracing = %+v, Runtime = %+v", config.Tracing, config.Runtime)
+	}
+	clients := config.Services[0].Dataplane.Clients
+	if len(clients) != 2 {
+		t.Fatalf("clients = %+v", clients)
+	}
+	if !clients[0].Tls.Insecure || *clients[0].ConnectTimeout != 2*time.Second || clients[0].Endpoint != "https://slim.example.com:46357" {
+		t.Errorf("clients[0] = %+v", clients[0])
+	}
+	if _, ok := clients[0].Tls.CaSource.(slim_bindings.CaSourceNone); !ok {
+		t.Errorf("clients[0] CaSource = %#v, want none", clients[0].Tls.CaSource)
+	}
+	if headers := *clients[0].Headers; headers["x_api_key"] != "secret" || headers["x-tenant"] != "acme" {
+		t.Errorf("clients[0] Headers = %v", headers)
+	}
+	if clients[1].Endpoint != "http://backup:46357" || clients[1].Tls.TlsVersion != "tls1.3" {
+		t.Errorf("clients[1] = %+v", clients[1])
+	}
+	source := config.Services[0].Dataplane.Servers[0].Tls.Source.(slim_bindings.TlsSourceFile)
+	if source.Cert != "/etc/slim/cert.pem" || source.Key != "/run/key.pem" {
+		t.Errorf("server source = %+v", source)
+	}
+
+	config, err = Parse([]byte(sample), defaults(), WithValidation(false), WithEnv(environ), WithEnvPrefix(""))
+	if err != nil {
+		t.Fatalf("Parse without overrides: %v", err)
+	}
+	if config.Tracing.LogLevel != "warn" {
+		t.Errorf("LogLevel = %q, want the file value", config.Tracing.LogLevel)
+	}
+}
+
+func TestOverrideIndexGap(t *testing.T) {
+	_, err := Parse([]byte(sample), defaults(), WithValidation(false), WithEnv([]string{"TENANT=acme", "SLIM_SERVICES_0_DATAPLANE_CLIENTS_3_ENDPOINT=x"}))
+	if fieldErrors(t, err)["SLIM_SERVICES_0_DATAPLANE_CLIENTS_3_ENDPOINT"] == nil {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestOverrideIndexOrder(t *testing.T) {
+	// Listed out of order, and with 10 before 2 lexicographically.
+	environ := []string{"TENANT=acme"}
+	for i := 11; i >= 1; i-- {
+		environ = append(environ, fmt.Sprintf("SLIM_SERVICES_0_DATAPLANE_CLIENTS_%d_ENDPOINT=http://node-%d:46357", i, i))
+	}
+	given := slices.Clone(environ)
+	config, err := Parse([]byte(sample), defaults(), WithValidation(false), WithEnv(environ))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !slices.Equal(environ, given) {
+		t.Errorf("environ reordered to %v", environ)
+	}
+	clients := config.Services[0].Dataplane.Clients
+	if len(clients) != 12 {
+		t.Fatalf("%d clients, want 12", len(clients))
+	}
+	for i := 1; i < len(clients); i++ {
+		if want := fmt.Sprintf("http://node-%d:46357", i); clients[i].Endpoint != want {
+			t.Errorf("clients[%d] endpoint = %q, want %q", i, clients[i].Endpoint, want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	data := `
+runtime:
+  n_cores: -1
+  drain_timeout: 10
+tracing:
+  log_levle: debug
+services:
+  - dataplane:
+      clients:
+        - endpoint: ${ENDPOINT}
+          transport: quic
+          tls:
+            ca_source: {files: /ca.pem}
+            insecure: maybe
+      servers:
+        - endpoint: 0.0.0.0:46357
+          auth:
+            jwt: {duration: 1h}
+`
+	_, err := Parse([]byte(data), defaults(), WithEnv(nil))
+	byPath := fieldErrors(t, err)
+
+	want := map[string]string{
+		"runtime.n_cores":                                "out of range",
+		"runtime.drain_timeout":                          "expected a duration",
+		"tracing.log_levle":                              "unknown field",
+		"services[0].dataplane.clients[0].endpoint":      "ENDPOINT is not set",
+		"services[0].dataplane.clients[0].transport":     "invalid transport_protocol quic",
+		"services[0].dataplane.clients[0].tls.ca_source": `unknown ca_source "files"`,
+		"services[0].dataplane.clients[0].tls.insecure":  `invalid boolean "maybe"`,
+		"services[0].dataplane.servers[0].auth.jwt.key":  "missing jwt_key_type",
+	}
+	for path, message := range want {
+		got := byPath[path]
+		if got == nil {
+			t.Errorf("no error for %s", path)
+			continue
+		}
+		if !strings.Contains(got.Message, message) {
+			t.Errorf("%s: message = %q, want %q", path, got.Message, message)
+		}
+	}
+	if len(byPath) != len(want) {
+		t.Errorf("errors = %v", err)
+	}
+	if hint := byPath["tracing.log_levle"].Hint; !strings.Contains(hint, "log_level") {
+		t.Errorf("hint = %q", hint)
+	}
+	if hint := byPath["services[0].dataplane.clients[0].tls.ca_source"].Hint; hint != "one of file, pem, spire, none" {
+		t.Errorf("hint = %q", hint)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slim.yaml")
+	if err := os.WriteFile(path, []byte("tracing: [invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, defaults()); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Load error = %v, want the path", err)
+	}
+
+	if err := os.WriteFile(path, []byte("tracing: {log_level: error}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := Load(path, defaults(), WithEnv(nil))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if config.Tracing.LogLevel != "error" || config.Services != nil {
+		t.Errorf("config = %+v", config)
+	}
+}
+
+func TestSnake(t *testing.T) {
+	for name, want := range map[string]string{
+		"NCores":                   "n_cores",
+		"Http2Only":                "http2_only",
+		"IncludeSystemCaCertsPool": "include_system_ca_certs_pool",
+		"TlsVersion":               "tls_version",
+		"EdDsa":                    "ed_dsa",
+		"StaticJwt":                "static_jwt",
+	} {
+		if got := snake(name); got != want {
+			t.Errorf("snake(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestParseValidates(t *testing.T) {
+	data := `
+services:
+  - dataplane:
+      servers:
+        - endpoint: 0.0.0.0:46357
+      clients:
+        - endpoint: http://localhost:46357
+          rate_limit: 100/week
+          tls:
+            insecure: true
+            tls_version: "1.3"
+`
+	_, err := Parse([]byte(data), defaults(), WithEnv(nil))
+	byPath := fieldErrors(t, err)
+	for _, path := range []string{
+		"services[0].dataplane.servers[0].tls.source",
+		"services[0].dataplane.clients[0].rate_limit",
+		"services[0].dataplane.clients[0].tls.tls_version",
+	} {
+		if byPath[path] == nil {
+			t.Errorf("no error for %s in %v", path, err)
+		}
+	}
+	if len(byPath) != 3 {
+		t.Errorf("errors = %v", err)
+	}
+
+	if _, err := Parse([]byte(data), defaults(), WithEnv(nil), WithValidation(false)); err != nil {
+		t.Errorf("Parse without validation: %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package slimconfig
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// decoder decodes a generic YAML/JSON tree into the generated configuration
+// types, collecting every error with the path of its field.
+type decoder struct {
+	errs   errorList
+	lookup func(string) (string, bool)
+}
+
+func index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// decode decodes v into dst. A nil v leaves dst unchanged, so that omitted
+// and null fields keep their defaults.
+func (d *decoder) decode(path string, v any, dst reflect.Value) {
+	if v == nil {
+		return
+	}
+	if s, ok := v.(string); ok {
+		expanded, ok := d.expand(path, s)
+		if !ok {
+			return
+		}
+		v = expanded
+	}
+
+	t := dst.Type()
+	switch {
+	case t == durationType:
+		d.duration(path, v, dst)
+	case enums[t] != nil:
+		d.enum(path, v, dst)
+	case variants[t] != nil:
+		d.variant(path, v, dst)
+	default:
+		d.value(path, v, dst)
+	}
+}
+
+func (d *decoder) value(path string, v any, dst reflect.Value) {
+	t := dst.Type()
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(t.Elem())
+		if !dst.IsNil() {
+			elem.Elem().Set(dst.Elem())
+		} else if start, ok := initial[t.Elem()]; ok {
+			elem.Elem().Set(reflect.ValueOf(start()))
+		}
+		d.decode(path, v, elem.Elem())
+		dst.Set(elem)
+	case reflect.Struct:
+		d.fields(path, v, dst)
+	case reflect.Slice:
+		items, ok := v.([]any)
+		if !ok {
+			d.errs.add(path, "", "expected a list, got %s", describe(v))
+			return
+		}
+		slice := reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			if start, ok := initial[t.Elem()]; ok {
+				slice.Index(i).Set(reflect.ValueOf(start()))
+			}
+			d.decode(index(path, i), item, slice.Index(i))
+		}
+		dst.Set(slice)
+	case reflect.Map:
+		entries, ok := v.(map[string]any)
+		if !ok {
+			d.errs.add(path, "", "expected a mapping, got %s", describe(v))
+			return
+		}
+		m := reflect.MakeMapWithSize(t, len(entries))
+		for _, key := range sortedKeys(entries) {
+			elem := reflect.New(t.Elem()).Elem()
+			d.decode(join(path, key), entries[key], elem)
+			m.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), elem)
+		}
+		dst.Set(m)
+	case reflect.String:
+		switch v.(type) {
+		case string, bool, int, int64, uint64, float64:
+			dst.SetString(fmt.Sprint(v))
+		default:
+			d.errs.add(path, "", "expected a string, got %s", describe(v))
+		}
+	case reflect.Bool:
+		switch b := v.(type) {
+		case bool:
+			dst.SetBool(b)
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			if err != nil {
+				d.errs.add(path, "use true or false", "invalid boolean %q", b)
+				return
+			}
+			dst.SetBool(parsed)
+		default:
+			d.errs.add(path, "", "expected a boolean, got %s", describe(v))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := d.integer(path, v)
+		if !ok {
+			return
+		}
+		if n < 0 || dst.OverflowUint(uint64(n)) {
+			d.errs.add(path, "", "%d is out of range", n)
+			return
+		}
+		dst.SetUint(uint64(n))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := d.integer(path, v)
+		if !ok {
+			return
+		}
+		if dst.OverflowInt(n) {
+			d.errs.add(path, "", "%d is out of range", n)
+			return
+		}
+		dst.SetInt(n)
+	default:
+		d.errs.add(path, "", "unsupported field type %s", t)
+	}
+}
+
+// fields decodes a mapping into the fields of a struct.
+func (d *decoder) fields(path string, v any, dst reflect.Value) {
+	entries, ok := v.(map[string]any)
+	if !ok {
+		d.errs.add(path, "", "expected a mapping, got %s", describe(v))
+		return
+	}
+	for _, key := range sortedKeys(entries) {
+		f, ok := field(dst.Type(), key)
+		if !ok {
+			d.errs.add(join(path, key), knownFields(dst.Type()), "unknown field")
+			continue
+		}
+		d.decode(join(path, key), entries[key], dst.FieldByIndex(f.Index))
+	}
+}
+
+func (d *decoder) integer(path string, v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint64:
+		if n > math.MaxInt64 {
+			d.errs.add(path, "", "%d is out of range", n)
+			return 0, false
+		}
+		return int64(n), true
+	case float64:
+		if n != math.Trunc(n) || math.Abs(n) > math.MaxInt64 {
+			d.errs.add(path, "", "expected an integer, got %v", n)
+			return 0, false
+		}
+		return int64(n), true
+	case string:
+		parsed, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+		if err != nil {
+			d.errs.add(path, "", "invalid integer %q", n)
+			return 0, false
+		}
+		return parsed, true
+	}
+	d.errs.add(path, "", "expected an integer, got %s", describe(v))
+	return 0, false
+}
+
+func (d *decoder) duration(path string, v any, dst reflect.Value) {
+	s, ok := v.(string)
+	if !ok {
+		d.errs.add(path, `use a duration such as "500ms" or "10s"`, "expected a duration, got %s", describe(v))
+		return
+	}
+	parsed, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil || parsed < 0 {
+		d.errs.add(path, `use a duration such as "500ms" or "10s"`, "invalid duration %q", s)
+		return
+	}
+	dst.SetInt(int64(parsed))
+}
+
+func (d *decoder) enum(path string, v any, dst reflect.Value) {
+	t := dst.Type()
+	s, ok := v.(string)
+	value, known := enums[t][strings.ToLower(strings.TrimSpace(s))]
+	if !ok || !known {
+		d.errs.add(path, "one of "+strings.Join(enumNames(t), ", "), "invalid %s %v", snake(t.Name()), v)
+		return
+	}
+	dst.SetUint(value)
+}
+
+// variant decodes an enum with data. It is written as the name of the
+// variant when the variant has no data, and otherwise as a mapping with the
+// variant name as its only key.
+func (d *decoder) variant(path string, v any, dst reflect.Value) {
+	enum := dst.Type()
+	hint := "one of " + strings.Join(variantNames(enum), ", ")
+
+	var name string
+	var payload any
+	switch x := v.(type) {
+	case string:
+		name = x
+	case map[string]any:
+		if len(x) != 1 {
+			d.errs.add(path, hint, "expected a single %s variant, got %d keys", snake(enum.Name()), len(x))
+			return
+		}
+		for key, value := range x {
+			name, payload = key, value
+		}
+	default:
+		d.errs.add(path, hint, "expected a %s variant, got %s", snake(enum.Name()), describe(v))
+		return
+	}
+
+	t, ok := variant(enum, name)
+	if !ok {
+		d.errs.add(path, hint, "unknown %s %q", snake(enum.Name()), name)
+		return
+	}
+	value := reflect.New(t).Elem()
+	// Keep the data of a variant of the same kind, so that an override can
+	// change a single field of it.
+	if !dst.IsNil() && dst.Elem().Type() == t {
+		value.Set(dst.Elem())
+	}
+	vpath := join(path, name)
+	switch {
+	case t.NumField() == 0:
+		if payload != nil && !isEmpty(payload) {
+			d.errs.add(vpath, "", "%s takes no settings", name)
+		}
+	case unwrapped(t):
+		d.decode(vpath, payload, value.Field(0))
+	default:
+		d.decode(vpath, payload, value)
+	}
+	dst.Set(value)
+}
+
+// complete checks the fields that have no usable zero value once decoding is
+// done: an enum with data left unset takes its none variant if it has one
+// and is reported missing otherwise, and so is an unset integer enum.
+func (d *decoder) complete(path string, v reflect.Value) {
+	if d.errs.has(path) {
+		return
+	}
+	t := v.Type()
+	switch {
+	case enums[t] != nil:
+		if v.Uint() == 0 {
+			d.errs.add(path, "one of "+strings.Join(enumNames(t), ", "), "missing %s", snake(t.Name()))
+		}
+		return
+	case variants[t] != nil:
+		if v.IsNil() {
+			if none, ok := variant(t, "none"); ok {
+				v.Set(reflect.New(none).Elem())
+				return
+			}
+			d.errs.add(path, "one of "+strings.Join(variantNames(t), ", "), "missing %s", snake(t.Name()))
+			return
+		}
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		vpath := join(path, variantName(t, elem.Type()))
+		if unwrapped(elem.Type()) {
+			d.complete(vpath, elem.Field(0))
+		} else {
+			d.complete(vpath, elem)
+		}
+		v.Set(elem)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			d.complete(path, v.Elem())
+		}
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if f := t.Field(i); f.IsExported() {
+				d.complete(join(path, snake(f.Name)), v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			d.complete(index(path, i), v.Index(i))
+		}
+	}
+}
+
+func isEmpty(v any) bool {
+	m, ok := v.(map[string]any)
+	return ok && len(m) == 0
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func knownFields(t reflect.Type) string {
+	names := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		if f := t.Field(i); f.IsExported() {
+			names = append(names, snake(f.Name))
+		}
+	}
+	return "known fields: " + strings.Join(names, ", ")
+}
+
+func describe(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "a mapping"
+	case []any:
+		return "a list"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	default:
+		return fmt.Sprintf("%T %v", v, v)
+	}
+}
@@ -0,0 +1,225 @@
+package slimconfig
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// expand replaces ${VAR} and ${VAR:-default} in s with environment values.
+// $${ produces a literal ${.
+func (d *decoder) expand(path, s string) (string, bool) {
+	if !strings.Contains(s, "${") {
+		return s, true
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), true
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			d.errs.add(path, "close it with }", "unterminated ${ in %q", s)
+			return "", false
+		}
+		b.WriteString(s[:i])
+		name, fallback, hasFallback := strings.Cut(s[i+2:i+end], ":-")
+		value, ok := d.lookup(name)
+		switch {
+		case ok && value != "":
+			b.WriteString(value)
+		case hasFallback:
+			b.WriteString(fallback)
+		case ok:
+		default:
+			d.errs.add(path, "set it or give a default with ${"+name+":-default}", "environment variable %s is not set", name)
+			return "", false
+		}
+		s = s[i+end+1:]
+	}
+}
+
+// step is one key of the path of an override in the generic tree.
+type step struct {
+	key     string
+	index   int
+	isIndex bool
+	// variant marks the key naming the variant of an enum with data.
+	variant bool
+}
+
+// resolve maps the underscore-separated tokens of an override variable, such
+// as SERVICES_0_DATAPLANE_CLIENTS_0_TLS_INSECURE, to a path in the tree of
+// type t. Field names contain underscores too, so every split is tried.
+func resolve(t reflect.Type, tokens []string) ([]step, bool) {
+	if len(tokens) == 0 {
+		return nil, true
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType || enums[t] != nil:
+		return nil, false
+	case variants[t] != nil:
+		for _, v := range variants[t] {
+			name := variantName(t, v)
+			rest, ok := cutTokens(tokens, name)
+			if !ok {
+				continue
+			}
+			inner := v
+			if unwrapped(v) {
+				inner = v.Field(0).Type
+			}
+			if steps, ok := resolve(inner, rest); ok {
+				return append([]step{{key: name, variant: true}}, steps...), true
+			}
+		}
+		return nil, false
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			key := snake(f.Name)
+			rest, ok := cutTokens(tokens, key)
+			if !ok {
+				continue
+			}
+			if steps, ok := resolve(f.Type, rest); ok {
+				return append([]step{{key: key}}, steps...), true
+			}
+		}
+	case reflect.Slice:
+		n, err := strconv.Atoi(tokens[0])
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		if steps, ok := resolve(t.Elem(), tokens[1:]); ok {
+			return append([]step{{index: n, isIndex: true}}, steps...), true
+		}
+	case reflect.Map:
+		return []step{{key: strings.Join(tokens, "_")}}, true
+	}
+	return nil, false
+}
+
+// cutTokens removes the tokens of key, such as n_cores, from the front of
+// tokens.
+func cutTokens(tokens []string, key string) ([]string, bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) > len(tokens) {
+		return nil, false
+	}
+	for i, part := range parts {
+		if tokens[i] != part {
+			return nil, false
+		}
+	}
+	return tokens[len(parts):], true
+}
+
+// override is an environment variable resolved to a path in the tree.
+type override struct {
+	name  string
+	value string
+	steps []step
+}
+
+// overrides applies the environment variables starting with prefix to tree.
+// Variables that match no field are ignored. They are applied in the order
+// of their paths, with list indexes in numeric order, so that lists grow one
+// entry at a time whatever the order of environ.
+func (d *decoder) overrides(tree map[string]any, prefix string, environ []string) {
+	var list []override
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, prefix) || name == prefix {
+			continue
+		}
+		tokens := strings.Split(strings.ToLower(strings.TrimPrefix(name, prefix)), "_")
+		steps, ok := resolve(reflect.TypeFor[Config](), tokens)
+		if !ok || len(steps) == 0 {
+			continue
+		}
+		list = append(list, override{name: name, value: value, steps: steps})
+	}
+	slices.SortFunc(list, func(a, b override) int {
+		return cmp.Or(compareSteps(a.steps, b.steps), strings.Compare(a.name, b.name))
+	})
+
+	for _, o := range list {
+		if _, err := put(tree, o.steps, o.value); err != nil {
+			d.errs.add(o.name, "indexes must extend the lists of the file one at a time", "%v", err)
+		}
+	}
+}
+
+// compareSteps orders paths step by step: indexes by number, keys by name.
+func compareSteps(a, b []step) int {
+	for i := range min(len(a), len(b)) {
+		var c int
+		if a[i].isIndex && b[i].isIndex {
+			c = cmp.Compare(a[i].index, b[i].index)
+		} else {
+			c = strings.Compare(a[i].key, b[i].key)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// put stores value in node at the path of steps and returns the updated
+// node. Mappings and list entries are created on the way, and values in the
+// way are replaced.
+func put(node any, steps []step, value string) (any, error) {
+	if len(steps) == 0 {
+		return value, nil
+	}
+	s := steps[0]
+	if s.isIndex {
+		list, _ := node.([]any)
+		if s.index > len(list) {
+			return node, fmt.Errorf("index %d is past the end of a list of %d", s.index, len(list))
+		}
+		if s.index == len(list) {
+			list = append(list, nil)
+		}
+		child, err := put(list[s.index], steps[1:], value)
+		list[s.index] = child
+		return list, err
+	}
+
+	m, ok := node.(map[string]any)
+	if !ok {
+		m = map[string]any{}
+	}
+	if s.variant {
+		// Switch the enum to this variant, dropping any other.
+		for key := range m {
+			if key != s.key {
+				delete(m, key)
+			}
+		}
+	}
+	child, err := put(m[s.key], steps[1:], value)
+	m[s.key] = child
+	return m, err
+}
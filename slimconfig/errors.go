@@ -0,0 +1,80 @@
+package slimconfig
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// FieldError is a problem with one field of a configuration. Its Path, such
+// as "services[0].dataplane.clients[1].endpoint", starts at the root of the
+// file.
+type FieldError = slim_bindings.FieldError
+
+// Errors collects every problem found in a configuration. Use errors.As to
+// inspect the individual FieldErrors.
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	if len(lines) == 1 {
+		return "slimconfig: " + lines[0]
+	}
+	return fmt.Sprintf("slimconfig: %d problems:\n  %s", len(lines), strings.Join(lines, "\n  "))
+}
+
+// Unwrap returns the individual errors.
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// errorList accumulates field errors.
+type errorList struct {
+	errs Errors
+}
+
+func (l *errorList) add(path, hint, format string, args ...any) {
+	l.errs = append(l.errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...), Hint: hint})
+}
+
+// validated adds the problems found by a Validate method, whose paths are
+// relative to path.
+func (l *errorList) validated(path string, err error) {
+	var errs slim_bindings.ValidationErrors
+	if !errors.As(err, &errs) {
+		if err != nil {
+			l.add(path, "", "%v", err)
+		}
+		return
+	}
+	for _, e := range errs {
+		l.errs = append(l.errs, &FieldError{Path: join(path, e.Path), Message: e.Message, Hint: e.Hint})
+	}
+}
+
+// has reports whether a problem was already found at path.
+func (l *errorList) has(path string) bool {
+	for _, err := range l.errs {
+		if err.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// err returns the accumulated errors, or nil.
+func (l *errorList) err() error {
+	if len(l.errs) == 0 {
+		return nil
+	}
+	return l.errs
+}
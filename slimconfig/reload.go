@@ -0,0 +1,439 @@
+package slimconfig
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// DefaultReloadInterval is how often a Reloader checks its file for changes.
+const DefaultReloadInterval = 2 * time.Second
+
+// Action is what a reload did to a server or client.
+type Action int
+
+const (
+	// ActionAdded means the server was started or the client connected.
+	ActionAdded Action = iota
+	// ActionRemoved means the server was stopped or the client disconnected.
+	ActionRemoved
+	// ActionUpdated means the server was restarted or the client reconnected
+	// with its new settings.
+	ActionUpdated
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionAdded:
+		return "added"
+	case ActionRemoved:
+		return "removed"
+	case ActionUpdated:
+		return "updated"
+	default:
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+}
+
+// Change is a server or client a reload acted on.
+type Change struct {
+	// Path locates the server or client, such as
+	// "services[0].dataplane.clients[1]", in the file it was taken from.
+	Path     string
+	Endpoint string
+	Action   Action
+	// Err is the failure of the action, if any. A server or client whose
+	// change failed keeps its previous state where possible and is retried
+	// on the next reload.
+	Err error
+}
+
+// Event reports a reload.
+type Event struct {
+	// Config is the configuration in effect after the reload.
+	Config *Config
+	// Changes lists the servers and clients that were acted on.
+	Changes []Change
+	// Restart lists the paths of changed settings that only take effect on
+	// a restart, such as "tracing" or "services[0].node_id".
+	Restart []string
+	// Err is set when the file could not be loaded, in which case nothing
+	// was changed.
+	Err error
+}
+
+// WithReloadInterval sets how often a Reloader checks its file for changes.
+// Zero disables the checks, leaving signals and Reload.
+func WithReloadInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// WithReloadSignals sets the signals that make a Reloader reload its file.
+// The default is SIGHUP; no signals disables them.
+func WithReloadSignals(signals ...os.Signal) Option {
+	return func(o *options) {
+		o.signals = signals
+	}
+}
+
+// WithReloadHandler calls handler after every reload, including failed ones.
+// Calls are made one at a time.
+func WithReloadHandler(handler func(Event)) Option {
+	return func(o *options) {
+		o.onReload = handler
+	}
+}
+
+// Reloader applies changes of a configuration file to running services.
+//
+// On every reload it loads the file again and compares the dataplane of each
+// service with the one in effect. Servers and clients are matched by
+// endpoint: removed servers are stopped and removed clients disconnected,
+// new ones are started and connected, and changed ones are restarted and
+// reconnected. Apps, sessions and the connections a Reloader did not create
+// from the file, such as those of a slimconn.ConnectionManager, are left
+// alone. Runtime and tracing settings, node IDs and group names cannot change
+// on a running service; they are reported in Event.Restart.
+type Reloader struct {
+	path     string
+	opts     []Option
+	o        options
+	services []slim_bindings.ServiceInterface
+
+	// reloading serializes reloads; mu guards the fields below.
+	reloading sync.Mutex
+	mu        sync.Mutex
+	current   *Config
+	data      []byte
+	// unreadable is set when the last reload could not read the file.
+	unreadable bool
+	// conns holds the IDs of the connections of each service by endpoint.
+	conns []map[string]uint64
+}
+
+// NewReloader loads the file at path as the configuration services run with
+// now, as passed to InitializeWithConfigs. services[i] runs the i-th service
+// of the file; nil means the services of GetServices. opts apply to every
+// load of the file.
+func NewReloader(path string, services []slim_bindings.ServiceInterface, opts ...Option) (*Reloader, error) {
+	o := options{interval: DefaultReloadInterval, signals: []os.Signal{syscall.SIGHUP}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if services == nil {
+		for _, service := range slim_bindings.GetServices() {
+			services = append(services, service)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("slimconfig: %w", err)
+	}
+	current, err := load(path, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(current.Services) > len(services) {
+		return nil, fmt.Errorf("slimconfig: %s has %d services but %d are running", path, len(current.Services), len(services))
+	}
+	r := &Reloader{
+		path:     path,
+		opts:     opts,
+		o:        o,
+		services: services,
+		current:  current,
+		data:     data,
+		conns:    make([]map[string]uint64, len(services)),
+	}
+	for i := range r.conns {
+		r.conns[i] = make(map[string]uint64)
+	}
+	return r, nil
+}
+
+// Config returns the configuration in effect.
+func (r *Reloader) Config() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Run reloads the file when it changes or a reload signal arrives, until
+// ctx is done.
+func (r *Reloader) Run(ctx context.Context) error {
+	var signals chan os.Signal
+	if len(r.o.signals) > 0 {
+		signals = make(chan os.Signal, 1)
+		signal.Notify(signals, r.o.signals...)
+		defer signal.Stop(signals)
+	}
+	var tick <-chan time.Time
+	if r.o.interval > 0 {
+		ticker := time.NewTicker(r.o.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-signals:
+			_, _ = r.Reload()
+		case <-tick:
+			if r.changed() {
+				_, _ = r.Reload()
+			}
+		}
+	}
+}
+
+// changed reports whether the content of the file differs from the last one
+// loaded. A file that can no longer be read counts as changed, so that the
+// failure is reported once.
+func (r *Reloader) changed() bool {
+	data, err := os.ReadFile(r.path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		return !r.unreadable
+	}
+	return r.unreadable || !bytes.Equal(data, r.data)
+}
+
+// Reload loads the file and applies the changes. The error is the load
+// failure, or the failures of the changes joined.
+func (r *Reloader) Reload() (Event, error) {
+	r.reloading.Lock()
+	defer r.reloading.Unlock()
+
+	r.mu.Lock()
+	event, err := r.reload()
+	r.mu.Unlock()
+	if r.o.onReload != nil {
+		r.o.onReload(event)
+	}
+	return event, err
+}
+
+func (r *Reloader) reload() (Event, error) {
+	data, err := os.ReadFile(r.path)
+	r.unreadable = err != nil
+	if err != nil {
+		err = fmt.Errorf("slimconfig: %w", err)
+		return Event{Config: r.current, Err: err}, err
+	}
+	// Mark the content as seen even if it fails, so that a broken file is
+	// reported once rather than on every check.
+	r.data = data
+	next, err := load(r.path, data, r.opts)
+	if err == nil {
+		err = checkEndpoints(next)
+	}
+	if err != nil {
+		return Event{Config: r.current, Err: err}, err
+	}
+
+	applied := &Config{Runtime: r.current.Runtime, Tracing: r.current.Tracing}
+	var event Event
+	if !reflect.DeepEqual(next.Runtime, r.current.Runtime) {
+		event.Restart = append(event.Restart, "runtime")
+	}
+	if !reflect.DeepEqual(next.Tracing, r.current.Tracing) {
+		event.Restart = append(event.Restart, "tracing")
+	}
+	for i := range max(len(next.Services), len(r.current.Services)) {
+		path := index("services", i)
+		switch {
+		case i >= len(r.current.Services) || i >= len(r.services):
+			event.Restart = append(event.Restart, path)
+			continue
+		case i >= len(next.Services):
+			event.Restart = append(event.Restart, path)
+			applied.Services = append(applied.Services, r.current.Services[i])
+			continue
+		}
+		current, wanted := r.current.Services[i], next.Services[i]
+		if !reflect.DeepEqual(current.NodeId, wanted.NodeId) {
+			event.Restart = append(event.Restart, join(path, "node_id"))
+		}
+		if !reflect.DeepEqual(current.GroupName, wanted.GroupName) {
+			event.Restart = append(event.Restart, join(path, "group_name"))
+		}
+		service := current
+		service.Dataplane = r.apply(&event, i, current.Dataplane, wanted.Dataplane)
+		applied.Services = append(applied.Services, service)
+	}
+	r.current = applied
+	event.Config = applied
+
+	var errs []error
+	for _, change := range event.Changes {
+		if change.Err != nil {
+			errs = append(errs, fmt.Errorf("slimconfig: %s %s: %w", change.Path, change.Action, change.Err))
+		}
+	}
+	return event, errors.Join(errs...)
+}
+
+// apply changes the dataplane of the i-th service from current to wanted
+// and returns the dataplane in effect.
+func (r *Reloader) apply(event *Event, i int, current, wanted slim_bindings.DataplaneConfig) slim_bindings.DataplaneConfig {
+	service := r.services[i]
+	path := join(index("services", i), "dataplane")
+	var applied slim_bindings.DataplaneConfig
+
+	servers := make(map[string]int, len(wanted.Servers))
+	for j, server := range wanted.Servers {
+		servers[server.Endpoint] = j
+	}
+	for j, server := range current.Servers {
+		change := Change{Path: index(join(path, "servers"), j), Endpoint: server.Endpoint}
+		k, ok := servers[server.Endpoint]
+		if ok && reflect.DeepEqual(server, wanted.Servers[k]) {
+			applied.Servers = append(applied.Servers, server)
+			continue
+		}
+		change.Action = ActionRemoved
+		if ok {
+			change.Action = ActionUpdated
+			change.Path = index(join(path, "servers"), k)
+		}
+		if change.Err = service.StopServer(server.Endpoint); change.Err != nil {
+			// Still running with its previous settings.
+			applied.Servers = append(applied.Servers, server)
+		} else if ok {
+			if change.Err = service.RunServer(wanted.Servers[k]); change.Err == nil {
+				applied.Servers = append(applied.Servers, wanted.Servers[k])
+			}
+		}
+		event.Changes = append(event.Changes, change)
+	}
+	for k, server := range wanted.Servers {
+		if slices.Contains(serverEndpoints(current.Servers), server.Endpoint) {
+			continue
+		}
+		change := Change{Path: index(join(path, "servers"), k), Endpoint: server.Endpoint, Action: ActionAdded}
+		if change.Err = service.RunServer(server); change.Err == nil {
+			applied.Servers = append(applied.Servers, server)
+		}
+		event.Changes = append(event.Changes, change)
+	}
+
+	clients := make(map[string]int, len(wanted.Clients))
+	for j, client := range wanted.Clients {
+		clients[client.Endpoint] = j
+	}
+	for j, client := range current.Clients {
+		change := Change{Path: index(join(path, "clients"), j), Endpoint: client.Endpoint}
+		k, ok := clients[client.Endpoint]
+		if ok && reflect.DeepEqual(client, wanted.Clients[k]) {
+			applied.Clients = append(applied.Clients, client)
+			continue
+		}
+		change.Action = ActionRemoved
+		if ok {
+			change.Action = ActionUpdated
+			change.Path = index(join(path, "clients"), k)
+		}
+		if change.Err = r.disconnect(i, client.Endpoint); change.Err != nil {
+			applied.Clients = append(applied.Clients, client)
+		} else if ok {
+			if change.Err = r.connect(i, wanted.Clients[k]); change.Err == nil {
+				applied.Clients = append(applied.Clients, wanted.Clients[k])
+			}
+		}
+		event.Changes = append(event.Changes, change)
+	}
+	for k, client := range wanted.Clients {
+		if slices.Contains(clientEndpoints(current.Clients), client.Endpoint) {
+			continue
+		}
+		change := Change{Path: index(join(path, "clients"), k), Endpoint: client.Endpoint, Action: ActionAdded}
+		if change.Err = r.connect(i, client); change.Err == nil {
+			applied.Clients = append(applied.Clients, client)
+		}
+		event.Changes = append(event.Changes, change)
+	}
+	return applied
+}
+
+func (r *Reloader) connect(i int, config slim_bindings.ClientConfig) error {
+	connId, err := r.services[i].Connect(config)
+	if err != nil {
+		return err
+	}
+	r.conns[i][config.Endpoint] = connId
+	return nil
+}
+
+// disconnect closes the connection to endpoint: the one the Reloader made,
+// or else the one the service made at initialization. A connection that is
+// already gone is not an error.
+func (r *Reloader) disconnect(i int, endpoint string) error {
+	connId, ok := r.conns[i][endpoint]
+	if !ok {
+		id := r.services[i].GetConnectionId(endpoint)
+		if id == nil {
+			return nil
+		}
+		connId = *id
+	}
+	if err := r.services[i].Disconnect(connId); err != nil {
+		return err
+	}
+	delete(r.conns[i], endpoint)
+	return nil
+}
+
+func serverEndpoints(servers []slim_bindings.ServerConfig) []string {
+	endpoints := make([]string, len(servers))
+	for i, server := range servers {
+		endpoints[i] = server.Endpoint
+	}
+	return endpoints
+}
+
+func clientEndpoints(clients []slim_bindings.ClientConfig) []string {
+	endpoints := make([]string, len(clients))
+	for i, client := range clients {
+		endpoints[i] = client.Endpoint
+	}
+	return endpoints
+}
+
+// checkEndpoints reports servers and clients of a service that share an
+// endpoint, which a reload could not tell apart.
+func checkEndpoints(config *Config) error {
+	var errs errorList
+	for i, service := range config.Services {
+		path := join(index("services", i), "dataplane")
+		duplicates(&errs, join(path, "servers"), serverEndpoints(service.Dataplane.Servers))
+		duplicates(&errs, join(path, "clients"), clientEndpoints(service.Dataplane.Clients))
+	}
+	return errs.err()
+}
+
+func duplicates(errs *errorList, path string, endpoints []string) {
+	seen := make(map[string]int, len(endpoints))
+	for i, endpoint := range endpoints {
+		if first, ok := seen[endpoint]; ok {
+			errs.add(join(index(path, i), "endpoint"), "", "endpoint %s is also used by %s", endpoint, index(path, first))
+			continue
+		}
+		seen[endpoint] = i
+	}
+}
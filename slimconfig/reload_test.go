@@ -0,0 +1,264 @@
+package slimconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// fakeService records the dataplane calls of a Reloader.
+type fakeService struct {
+	slim_bindings.ServiceInterface
+
+	mu    sync.Mutex
+	calls []string
+	next  uint64
+	conns map[string]uint64
+	fail  map[string]bool
+}
+
+func newFakeService(endpoints ...string) *fakeService {
+	f := &fakeService{conns: make(map[string]uint64), fail: make(map[string]bool)}
+	for _, endpoint := range endpoints {
+		f.next++
+		f.conns[endpoint] = f.next
+	}
+	return f
+}
+
+func (f *fakeService) record(call string) error {
+	f.calls = append(f.calls, call)
+	if f.fail[call] {
+		return errors.New("refused")
+	}
+	return nil
+}
+
+func (f *fakeService) RunServer(config slim_bindings.ServerConfig) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.record("run " + config.Endpoint)
+}
+
+func (f *fakeService) StopServer(endpoint string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.record("stop " + endpoint)
+}
+
+func (f *fakeService) Connect(config slim_bindings.ClientConfig) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("connect " + config.Endpoint); err != nil {
+		return 0, err
+	}
+	f.next++
+	f.conns[config.Endpoint] = f.next
+	return f.next, nil
+}
+
+func (f *fakeService) Disconnect(connId uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for endpoint, id := range f.conns {
+		if id == connId {
+			delete(f.conns, endpoint)
+		}
+	}
+	return f.record(fmt.Sprintf("disconnect %d", connId))
+}
+
+func (f *fakeService) GetConnectionId(endpoint string) *uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	connId, ok := f.conns[endpoint]
+	if !ok {
+		return nil
+	}
+	return &connId
+}
+
+func (f *fakeService) takeCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+func dataplane(logLevel string, servers []string, clients []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "tracing: {log_level: %s}\nservices:\n  - dataplane:\n      servers:\n", logLevel)
+	for _, server := range servers {
+		fmt.Fprintf(&b, "        - {endpoint: %q, tls: {insecure: true}}\n", server)
+	}
+	b.WriteString("      clients:\n")
+	for _, client := range clients {
+		fmt.Fprintf(&b, "        - {endpoint: %q, tls: {insecure: true}}\n", client)
+	}
+	return b.String()
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slim.yaml")
+	writeFile(t, path, dataplane("info", []string{"0.0.0.0:1000"}, []string{"http://x:1", "http://y:1"}))
+	service := newFakeService("http://x:1", "http://y:1")
+	reloader, err := NewReloader(path, []slim_bindings.ServiceInterface{service}, defaults(), WithEnv(nil))
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+
+	// Change the server on :1000, add one on :2000, drop x and add z.
+	writeFile(t, path, strings.Replace(
+		dataplane("debug", []string{"0.0.0.0:1000", "0.0.0.0:2000"}, []string{"http://y:1", "http://z:1"}),
+		`{endpoint: "0.0.0.0:1000", tls: {insecure: true}}`,
+		`{endpoint: "0.0.0.0:1000", tls: {insecure: true}, metadata: "{}"}`, 1))
+
+	event, err := reloader.Reload()
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	want := []string{"stop 0.0.0.0:1000", "run 0.0.0.0:1000", "run 0.0.0.0:2000", "disconnect 1", "connect http://z:1"}
+	if calls := service.takeCalls(); !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	var changes []string
+	for _, change := range event.Changes {
+		changes = append(changes, fmt.Sprintf("%s %s %s", change.Path, change.Endpoint, change.Action))
+	}
+	wantChanges := []string{
+		"services[0].dataplane.servers[0] 0.0.0.0:1000 updated",
+		"services[0].dataplane.servers[1] 0.0.0.0:2000 added",
+		"services[0].dataplane.clients[0] http://x:1 removed",
+		"services[0].dataplane.clients[1] http://z:1 added",
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("changes = %q, want %q", changes, wantChanges)
+	}
+	if !reflect.DeepEqual(event.Restart, []string{"tracing"}) {
+		t.Errorf("Restart = %q", event.Restart)
+	}
+	if config := reloader.Config(); config.Tracing.LogLevel != "info" || len(config.Services[0].Dataplane.Clients) != 2 {
+		t.Errorf("Config = %+v", config)
+	}
+
+	// Nothing changed: nothing to do.
+	if event, err := reloader.Reload(); err != nil || len(event.Changes) != 0 {
+		t.Errorf("Reload = %+v, %v", event, err)
+	}
+	if calls := service.takeCalls(); len(calls) != 0 {
+		t.Errorf("calls = %q", calls)
+	}
+}
+
+func TestReloadFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slim.yaml")
+	writeFile(t, path, dataplane("info", nil, []string{"http://x:1"}))
+	service := newFakeService("http://x:1")
+	var events []Event
+	reloader, err := NewReloader(path, []slim_bindings.ServiceInterface{service}, defaults(), WithEnv(nil),
+		WithReloadHandler(func(event Event) { events = append(events, event) }))
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+
+	// A file that does not load changes nothing.
+	writeFile(t, path, "services: [{dataplane: {clients: [{endpoint: 5s, rate_limit: 100/week}]}}]")
+	if _, err := reloader.Reload(); err == nil {
+		t.Fatal("Reload of an invalid file succeeded")
+	}
+	writeFile(t, path, dataplane("info", []string{"0.0.0.0:1000", "0.0.0.0:1000"}, nil))
+	if _, err := reloader.Reload(); err == nil || !strings.Contains(err.Error(), "also used by") {
+		t.Fatalf("Reload error = %v, want duplicate endpoint", err)
+	}
+	if calls := service.takeCalls(); len(calls) != 0 {
+		t.Errorf("calls = %q", calls)
+	}
+
+	// A failed change is retried on the next reload.
+	service.fail["run 0.0.0.0:1000"] = true
+	writeFile(t, path, dataplane("info", []string{"0.0.0.0:1000"}, []string{"http://x:1"}))
+	event, err := reloader.Reload()
+	if err == nil || event.Changes[0].Err == nil {
+		t.Fatalf("Reload = %+v, %v, want the server failure", event, err)
+	}
+	if servers := reloader.Config().Services[0].Dataplane.Servers; len(servers) != 0 {
+		t.Errorf("servers = %+v, want none", servers)
+	}
+	delete(service.fail, "run 0.0.0.0:1000")
+	if _, err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	want := []string{"run 0.0.0.0:1000", "run 0.0.0.0:1000"}
+	if calls := service.takeCalls(); !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+
+	if len(events) != 4 || events[0].Err == nil || events[3].Err != nil {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestReloaderRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slim.yaml")
+	writeFile(t, path, dataplane("info", nil, nil))
+	service := newFakeService()
+	events := make(chan Event, 4)
+	reloader, err := NewReloader(path, []slim_bindings.ServiceInterface{service}, defaults(), WithEnv(nil),
+		WithReloadInterval(10*time.Millisecond), WithReloadSignals(),
+		WithReloadHandler(func(event Event) { events <- event }))
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- reloader.Run(ctx) }()
+
+	writeFile(t, path, dataplane("info", nil, []string{"http://x:1"}))
+	select {
+	case event := <-events:
+		if len(event.Changes) != 1 || event.Changes[0].Action != ActionAdded {
+			t.Errorf("event = %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after the file changed")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		if event.Err == nil {
+			t.Errorf("event = %+v, want the read failure", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after the file was removed")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(events) != 0 {
+		t.Errorf("read failure reported %d more times", len(events))
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package slimconfig
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// The generated configuration types carry no tags, so the file format is
+// derived from them: struct fields become snake_case keys, enums are written
+// by name and enum variants with data are single-key maps naming the variant.
+
+// enums maps the generated integer enums to their names in files.
+var enums = map[reflect.Type]map[string]uint64{
+	reflect.TypeFor[slim_bindings.TransportProtocol](): {
+		"grpc":      uint64(slim_bindings.TransportProtocolGrpc),
+		"websocket": uint64(slim_bindings.TransportProtocolWebsocket),
+	},
+	reflect.TypeFor[slim_bindings.CompressionType](): {
+		"gzip":    uint64(slim_bindings.CompressionTypeGzip),
+		"zlib":    uint64(slim_bindings.CompressionTypeZlib),
+		"deflate": uint64(slim_bindings.CompressionTypeDeflate),
+		"snappy":  uint64(slim_bindings.CompressionTypeSnappy),
+		"zstd":    uint64(slim_bindings.CompressionTypeZstd),
+		"lz4":     uint64(slim_bindings.CompressionTypeLz4),
+		"none":    uint64(slim_bindings.CompressionTypeNone),
+		"empty":   uint64(slim_bindings.CompressionTypeEmpty),
+	},
+	reflect.TypeFor[slim_bindings.JwtAlgorithm](): {
+		"hs256": uint64(slim_bindings.JwtAlgorithmHs256),
+		"hs384": uint64(slim_bindings.JwtAlgorithmHs384),
+		"hs512": uint64(slim_bindings.JwtAlgorithmHs512),
+		"es256": uint64(slim_bindings.JwtAlgorithmEs256),
+		"es384": uint64(slim_bindings.JwtAlgorithmEs384),
+		"rs256": uint64(slim_bindings.JwtAlgorithmRs256),
+		"rs384": uint64(slim_bindings.JwtAlgorithmRs384),
+		"rs512": uint64(slim_bindings.JwtAlgorithmRs512),
+		"ps256": uint64(slim_bindings.JwtAlgorithmPs256),
+		"ps384": uint64(slim_bindings.JwtAlgorithmPs384),
+		"ps512": uint64(slim_bindings.JwtAlgorithmPs512),
+		"eddsa": uint64(slim_bindings.JwtAlgorithmEdDsa),
+	},
+	reflect.TypeFor[slim_bindings.JwtKeyFormat](): {
+		"pem":  uint64(slim_bindings.JwtKeyFormatPem),
+		"jwk":  uint64(slim_bindings.JwtKeyFormatJwk),
+		"jwks": uint64(slim_bindings.JwtKeyFormatJwks),
+	},
+}
+
+// variants lists the variants of the generated enums with data. A variant is
+// named after its type without the enum prefix, in snake_case.
+var variants = map[reflect.Type][]reflect.Type{
+	reflect.TypeFor[slim_bindings.TlsSource](): {
+		reflect.TypeFor[slim_bindings.TlsSourcePem](),
+		reflect.TypeFor[slim_bindings.TlsSourceFile](),
+		reflect.TypeFor[slim_bindings.TlsSourceSpire](),
+		reflect.TypeFor[slim_bindings.TlsSourceNone](),
+	},
+	reflect.TypeFor[slim_bindings.CaSource](): {
+		reflect.TypeFor[slim_bindings.CaSourceFile](),
+		reflect.TypeFor[slim_bindings.CaSourcePem](),
+		reflect.TypeFor[slim_bindings.CaSourceSpire](),
+		reflect.TypeFor[slim_bindings.CaSourceNone](),
+	},
+	reflect.TypeFor[slim_bindings.ClientAuthenticationConfig](): {
+		reflect.TypeFor[slim_bindings.ClientAuthenticationConfigBasic](),
+		reflect.TypeFor[slim_bindings.ClientAuthenticationConfigStaticJwt](),
+		reflect.TypeFor[slim_bindings.ClientAuthenticationConfigJwt](),
+		reflect.TypeFor[slim_bindings.ClientAuthenticationConfigSpire](),
+		reflect.TypeFor[slim_bindings.ClientAuthenticationConfigNone](),
+	},
+	reflect.TypeFor[slim_bindings.ServerAuthenticationConfig](): {
+		reflect.TypeFor[slim_bindings.ServerAuthenticationConfigBasic](),
+		reflect.TypeFor[slim_bindings.ServerAuthenticationConfigJwt](),
+		reflect.TypeFor[slim_bindings.ServerAuthenticationConfigSpire](),
+		reflect.TypeFor[slim_bindings.ServerAuthenticationConfigNone](),
+	},
+	reflect.TypeFor[slim_bindings.JwtKeyType](): {
+		reflect.TypeFor[slim_bindings.JwtKeyTypeEncoding](),
+		reflect.TypeFor[slim_bindings.JwtKeyTypeDecoding](),
+		reflect.TypeFor[slim_bindings.JwtKeyTypeAutoresolve](),
+	},
+	reflect.TypeFor[slim_bindings.JwtKeyData](): {
+		reflect.TypeFor[slim_bindings.JwtKeyDataData](),
+		reflect.TypeFor[slim_bindings.JwtKeyDataFile](),
+	},
+	reflect.TypeFor[slim_bindings.BackoffConfig](): {
+		reflect.TypeFor[slim_bindings.BackoffConfigExponential](),
+		reflect.TypeFor[slim_bindings.BackoffConfigFixedInterval](),
+	},
+}
+
+// initial returns the starting value of new list entries and optional
+// settings whose zero value differs from the documented defaults.
+var initial = map[reflect.Type]func() any{
+	reflect.TypeFor[slim_bindings.ClientConfig](): func() any {
+		return slim_bindings.ClientConfig{
+			Tls: slim_bindings.TlsClientConfig{
+				IncludeSystemCaCertsPool: true,
+				TlsVersion:               "tls1.3",
+			},
+		}
+	},
+	reflect.TypeFor[slim_bindings.ProxyConfig](): func() any {
+		return slim_bindings.ProxyConfig{
+			Tls: slim_bindings.TlsClientConfig{
+				IncludeSystemCaCertsPool: true,
+				TlsVersion:               "tls1.3",
+			},
+		}
+	},
+}
+
+// variant returns the variant type of enum called name.
+func variant(enum reflect.Type, name string) (reflect.Type, bool) {
+	for _, t := range variants[enum] {
+		if variantName(enum, t) == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func variantName(enum, t reflect.Type) string {
+	return snake(strings.TrimPrefix(t.Name(), enum.Name()))
+}
+
+func variantNames(enum reflect.Type) []string {
+	names := make([]string, 0, len(variants[enum]))
+	for _, t := range variants[enum] {
+		names = append(names, variantName(enum, t))
+	}
+	return names
+}
+
+func enumNames(t reflect.Type) []string {
+	names := make([]string, 0, len(enums[t]))
+	for name := range enums[t] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unwrapped reports whether a variant holds a single field, such as Config or
+// Path, whose value is written directly under the variant name.
+func unwrapped(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.NumField() == 1
+}
+
+// snake converts a Go field name to its key: NCores becomes n_cores and
+// Http2Only http2_only.
+func snake(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// field returns the struct field of t with the given key.
+func field(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.IsExported() && snake(f.Name) == key {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
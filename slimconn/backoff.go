@@ -0,0 +1,66 @@
+package slimconn
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// DefaultBackoff returns the backoff used when neither WithBackoff nor the
+// ClientConfig sets one: exponential from 100ms, doubling up to 10s, with
+// jitter and no limit on the number of attempts.
+func DefaultBackoff() slim_bindings.BackoffConfig {
+	return slim_bindings.BackoffConfigExponential{Config: slim_bindings.ExponentialBackoff{
+		Base:     100 * time.Millisecond,
+		Factor:   2,
+		MaxDelay: 10 * time.Second,
+		Jitter:   true,
+	}}
+}
+
+// backoffDelay returns how long to wait before retry attempt n, counting
+// from 1, and false once config allows no more attempts. A MaxAttempts of 0
+// retries forever.
+func backoffDelay(config slim_bindings.BackoffConfig, n int) (time.Duration, bool) {
+	switch config := config.(type) {
+	case slim_bindings.BackoffConfigFixedInterval:
+		if exhausted(config.Config.MaxAttempts, n) {
+			return 0, false
+		}
+		return config.Config.Interval, true
+
+	case slim_bindings.BackoffConfigExponential:
+		c := config.Config
+		if exhausted(c.MaxAttempts, n) {
+			return 0, false
+		}
+		limit := c.MaxDelay
+		if limit <= 0 {
+			limit = math.MaxInt64
+		}
+		factor := time.Duration(max(c.Factor, 1))
+		delay := min(c.Base, limit)
+		for i := 1; i < n && delay < limit; i++ {
+			if delay > limit/factor {
+				delay = limit
+				break
+			}
+			delay *= factor
+		}
+		if c.Jitter && delay > 0 {
+			// Spread retries over [delay/2, delay] so that clients cut off
+			// together do not reconnect together.
+			delay = delay/2 + rand.N(delay/2+1)
+		}
+		return delay, true
+
+	default:
+		return backoffDelay(DefaultBackoff(), n)
+	}
+}
+
+func exhausted(maxAttempts uint64, n int) bool {
+	return maxAttempts > 0 && uint64(n) > maxAttempts
+}
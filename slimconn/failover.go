@@ -0,0 +1,155 @@
+package slimconn
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// ErrNoEndpoints is returned by NewFailoverGroup when given no configs.
+var ErrNoEndpoints = errors.New("slimconn: failover group has no endpoints")
+
+// WithRandomOrder makes a failover group try its endpoints in random order
+// instead of in the order given.
+func WithRandomOrder() Option {
+	return func(o *options) {
+		o.randomOrder = true
+	}
+}
+
+// WithWarmStandby makes a failover group keep a second connection open to
+// the next endpoint, so that failing over does not wait for a connect.
+func WithWarmStandby() Option {
+	return func(o *options) {
+		o.warmStandby = true
+	}
+}
+
+// standby is an open connection that is not used yet.
+type standby struct {
+	index  int
+	connId uint64
+}
+
+// NewFailoverGroup connects service to the first reachable endpoint among
+// configs and returns a ConnectionManager for it. When the connection fails,
+// the manager moves to the next endpoint, wrapping around, and carries its
+// subscriptions and routes over. Endpoints are tried in the order given,
+// highest priority first, unless WithRandomOrder is set.
+//
+// The backoff applies between passes over the whole list and is taken from
+// the first config unless WithBackoff is set.
+func NewFailoverGroup(ctx context.Context, service slim_bindings.ServiceInterface, configs []slim_bindings.ClientConfig, opts ...Option) (*ConnectionManager, error) {
+	if len(configs) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	configs = append([]slim_bindings.ClientConfig(nil), configs...)
+	return newConnectionManager(ctx, service, configs, newOptions(configs[0], opts))
+}
+
+// order returns the indexes of the endpoints to try, in order. The standby
+// comes first, and the endpoint that failed last.
+func (m *ConnectionManager) order() []int {
+	m.mu.Lock()
+	active, standby := m.active, m.standby
+	m.mu.Unlock()
+
+	n := len(m.configs)
+	order := make([]int, 0, n)
+	if standby != nil {
+		order = append(order, standby.index)
+	}
+	for k := 1; k <= n; k++ {
+		i := (active + k) % n
+		if i != active && (standby == nil || i != standby.index) {
+			order = append(order, i)
+		}
+	}
+	if m.opts.randomOrder {
+		rest := order
+		if standby != nil {
+			rest = order[1:]
+		}
+		rand.Shuffle(len(rest), func(a, b int) { rest[a], rest[b] = rest[b], rest[a] })
+	}
+	if active >= 0 && (standby == nil || active != standby.index) {
+		order = append(order, active)
+	}
+	return order
+}
+
+// open connects to configs[i], using the standby if it is the one.
+func (m *ConnectionManager) open(i int) (uint64, error) {
+	m.mu.Lock()
+	if sb := m.standby; sb != nil && sb.index == i {
+		m.standby = nil
+		m.mu.Unlock()
+		if m.alive(m.configs[i].Endpoint, sb.connId) {
+			return sb.connId, nil
+		}
+		_ = m.service.Disconnect(sb.connId)
+	} else {
+		m.mu.Unlock()
+	}
+	return m.dialConfig(i)
+}
+
+// maintainStandby replaces a failed standby connection and opens one if
+// there is none.
+func (m *ConnectionManager) maintainStandby() {
+	if !m.opts.warmStandby || len(m.configs) < 2 {
+		return
+	}
+	m.mu.Lock()
+	sb := m.standby
+	m.mu.Unlock()
+	if sb != nil {
+		if m.alive(m.configs[sb.index].Endpoint, sb.connId) {
+			return
+		}
+		m.dropStandby()
+	}
+
+	for _, i := range m.order() {
+		m.mu.Lock()
+		active := m.active
+		m.mu.Unlock()
+		if i == active {
+			continue
+		}
+		if m.ctx.Err() != nil {
+			return
+		}
+		connId, err := m.dialConfig(i)
+		if err != nil {
+			continue
+		}
+		m.mu.Lock()
+		m.standby = &standby{index: i, connId: connId}
+		m.mu.Unlock()
+		return
+	}
+}
+
+// dropStandby closes the standby connection, if any.
+func (m *ConnectionManager) dropStandby() {
+	m.mu.Lock()
+	sb := m.standby
+	m.standby = nil
+	m.mu.Unlock()
+	if sb != nil {
+		_ = m.service.Disconnect(sb.connId)
+	}
+}
+
+// endpoints lists the endpoints for error messages.
+func (m *ConnectionManager) endpoints() string {
+	endpoints := make([]string, len(m.configs))
+	for i, config := range m.configs {
+		endpoints[i] = config.Endpoint
+	}
+	return strings.Join(endpoints, ", ")
+}
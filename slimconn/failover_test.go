@@ -0,0 +1,111 @@
+package slimconn
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+func group(endpoints ...string) []slim_bindings.ClientConfig {
+	configs := make([]slim_bindings.ClientConfig, len(endpoints))
+	for i, endpoint := range endpoints {
+		configs[i] = slim_bindings.ClientConfig{Endpoint: endpoint}
+	}
+	return configs
+}
+
+func TestFailoverMovesBindingsToNextEndpoint(t *testing.T) {
+	service := newFakeService()
+	service.stop("a")
+	e := newEvents()
+	m, err := newConnectionManager(context.Background(), service, group("a", "b", "c"), testOptions(e))
+	if err != nil {
+		t.Fatalf("newConnectionManager: %v", err)
+	}
+	defer m.Close()
+	if ready := e.waitFor(t, StateReady); ready.Endpoint != "b" {
+		t.Fatalf("connected to %q, want b (a is down)", ready.Endpoint)
+	}
+
+	app := newFakeApp()
+	name := &slim_bindings.Name{}
+	if err := m.Subscribe(app, name); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	service.stop("b")
+	ready := e.waitFor(t, StateReady)
+	if ready.Endpoint != "c" || !ready.Reconnected {
+		t.Fatalf("failover event = %+v, want ready on c", ready)
+	}
+	if m.Endpoint() != "c" {
+		t.Errorf("Endpoint() = %q, want c", m.Endpoint())
+	}
+	if sub, _ := app.bound(name); sub != ready.ConnectionId {
+		t.Errorf("subscription on connection %d, want %d", sub, ready.ConnectionId)
+	}
+}
+
+func TestWarmStandbyFailsOverWithoutConnecting(t *testing.T) {
+	service := newFakeService()
+	e := newEvents()
+	o := testOptions(e)
+	o.warmStandby = true
+	m, err := newConnectionManager(context.Background(), service, group("a", "b"), o)
+	if err != nil {
+		t.Fatalf("newConnectionManager: %v", err)
+	}
+	defer m.Close()
+	e.waitFor(t, StateReady)
+
+	deadline := time.Now().Add(time.Second)
+	for service.GetConnectionId("b") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no standby connection to b")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	standbyId := *service.GetConnectionId("b")
+
+	service.stop("a")
+	ready := e.waitFor(t, StateReady)
+	if ready.Endpoint != "b" || ready.ConnectionId != standbyId {
+		t.Fatalf("failover event = %+v, want the standby %d on b", ready, standbyId)
+	}
+	if n := service.connectCount("b"); n != 1 {
+		t.Errorf("connects to b = %d, want only the standby", n)
+	}
+}
+
+func TestFailoverOrder(t *testing.T) {
+	m := &ConnectionManager{configs: group("a", "b", "c", "d"), active: -1}
+	if got := m.order(); !slices.Equal(got, []int{0, 1, 2, 3}) {
+		t.Errorf("initial order = %v, want priority order", got)
+	}
+
+	m.active = 1
+	if got := m.order(); !slices.Equal(got, []int{2, 3, 0, 1}) {
+		t.Errorf("order after 1 failed = %v, want the next endpoints first", got)
+	}
+
+	m.standby = &standby{index: 0}
+	if got := m.order(); !slices.Equal(got, []int{0, 2, 3, 1}) {
+		t.Errorf("order with standby = %v, want the standby first", got)
+	}
+
+	m.opts.randomOrder = true
+	got := m.order()
+	if got[0] != 0 || got[3] != 1 || !slices.Equal(slices.Sorted(slices.Values(got)), []int{0, 1, 2, 3}) {
+		t.Errorf("random order = %v, want standby first, failed last", got)
+	}
+}
+
+func TestFailoverGroupNeedsEndpoints(t *testing.T) {
+	if _, err := NewFailoverGroup(context.Background(), newFakeService(), nil); !errors.Is(err, ErrNoEndpoints) {
+		t.Errorf("error = %v, want ErrNoEndpoints", err)
+	}
+}
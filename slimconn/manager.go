@@ -0,0 +1,553 @@
+// Package slimconn keeps slim_bindings connections alive.
+//
+// Service.Connect returns a bare connection ID, and nothing reports when
+// that connection fails. A ConnectionManager owns the connection instead: it
+// watches it, reconnects with backoff when it fails, re-applies the
+// subscriptions and routes registered through it on the new connection ID,
+// and reports every state change. A failover group spreads the same logical
+// connection over several nodes.
+package slimconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+	"github.com/agntcy/slim-bindings-go/slimsession"
+)
+
+// DefaultHealthCheckInterval is how often the connection is checked.
+const DefaultHealthCheckInterval = time.Second
+
+// ErrConnectionLost is the cause reported when a health check finds the
+// connection gone.
+var ErrConnectionLost = errors.New("slimconn: connection lost")
+
+var _ io.Closer = (*ConnectionManager)(nil)
+
+// State is the state of a managed connection.
+type State int
+
+const (
+	// StateConnecting means a connection attempt is in progress.
+	StateConnecting State = iota
+	// StateReady means the connection is up and subscriptions and routes
+	// are applied to it.
+	StateReady
+	// StateTransientFailure means the connection failed and the manager is
+	// waiting to retry.
+	StateTransientFailure
+	// StateClosed means the manager was closed or gave up reconnecting.
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateReady:
+		return "ready"
+	case StateTransientFailure:
+		return "transient failure"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Event reports a state change of a managed connection.
+type Event struct {
+	From, To State
+	// ConnectionId is the current connection ID. It is only meaningful when
+	// To is StateReady.
+	ConnectionId uint64
+	// PreviousConnectionId is the ID of the connection that was replaced,
+	// when To is StateReady after a reconnect. Servers and channels created
+	// with that ID must be recreated with ConnectionId.
+	PreviousConnectionId uint64
+	// Reconnected is true when the connection replaces one that failed.
+	Reconnected bool
+	// Endpoint is the endpoint of the connection in ConnectionId.
+	Endpoint string
+	// Attempt counts the connection attempts since the last ready state.
+	Attempt int
+	// Err is the failure that caused the change, if any.
+	Err error
+}
+
+// Option configures a ConnectionManager.
+type Option func(*options)
+
+type options struct {
+	backoff             slim_bindings.BackoffConfig
+	healthCheckInterval time.Duration
+	onStateChange       func(Event)
+	randomOrder         bool
+	warmStandby         bool
+	// nameKey identifies a subscribed or routed name.
+	nameKey func(*slim_bindings.Name) string
+}
+
+// WithBackoff sets the reconnection backoff, overriding the Backoff field of
+// the ClientConfig. A MaxAttempts of 0 retries forever.
+func WithBackoff(backoff slim_bindings.BackoffConfig) Option {
+	return func(o *options) {
+		o.backoff = backoff
+	}
+}
+
+// WithHealthCheckInterval sets how often the connection is checked.
+func WithHealthCheckInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.healthCheckInterval = d
+	}
+}
+
+// WithStateHandler calls handler for every state change. Calls are made one
+// at a time from the goroutine that changed the state, so handler should
+// return quickly.
+func WithStateHandler(handler func(Event)) Option {
+	return func(o *options) {
+		o.onStateChange = handler
+	}
+}
+
+// binding is a subscription or route to re-apply after a reconnect.
+type binding struct {
+	app  slim_bindings.AppInterface
+	name *slim_bindings.Name
+}
+
+type bindingKey struct {
+	app  slim_bindings.AppInterface
+	name string
+}
+
+// connector is implemented by *slim_bindings.Service. Services that lack it
+// connect without cancellation.
+type connector interface {
+	ConnectContext(ctx context.Context, config slim_bindings.ClientConfig) (uint64, error)
+}
+
+// failure is a failure reported for a given connection ID.
+type failure struct {
+	connId uint64
+	err    error
+}
+
+// ConnectionManager owns a connection to a SLIM node and keeps it up.
+//
+// Register subscriptions and routes through the manager rather than on the
+// App directly, so that they follow the connection when it is replaced.
+type ConnectionManager struct {
+	service slim_bindings.ServiceInterface
+	configs []slim_bindings.ClientConfig
+	opts    options
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	failed  chan failure
+	done    chan struct{}
+	handler sync.Mutex
+
+	// bindMu guards subscriptions and routes, and is held while they are
+	// applied, so that the native calls never run under mu.
+	bindMu        sync.Mutex
+	subscriptions map[bindingKey]binding
+	routes        map[bindingKey]binding
+
+	mu        sync.Mutex
+	state     State
+	connId    uint64
+	connected bool
+	// active is the index in configs of the current connection, or of the
+	// last one once it failed. It is -1 before the first connection.
+	active  int
+	standby *standby
+	closed  bool
+	stats   stats
+}
+
+// NewConnectionManager connects service to config.Endpoint, retrying with
+// backoff until it succeeds, ctx is done or the attempts are exhausted, and
+// then monitors the connection until Close.
+func NewConnectionManager(ctx context.Context, service slim_bindings.ServiceInterface, config slim_bindings.ClientConfig, opts ...Option) (*ConnectionManager, error) {
+	return newConnectionManager(ctx, service, []slim_bindings.ClientConfig{config}, newOptions(config, opts))
+}
+
+func newOptions(config slim_bindings.ClientConfig, opts []Option) options {
+	o := options{
+		healthCheckInterval: DefaultHealthCheckInterval,
+		nameKey:             (*slim_bindings.Name).String,
+	}
+	if config.Backoff != nil {
+		o.backoff = *config.Backoff
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func newConnectionManager(ctx context.Context, service slim_bindings.ServiceInterface, configs []slim_bindings.ClientConfig, o options) (*ConnectionManager, error) {
+	m := &ConnectionManager{
+		service:       service,
+		configs:       configs,
+		opts:          o,
+		active:        -1,
+		failed:        make(chan failure, 1),
+		done:          make(chan struct{}),
+		state:         StateConnecting,
+		subscriptions: make(map[bindingKey]binding),
+		routes:        make(map[bindingKey]binding),
+		stats:         stats{since: time.Now(), sessions: make(map[*slimsession.Session]struct{})},
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
+	stop := context.AfterFunc(ctx, m.cancel)
+	_, err := m.dial(0)
+	if !stop() {
+		err = ctx.Err()
+	}
+	if err != nil {
+		m.cancel()
+		_ = m.disconnect()
+		return nil, err
+	}
+
+	go m.monitor()
+	return m, nil
+}
+
+// Endpoint returns the endpoint of the current connection, or of the last
+// one while reconnecting.
+func (m *ConnectionManager) Endpoint() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.endpoint()
+}
+
+// endpoint returns the active endpoint. m.mu must be held.
+func (m *ConnectionManager) endpoint() string {
+	return m.configs[max(m.active, 0)].Endpoint
+}
+
+// State returns the current state of the connection.
+func (m *ConnectionManager) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// ConnectionId returns the current connection ID. It changes on every
+// reconnect.
+func (m *ConnectionManager) ConnectionId() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.connId
+}
+
+// Subscribe subscribes app to name on the managed connection, now if it is
+// ready and again after every reconnect. The manager keeps name, which must
+// stay valid until Unsubscribe or Close.
+func (m *ConnectionManager) Subscribe(app slim_bindings.AppInterface, name *slim_bindings.Name) error {
+	return m.bind(m.subscriptions, "Subscribe", app, name, subscribe)
+}
+
+// Unsubscribe removes a subscription made with Subscribe.
+func (m *ConnectionManager) Unsubscribe(app slim_bindings.AppInterface, name *slim_bindings.Name) error {
+	return m.unbind(m.subscriptions, "Unsubscribe", app, name, func(b binding, connId uint64) error {
+		return b.app.Unsubscribe(b.name, &connId)
+	})
+}
+
+// SetRoute routes name to the managed connection for app, now if it is
+// ready and again after every reconnect. The manager keeps name, which must
+// stay valid until RemoveRoute or Close.
+func (m *ConnectionManager) SetRoute(app slim_bindings.AppInterface, name *slim_bindings.Name) error {
+	return m.bind(m.routes, "SetRoute", app, name, setRoute)
+}
+
+// RemoveRoute removes a route set with SetRoute.
+func (m *ConnectionManager) RemoveRoute(app slim_bindings.AppInterface, name *slim_bindings.Name) error {
+	return m.unbind(m.routes, "RemoveRoute", app, name, func(b binding, connId uint64) error {
+		return b.app.RemoveRoute(b.name, connId)
+	})
+}
+
+func subscribe(b binding, connId uint64) error {
+	return b.app.Subscribe(b.name, &connId)
+}
+
+func setRoute(b binding, connId uint64) error {
+	return b.app.SetRoute(b.name, connId)
+}
+
+func (m *ConnectionManager) bind(bindings map[bindingKey]binding, op string, app slim_bindings.AppInterface, name *slim_bindings.Name, apply func(binding, uint64) error) error {
+	m.bindMu.Lock()
+	defer m.bindMu.Unlock()
+	m.mu.Lock()
+	closed := m.closed || m.state == StateClosed
+	ready, connId := m.state == StateReady, m.connId
+	m.mu.Unlock()
+	if closed {
+		return m.closedError(op)
+	}
+	b := binding{app: app, name: name}
+	if ready {
+		if err := apply(b, connId); err != nil {
+			return err
+		}
+	}
+	bindings[bindingKey{app: app, name: m.opts.nameKey(name)}] = b
+	return nil
+}
+
+func (m *ConnectionManager) unbind(bindings map[bindingKey]binding, op string, app slim_bindings.AppInterface, name *slim_bindings.Name, remove func(binding, uint64) error) error {
+	m.bindMu.Lock()
+	defer m.bindMu.Unlock()
+	m.mu.Lock()
+	closed := m.closed || m.state == StateClosed
+	ready, connId := m.state == StateReady, m.connId
+	m.mu.Unlock()
+	if closed {
+		return m.closedError(op)
+	}
+	key := bindingKey{app: app, name: m.opts.nameKey(name)}
+	b, ok := bindings[key]
+	if !ok {
+		return nil
+	}
+	delete(bindings, key)
+	if !ready {
+		return nil
+	}
+	return remove(b, connId)
+}
+
+// ReportFailure tells the manager that the current connection failed, for
+// example because a publish failed, so that it reconnects without waiting
+// for the next health check.
+func (m *ConnectionManager) ReportFailure(err error) {
+	m.mu.Lock()
+	if m.state != StateReady {
+		m.mu.Unlock()
+		return
+	}
+	f := failure{connId: m.connId, err: err}
+	m.mu.Unlock()
+
+	select {
+	case m.failed <- f:
+	default:
+	}
+}
+
+// Close stops monitoring and disconnects. Subscriptions and routes are left
+// in place. Closing twice returns a *slim_bindings.ClosedError.
+func (m *ConnectionManager) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return m.closedError("Close")
+	}
+	m.closed = true
+	m.mu.Unlock()
+
+	m.cancel()
+	<-m.done
+	m.transition(StateClosed, 0, nil)
+	m.dropStandby()
+	return m.disconnect()
+}
+
+func (m *ConnectionManager) closedError(op string) error {
+	return &slim_bindings.ClosedError{Kind: "*slimconn.ConnectionManager", Op: op}
+}
+
+// monitor watches the connection and replaces it when it fails.
+func (m *ConnectionManager) monitor() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.opts.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		var cause error
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			if m.healthy() {
+				m.maintainStandby()
+				continue
+			}
+			cause = ErrConnectionLost
+		case f := <-m.failed:
+			if f.connId != m.ConnectionId() {
+				continue
+			}
+			cause = f.err
+		}
+
+		previous := m.ConnectionId()
+		m.transition(StateTransientFailure, 0, cause)
+		_ = m.disconnect()
+		if _, err := m.dial(previous); err != nil {
+			if m.ctx.Err() == nil {
+				m.transition(StateClosed, 0, err)
+			}
+			return
+		}
+	}
+}
+
+// healthy reports whether the service still has the managed connection.
+func (m *ConnectionManager) healthy() bool {
+	m.mu.Lock()
+	endpoint, connId := m.endpoint(), m.connId
+	m.mu.Unlock()
+	return m.alive(endpoint, connId)
+}
+
+func (m *ConnectionManager) alive(endpoint string, connId uint64) bool {
+	current := m.service.GetConnectionId(endpoint)
+	return current != nil && *current == connId
+}
+
+// dial connects, retrying with backoff, and applies every binding to the
+// new connection. previous is the ID of the connection being replaced, or 0.
+func (m *ConnectionManager) dial(previous uint64) (uint64, error) {
+	for attempt := 1; ; attempt++ {
+		m.transition(StateConnecting, attempt, nil)
+		connId, err := m.connect(previous, attempt)
+		if err == nil {
+			return connId, nil
+		}
+		if m.ctx.Err() != nil {
+			return 0, m.ctx.Err()
+		}
+
+		delay, ok := backoffDelay(m.opts.backoff, attempt)
+		if !ok {
+			return 0, fmt.Errorf("slimconn: connect to %s: giving up after %d attempts: %w", m.endpoints(), attempt, err)
+		}
+		m.transition(StateTransientFailure, attempt, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-m.ctx.Done():
+			timer.Stop()
+			return 0, m.ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// connect makes a single pass over the endpoints, in failover order, and
+// re-applies the bindings to the first connection that succeeds.
+func (m *ConnectionManager) connect(previous uint64, attempt int) (uint64, error) {
+	var err error
+	for _, i := range m.order() {
+		if m.ctx.Err() != nil {
+			return 0, m.ctx.Err()
+		}
+		var connId uint64
+		connId, err = m.open(i)
+		if err != nil {
+			continue
+		}
+
+		// bindMu is held until the state is ready, so that bindings made
+		// meanwhile wait and then apply to connId.
+		m.bindMu.Lock()
+		if err = m.reapply(connId); err != nil {
+			m.bindMu.Unlock()
+			_ = m.service.Disconnect(connId)
+			continue
+		}
+		m.mu.Lock()
+		from := m.state
+		m.state, m.connId, m.connected, m.active = StateReady, connId, true, i
+		m.mu.Unlock()
+		m.bindMu.Unlock()
+
+		m.emit(Event{
+			From:                 from,
+			To:                   StateReady,
+			ConnectionId:         connId,
+			PreviousConnectionId: previous,
+			Reconnected:          previous != 0,
+			Endpoint:             m.configs[i].Endpoint,
+			Attempt:              attempt,
+		})
+		return connId, nil
+	}
+	return 0, err
+}
+
+// dialConfig opens a connection to configs[i].
+func (m *ConnectionManager) dialConfig(i int) (uint64, error) {
+	if c, ok := m.service.(connector); ok {
+		return c.ConnectContext(m.ctx, m.configs[i])
+	}
+	return m.service.Connect(m.configs[i])
+}
+
+// reapply applies every binding to connId. m.bindMu must be held.
+func (m *ConnectionManager) reapply(connId uint64) error {
+	for _, b := range m.subscriptions {
+		if err := subscribe(b, connId); err != nil {
+			return fmt.Errorf("slimconn: re-subscribe: %w", err)
+		}
+	}
+	for _, b := range m.routes {
+		if err := setRoute(b, connId); err != nil {
+			return fmt.Errorf("slimconn: re-route: %w", err)
+		}
+	}
+	return nil
+}
+
+// disconnect drops the current connection, if any.
+func (m *ConnectionManager) disconnect() error {
+	m.mu.Lock()
+	connected, connId := m.connected, m.connId
+	m.connected = false
+	m.mu.Unlock()
+	if !connected {
+		return nil
+	}
+	return m.service.Disconnect(connId)
+}
+
+// transition moves to state to and reports the change.
+func (m *ConnectionManager) transition(to State, attempt int, err error) {
+	m.mu.Lock()
+	from := m.state
+	if from == to || from == StateClosed {
+		m.mu.Unlock()
+		return
+	}
+	m.state = to
+	connId, endpoint := m.connId, m.endpoint()
+	m.mu.Unlock()
+	m.emit(Event{From: from, To: to, ConnectionId: connId, Endpoint: endpoint, Attempt: attempt, Err: err})
+}
+
+// emit records event in the statistics and passes it to the state handler.
+func (m *ConnectionManager) emit(event Event) {
+	m.mu.Lock()
+	m.stats.record(event)
+	m.mu.Unlock()
+
+	if m.opts.onStateChange == nil {
+		return
+	}
+	m.handler.Lock()
+	defer m.handler.Unlock()
+	m.opts.onStateChange(event)
+}
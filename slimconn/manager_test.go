@@ -0,0 +1,381 @@
+package slimconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// fakeService hands out connection IDs per endpoint and lets tests drop
+// them.
+type fakeService struct {
+	slim_bindings.ServiceInterface
+
+	mu       sync.Mutex
+	next     uint64
+	conns    map[string]uint64
+	down     map[string]bool
+	failures int
+	connects map[string]int
+}
+
+func newFakeService() *fakeService {
+	return &fakeService{
+		conns:    make(map[string]uint64),
+		down:     make(map[string]bool),
+		connects: make(map[string]int),
+	}
+}
+
+func (f *fakeService) Connect(config slim_bindings.ClientConfig) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connects[config.Endpoint]++
+	if f.down[config.Endpoint] {
+		return 0, errors.New("connection refused")
+	}
+	if f.failures > 0 {
+		f.failures--
+		return 0, errors.New("connection refused")
+	}
+	f.next++
+	f.conns[config.Endpoint] = f.next
+	return f.next, nil
+}
+
+func (f *fakeService) Disconnect(connId uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for endpoint, id := range f.conns {
+		if id == connId {
+			delete(f.conns, endpoint)
+		}
+	}
+	return nil
+}
+
+func (f *fakeService) GetConnectionId(endpoint string) *uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	connId, ok := f.conns[endpoint]
+	if !ok {
+		return nil
+	}
+	return &connId
+}
+
+// fail drops every connection and makes the next n connects fail.
+func (f *fakeService) fail(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	clear(f.conns)
+	f.failures = n
+}
+
+// stop takes endpoint down, dropping its connection.
+func (f *fakeService) stop(endpoint string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, endpoint)
+	f.down[endpoint] = true
+}
+
+func (f *fakeService) connectCount(endpoint string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connects[endpoint]
+}
+
+// fakeApp records the connection each name is subscribed and routed to.
+type fakeApp struct {
+	slim_bindings.AppInterface
+
+	mu            sync.Mutex
+	subscriptions map[*slim_bindings.Name]uint64
+	routes        map[*slim_bindings.Name]uint64
+}
+
+func newFakeApp() *fakeApp {
+	return &fakeApp{
+		subscriptions: make(map[*slim_bindings.Name]uint64),
+		routes:        make(map[*slim_bindings.Name]uint64),
+	}
+}
+
+func (f *fakeApp) Subscribe(name *slim_bindings.Name, connId *uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscriptions[name] = *connId
+	return nil
+}
+
+func (f *fakeApp) Unsubscribe(name *slim_bindings.Name, connId *uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subscriptions, name)
+	return nil
+}
+
+func (f *fakeApp) SetRoute(name *slim_bindings.Name, connId uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routes[name] = connId
+	return nil
+}
+
+func (f *fakeApp) bound(name *slim_bindings.Name) (subscribed, routed uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.subscriptions[name], f.routes[name]
+}
+
+// events collects state changes.
+type events struct {
+	ch chan Event
+}
+
+func newEvents() *events {
+	return &events{ch: make(chan Event, 64)}
+}
+
+func (e *events) handle(event Event) {
+	e.ch <- event
+}
+
+// waitFor returns the next event moving to state, failing after a second.
+func (e *events) waitFor(t *testing.T, state State) Event {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case event := <-e.ch:
+			if event.To == state {
+				return event
+			}
+		case <-deadline:
+			t.Fatalf("no transition to %s", state)
+		}
+	}
+}
+
+func testOptions(e *events) options {
+	return options{
+		backoff: slim_bindings.BackoffConfigFixedInterval{Config: slim_bindings.FixedIntervalBackoff{
+			Interval: time.Millisecond,
+		}},
+		healthCheckInterval: 5 * time.Millisecond,
+		onStateChange:       e.handle,
+		nameKey:             func(n *slim_bindings.Name) string { return fmt.Sprintf("%p", n) },
+	}
+}
+
+func TestReconnectReappliesSubscriptionsAndRoutes(t *testing.T) {
+	service := newFakeService()
+	e := newEvents()
+	m, err := newConnectionManager(context.Background(), service, group("node"), testOptions(e))
+	if err != nil {
+		t.Fatalf("newConnectionManager: %v", err)
+	}
+	defer m.Close()
+	if event := e.waitFor(t, StateReady); event.ConnectionId != 1 || event.Reconnected {
+		t.Fatalf("first ready event = %+v", event)
+	}
+
+	app := newFakeApp()
+	local, remote := &slim_bindings.Name{}, &slim_bindings.Name{}
+	if err := m.Subscribe(app, local); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := m.SetRoute(app, remote); err != nil {
+		t.Fatalf("SetRoute: %v", err)
+	}
+
+	service.fail(2)
+	failure := e.waitFor(t, StateTransientFailure)
+	if !errors.Is(failure.Err, ErrConnectionLost) {
+		t.Errorf("failure cause = %v, want ErrConnectionLost", failure.Err)
+	}
+	ready := e.waitFor(t, StateReady)
+	if !ready.Reconnected || ready.PreviousConnectionId != 1 || ready.ConnectionId != 2 || ready.Attempt != 3 {
+		t.Fatalf("reconnect event = %+v", ready)
+	}
+	if m.ConnectionId() != 2 || m.State() != StateReady {
+		t.Fatalf("manager = %s on %d, want ready on 2", m.State(), m.ConnectionId())
+	}
+	if sub, _ := app.bound(local); sub != 2 {
+		t.Errorf("subscription on connection %d, want 2", sub)
+	}
+	if _, route := app.bound(remote); route != 2 {
+		t.Errorf("route on connection %d, want 2", route)
+	}
+
+	if err := m.Unsubscribe(app, local); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	m.ReportFailure(errors.New("publish failed"))
+	if failure := e.waitFor(t, StateTransientFailure); failure.Err == nil || failure.Err.Error() != "publish failed" {
+		t.Errorf("reported failure cause = %v", failure.Err)
+	}
+	e.waitFor(t, StateReady)
+	if sub, route := app.bound(local); sub != 0 || route != 0 {
+		t.Errorf("unsubscribed name re-applied: subscribed %d, routed %d", sub, route)
+	}
+	if _, route := app.bound(remote); route != 3 {
+		t.Errorf("route on connection %d, want 3", route)
+	}
+}
+
+// blockingApp blocks Subscribe until release is closed.
+type blockingApp struct {
+	*fakeApp
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingApp) Subscribe(name *slim_bindings.Name, connId *uint64) error {
+	b.once.Do(func() { close(b.entered) })
+	<-b.release
+	return b.fakeApp.Subscribe(name, connId)
+}
+
+func TestBindingDoesNotBlockState(t *testing.T) {
+	service := newFakeService()
+	e := newEvents()
+	m, err := newConnectionManager(context.Background(), service, group("node"), testOptions(e))
+	if err != nil {
+		t.Fatalf("newConnectionManager: %v", err)
+	}
+	defer m.Close()
+	e.waitFor(t, StateReady)
+
+	app := &blockingApp{fakeApp: newFakeApp(), entered: make(chan struct{}), release: make(chan struct{})}
+	name := &slim_bindings.Name{}
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- m.Subscribe(app, name) }()
+	<-app.entered
+
+	// The native call is in progress: the state is still readable.
+	done := make(chan struct{})
+	go func() {
+		_ = m.State()
+		_ = m.Stats()
+		m.ReportFailure(errors.New("publish failed"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("State, Stats or ReportFailure blocked behind Subscribe")
+	}
+
+	close(app.release)
+	if err := <-subscribed; err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	ready := e.waitFor(t, StateReady)
+	if sub, _ := app.bound(name); sub != ready.ConnectionId {
+		t.Errorf("subscription on connection %d, want %d", sub, ready.ConnectionId)
+	}
+}
+
+func TestGivesUpAfterMaxAttempts(t *testing.T) {
+	service := newFakeService()
+	e := newEvents()
+	o := testOptions(e)
+	o.backoff = slim_bindings.BackoffConfigFixedInterval{Config: slim_bindings.FixedIntervalBackoff{
+		Interval:    time.Millisecond,
+		MaxAttempts: 2,
+	}}
+	m, err := newConnectionManager(context.Background(), service, group("node"), o)
+	if err != nil {
+		t.Fatalf("newConnectionManager: %v", err)
+	}
+
+	service.fail(10)
+	closed := e.waitFor(t, StateClosed)
+	if closed.Err == nil {
+		t.Fatal("closed without an error")
+	}
+	if err := m.Subscribe(newFakeApp(), &slim_bindings.Name{}); !errors.Is(err, slim_bindings.ErrClosed) {
+		t.Errorf("Subscribe after giving up = %v, want ErrClosed", err)
+	}
+	if err := m.Unsubscribe(newFakeApp(), &slim_bindings.Name{}); !errors.Is(err, slim_bindings.ErrClosed) {
+		t.Errorf("Unsubscribe after giving up = %v, want ErrClosed", err)
+	}
+	if connects := service.connectCount("node"); connects != 4 {
+		t.Errorf("connects = %d, want 1 + 1 attempt + 2 retries", connects)
+	}
+	if err := m.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestInitialConnectHonoursContext(t *testing.T) {
+	service := newFakeService()
+	service.failures = 1 << 30
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	o := testOptions(nil)
+	o.onStateChange = nil
+	_, err := newConnectionManager(ctx, service, group(""), o)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestCloseDisconnects(t *testing.T) {
+	service := newFakeService()
+	e := newEvents()
+	m, err := newConnectionManager(context.Background(), service, group(""), testOptions(e))
+	if err != nil {
+		t.Fatalf("newConnectionManager: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	e.waitFor(t, StateClosed)
+	if service.GetConnectionId("") != nil {
+		t.Error("connection still open after Close")
+	}
+	if err := m.Close(); !errors.Is(err, slim_bindings.ErrClosed) {
+		t.Errorf("second Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	exponential := slim_bindings.BackoffConfigExponential{Config: slim_bindings.ExponentialBackoff{
+		Base:        10 * time.Millisecond,
+		Factor:      3,
+		MaxDelay:    time.Second,
+		MaxAttempts: 6,
+	}}
+	for n, want := range map[int]time.Duration{
+		1: 10 * time.Millisecond,
+		2: 30 * time.Millisecond,
+		3: 90 * time.Millisecond,
+		4: 270 * time.Millisecond,
+		5: 810 * time.Millisecond,
+		6: time.Second,
+	} {
+		if got, ok := backoffDelay(exponential, n); !ok || got != want {
+			t.Errorf("attempt %d: delay = %v, %v, want %v", n, got, ok, want)
+		}
+	}
+	if _, ok := backoffDelay(exponential, 7); ok {
+		t.Error("attempt 7 allowed, want exhausted")
+	}
+
+	jittered := DefaultBackoff()
+	for n := 1; n < 100; n++ {
+		got, ok := backoffDelay(jittered, n)
+		if !ok || got < 0 || got > 10*time.Second {
+			t.Fatalf("attempt %d: delay = %v, %v", n, got, ok)
+		}
+	}
+}
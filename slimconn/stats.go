@@ -0,0 +1,120 @@
+package slimconn
+
+import (
+	"time"
+
+	"github.com/agntcy/slim-bindings-go/slimsession"
+)
+
+// Stats is a snapshot of a managed connection. The native layer does not
+// report traffic per connection, so the traffic counters add up the sessions
+// attached with Attach.
+type Stats struct {
+	Endpoint     string
+	State        State
+	ConnectionId uint64
+	// StateSince is when the connection entered State.
+	StateSince time.Time
+	// Reconnects counts the connections that replaced a failed one.
+	Reconnects uint64
+	// LastError is the most recent failure, and LastErrorTime when it
+	// happened.
+	LastError     error
+	LastErrorTime time.Time
+
+	// Sessions is the number of attached sessions.
+	Sessions    int
+	MessagesIn  uint64
+	MessagesOut uint64
+	BytesIn     uint64
+	BytesOut    uint64
+	// Retransmitted, Dropped and Duplicates add up the same counters of the
+	// sessions.
+	Retransmitted uint64
+	Dropped       uint64
+	Duplicates    uint64
+	// RTT is the average smoothed round-trip time of the attached sessions
+	// that have one, or 0.
+	RTT time.Duration
+}
+
+// stats holds the bookkeeping behind Stats. It is guarded by the manager's
+// mutex.
+type stats struct {
+	since         time.Time
+	reconnects    uint64
+	lastError     error
+	lastErrorTime time.Time
+
+	sessions map[*slimsession.Session]struct{}
+	// detached accumulates the counters of detached sessions, so that the
+	// totals never go backwards.
+	detached slimsession.Stats
+}
+
+func (s *stats) record(event Event) {
+	now := time.Now()
+	s.since = now
+	if event.To == StateReady && event.Reconnected {
+		s.reconnects++
+	}
+	if event.Err != nil {
+		s.lastError, s.lastErrorTime = event.Err, now
+	}
+}
+
+// Attach counts the traffic of session in the statistics of the connection
+// until detach is called. Sessions should be attached to the manager whose
+// connection they use.
+func (m *ConnectionManager) Attach(session *slimsession.Session) (detach func()) {
+	m.mu.Lock()
+	m.stats.sessions[session] = struct{}{}
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.stats.sessions[session]; !ok {
+			return
+		}
+		delete(m.stats.sessions, session)
+		m.stats.detached.Add(session.Stats())
+	}
+}
+
+// Stats returns the current state and counters of the connection. It is
+// cheap enough to poll.
+func (m *ConnectionManager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := Stats{
+		Endpoint:      m.endpoint(),
+		State:         m.state,
+		ConnectionId:  m.connId,
+		StateSince:    m.stats.since,
+		Reconnects:    m.stats.reconnects,
+		LastError:     m.stats.lastError,
+		LastErrorTime: m.stats.lastErrorTime,
+		Sessions:      len(m.stats.sessions),
+	}
+
+	total := m.stats.detached
+	var rtt time.Duration
+	var timed int
+	for session := range m.stats.sessions {
+		s := session.Stats()
+		total.Add(s)
+		if s.RTT > 0 {
+			rtt += s.RTT
+			timed++
+		}
+	}
+	stats.MessagesIn, stats.BytesIn = total.Received, total.ReceivedBytes
+	stats.MessagesOut, stats.BytesOut = total.Published, total.PublishedBytes
+	stats.Retransmitted, stats.Dropped, stats.Duplicates = total.Retransmitted, total.Dropped, total.Duplicates
+	if timed > 0 {
+		stats.RTT = rtt / time.Duration(timed)
+	}
+	return stats
+}
@@ -0,0 +1,62 @@
+package slimconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+	"github.com/agntcy/slim-bindings-go/slimsession"
+)
+
+// sinkSession accepts and discards every publish.
+type sinkSession struct {
+	slim_bindings.SessionInterface
+}
+
+func (sinkSession) Publish([]byte, *string, *map[string]string) (*slim_bindings.CompletionHandle, error) {
+	return nil, nil
+}
+
+func TestStatsTrackReconnectsAndTraffic(t *testing.T) {
+	service := newFakeService()
+	e := newEvents()
+	m, err := newConnectionManager(context.Background(), service, group("node"), testOptions(e))
+	if err != nil {
+		t.Fatalf("newConnectionManager: %v", err)
+	}
+	defer m.Close()
+	e.waitFor(t, StateReady)
+
+	session := slimsession.Wrap(sinkSession{})
+	detach := m.Attach(session)
+	for range 3 {
+		if _, err := session.Publish([]byte("ping"), nil, nil); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	m.ReportFailure(errors.New("broken pipe"))
+	e.waitFor(t, StateReady)
+
+	stats := m.Stats()
+	if stats.State != StateReady || stats.Endpoint != "node" || stats.ConnectionId != 2 {
+		t.Errorf("stats = %s on %q/%d, want ready on node/2", stats.State, stats.Endpoint, stats.ConnectionId)
+	}
+	if stats.Reconnects != 1 {
+		t.Errorf("Reconnects = %d, want 1", stats.Reconnects)
+	}
+	if stats.LastError == nil || stats.LastError.Error() != "broken pipe" || stats.LastErrorTime.IsZero() {
+		t.Errorf("LastError = %v at %v", stats.LastError, stats.LastErrorTime)
+	}
+	if stats.Sessions != 1 || stats.MessagesOut != 3 || stats.BytesOut != 12 {
+		t.Errorf("traffic = %d sessions, %d messages, %d bytes; want 1, 3, 12", stats.Sessions, stats.MessagesOut, stats.BytesOut)
+	}
+
+	detach()
+	detach()
+	stats = m.Stats()
+	if stats.Sessions != 0 || stats.MessagesOut != 3 {
+		t.Errorf("after detach: %d sessions, %d messages; want 0, 3", stats.Sessions, stats.MessagesOut)
+	}
+}
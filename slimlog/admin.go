@@ -0,0 +1,105 @@
+package slimlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// AdminPath is the path ServeAdmin serves the settings at.
+const AdminPath = "/loglevel"
+
+// settingsJSON is the JSON form of Settings. Omitted fields are left
+// unchanged by an update.
+type settingsJSON struct {
+	Level   *string   `json:"level,omitempty"`
+	Filters *[]string `json:"filters,omitempty"`
+}
+
+func (s *Sink) settingsJSON() settingsJSON {
+	settings := s.Settings()
+	level := FormatLevel(settings.Level)
+	if settings.Filters == nil {
+		settings.Filters = []string{}
+	}
+	return settingsJSON{Level: &level, Filters: &settings.Filters}
+}
+
+// Handler returns an HTTP handler for the settings of the sink. GET returns
+// them as JSON, such as {"level":"info","filters":["slim_session=debug"]}.
+// PUT or POST with a body in the same form changes them; an omitted field
+// keeps its value. Both answer with the resulting settings.
+func (s *Sink) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut, http.MethodPost:
+			var update settingsJSON
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&update); err != nil {
+				http.Error(w, fmt.Sprintf("invalid settings: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := s.update(update); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.settingsJSON())
+	})
+}
+
+func (s *Sink) update(update settingsJSON) error {
+	settings := s.Settings()
+	if update.Level != nil {
+		level, err := ParseLevel(*update.Level)
+		if err != nil {
+			return fmt.Errorf("slimlog: level %q: %w", *update.Level, err)
+		}
+		settings.Level = level
+	}
+	if update.Filters != nil {
+		settings.Filters = *update.Filters
+	}
+	return s.Apply(settings)
+}
+
+// ServeAdmin serves Handler at AdminPath on addr until ctx is done. The
+// endpoint has no authentication, so addr must be a loopback address such
+// as "127.0.0.1:6061" or "localhost:6061".
+func (s *Sink) ServeAdmin(ctx context.Context, addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("slimlog: admin address: %w", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("slimlog: admin address %q is not a loopback address", addr)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("slimlog: admin: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(AdminPath, s.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	stop := context.AfterFunc(ctx, func() {
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+	})
+	defer stop()
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("slimlog: admin: %w", err)
+	}
+	return nil
+}
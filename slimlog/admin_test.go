@@ -0,0 +1,57 @@
+package slimlog
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	sink := newSink(nil, options{level: slog.LevelInfo}, &filters{})
+	handler := sink.Handler()
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, AdminPath, strings.NewReader(body)))
+		return w
+	}
+
+	if w := do(http.MethodGet, ""); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"level":"info","filters":[]}` {
+		t.Errorf("GET = %d %s", w.Code, w.Body)
+	}
+	w := do(http.MethodPut, `{"level":"debug","filters":["slim_session=trace"]}`)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"level":"debug","filters":["slim_session=trace"]}` {
+		t.Errorf("PUT = %d %s", w.Code, w.Body)
+	}
+	// Omitted fields are kept.
+	if w := do(http.MethodPost, `{"level":"warn"}`); !strings.Contains(w.Body.String(), `"filters":["slim_session=trace"]`) {
+		t.Errorf("POST = %d %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPut, `{"filters":["slim=loud"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid PUT = %d, want 400", w.Code)
+	}
+	if w := do(http.MethodDelete, ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE = %d, want 405", w.Code)
+	}
+	if sink.Level() != slog.LevelWarn {
+		t.Errorf("level = %s, want warn", sink.Level())
+	}
+}
+
+func TestServeAdminRequiresLoopback(t *testing.T) {
+	sink := newSink(nil, options{level: slog.LevelInfo}, &filters{})
+	for _, addr := range []string{"0.0.0.0:0", ":0", "example.com:80", "nonsense"} {
+		if err := sink.ServeAdmin(context.Background(), addr); err == nil {
+			t.Errorf("ServeAdmin(%q) succeeded", addr)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sink.ServeAdmin(ctx, "127.0.0.1:0"); err != nil {
+		t.Errorf("ServeAdmin on loopback: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package slimlog
+
+import (
+	"errors"
+	"os"
+)
+
+type capture struct {
+	original *os.File
+	reader   *os.File
+}
+
+func startCapture(*os.File) (*capture, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (c *capture) stop() error {
+	return nil
+}
+
+func (c *capture) close() {}
@@ -0,0 +1,53 @@
+//go:build unix
+
+package slimlog
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// capture redirects a file descriptor into a pipe.
+type capture struct {
+	fd int
+	// original is a duplicate of the descriptor before the redirection.
+	original *os.File
+	reader   *os.File
+	writer   *os.File
+}
+
+func startCapture(file *os.File) (*capture, error) {
+	fd := int(file.Fd())
+	dup, err := unix.Dup(fd)
+	if err != nil {
+		return nil, err
+	}
+	original := os.NewFile(uintptr(dup), file.Name())
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		original.Close()
+		return nil, err
+	}
+	if err := unix.Dup2(int(writer.Fd()), fd); err != nil {
+		original.Close()
+		reader.Close()
+		writer.Close()
+		return nil, err
+	}
+	return &capture{fd: fd, original: original, reader: reader, writer: writer}, nil
+}
+
+// stop points the descriptor back at its original destination. The reader
+// sees EOF once the output already written has been read.
+func (c *capture) stop() error {
+	err := unix.Dup2(int(c.original.Fd()), c.fd)
+	return errors.Join(err, c.writer.Close())
+}
+
+// close releases the pipe and the duplicate descriptor once stopped.
+func (c *capture) close() {
+	c.reader.Close()
+	c.original.Close()
+}
@@ -0,0 +1,143 @@
+package slimlog
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+)
+
+// LevelOff is above every level; a filter directive at "off" drops all events
+// of its target.
+const LevelOff = slog.Level(math.MaxInt32)
+
+// ParseLevel parses a native level name ("trace", "debug", "info", "warn",
+// "error", "off"), in any case, or a slog level such as "INFO+2".
+func ParseLevel(s string) (slog.Level, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	if upper == "OFF" {
+		return LevelOff, nil
+	}
+	return parseLevel(upper)
+}
+
+// FormatLevel returns the name of level as accepted by ParseLevel.
+func FormatLevel(level slog.Level) string {
+	if level == LevelOff {
+		return "off"
+	}
+	for name, l := range levels {
+		if l == level {
+			return strings.ToLower(name)
+		}
+	}
+	return level.String()
+}
+
+// directive is a parsed filter directive such as "slim_session=debug".
+type directive struct {
+	target string
+	level  slog.Level
+}
+
+// filters are parsed directives, most specific target first.
+type filters struct {
+	raw        []string
+	directives []directive
+}
+
+// parseFilters parses directives in the syntax of the native TracingConfig
+// filters: "target=level" sets the level of a target and the modules below
+// it, a bare "target" enables all its events, and a bare level is ignored
+// here because it is the level of the sink.
+func parseFilters(raw []string) (*filters, error) {
+	f := &filters{raw: slices.Clone(raw)}
+	for _, d := range raw {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		target, name, ok := strings.Cut(d, "=")
+		if !ok {
+			if _, err := ParseLevel(d); err == nil {
+				continue
+			}
+			target, name = d, "trace"
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("slimlog: filter %q: %w", d, err)
+		}
+		if target == "" {
+			return nil, fmt.Errorf("slimlog: filter %q: empty target", d)
+		}
+		f.directives = append(f.directives, directive{target: target, level: level})
+	}
+	slices.SortStableFunc(f.directives, func(a, b directive) int {
+		return len(b.target) - len(a.target)
+	})
+	return f, nil
+}
+
+// level returns the minimum level for target, and false when no directive
+// applies to it.
+func (f *filters) level(target string) (slog.Level, bool) {
+	for _, d := range f.directives {
+		if target == d.target || strings.HasPrefix(target, d.target+"::") {
+			return d.level, true
+		}
+	}
+	return 0, false
+}
+
+// Settings are the level and filters of a Sink.
+type Settings struct {
+	// Level is the minimum level of targets no filter applies to.
+	Level slog.Level
+	// Filters are directives such as "slim_session=debug" or "h2=off".
+	Filters []string
+}
+
+// SetFilters replaces the filter directives of the sink. A directive sets
+// the minimum level of a target and of the modules below it, overriding the
+// level of the sink; the most specific directive wins.
+func (s *Sink) SetFilters(directives []string) error {
+	f, err := parseFilters(directives)
+	if err != nil {
+		return err
+	}
+	s.filters.Store(f)
+	return nil
+}
+
+// Filters returns the filter directives of the sink.
+func (s *Sink) Filters() []string {
+	return slices.Clone(s.filters.Load().raw)
+}
+
+// Settings returns the current level and filters of the sink.
+func (s *Sink) Settings() Settings {
+	return Settings{Level: s.Level(), Filters: s.Filters()}
+}
+
+// Apply sets the level and filters of the sink at once. Nothing changes if
+// a filter is invalid.
+func (s *Sink) Apply(settings Settings) error {
+	f, err := parseFilters(settings.Filters)
+	if err != nil {
+		return err
+	}
+	s.level.Set(settings.Level)
+	s.filters.Store(f)
+	return nil
+}
+
+// enabled reports whether an event of target at level passes the level and
+// filters of the sink.
+func (s *Sink) enabled(target string, level slog.Level) bool {
+	if min, ok := s.filters.Load().level(target); ok {
+		return level >= min
+	}
+	return level >= s.level.Level()
+}
@@ -0,0 +1,66 @@
+package slimlog
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestFiltersOverrideLevel(t *testing.T) {
+	sink := newSink(nil, options{level: slog.LevelWarn}, &filters{})
+	if err := sink.SetFilters([]string{"slim_session=debug", "slim_session::p2p=error", "h2=off", "tokio", "info"}); err != nil {
+		t.Fatalf("SetFilters: %v", err)
+	}
+
+	tests := []struct {
+		target string
+		level  slog.Level
+		want   bool
+	}{
+		{"slim_session", slog.LevelDebug, true},
+		{"slim_session::group", slog.LevelDebug, true},
+		{"slim_session::p2p", slog.LevelWarn, false},
+		{"slim_session::p2p::send", slog.LevelError, true},
+		{"slim_sessions", slog.LevelInfo, false},
+		{"h2::codec", slog.LevelError, false},
+		{"tokio::runtime", LevelTrace, true},
+		{"slim::service", slog.LevelInfo, false},
+		{"slim::service", slog.LevelWarn, true},
+	}
+	for _, tt := range tests {
+		if got := sink.enabled(tt.target, tt.level); got != tt.want {
+			t.Errorf("enabled(%s, %s) = %v, want %v", tt.target, FormatLevel(tt.level), got, tt.want)
+		}
+	}
+
+	settings := sink.Settings()
+	if settings.Level != slog.LevelWarn || len(settings.Filters) != 5 {
+		t.Errorf("Settings = %+v", settings)
+	}
+}
+
+func TestInvalidFiltersAreRejected(t *testing.T) {
+	sink := newSink(nil, options{level: slog.LevelInfo}, &filters{raw: []string{"slim=debug"}})
+	for _, bad := range [][]string{{"slim=loud"}, {"=debug"}} {
+		if err := sink.Apply(Settings{Level: slog.LevelError, Filters: bad}); err == nil {
+			t.Errorf("Apply(%v) succeeded", bad)
+		}
+	}
+	if settings := sink.Settings(); settings.Level != slog.LevelInfo || len(settings.Filters) != 1 {
+		t.Errorf("settings changed to %+v by an invalid update", settings)
+	}
+}
+
+func TestLevelNames(t *testing.T) {
+	for _, name := range []string{"trace", "debug", "info", "warn", "error", "off"} {
+		level, err := ParseLevel(name)
+		if err != nil {
+			t.Fatalf("ParseLevel(%q): %v", name, err)
+		}
+		if got := FormatLevel(level); got != name {
+			t.Errorf("FormatLevel(ParseLevel(%q)) = %q", name, got)
+		}
+	}
+	if level, err := ParseLevel("INFO+2"); err != nil || level != slog.LevelInfo+2 {
+		t.Errorf("ParseLevel(INFO+2) = %v, %v", level, err)
+	}
+}
@@ -0,0 +1,218 @@
+package slimlog
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LevelTrace is the slog level of native TRACE events, below slog.LevelDebug.
+const LevelTrace = slog.Level(-8)
+
+var levels = map[string]slog.Level{
+	"TRACE": LevelTrace,
+	"DEBUG": slog.LevelDebug,
+	"INFO":  slog.LevelInfo,
+	"WARN":  slog.LevelWarn,
+	"ERROR": slog.LevelError,
+}
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// event is a native tracing event parsed from one line of output.
+type event struct {
+	time       time.Time
+	level      slog.Level
+	threadName string
+	threadId   string
+	spans      []span
+	target     string
+	message    string
+	fields     []field
+}
+
+type span struct {
+	name   string
+	fields []field
+}
+
+type field struct {
+	key, value string
+}
+
+// format describes the optional parts of the native output, which follow the
+// TracingConfig the library was initialized with.
+type format struct {
+	threadNames bool
+	threadIds   bool
+}
+
+// parse parses a line in the format of the native tracing output:
+//
+//	2025-01-02T03:04:05.678901Z  INFO worker ThreadId(02) span{a=1}:inner: target: message key=value
+//
+// It returns false for lines that are not tracing events.
+func (f format) parse(line string) (event, bool) {
+	line = ansi.ReplaceAllString(line, "")
+	var e event
+
+	stamp, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+	t, err := time.Parse(time.RFC3339Nano, stamp)
+	if err != nil {
+		return e, false
+	}
+	e.time = t
+
+	level, rest, _ := strings.Cut(strings.TrimLeft(rest, " "), " ")
+	if e.level, err = parseLevel(level); err != nil {
+		return e, false
+	}
+	rest = strings.TrimLeft(rest, " ")
+
+	if f.threadNames || f.threadIds {
+		e.threadName, e.threadId, rest = f.threads(rest)
+	}
+
+	head, rest, ok := strings.Cut(rest, ": ")
+	if !ok {
+		// An event without a message or fields ends with the target.
+		head, ok = strings.CutSuffix(rest, ":")
+		if !ok {
+			return e, false
+		}
+		rest = ""
+	}
+	if isSpans(head) {
+		e.spans = parseSpans(head)
+		if head, rest, ok = strings.Cut(rest, ": "); !ok {
+			head, rest = strings.TrimSuffix(rest, ":"), ""
+		}
+	}
+	e.target = head
+	e.message, e.fields = parseMessage(rest)
+	return e, true
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	if level, ok := levels[s]; ok {
+		return level, nil
+	}
+	var level slog.Level
+	return level, level.UnmarshalText([]byte(s))
+}
+
+// threads reads the thread name and ID printed after the level.
+func (f format) threads(rest string) (name, id, remaining string) {
+	token, after, _ := strings.Cut(rest, " ")
+	if f.threadNames && !strings.HasPrefix(token, "ThreadId(") && !strings.HasSuffix(token, ":") {
+		name, rest = token, strings.TrimLeft(after, " ")
+		token, after, _ = strings.Cut(rest, " ")
+	}
+	if f.threadIds && strings.HasPrefix(token, "ThreadId(") {
+		id, rest = strings.TrimSuffix(strings.TrimPrefix(token, "ThreadId("), ")"), strings.TrimLeft(after, " ")
+	}
+	return name, id, rest
+}
+
+// isSpans reports whether the head of an event is a span scope rather than a
+// target. Spans carry fields in braces or are joined by single colons, while
+// targets are module paths. A single span without fields cannot be told
+// apart from a target and is read as one.
+func isSpans(head string) bool {
+	return strings.Contains(head, "{") || strings.Contains(strings.ReplaceAll(head, "::", ""), ":")
+}
+
+// parseSpans parses a scope such as "outer{a=1 b=2}:inner".
+func parseSpans(scope string) []span {
+	var spans []span
+	for scope != "" {
+		var s span
+		end := strings.IndexAny(scope, "{:")
+		if end < 0 {
+			spans = append(spans, span{name: scope})
+			break
+		}
+		s.name = scope[:end]
+		scope = scope[end:]
+		if scope[0] == '{' {
+			closing := matchingBrace(scope)
+			_, s.fields = parseMessage(scope[1:closing])
+			scope = scope[min(closing+1, len(scope)):]
+		}
+		scope = strings.TrimPrefix(scope, ":")
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+func matchingBrace(s string) int {
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s) - 1
+}
+
+// parseMessage splits the message of an event from the key=value fields
+// that follow it.
+func parseMessage(s string) (string, []field) {
+	words := split(s)
+	i := len(words)
+	for i > 0 {
+		key, _, ok := strings.Cut(words[i-1], "=")
+		if !ok || key == "" || strings.ContainsAny(key, "\" ") {
+			break
+		}
+		i--
+	}
+	var fields []field
+	for _, word := range words[i:] {
+		key, value, _ := strings.Cut(word, "=")
+		fields = append(fields, field{key: key, value: unquote(value)})
+	}
+	return strings.Join(words[:i], " "), fields
+}
+
+// split splits s on spaces outside double quotes.
+func split(s string) []string {
+	var words []string
+	var b strings.Builder
+	quoted, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if b.Len() > 0 {
+				words = append(words, b.String())
+				b.Reset()
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() > 0 {
+		words = append(words, b.String())
+	}
+	return words
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `\"`, `"`)
+	}
+	return s
+}
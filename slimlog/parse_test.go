@@ -0,0 +1,78 @@
+package slimlog
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	full := format{threadNames: true, threadIds: true}
+	tests := []struct {
+		name   string
+		format format
+		line   string
+		want   event
+	}{
+		{
+			name: "plain",
+			line: "2025-01-02T03:04:05.678901Z  INFO slim_service::service: connected to node endpoint=\"http://localhost:46357\" id=3\n",
+			want: event{
+				level:   slog.LevelInfo,
+				target:  "slim_service::service",
+				message: "connected to node",
+				fields:  []field{{"endpoint", "http://localhost:46357"}, {"id", "3"}},
+			},
+		},
+		{
+			name:   "threads and spans",
+			format: full,
+			line:   "2025-01-02T03:04:05.678901Z DEBUG tokio-runtime-worker ThreadId(07) session{id=12 kind=\"p2p\"}:publish: slim_session::p2p: sent message\n",
+			want: event{
+				level:      slog.LevelDebug,
+				threadName: "tokio-runtime-worker",
+				threadId:   "07",
+				spans:      []span{{name: "session", fields: []field{{"id", "12"}, {"kind", "p2p"}}}, {name: "publish"}},
+				target:     "slim_session::p2p",
+				message:    "sent message",
+			},
+		},
+		{
+			name:   "unnamed thread",
+			format: full,
+			line:   "2025-01-02T03:04:05.678901Z TRACE ThreadId(01) slim::runtime: tick",
+			want:   event{level: LevelTrace, threadId: "01", target: "slim::runtime", message: "tick"},
+		},
+		{
+			name: "ansi and fields only",
+			line: "\x1b[2m2025-01-02T03:04:05.678901Z\x1b[0m \x1b[33m WARN\x1b[0m \x1b[2mslim::conn\x1b[0m\x1b[2m:\x1b[0m \x1b[3mretries\x1b[0m\x1b[2m=\x1b[0m5",
+			want: event{level: slog.LevelWarn, target: "slim::conn", fields: []field{{"retries", "5"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.format.parse(tt.line)
+			if !ok {
+				t.Fatalf("parse(%q) failed", tt.line)
+			}
+			tt.want.time = time.Date(2025, 1, 2, 3, 4, 5, 678901000, time.UTC)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parse = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsOtherOutput(t *testing.T) {
+	for _, line := range []string{
+		"hello world\n",
+		"",
+		"2025-01-02T03:04:05Z NOTICE something: happened\n",
+		"2025-01-02T03:04:05Z INFO no target here\n",
+	} {
+		if e, ok := (format{}).parse(line); ok {
+			t.Errorf("parse(%q) = %+v, want rejected", line, e)
+		}
+	}
+}
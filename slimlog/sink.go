@@ -0,0 +1,309 @@
+// Package slimlog routes the logs of the native SLIM library into log/slog.
+//
+// The native library formats its tracing events and writes them to standard
+// output; it offers no callback. A Sink takes over the file descriptor it is
+// given, turns each event back into a slog.Record (level, target, span
+// fields, thread name and ID, event fields) and passes it to a slog.Handler.
+// Anything else written to the descriptor, such as fmt.Println output, goes
+// through to the original destination unchanged.
+//
+// Nothing is captured unless asked for: the descriptor is passed explicitly,
+// and capturing os.Stdout redirects it for the whole process.
+//
+//	sink, err := slimlog.InitializeWithConfigs(os.Stdout, runtimeConfig, tracingConfig, serviceConfigs,
+//		slog.Default().Handler())
+//	if err != nil {
+//		return err
+//	}
+//	defer sink.Close()
+//	sink.SetLevel(slog.LevelWarn)
+package slimlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+const (
+	// partialLineDelay is how long the sink waits for the rest of a line
+	// before handling what it has, so that output without a trailing
+	// newline is not held back.
+	partialLineDelay = 50 * time.Millisecond
+	// queueSize bounds the events waiting for the handler. Further events
+	// are dropped, so that a slow handler never blocks the writers of the
+	// captured descriptor.
+	queueSize = 1024
+)
+
+// Option configures a Sink.
+type Option func(*options)
+
+type options struct {
+	level       slog.Leveler
+	filters     []string
+	threadNames bool
+	threadIds   bool
+}
+
+// WithLevel sets the initial minimum level of the records passed on. Events
+// below the level of the TracingConfig are never emitted by the native
+// library, whatever the level of the sink.
+func WithLevel(level slog.Leveler) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// WithFilters sets the initial filter directives, as with Sink.SetFilters.
+func WithFilters(directives ...string) Option {
+	return func(o *options) {
+		o.filters = directives
+	}
+}
+
+// WithThreads tells the sink whether the native output displays thread names
+// and IDs, as set in the TracingConfig. InitializeWithConfigs sets it.
+func WithThreads(names, ids bool) Option {
+	return func(o *options) {
+		o.threadNames, o.threadIds = names, ids
+	}
+}
+
+// Sink receives the native log output and emits it as slog records.
+type Sink struct {
+	handler atomic.Pointer[slog.Handler]
+	level   slog.LevelVar
+	filters atomic.Pointer[filters]
+	format  format
+
+	capture   *capture
+	queue     chan event
+	dropped   atomic.Uint64
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Install starts capturing what is written to the descriptor of file and
+// passing the tracing events to handler. The native library writes to
+// standard output, so pass os.Stdout to capture it; every write to the
+// descriptor then goes through the sink until Close. Install it before
+// initializing the native library, which may keep its own copy of the file
+// descriptor.
+func Install(file *os.File, handler slog.Handler, opts ...Option) (*Sink, error) {
+	if file == nil {
+		return nil, errors.New("slimlog: no file to capture")
+	}
+	o := options{level: slog.LevelInfo}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	f, err := parseFilters(o.filters)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := startCapture(file)
+	if err != nil {
+		return nil, err
+	}
+	s := newSink(handler, o, f)
+	s.capture = c
+	go s.read()
+	go s.run()
+	return s, nil
+}
+
+func newSink(handler slog.Handler, o options, f *filters) *Sink {
+	s := &Sink{
+		format: format{threadNames: o.threadNames, threadIds: o.threadIds},
+		queue:  make(chan event, queueSize),
+		done:   make(chan struct{}),
+	}
+	s.handler.Store(&handler)
+	s.level.Set(o.level.Level())
+	s.filters.Store(f)
+	return s
+}
+
+// InitializeWithConfigs installs a Sink on file for handler and then
+// initializes the native library with slim_bindings.InitializeWithConfigs.
+// The sink is closed again if initialization fails.
+func InitializeWithConfigs(file *os.File, runtimeConfig slim_bindings.RuntimeConfig, tracingConfig slim_bindings.TracingConfig, serviceConfig []slim_bindings.ServiceConfig, handler slog.Handler, opts ...Option) (*Sink, error) {
+	opts = append([]Option{WithThreads(tracingConfig.DisplayThreadNames, tracingConfig.DisplayThreadIds)}, opts...)
+	s, err := Install(file, handler, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := slim_bindings.InitializeWithConfigs(runtimeConfig, tracingConfig, serviceConfig); err != nil {
+		return nil, errors.Join(err, s.Close())
+	}
+	return s, nil
+}
+
+// SetHandler replaces the handler the records are passed to.
+func (s *Sink) SetHandler(handler slog.Handler) {
+	s.handler.Store(&handler)
+}
+
+// SetLevel sets the minimum level of the records passed on, for targets no
+// filter applies to.
+func (s *Sink) SetLevel(level slog.Level) {
+	s.level.Set(level)
+}
+
+// Level returns the minimum level of the records passed on.
+func (s *Sink) Level() slog.Level {
+	return s.level.Level()
+}
+
+// Dropped returns how many events were discarded because the handler fell
+// behind.
+func (s *Sink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close restores the file descriptor and waits until the output already
+// captured has been handled. It is safe to call more than once.
+func (s *Sink) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.capture.stop()
+		<-s.done
+		s.capture.close()
+	})
+	return s.closeErr
+}
+
+// read splits the captured output into lines and queues their events for
+// run. A partial line is handled on its own once no more output follows
+// within partialLineDelay.
+func (s *Sink) read() {
+	defer close(s.queue)
+	reader := s.capture.reader
+	buf := make([]byte, 32*1024)
+	var pending []byte
+	waiting := false
+	for {
+		n, err := reader.Read(buf)
+		pending = append(pending, buf[:n]...)
+		for {
+			i := bytes.IndexByte(pending, '\n')
+			if i < 0 {
+				break
+			}
+			s.route(string(pending[:i+1]))
+			pending = pending[i+1:]
+		}
+		pending = append([]byte(nil), pending...)
+
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			s.route(string(pending))
+			pending = nil
+			err = nil
+		} else if err != nil {
+			if len(pending) > 0 {
+				s.route(string(pending))
+			}
+			if !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrClosed) {
+				slog.Default().Error("slimlog: reading native output", "error", err)
+			}
+			return
+		}
+
+		switch {
+		case len(pending) > 0:
+			waiting = true
+			_ = reader.SetReadDeadline(time.Now().Add(partialLineDelay))
+		case waiting:
+			waiting = false
+			_ = reader.SetReadDeadline(time.Time{})
+		}
+	}
+}
+
+// route queues the event of a line, or forwards the line to the original
+// destination when it is not a tracing event.
+func (s *Sink) route(line string) {
+	e, ok := s.event(line)
+	if !ok {
+		return
+	}
+	select {
+	case s.queue <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// event parses line and reports whether it is an event the sink keeps.
+// Other output is forwarded to the original destination.
+func (s *Sink) event(line string) (event, bool) {
+	e, ok := s.format.parse(line)
+	if !ok {
+		_, _ = io.WriteString(s.capture.original, line)
+		return e, false
+	}
+	return e, s.enabled(e.target, e.level)
+}
+
+// run passes the queued events to the handler.
+func (s *Sink) run() {
+	defer close(s.done)
+	for e := range s.queue {
+		s.emit(e)
+	}
+}
+
+func (s *Sink) emit(e event) {
+	handler := *s.handler.Load()
+	ctx := context.Background()
+	if !handler.Enabled(ctx, e.level) {
+		return
+	}
+	_ = handler.Handle(ctx, e.record())
+}
+
+// record converts the event to a slog record. The target, thread and span
+// path ("outer:inner") are plain attributes; the fields of each span are in a
+// group named after it, within a "spans" group.
+func (e event) record() slog.Record {
+	r := slog.NewRecord(e.time, e.level, e.message, 0)
+	r.AddAttrs(slog.String("target", e.target))
+	if e.threadName != "" {
+		r.AddAttrs(slog.String("thread.name", e.threadName))
+	}
+	if e.threadId != "" {
+		r.AddAttrs(slog.String("thread.id", e.threadId))
+	}
+	if len(e.spans) > 0 {
+		names := make([]string, 0, len(e.spans))
+		spans := make([]any, 0, len(e.spans))
+		for _, sp := range e.spans {
+			names = append(names, sp.name)
+			spans = append(spans, slog.Group(sp.name, attrs(sp.fields)...))
+		}
+		r.AddAttrs(slog.String("span", strings.Join(names, ":")), slog.Group("spans", spans...))
+	}
+	for _, f := range e.fields {
+		r.AddAttrs(slog.String(f.key, f.value))
+	}
+	return r
+}
+
+func attrs(fields []field) []any {
+	out := make([]any, 0, len(fields))
+	for _, f := range fields {
+		out = append(out, slog.String(f.key, f.value))
+	}
+	return out
+}
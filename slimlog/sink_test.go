@@ -0,0 +1,185 @@
+//go:build unix
+
+package slimlog
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder keeps the records it handles.
+type recorder struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (r *recorder) Enabled(context.Context, slog.Level) bool { return true }
+
+func (r *recorder) Handle(_ context.Context, record slog.Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+	return nil
+}
+
+func (r *recorder) WithAttrs([]slog.Attr) slog.Handler { return r }
+func (r *recorder) WithGroup(string) slog.Handler      { return r }
+
+func TestSinkCapturesNativeOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stdout")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records := &recorder{}
+	sink, err := Install(file, records, WithThreads(false, true))
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	// The native library writes to the descriptor, not through the *os.File.
+	out := os.NewFile(file.Fd(), "native")
+	for _, line := range []string{
+		"2025-01-02T03:04:05Z  INFO ThreadId(02) conn{id=1}: slim::conn: connected peer=node\n",
+		"2025-01-02T03:04:05Z DEBUG ThreadId(02) slim::conn: filtered\n",
+		"plain output\n",
+	} {
+		if _, err := out.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	if len(records.records) != 1 {
+		t.Fatalf("handled %d records, want 1 above the info level", len(records.records))
+	}
+	r := records.records[0]
+	attrs := map[string]string{}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value.String()
+		return true
+	})
+	if r.Message != "connected" || r.Level != slog.LevelInfo || attrs["target"] != "slim::conn" ||
+		attrs["thread.id"] != "02" || attrs["span"] != "conn" || attrs["peer"] != "node" {
+		t.Errorf("record = %q %s %v", r.Message, r.Level, attrs)
+	}
+
+	if _, err := file.WriteString("after close\n"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "plain output\nafter close\n" {
+		t.Errorf("original destination got %q", data)
+	}
+}
+
+func TestSinkLevelIsAdjustable(t *testing.T) {
+	records := &recorder{}
+	sink := newSink(nil, options{level: slog.LevelInfo}, &filters{})
+	sink.SetHandler(records)
+	sink.SetLevel(LevelTrace)
+	handle := func(line string) {
+		if e, ok := sink.event(line); ok {
+			sink.emit(e)
+		}
+	}
+	handle("2025-01-02T03:04:05Z TRACE slim::conn: detail\n")
+	sink.SetLevel(slog.LevelError)
+	handle("2025-01-02T03:04:05Z WARN slim::conn: ignored\n")
+	if sink.Level() != slog.LevelError || len(records.records) != 1 {
+		t.Errorf("level %s, %d records; want ERROR and 1", sink.Level(), len(records.records))
+	}
+}
+
+func TestInstallNeedsFile(t *testing.T) {
+	if _, err := Install(nil, &recorder{}); err == nil {
+		t.Error("Install without a file succeeded")
+	}
+}
+
+// blockedHandler blocks every record until release is closed.
+type blockedHandler struct {
+	recorder
+	release chan struct{}
+}
+
+func (b *blockedHandler) Handle(ctx context.Context, record slog.Record) error {
+	<-b.release
+	return b.recorder.Handle(ctx, record)
+}
+
+func TestSinkDoesNotHoldBackOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stdout")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	handler := &blockedHandler{release: make(chan struct{})}
+	sink, err := Install(file, handler)
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	out := os.NewFile(file.Fd(), "native")
+
+	// Events beyond the queue are dropped rather than block the writer
+	// while the handler is stuck.
+	written := make(chan error, 1)
+	go func() {
+		for range queueSize + 10 {
+			if _, err := out.WriteString("2025-01-02T03:04:05Z  INFO slim::conn: event\n"); err != nil {
+				written <- err
+				return
+			}
+		}
+		_, err := out.WriteString("prompt> ")
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes blocked behind the handler")
+	}
+
+	// A partial line reaches the original destination without a newline.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if string(data) == "prompt> " {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("original destination got %q, want the partial line", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(handler.release)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if sink.Dropped() == 0 {
+		t.Error("no events dropped behind a stuck handler")
+	}
+	if total := uint64(len(handler.records)) + sink.Dropped(); total != queueSize+10 {
+		t.Errorf("handled %d + dropped %d events, want %d", len(handler.records), sink.Dropped(), queueSize+10)
+	}
+}
@@ -0,0 +1,306 @@
+// Package slimmetrics exports Prometheus metrics for SLIM connections,
+// sessions and slimrpc calls. It is opt-in: nothing is measured until a
+// Metrics is registered and wired into the objects to observe.
+//
+//	m := slimmetrics.New()
+//	registry.MustRegister(m)
+//
+//	untrack, err := m.TrackConnection("primary", conns)
+//	session := slimsession.Wrap(raw, slimsession.WithCompletionHook(m.ObserveCompletion))
+//	m.TrackSession(session)
+//	client := pb.NewTestClient(slimrpc.InterceptChannel(channel, m.ClientInterceptor()))
+//	pb.RegisterTestServer(slimrpc.InterceptServer(server, m.ServerInterceptor()), impl)
+package slimmetrics
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+	"github.com/agntcy/slim-bindings-go/slimconn"
+	"github.com/agntcy/slim-bindings-go/slimrpc"
+	"github.com/agntcy/slim-bindings-go/slimsession"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultNamespace prefixes every metric name.
+const DefaultNamespace = "slim"
+
+// Option configures a Metrics.
+type Option func(*options)
+
+type options struct {
+	namespace   string
+	buckets     []float64
+	constLabels prometheus.Labels
+}
+
+// WithNamespace replaces DefaultNamespace as the metric name prefix.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithBuckets sets the histogram buckets, in seconds, of the latency metrics.
+func WithBuckets(buckets []float64) Option {
+	return func(o *options) {
+		o.buckets = buckets
+	}
+}
+
+// WithConstLabels adds labels to every metric, for example to tell apart
+// several agents in one process.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(o *options) {
+		o.constLabels = labels
+	}
+}
+
+// Metrics is a prometheus.Collector for SLIM. Register it with any
+// prometheus.Registerer.
+type Metrics struct {
+	mu          sync.Mutex
+	connections map[*slimconn.ConnectionManager]string
+	sessions    map[*slimsession.Session]struct{}
+	// detached accumulates the counters of untracked sessions, so that the
+	// totals never go backwards.
+	detached slimsession.Stats
+
+	connectionState      *prometheus.Desc
+	connectionReconnects *prometheus.Desc
+	connectionMessages   *prometheus.Desc
+	connectionBytes      *prometheus.Desc
+	connectionRTT        *prometheus.Desc
+
+	sessionsActive       *prometheus.Desc
+	sessionMessages      *prometheus.Desc
+	sessionBytes         *prometheus.Desc
+	sessionRetransmitted *prometheus.Desc
+	sessionDropped       *prometheus.Desc
+	sessionDuplicates    *prometheus.Desc
+	sessionBuffered      *prometheus.Desc
+
+	completion *prometheus.HistogramVec
+
+	client rpcMetrics
+	server rpcMetrics
+}
+
+// rpcMetrics are the per-method slimrpc metrics of one side.
+type rpcMetrics struct {
+	started  *prometheus.CounterVec
+	handled  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func newRPCMetrics(o options, side string) rpcMetrics {
+	labels := []string{"service", "method", "kind"}
+	return rpcMetrics{
+		started: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace, Subsystem: "rpc_" + side, Name: "started_total",
+			Help:        "slimrpc calls started, by method.",
+			ConstLabels: o.constLabels,
+		}, labels),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace, Subsystem: "rpc_" + side, Name: "handled_total",
+			Help:        "slimrpc calls completed, by method and RpcCode.",
+			ConstLabels: o.constLabels,
+		}, append(labels, "code")),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace, Subsystem: "rpc_" + side, Name: "handling_seconds",
+			Help:        "Duration of slimrpc calls, by method. For streaming client calls, the time to open the stream.",
+			ConstLabels: o.constLabels,
+			Buckets:     o.buckets,
+		}, labels),
+	}
+}
+
+// New returns Metrics with no connection or session tracked yet.
+func New(opts ...Option) *Metrics {
+	o := options{namespace: DefaultNamespace, buckets: prometheus.DefBuckets}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	desc := func(subsystem, name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(o.namespace, subsystem, name), help, labels, o.constLabels)
+	}
+
+	return &Metrics{
+		connections: make(map[*slimconn.ConnectionManager]string),
+		sessions:    make(map[*slimsession.Session]struct{}),
+
+		connectionState:      desc("connection", "state", "1 for the current state of each tracked connection.", "connection", "endpoint", "state"),
+		connectionReconnects: desc("connection", "reconnects_total", "Reconnections of each tracked connection.", "connection"),
+		connectionMessages:   desc("connection", "messages_total", "Messages through each tracked connection, by direction.", "connection", "direction"),
+		connectionBytes:      desc("connection", "bytes_total", "Payload bytes through each tracked connection, by direction.", "connection", "direction"),
+		connectionRTT:        desc("connection", "rtt_seconds", "Smoothed acknowledgement round-trip time of each tracked connection.", "connection"),
+
+		sessionsActive:       desc("", "sessions_active", "Tracked sessions."),
+		sessionMessages:      desc("session", "messages_total", "Messages published and received by sessions, by direction.", "direction"),
+		sessionBytes:         desc("session", "bytes_total", "Payload bytes published and received by sessions, by direction.", "direction"),
+		sessionRetransmitted: desc("session", "retransmitted_total", "Messages published again by sessions."),
+		sessionDropped:       desc("session", "dropped_total", "Messages dropped by the receive buffer overflow policy."),
+		sessionDuplicates:    desc("session", "duplicates_total", "Duplicate messages discarded by sessions."),
+		sessionBuffered:      desc("session", "buffered_messages", "Messages waiting to be received."),
+
+		completion: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace, Subsystem: "session", Name: "completion_seconds",
+			Help:        "Time from publish to delivery confirmation, by outcome.",
+			ConstLabels: o.constLabels,
+			Buckets:     o.buckets,
+		}, []string{"outcome"}),
+
+		client: newRPCMetrics(o, "client"),
+		server: newRPCMetrics(o, "server"),
+	}
+}
+
+// TrackConnection reports the state and traffic of conns under the given
+// connection label until untrack is called. The label must be unique among
+// the tracked connections, and a connection is tracked once.
+func (m *Metrics) TrackConnection(name string, conns *slimconn.ConnectionManager) (untrack func(), err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tracked, ok := m.connections[conns]; ok {
+		return nil, fmt.Errorf("slimmetrics: connection already tracked as %q", tracked)
+	}
+	for _, tracked := range m.connections {
+		if tracked == name {
+			return nil, fmt.Errorf("slimmetrics: connection %q already tracked", name)
+		}
+	}
+	m.connections[conns] = name
+	return func() {
+		m.mu.Lock()
+		delete(m.connections, conns)
+		m.mu.Unlock()
+	}, nil
+}
+
+// TrackSession adds the counters of session to the session metrics until
+// untrack is called.
+func (m *Metrics) TrackSession(session *slimsession.Session) (untrack func()) {
+	m.mu.Lock()
+	m.sessions[session] = struct{}{}
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.sessions[session]; !ok {
+			return
+		}
+		delete(m.sessions, session)
+		m.detached.Add(session.Stats())
+	}
+}
+
+// ObserveCompletion records a publish completion. Pass it to
+// slimsession.WithCompletionHook.
+func (m *Metrics) ObserveCompletion(elapsed time.Duration, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	m.completion.WithLabelValues(outcome).Observe(elapsed.Seconds())
+}
+
+// ClientInterceptor returns a slimrpc.ClientInterceptor that counts calls
+// per method and RpcCode and times them. Pass it to slimrpc.InterceptChannel.
+func (m *Metrics) ClientInterceptor() slimrpc.ClientInterceptor {
+	return func(info slimrpc.CallInfo, _ map[string]string) func(error) {
+		return m.client.start(info)
+	}
+}
+
+// ServerInterceptor returns a slimrpc.ServerInterceptor that counts handled
+// calls per method and RpcCode and times them. Pass it to
+// slimrpc.InterceptServer.
+func (m *Metrics) ServerInterceptor() slimrpc.ServerInterceptor {
+	return func(info slimrpc.CallInfo, _ *slim_bindings.Context) func(error) {
+		return m.server.start(info)
+	}
+}
+
+func (r rpcMetrics) start(info slimrpc.CallInfo) func(error) {
+	kind := info.Kind.String()
+	r.started.WithLabelValues(info.Service, info.Method, kind).Inc()
+	start := time.Now()
+	return func(err error) {
+		r.duration.WithLabelValues(info.Service, info.Method, kind).Observe(time.Since(start).Seconds())
+		r.handled.WithLabelValues(info.Service, info.Method, kind, slimrpc.CodeName(slimrpc.Code(err))).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		m.connectionState, m.connectionReconnects, m.connectionMessages, m.connectionBytes, m.connectionRTT,
+		m.sessionsActive, m.sessionMessages, m.sessionBytes, m.sessionRetransmitted, m.sessionDropped,
+		m.sessionDuplicates, m.sessionBuffered,
+	} {
+		ch <- desc
+	}
+	m.completion.Describe(ch)
+	for _, r := range []rpcMetrics{m.client, m.server} {
+		r.started.Describe(ch)
+		r.handled.Describe(ch)
+		r.duration.Describe(ch)
+	}
+}
+
+var states = []slimconn.State{
+	slimconn.StateConnecting,
+	slimconn.StateReady,
+	slimconn.StateTransientFailure,
+	slimconn.StateClosed,
+}
+
+// Collect implements prometheus.Collector. Connection and session metrics
+// are read from their Stats at collection time.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for conns, name := range m.connections {
+		stats := conns.Stats()
+		for _, state := range states {
+			value := 0.0
+			if stats.State == state {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(m.connectionState, prometheus.GaugeValue, value, name, stats.Endpoint, state.String())
+		}
+		ch <- prometheus.MustNewConstMetric(m.connectionReconnects, prometheus.CounterValue, float64(stats.Reconnects), name)
+		ch <- prometheus.MustNewConstMetric(m.connectionMessages, prometheus.CounterValue, float64(stats.MessagesIn), name, "in")
+		ch <- prometheus.MustNewConstMetric(m.connectionMessages, prometheus.CounterValue, float64(stats.MessagesOut), name, "out")
+		ch <- prometheus.MustNewConstMetric(m.connectionBytes, prometheus.CounterValue, float64(stats.BytesIn), name, "in")
+		ch <- prometheus.MustNewConstMetric(m.connectionBytes, prometheus.CounterValue, float64(stats.BytesOut), name, "out")
+		ch <- prometheus.MustNewConstMetric(m.connectionRTT, prometheus.GaugeValue, stats.RTT.Seconds(), name)
+	}
+
+	total := m.detached
+	var buffered int
+	for session := range m.sessions {
+		stats := session.Stats()
+		total.Add(stats)
+		buffered += stats.Buffered
+	}
+	ch <- prometheus.MustNewConstMetric(m.sessionsActive, prometheus.GaugeValue, float64(len(m.sessions)))
+	ch <- prometheus.MustNewConstMetric(m.sessionMessages, prometheus.CounterValue, float64(total.Received), "in")
+	ch <- prometheus.MustNewConstMetric(m.sessionMessages, prometheus.CounterValue, float64(total.Published), "out")
+	ch <- prometheus.MustNewConstMetric(m.sessionBytes, prometheus.CounterValue, float64(total.ReceivedBytes), "in")
+	ch <- prometheus.MustNewConstMetric(m.sessionBytes, prometheus.CounterValue, float64(total.PublishedBytes), "out")
+	ch <- prometheus.MustNewConstMetric(m.sessionRetransmitted, prometheus.CounterValue, float64(total.Retransmitted))
+	ch <- prometheus.MustNewConstMetric(m.sessionDropped, prometheus.CounterValue, float64(total.Dropped))
+	ch <- prometheus.MustNewConstMetric(m.sessionDuplicates, prometheus.CounterValue, float64(total.Duplicates))
+	ch <- prometheus.MustNewConstMetric(m.sessionBuffered, prometheus.GaugeValue, float64(buffered))
+
+	m.completion.Collect(ch)
+	for _, r := range []rpcMetrics{m.client, m.server} {
+		r.started.Collect(ch)
+		r.handled.Collect(ch)
+		r.duration.Collect(ch)
+	}
+}
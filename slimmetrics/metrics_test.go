@@ -0,0 +1,146 @@
+package slimmetrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+	"github.com/agntcy/slim-bindings-go/slimconn"
+	"github.com/agntcy/slim-bindings-go/slimrpc"
+	"github.com/agntcy/slim-bindings-go/slimsession"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// sinkSession accepts and discards every publish.
+type sinkSession struct {
+	slim_bindings.SessionInterface
+}
+
+func (sinkSession) Publish([]byte, *string, *map[string]string) (*slim_bindings.CompletionHandle, error) {
+	return nil, nil
+}
+
+func TestRPCMetrics(t *testing.T) {
+	m := New()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(m)
+
+	info := slimrpc.CallInfo{Service: "pkg.Svc", Method: "Get", Kind: slimrpc.KindUnaryUnary}
+	m.ClientInterceptor()(info, map[string]string{})(nil)
+	m.ClientInterceptor()(info, map[string]string{})(slim_bindings.NewRpcErrorRpc(slim_bindings.RpcCodeNotFound, "", nil))
+	m.ServerInterceptor()(info, nil)(errors.New("boom"))
+
+	if got := testutil.ToFloat64(m.client.started.WithLabelValues("pkg.Svc", "Get", "unary_unary")); got != 2 {
+		t.Errorf("client started = %v, want 2", got)
+	}
+	for code, want := range map[string]float64{"OK": 1, "NOT_FOUND": 1} {
+		if got := testutil.ToFloat64(m.client.handled.WithLabelValues("pkg.Svc", "Get", "unary_unary", code)); got != want {
+			t.Errorf("client handled %s = %v, want %v", code, got, want)
+		}
+	}
+	if got := testutil.ToFloat64(m.server.handled.WithLabelValues("pkg.Svc", "Get", "unary_unary", "UNKNOWN")); got != 1 {
+		t.Errorf("server handled UNKNOWN = %v, want 1", got)
+	}
+	if n, err := testutil.GatherAndCount(registry, "slim_rpc_client_handling_seconds", "slim_rpc_server_handling_seconds"); err != nil || n != 2 {
+		t.Errorf("handling histograms = %d (%v), want 2", n, err)
+	}
+}
+
+func TestSessionMetrics(t *testing.T) {
+	m := New(WithNamespace("test"))
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(m)
+
+	session := slimsession.Wrap(sinkSession{}, slimsession.WithCompletionHook(m.ObserveCompletion))
+	untrack := m.TrackSession(session)
+	for range 2 {
+		completion, err := session.Publish([]byte("ping"), nil, nil)
+		if err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		if err := completion.Wait(); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+	untrack()
+	untrack()
+
+	expected := `
+# HELP test_session_messages_total Messages published and received by sessions, by direction.
+# TYPE test_session_messages_total counter
+test_session_messages_total{direction="in"} 0
+test_session_messages_total{direction="out"} 2
+# HELP test_sessions_active Tracked sessions.
+# TYPE test_sessions_active gauge
+test_sessions_active 0
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "test_session_messages_total", "test_sessions_active"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(m.completion, "test_session_completion_seconds"); got != 1 {
+		t.Errorf("completion series = %d, want 1", got)
+	}
+}
+
+// fakeService accepts every connection as connection 1.
+type fakeService struct {
+	slim_bindings.ServiceInterface
+}
+
+func (fakeService) Connect(slim_bindings.ClientConfig) (uint64, error) { return 1, nil }
+func (fakeService) Disconnect(uint64) error                            { return nil }
+func (fakeService) GetConnectionId(string) *uint64 {
+	connId := uint64(1)
+	return &connId
+}
+
+func TestTrackConnectionRejectsDuplicates(t *testing.T) {
+	m := New()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(m)
+
+	var conns [2]*slimconn.ConnectionManager
+	for i := range conns {
+		c, err := slimconn.NewConnectionManager(context.Background(), fakeService{}, slim_bindings.ClientConfig{Endpoint: "node"})
+		if err != nil {
+			t.Fatalf("NewConnectionManager: %v", err)
+		}
+		defer c.Close()
+		conns[i] = c
+	}
+
+	untrack, err := m.TrackConnection("primary", conns[0])
+	if err != nil {
+		t.Fatalf("TrackConnection: %v", err)
+	}
+	if _, err := m.TrackConnection("primary", conns[1]); err == nil {
+		t.Error("tracking a second connection as primary succeeded")
+	}
+	if _, err := m.TrackConnection("secondary", conns[0]); err == nil {
+		t.Error("tracking a connection twice succeeded")
+	}
+	if _, err := m.TrackConnection("secondary", conns[1]); err != nil {
+		t.Fatalf("TrackConnection: %v", err)
+	}
+	if n, err := testutil.GatherAndCount(registry, "slim_connection_reconnects_total"); err != nil || n != 2 {
+		t.Errorf("reconnect series = %d (%v), want 2", n, err)
+	}
+
+	untrack()
+	if _, err := m.TrackConnection("primary", conns[0]); err != nil {
+		t.Errorf("TrackConnection after untrack: %v", err)
+	}
+}
+
+func TestObserveCompletionOutcome(t *testing.T) {
+	m := New()
+	m.ObserveCompletion(time.Millisecond, nil)
+	m.ObserveCompletion(time.Second, errors.New("lost"))
+	if got := testutil.CollectAndCount(m.completion); got != 2 {
+		t.Errorf("completion series = %d, want ok and error", got)
+	}
+}
@@ -0,0 +1,237 @@
+// Package slimotel traces SLIM with OpenTelemetry. It starts client and
+// server spans around slimrpc calls and producer and consumer spans around
+// session messages, and carries the W3C trace context (traceparent,
+// tracestate) from one side to the other in the message metadata.
+//
+//	tracing := slimotel.New()
+//	client := pb.NewTestClient(slimrpc.InterceptChannel(channel, tracing.ClientInterceptor()))
+//	pb.RegisterTestServer(slimrpc.InterceptServer(server, tracing.ServerInterceptor()), impl)
+//
+//	completion, err := tracing.Publish(ctx, session, data, nil, nil)
+//	ctx, msg, err := tracing.Receive(ctx, session)
+package slimotel
+
+import (
+	"context"
+	"maps"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+	"github.com/agntcy/slim-bindings-go/slimrpc"
+	"github.com/agntcy/slim-bindings-go/slimsession"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the spans.
+const ScopeName = "github.com/agntcy/slim-bindings-go/slimotel"
+
+// Option configures a Tracing.
+type Option func(*options)
+
+type options struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// WithTracerProvider sets the provider of the tracer. It defaults to the
+// global provider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *options) {
+		o.provider = provider
+	}
+}
+
+// WithPropagator sets how the trace context is written to and read from
+// metadata. It defaults to the W3C trace context, which is also what
+// slimrpc.ContextFromRpcContext reads.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(o *options) {
+		o.propagator = propagator
+	}
+}
+
+// Tracing creates spans for slimrpc calls and session messages.
+type Tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New returns a Tracing.
+func New(opts ...Option) *Tracing {
+	o := options{propagator: propagation.TraceContext{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.provider == nil {
+		o.provider = otel.GetTracerProvider()
+	}
+	return &Tracing{
+		tracer:     o.provider.Tracer(ScopeName),
+		propagator: o.propagator,
+	}
+}
+
+// Inject writes the trace context of ctx to metadata.
+func (t *Tracing) Inject(ctx context.Context, metadata map[string]string) {
+	t.propagator.Inject(ctx, propagation.MapCarrier(metadata))
+}
+
+// Extract returns ctx with the trace context read from metadata.
+func (t *Tracing) Extract(ctx context.Context, metadata map[string]string) context.Context {
+	return t.propagator.Extract(ctx, propagation.MapCarrier(metadata))
+}
+
+// OutgoingContext returns ctx with its trace context added to the slimrpc
+// metadata of ctx. When the call metadata comes from that context, a
+// ClientInterceptor then starts its span as a child of the span in ctx rather
+// than as a new trace.
+func (t *Tracing) OutgoingContext(ctx context.Context) context.Context {
+	metadata, _ := slimrpc.MetadataFromContext(ctx)
+	metadata = maps.Clone(metadata)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	t.Inject(ctx, metadata)
+	return slimrpc.WithMetadata(ctx, metadata)
+}
+
+// ClientInterceptor returns a slimrpc.ClientInterceptor that starts a client
+// span named after the method for each call and sends its trace context in
+// the call metadata. The parent is the trace context already in the metadata,
+// if any. For streaming calls the span covers opening the stream.
+func (t *Tracing) ClientInterceptor() slimrpc.ClientInterceptor {
+	return func(info slimrpc.CallInfo, metadata map[string]string) func(error) {
+		parent := t.Extract(context.Background(), metadata)
+		ctx, span := t.tracer.Start(parent, info.FullMethod(),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(rpcAttributes(info)...))
+		t.Inject(ctx, metadata)
+		return func(err error) {
+			end(span, err)
+		}
+	}
+}
+
+// ServerInterceptor returns a slimrpc.ServerInterceptor that starts a server
+// span named after the method for each call, continuing the trace of the
+// caller. The handler's context, from slimrpc.ContextFromRpcContext, carries
+// the span.
+func (t *Tracing) ServerInterceptor() slimrpc.ServerInterceptor {
+	return func(info slimrpc.CallInfo, rpcContext *slim_bindings.Context) func(error) {
+		parent := context.Background()
+		if rpcContext != nil {
+			parent = t.Extract(parent, rpcContext.Metadata())
+		}
+		ctx, span := t.tracer.Start(parent, info.FullMethod(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(rpcAttributes(info)...))
+		unbind := func() {}
+		if rpcContext != nil {
+			unbind = slimrpc.BindContext(rpcContext, ctx)
+		}
+		return func(err error) {
+			unbind()
+			end(span, err)
+		}
+	}
+}
+
+func rpcAttributes(info slimrpc.CallInfo) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("rpc.system", "slimrpc"),
+		attribute.String("rpc.service", info.Service),
+		attribute.String("rpc.method", info.Method),
+		attribute.String("rpc.slimrpc.kind", info.Kind.String()),
+		attribute.Bool("rpc.slimrpc.multicast", info.Multicast),
+	}
+}
+
+// end records the outcome of an RPC on span and ends it.
+func end(span trace.Span, err error) {
+	code := slimrpc.Code(err)
+	span.SetAttributes(attribute.Int("rpc.slimrpc.status_code", int(code)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, slimrpc.CodeName(code))
+	}
+	span.End()
+}
+
+// Publish publishes data on session within a producer span, child of the
+// span in ctx, and sends the span's trace context in the message metadata.
+func (t *Tracing) Publish(ctx context.Context, session *slimsession.Session, data []byte, payloadType *string, metadata *map[string]string) (*slimsession.Completion, error) {
+	span, metadata := t.startPublish(ctx, len(data), metadata)
+	completion, err := session.Publish(data, payloadType, metadata)
+	endMessage(span, err)
+	return completion, err
+}
+
+// PublishTo replies to the sender of a received message like Publish.
+func (t *Tracing) PublishTo(ctx context.Context, session *slimsession.Session, messageContext slim_bindings.MessageContext, data []byte, payloadType *string, metadata *map[string]string) (*slimsession.Completion, error) {
+	span, metadata := t.startPublish(ctx, len(data), metadata)
+	completion, err := session.PublishTo(messageContext, data, payloadType, metadata)
+	endMessage(span, err)
+	return completion, err
+}
+
+// startPublish starts a producer span and returns it with a copy of metadata
+// carrying its trace context.
+func (t *Tracing) startPublish(ctx context.Context, size int, metadata *map[string]string) (trace.Span, *map[string]string) {
+	ctx, span := t.tracer.Start(ctx, "publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messageAttributes("publish", size)...))
+	md := map[string]string{}
+	if metadata != nil {
+		md = maps.Clone(*metadata)
+	}
+	t.Inject(ctx, md)
+	return span, &md
+}
+
+// Receive receives the next message of session within a consumer span. The
+// span continues the trace of the sender and links to the span in ctx, if
+// any. The returned context carries the span, so that the work done on the
+// message joins the sender's trace.
+func (t *Tracing) Receive(ctx context.Context, session *slimsession.Session) (context.Context, *slimsession.Message, error) {
+	msg, err := session.Receive(ctx)
+	if err != nil {
+		return ctx, nil, err
+	}
+	return t.Consume(ctx, msg.Context, len(msg.Payload)), msg, nil
+}
+
+// Consume records the receipt of a message, obtained by any other means than
+// Receive, in a consumer span and returns the context to process it with.
+func (t *Tracing) Consume(ctx context.Context, messageContext slim_bindings.MessageContext, size int) context.Context {
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messageAttributes("receive", size)...),
+	}
+	if local := trace.SpanContextFromContext(ctx); local.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: local}))
+	}
+	parent := t.Extract(trace.ContextWithSpanContext(ctx, trace.SpanContext{}), messageContext.Metadata)
+	ctx, span := t.tracer.Start(parent, "receive", opts...)
+	span.End()
+	return ctx
+}
+
+func messageAttributes(operation string, size int) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", "slim"),
+		attribute.String("messaging.operation.name", operation),
+		attribute.Int("messaging.message.body.size", size),
+	}
+}
+
+// endMessage records the outcome of a publish on span and ends it.
+func endMessage(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
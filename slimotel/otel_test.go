@@ -0,0 +1,150 @@
+package slimotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+	"github.com/agntcy/slim-bindings-go/slimrpc"
+	"github.com/agntcy/slim-bindings-go/slimsession"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTracing() (*Tracing, *tracetest.SpanRecorder, trace.Tracer) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return New(WithTracerProvider(provider)), recorder, provider.Tracer("test")
+}
+
+// loopSession delivers every published message back to the receiver.
+type loopSession struct {
+	slim_bindings.SessionInterface
+	frames chan slim_bindings.ReceivedMessage
+}
+
+func (l *loopSession) Publish(data []byte, payloadType *string, metadata *map[string]string) (*slim_bindings.CompletionHandle, error) {
+	msg := slim_bindings.ReceivedMessage{Payload: data, Context: slim_bindings.MessageContext{Metadata: map[string]string{}}}
+	if metadata != nil {
+		msg.Context.Metadata = *metadata
+	}
+	l.frames <- msg
+	return nil, nil
+}
+
+func (l *loopSession) GetMessage(timeout *time.Duration) (slim_bindings.ReceivedMessage, error) {
+	select {
+	case msg := <-l.frames:
+		return msg, nil
+	case <-time.After(*timeout):
+		return slim_bindings.ReceivedMessage{}, slim_bindings.NewSlimErrorTimeout()
+	}
+}
+
+func TestClientSpanContinuesOutgoingContext(t *testing.T) {
+	tracing, recorder, tracer := newTracing()
+	ctx, parent := tracer.Start(context.Background(), "caller")
+	ctx = tracing.OutgoingContext(ctx)
+	metadata, _ := slimrpc.MetadataFromContext(ctx)
+
+	info := slimrpc.CallInfo{Service: "pkg.Svc", Method: "Get", Kind: slimrpc.KindUnaryUnary}
+	done := tracing.ClientInterceptor()(info, metadata)
+	done(slim_bindings.NewRpcErrorRpc(slim_bindings.RpcCodeNotFound, "missing", nil))
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended %d spans, want 2", len(spans))
+	}
+	client := spans[0]
+	if client.Name() != "pkg.Svc/Get" || client.SpanKind() != trace.SpanKindClient {
+		t.Errorf("client span = %s (%s)", client.Name(), client.SpanKind())
+	}
+	if client.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("client span parent = %s, want the caller span", client.Parent().SpanID())
+	}
+	if client.Status().Code != codes.Error || client.Status().Description != "NOT_FOUND" {
+		t.Errorf("client span status = %+v", client.Status())
+	}
+	// The metadata sent now names the client span.
+	sent := tracing.Extract(context.Background(), metadata)
+	if trace.SpanContextFromContext(sent).SpanID() != client.SpanContext().SpanID() {
+		t.Errorf("traceparent = %q does not name the client span", metadata["traceparent"])
+	}
+}
+
+func TestServerSpanStartsTrace(t *testing.T) {
+	tracing, recorder, _ := newTracing()
+	info := slimrpc.CallInfo{Service: "pkg.Svc", Method: "Get", Kind: slimrpc.KindUnaryUnary}
+	tracing.ServerInterceptor()(info, nil)(nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].SpanKind() != trace.SpanKindServer || spans[0].Parent().IsValid() {
+		t.Fatalf("spans = %v, want one root server span", spans)
+	}
+	if spans[0].Status().Code == codes.Error {
+		t.Errorf("status = %+v, want unset", spans[0].Status())
+	}
+}
+
+func TestSessionSpansPropagateTrace(t *testing.T) {
+	tracing, recorder, tracer := newTracing()
+	session := slimsession.Wrap(&loopSession{frames: make(chan slim_bindings.ReceivedMessage, 1)})
+
+	ctx, parent := tracer.Start(context.Background(), "producer")
+	metadata := map[string]string{"key": "value"}
+	if _, err := tracing.Publish(ctx, session, []byte("hello"), nil, &metadata); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	parent.End()
+	if len(metadata) != 1 {
+		t.Errorf("caller metadata was modified: %v", metadata)
+	}
+
+	rctx, msg, err := tracing.Receive(context.Background(), session)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if msg.Context.Metadata["key"] != "value" {
+		t.Errorf("metadata = %v", msg.Context.Metadata)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("ended %d spans, want 3", len(spans))
+	}
+	producer, consumer := spans[0], spans[2]
+	if producer.SpanKind() != trace.SpanKindProducer || producer.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("producer span = %s, parent %s", producer.SpanKind(), producer.Parent().SpanID())
+	}
+	if consumer.SpanKind() != trace.SpanKindConsumer || consumer.Parent().SpanID() != producer.SpanContext().SpanID() {
+		t.Errorf("consumer span = %s, parent %s", consumer.SpanKind(), consumer.Parent().SpanID())
+	}
+	if trace.SpanContextFromContext(rctx).SpanID() != consumer.SpanContext().SpanID() {
+		t.Error("Receive context does not carry the consumer span")
+	}
+}
+
+func TestPublishErrorIsRecorded(t *testing.T) {
+	tracing, recorder, _ := newTracing()
+	session := slimsession.Wrap(failingSession{})
+	if _, err := tracing.Publish(context.Background(), session, []byte("x"), nil, nil); err == nil {
+		t.Fatal("Publish succeeded")
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Status().Code != codes.Error {
+		t.Fatalf("spans = %v, want one failed producer span", spans)
+	}
+}
+
+type failingSession struct {
+	slim_bindings.SessionInterface
+}
+
+func (failingSession) Publish([]byte, *string, *map[string]string) (*slim_bindings.CompletionHandle, error) {
+	return nil, errors.New("closed")
+}
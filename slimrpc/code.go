@@ -0,0 +1,60 @@
+package slimrpc
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+var codeNames = map[slim_bindings.RpcCode]string{
+	slim_bindings.RpcCodeOk:                 "OK",
+	slim_bindings.RpcCodeCancelled:          "CANCELLED",
+	slim_bindings.RpcCodeUnknown:            "UNKNOWN",
+	slim_bindings.RpcCodeInvalidArgument:    "INVALID_ARGUMENT",
+	slim_bindings.RpcCodeDeadlineExceeded:   "DEADLINE_EXCEEDED",
+	slim_bindings.RpcCodeNotFound:           "NOT_FOUND",
+	slim_bindings.RpcCodeAlreadyExists:      "ALREADY_EXISTS",
+	slim_bindings.RpcCodePermissionDenied:   "PERMISSION_DENIED",
+	slim_bindings.RpcCodeResourceExhausted:  "RESOURCE_EXHAUSTED",
+	slim_bindings.RpcCodeFailedPrecondition: "FAILED_PRECONDITION",
+	slim_bindings.RpcCodeAborted:            "ABORTED",
+	slim_bindings.RpcCodeOutOfRange:         "OUT_OF_RANGE",
+	slim_bindings.RpcCodeUnimplemented:      "UNIMPLEMENTED",
+	slim_bindings.RpcCodeInternal:           "INTERNAL",
+	slim_bindings.RpcCodeUnavailable:        "UNAVAILABLE",
+	slim_bindings.RpcCodeDataLoss:           "DATA_LOSS",
+	slim_bindings.RpcCodeUnauthenticated:    "UNAUTHENTICATED",
+}
+
+// CodeName returns the canonical name of an RPC code, such as "NOT_FOUND"
+func CodeName(code slim_bindings.RpcCode) string {
+	if name, ok := codeNames[code]; ok {
+		return name
+	}
+	return "CODE(" + strconv.Itoa(int(code)) + ")"
+}
+
+// Code returns the RPC code carried by err: RpcCodeOk for nil, the code of an
+// RpcError, the matching code for context errors, and RpcCodeUnknown otherwise
+func Code(err error) slim_bindings.RpcCode {
+	if err == nil {
+		return slim_bindings.RpcCodeOk
+	}
+	var rpc *slim_bindings.RpcErrorRpc
+	if errors.As(err, &rpc) {
+		return rpc.Code
+	}
+	var multicast *slim_bindings.RpcErrorMulticastRpc
+	if errors.As(err, &multicast) {
+		return multicast.Code
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return slim_bindings.RpcCodeDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return slim_bindings.RpcCodeCancelled
+	}
+	return slim_bindings.RpcCodeUnknown
+}
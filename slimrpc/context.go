@@ -2,8 +2,11 @@ package slimrpc
 
 import (
 	"context"
+	"sync"
 
 	slim_bindings "github.com/agntcy/slim-bindings-go"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type contextKey int
@@ -37,10 +40,40 @@ func SessionIdFromContext(ctx context.Context) (string, bool) {
 	return sessionId, ok
 }
 
+// boundContexts holds the contexts bound to in-flight calls with BindContext
+var boundContexts sync.Map
+
+// BindContext makes ContextFromRpcContext and ContextWithTimeout derive the
+// handler's context from ctx for the call of rpcContext, until unbind is called.
+// Server interceptors use it to pass values, such as a span, to the handler
+func BindContext(rpcContext *slim_bindings.Context, ctx context.Context) (unbind func()) {
+	boundContexts.Store(rpcContext, ctx)
+	return func() {
+		boundContexts.CompareAndDelete(rpcContext, ctx)
+	}
+}
+
+// baseContext returns the context bound to the call, or context.Background()
+func baseContext(rpcContext *slim_bindings.Context) context.Context {
+	if ctx, ok := boundContexts.Load(rpcContext); ok {
+		return ctx.(context.Context)
+	}
+	return context.Background()
+}
+
+// withTrace continues the W3C trace context (traceparent, tracestate) carried
+// in the metadata, unless ctx already has a span
+func withTrace(ctx context.Context, metadata map[string]string) context.Context {
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(metadata))
+}
+
 // ContextFromRpcContext creates a Go context.Context from a slim_bindings.Context
-// It extracts the deadline, metadata, and session ID and applies them to the context
+// It extracts the deadline, metadata, session ID and W3C trace context and applies them to the context
 func ContextFromRpcContext(rpcContext *slim_bindings.Context) (context.Context, context.CancelFunc) {
-	ctx := context.Background()
+	ctx := baseContext(rpcContext)
 
 	// Get deadline and create context with timeout/deadline
 	deadline := rpcContext.Deadline()
@@ -58,11 +91,12 @@ func ContextFromRpcContext(rpcContext *slim_bindings.Context) (context.Context,
 		ctx = WithSessionId(ctx, sessionId)
 	}
 
-	// Add metadata to context
+	// Add metadata and trace context to context
 	metadata := rpcContext.Metadata()
 	if len(metadata) > 0 {
 		ctx = WithMetadata(ctx, metadata)
 	}
+	ctx = withTrace(ctx, metadata)
 
 	return ctx, cancel
 }
@@ -70,7 +104,7 @@ func ContextFromRpcContext(rpcContext *slim_bindings.Context) (context.Context,
 // ContextWithTimeout creates a Go context.Context with a timeout based on RemainingTime
 // This is useful when you want to use the remaining time as a timeout instead of an absolute deadline
 func ContextWithTimeout(rpcContext *slim_bindings.Context) (context.Context, context.CancelFunc) {
-	ctx := context.Background()
+	ctx := baseContext(rpcContext)
 
 	// Get remaining time and create context with timeout
 	remainingTime := rpcContext.RemainingTime()
@@ -88,11 +122,12 @@ func ContextWithTimeout(rpcContext *slim_bindings.Context) (context.Context, con
 		ctx = WithSessionId(ctx, sessionId)
 	}
 
-	// Add metadata to context
+	// Add metadata and trace context to context
 	metadata := rpcContext.Metadata()
 	if len(metadata) > 0 {
 		ctx = WithMetadata(ctx, metadata)
 	}
+	ctx = withTrace(ctx, metadata)
 
 	return ctx, cancel
 }
@@ -3,6 +3,9 @@ package slimrpc
 import (
 	"context"
 	"testing"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestWithMetadata(t *testing.T) {
@@ -65,3 +68,35 @@ func TestSessionIdFromContext_NotPresent(t *testing.T) {
 		t.Fatal("Expected session ID to not be present in context")
 	}
 }
+
+func TestWithTrace(t *testing.T) {
+	metadata := map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+
+	ctx := withTrace(context.Background(), metadata)
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsRemote() || sc.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("span context = %+v, want the traceparent of the metadata", sc)
+	}
+
+	// A span already in the context, such as a server span, takes precedence.
+	local := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}})
+	ctx = withTrace(trace.ContextWithSpanContext(context.Background(), local), metadata)
+	if !trace.SpanContextFromContext(ctx).Equal(local) {
+		t.Error("withTrace replaced the span of the context")
+	}
+}
+
+func TestBindContext(t *testing.T) {
+	rpcContext := &slim_bindings.Context{}
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "bound")
+
+	unbind := BindContext(rpcContext, ctx)
+	if baseContext(rpcContext).Value(key{}) != "bound" {
+		t.Error("baseContext does not return the bound context")
+	}
+	unbind()
+	if baseContext(rpcContext).Value(key{}) != nil {
+		t.Error("baseContext returns the context after unbind")
+	}
+}
@@ -0,0 +1,274 @@
+package slimrpc
+
+import (
+	"maps"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// Kind is the streaming shape of an RPC
+type Kind int
+
+const (
+	KindUnaryUnary Kind = iota
+	KindUnaryStream
+	KindStreamUnary
+	KindStreamStream
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindUnaryUnary:
+		return "unary_unary"
+	case KindUnaryStream:
+		return "unary_stream"
+	case KindStreamUnary:
+		return "stream_unary"
+	case KindStreamStream:
+		return "stream_stream"
+	default:
+		return "unknown"
+	}
+}
+
+// CallInfo describes an RPC seen by an interceptor
+type CallInfo struct {
+	Service   string
+	Method    string
+	Kind      Kind
+	Multicast bool
+}
+
+// FullMethod returns the method in the {package-name}.{service-name}/{method-name} form
+func (c CallInfo) FullMethod() string {
+	return c.Service + "/" + c.Method
+}
+
+// ClientInterceptor observes an outgoing call. It runs before the call with the
+// outgoing metadata, which it may modify, and returns a function that is called
+// with the outcome. For streaming calls the outcome is that of opening the stream.
+type ClientInterceptor func(info CallInfo, metadata map[string]string) (done func(err error))
+
+// ServerInterceptor observes an incoming call. It runs before the handler and
+// returns a function that is called with the handler's outcome.
+type ServerInterceptor func(info CallInfo, rpcContext *slim_bindings.Context) (done func(err error))
+
+// InterceptChannel returns a channel that runs interceptors around every call
+// made through channel. Pass it to the generated New*Client functions in place
+// of the channel.
+func InterceptChannel(channel slim_bindings.ChannelInterface, interceptors ...ClientInterceptor) slim_bindings.ChannelInterface {
+	return &interceptedChannel{ChannelInterface: channel, interceptors: interceptors}
+}
+
+type interceptedChannel struct {
+	slim_bindings.ChannelInterface
+	interceptors []ClientInterceptor
+}
+
+// start runs the interceptors and returns the metadata to send and the
+// function reporting the outcome
+func (c *interceptedChannel) start(info CallInfo, metadata *map[string]string) (*map[string]string, func(error)) {
+	md := map[string]string{}
+	if metadata != nil {
+		md = maps.Clone(*metadata)
+	}
+	dones := make([]func(error), 0, len(c.interceptors))
+	for _, intercept := range c.interceptors {
+		if done := intercept(info, md); done != nil {
+			dones = append(dones, done)
+		}
+	}
+	finish := func(err error) {
+		for i := len(dones) - 1; i >= 0; i-- {
+			dones[i](err)
+		}
+	}
+	if metadata == nil && len(md) == 0 {
+		return nil, finish
+	}
+	return &md, finish
+}
+
+func (c *interceptedChannel) CallUnary(serviceName string, methodName string, request []byte, timeout *time.Duration, metadata *map[string]string) ([]byte, error) {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindUnaryUnary}, metadata)
+	resp, err := c.ChannelInterface.CallUnary(serviceName, methodName, request, timeout, metadata)
+	done(err)
+	return resp, err
+}
+
+func (c *interceptedChannel) CallUnaryAsync(serviceName string, methodName string, request []byte, timeout *time.Duration, metadata *map[string]string) ([]byte, error) {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindUnaryUnary}, metadata)
+	resp, err := c.ChannelInterface.CallUnaryAsync(serviceName, methodName, request, timeout, metadata)
+	done(err)
+	return resp, err
+}
+
+func (c *interceptedChannel) CallUnaryStream(serviceName string, methodName string, request []byte, timeout *time.Duration, metadata *map[string]string) (*slim_bindings.ResponseStreamReader, error) {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindUnaryStream}, metadata)
+	stream, err := c.ChannelInterface.CallUnaryStream(serviceName, methodName, request, timeout, metadata)
+	done(err)
+	return stream, err
+}
+
+func (c *interceptedChannel) CallUnaryStreamAsync(serviceName string, methodName string, request []byte, timeout *time.Duration, metadata *map[string]string) (*slim_bindings.ResponseStreamReader, error) {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindUnaryStream}, metadata)
+	stream, err := c.ChannelInterface.CallUnaryStreamAsync(serviceName, methodName, request, timeout, metadata)
+	done(err)
+	return stream, err
+}
+
+func (c *interceptedChannel) CallStreamUnary(serviceName string, methodName string, timeout *time.Duration, metadata *map[string]string) *slim_bindings.RequestStreamWriter {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindStreamUnary}, metadata)
+	stream := c.ChannelInterface.CallStreamUnary(serviceName, methodName, timeout, metadata)
+	done(nil)
+	return stream
+}
+
+func (c *interceptedChannel) CallStreamStream(serviceName string, methodName string, timeout *time.Duration, metadata *map[string]string) *slim_bindings.BidiStreamHandler {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindStreamStream}, metadata)
+	stream := c.ChannelInterface.CallStreamStream(serviceName, methodName, timeout, metadata)
+	done(nil)
+	return stream
+}
+
+func (c *interceptedChannel) CallMulticastUnary(serviceName string, methodName string, request []byte, timeout *time.Duration, metadata *map[string]string) (*slim_bindings.MulticastResponseReader, error) {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindUnaryUnary, Multicast: true}, metadata)
+	reader, err := c.ChannelInterface.CallMulticastUnary(serviceName, methodName, request, timeout, metadata)
+	done(err)
+	return reader, err
+}
+
+func (c *interceptedChannel) CallMulticastUnaryAsync(serviceName string, methodName string, request []byte, timeout *time.Duration, metadata *map[string]string) (*slim_bindings.MulticastResponseReader, error) {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindUnaryUnary, Multicast: true}, metadata)
+	reader, err := c.ChannelInterface.CallMulticastUnaryAsync(serviceName, methodName, request, timeout, metadata)
+	done(err)
+	return reader, err
+}
+
+func (c *interceptedChannel) CallMulticastUnaryStream(serviceName string, methodName string, request []byte, timeout *time.Duration, metadata *map[string]string) (*slim_bindings.MulticastResponseReader, error) {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindUnaryStream, Multicast: true}, metadata)
+	reader, err := c.ChannelInterface.CallMulticastUnaryStream(serviceName, methodName, request, timeout, metadata)
+	done(err)
+	return reader, err
+}
+
+func (c *interceptedChannel) CallMulticastUnaryStreamAsync(serviceName string, methodName string, request []byte, timeout *time.Duration, metadata *map[string]string) (*slim_bindings.MulticastResponseReader, error) {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindUnaryStream, Multicast: true}, metadata)
+	reader, err := c.ChannelInterface.CallMulticastUnaryStreamAsync(serviceName, methodName, request, timeout, metadata)
+	done(err)
+	return reader, err
+}
+
+func (c *interceptedChannel) CallMulticastStreamUnary(serviceName string, methodName string, timeout *time.Duration, metadata *map[string]string) *slim_bindings.MulticastBidiStreamHandler {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindStreamUnary, Multicast: true}, metadata)
+	stream := c.ChannelInterface.CallMulticastStreamUnary(serviceName, methodName, timeout, metadata)
+	done(nil)
+	return stream
+}
+
+func (c *interceptedChannel) CallMulticastStreamStream(serviceName string, methodName string, timeout *time.Duration, metadata *map[string]string) *slim_bindings.MulticastBidiStreamHandler {
+	metadata, done := c.start(CallInfo{Service: serviceName, Method: methodName, Kind: KindStreamStream, Multicast: true}, metadata)
+	stream := c.ChannelInterface.CallMulticastStreamStream(serviceName, methodName, timeout, metadata)
+	done(nil)
+	return stream
+}
+
+// InterceptServer returns a server that runs interceptors around every handler
+// registered through it. Pass it to the generated Register*Server functions in
+// place of the server.
+func InterceptServer(server slim_bindings.ServerInterface, interceptors ...ServerInterceptor) slim_bindings.ServerInterface {
+	return &interceptedServer{ServerInterface: server, interceptors: interceptors}
+}
+
+type interceptedServer struct {
+	slim_bindings.ServerInterface
+	interceptors []ServerInterceptor
+}
+
+// start runs the interceptors and returns the function reporting the outcome
+func (s *interceptedServer) start(info CallInfo, rpcContext *slim_bindings.Context) func(error) {
+	dones := make([]func(error), 0, len(s.interceptors))
+	for _, intercept := range s.interceptors {
+		if done := intercept(info, rpcContext); done != nil {
+			dones = append(dones, done)
+		}
+	}
+	return func(err error) {
+		for i := len(dones) - 1; i >= 0; i-- {
+			dones[i](err)
+		}
+	}
+}
+
+func (s *interceptedServer) RegisterUnaryUnary(serviceName string, methodName string, handler slim_bindings.UnaryUnaryHandler) {
+	info := CallInfo{Service: serviceName, Method: methodName, Kind: KindUnaryUnary}
+	s.ServerInterface.RegisterUnaryUnary(serviceName, methodName, &unaryUnaryHandler{handler, info, s})
+}
+
+func (s *interceptedServer) RegisterUnaryStream(serviceName string, methodName string, handler slim_bindings.UnaryStreamHandler) {
+	info := CallInfo{Service: serviceName, Method: methodName, Kind: KindUnaryStream}
+	s.ServerInterface.RegisterUnaryStream(serviceName, methodName, &unaryStreamHandler{handler, info, s})
+}
+
+func (s *interceptedServer) RegisterStreamUnary(serviceName string, methodName string, handler slim_bindings.StreamUnaryHandler) {
+	info := CallInfo{Service: serviceName, Method: methodName, Kind: KindStreamUnary}
+	s.ServerInterface.RegisterStreamUnary(serviceName, methodName, &streamUnaryHandler{handler, info, s})
+}
+
+func (s *interceptedServer) RegisterStreamStream(serviceName string, methodName string, handler slim_bindings.StreamStreamHandler) {
+	info := CallInfo{Service: serviceName, Method: methodName, Kind: KindStreamStream}
+	s.ServerInterface.RegisterStreamStream(serviceName, methodName, &streamStreamHandler{handler, info, s})
+}
+
+type unaryUnaryHandler struct {
+	next   slim_bindings.UnaryUnaryHandler
+	info   CallInfo
+	server *interceptedServer
+}
+
+func (h *unaryUnaryHandler) Handle(request []byte, context *slim_bindings.Context) ([]byte, error) {
+	done := h.server.start(h.info, context)
+	resp, err := h.next.Handle(request, context)
+	done(err)
+	return resp, err
+}
+
+type unaryStreamHandler struct {
+	next   slim_bindings.UnaryStreamHandler
+	info   CallInfo
+	server *interceptedServer
+}
+
+func (h *unaryStreamHandler) Handle(request []byte, context *slim_bindings.Context, sink *slim_bindings.ResponseSink) error {
+	done := h.server.start(h.info, context)
+	err := h.next.Handle(request, context, sink)
+	done(err)
+	return err
+}
+
+type streamUnaryHandler struct {
+	next   slim_bindings.StreamUnaryHandler
+	info   CallInfo
+	server *interceptedServer
+}
+
+func (h *streamUnaryHandler) Handle(stream *slim_bindings.RequestStream, context *slim_bindings.Context) ([]byte, error) {
+	done := h.server.start(h.info, context)
+	resp, err := h.next.Handle(stream, context)
+	done(err)
+	return resp, err
+}
+
+type streamStreamHandler struct {
+	next   slim_bindings.StreamStreamHandler
+	info   CallInfo
+	server *interceptedServer
+}
+
+func (h *streamStreamHandler) Handle(stream *slim_bindings.RequestStream, context *slim_bindings.Context, sink *slim_bindings.ResponseSink) error {
+	done := h.server.start(h.info, context)
+	err := h.next.Handle(stream, context, sink)
+	done(err)
+	return err
+}
@@ -0,0 +1,114 @@
+package slimrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// fakeChannel returns err from unary calls and records the metadata sent.
+type fakeChannel struct {
+	slim_bindings.ChannelInterface
+	err      error
+	metadata *map[string]string
+}
+
+func (c *fakeChannel) CallUnary(_ string, _ string, request []byte, _ *time.Duration, metadata *map[string]string) ([]byte, error) {
+	c.metadata = metadata
+	return request, c.err
+}
+
+// fakeServer keeps the last unary handler registered.
+type fakeServer struct {
+	slim_bindings.ServerInterface
+	handler slim_bindings.UnaryUnaryHandler
+}
+
+func (s *fakeServer) RegisterUnaryUnary(_ string, _ string, handler slim_bindings.UnaryUnaryHandler) {
+	s.handler = handler
+}
+
+type handlerFunc func([]byte, *slim_bindings.Context) ([]byte, error)
+
+func (f handlerFunc) Handle(request []byte, context *slim_bindings.Context) ([]byte, error) {
+	return f(request, context)
+}
+
+func TestInterceptChannel(t *testing.T) {
+	var order []string
+	interceptor := func(name string) ClientInterceptor {
+		return func(info CallInfo, metadata map[string]string) func(error) {
+			order = append(order, name+" "+info.FullMethod()+" "+info.Kind.String())
+			metadata[name] = "seen"
+			return func(err error) {
+				order = append(order, fmt.Sprintf("%s done %s", name, CodeName(Code(err))))
+			}
+		}
+	}
+
+	fake := &fakeChannel{err: slim_bindings.NewRpcErrorRpc(slim_bindings.RpcCodeNotFound, "no such key", nil)}
+	channel := InterceptChannel(fake, interceptor("a"), interceptor("b"))
+	original := map[string]string{"key": "value"}
+	if _, err := channel.CallUnary("pkg.Svc", "Get", nil, nil, &original); err == nil {
+		t.Fatal("CallUnary succeeded, want the channel error")
+	}
+
+	want := "a pkg.Svc/Get unary_unary|b pkg.Svc/Get unary_unary|b done NOT_FOUND|a done NOT_FOUND"
+	if got := strings.Join(order, "|"); got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+	if sent := *fake.metadata; sent["key"] != "value" || sent["a"] != "seen" || sent["b"] != "seen" {
+		t.Errorf("sent metadata = %v", sent)
+	}
+	if len(original) != 1 {
+		t.Errorf("caller metadata was modified: %v", original)
+	}
+}
+
+func TestInterceptServer(t *testing.T) {
+	var outcome []error
+	fake := &fakeServer{}
+	server := InterceptServer(fake, func(info CallInfo, _ *slim_bindings.Context) func(error) {
+		if info.FullMethod() != "pkg.Svc/Get" || info.Kind != KindUnaryUnary {
+			t.Errorf("info = %+v", info)
+		}
+		return func(err error) { outcome = append(outcome, err) }
+	})
+
+	failure := errors.New("boom")
+	server.RegisterUnaryUnary("pkg.Svc", "Get", handlerFunc(func([]byte, *slim_bindings.Context) ([]byte, error) {
+		return nil, failure
+	}))
+	if _, err := fake.handler.Handle(nil, nil); err != failure {
+		t.Fatalf("Handle = %v, want %v", err, failure)
+	}
+	if len(outcome) != 1 || outcome[0] != failure {
+		t.Errorf("outcome = %v", outcome)
+	}
+}
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "OK"},
+		{fmt.Errorf("call: %w", slim_bindings.NewRpcErrorRpc(slim_bindings.RpcCodeUnavailable, "", nil)), "UNAVAILABLE"},
+		{&slim_bindings.RpcErrorMulticastRpc{Code: slim_bindings.RpcCodeAborted}, "ABORTED"},
+		{context.DeadlineExceeded, "DEADLINE_EXCEEDED"},
+		{errors.New("other"), "UNKNOWN"},
+	}
+	for _, tt := range tests {
+		if got := CodeName(Code(tt.err)); got != tt.want {
+			t.Errorf("Code(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+	if got := CodeName(99); got != "CODE(99)" {
+		t.Errorf("CodeName(99) = %s", got)
+	}
+}
@@ -0,0 +1,349 @@
+package slimsession
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// Metadata keys of the acknowledgement protocol. AckIdKey and DeliveryKey
+// are stamped on messages sent with PublishWithAck; AckForKey and
+// AckStatusKey are carried by the settlement the receiver sends back with
+// PublishTo.
+const (
+	AckIdKey     = "slim-ack-id"
+	DeliveryKey  = "slim-delivery"
+	AckForKey    = "slim-ack-for"
+	AckStatusKey = "slim-ack-status"
+)
+
+// Values of AckStatusKey.
+const (
+	ackStatusAck     = "ack"
+	ackStatusReject  = "reject"
+	ackStatusRequeue = "requeue"
+)
+
+const (
+	// DefaultVisibilityTimeout is how long a message sent with
+	// PublishWithAck waits to be settled before it is delivered again.
+	DefaultVisibilityTimeout = 30 * time.Second
+	// DefaultMaxDeliveries is how many times a message sent with
+	// PublishWithAck is delivered before the sender gives up.
+	DefaultMaxDeliveries = 5
+)
+
+var (
+	// ErrMessageRejected is returned by Receipt.Wait when the receiver called
+	// Nack(false).
+	ErrMessageRejected = errors.New("slimsession: message rejected by receiver")
+	// ErrNotAcknowledged is returned by Receipt.Wait when the message was
+	// delivered the maximum number of times without being settled.
+	ErrNotAcknowledged = errors.New("slimsession: message not acknowledged")
+	// ErrAlreadySettled is returned by Ack and Nack on a message that was
+	// already settled.
+	ErrAlreadySettled = errors.New("slimsession: message already settled")
+)
+
+// WithVisibilityTimeout sets how long a message sent with PublishWithAck may
+// stay unsettled before it is delivered again.
+func WithVisibilityTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.visibilityTimeout = d
+	}
+}
+
+// WithMaxDeliveries sets how many times a message sent with PublishWithAck
+// is delivered, counting requeues, before Receipt.Wait fails with
+// ErrNotAcknowledged.
+func WithMaxDeliveries(n int) Option {
+	return func(o *options) {
+		o.maxDeliveries = n
+	}
+}
+
+// Receipt tracks processing of a message sent with PublishWithAck.
+type Receipt struct {
+	session *Session
+	unacked *unacked
+}
+
+// Id returns the acknowledgement ID stamped on the message.
+func (r *Receipt) Id() string {
+	return r.unacked.id
+}
+
+// Wait blocks until the receiver acknowledges the message, rejects it, the
+// maximum number of deliveries is reached or the Session is closed, or until
+// ctx is done. While waiting it receives from the session on behalf of
+// GetMessage and Receive, so the settlement is seen even if nobody else is
+// reading. Giving up on ctx does not stop redelivery.
+func (r *Receipt) Wait(ctx context.Context) error {
+	var result error
+	err := r.session.wait(ctx, func() bool {
+		var settled bool
+		settled, result = r.unacked.result()
+		return settled
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// unacked is a message sent with PublishWithAck that is not settled yet.
+type unacked struct {
+	id          string
+	data        []byte
+	payloadType *string
+	metadata    map[string]string
+
+	mu         sync.Mutex
+	deliveries int
+	sentAt     time.Time
+	timer      *time.Timer
+	settled    bool
+	err        error
+}
+
+func (u *unacked) result() (bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.settled, u.err
+}
+
+// PublishWithAck publishes data and tracks it until the receiver settles it
+// with Message.Ack or Message.Nack. A message that is not settled within the
+// visibility timeout, or that is requeued, is published again with the same
+// AckIdKey. The message bypasses ordered delivery and the outbox, since
+// redelivered copies must not be discarded as duplicates. It is meant for
+// point-to-point sessions; in a group the first settlement wins.
+// Redelivery stops when the Session is closed.
+func (s *Session) PublishWithAck(data []byte, payloadType *string, metadata *map[string]string) (*Receipt, error) {
+	id, err := newMessageId()
+	if err != nil {
+		return nil, err
+	}
+	md := copyMetadata(metadata)
+	md[AckIdKey] = id
+	u := &unacked{id: id, data: data, payloadType: payloadType, metadata: md}
+
+	s.acks.mu.Lock()
+	s.acks.pending[id] = u
+	s.acks.mu.Unlock()
+
+	if err := s.deliver(u); err != nil {
+		s.settle(id, err)
+		return nil, err
+	}
+	return &Receipt{session: s, unacked: u}, nil
+}
+
+// PublishWithAckAndWait publishes data and waits until the receiver has
+// processed it.
+func (s *Session) PublishWithAckAndWait(ctx context.Context, data []byte, payloadType *string, metadata *map[string]string) error {
+	receipt, err := s.PublishWithAck(data, payloadType, metadata)
+	if err != nil {
+		return err
+	}
+	return receipt.Wait(ctx)
+}
+
+// acks tracks the sender side of the acknowledgement protocol.
+type acks struct {
+	mu      sync.Mutex
+	pending map[string]*unacked
+}
+
+func newAcks() *acks {
+	return &acks{pending: make(map[string]*unacked)}
+}
+
+// deliver publishes u once more and arms its visibility timer. It fails
+// with ErrSessionClosed once the Session is closed.
+func (s *Session) deliver(u *unacked) error {
+	if !s.life.enter() {
+		s.settle(u.id, ErrSessionClosed)
+		return ErrSessionClosed
+	}
+	defer s.life.leave()
+
+	u.mu.Lock()
+	if u.settled {
+		u.mu.Unlock()
+		return nil
+	}
+	if u.deliveries >= s.opts.maxDeliveries {
+		u.mu.Unlock()
+		s.settle(u.id, ErrNotAcknowledged)
+		return nil
+	}
+	u.deliveries++
+	if u.deliveries > 1 {
+		s.counters.retransmitted.Add(1)
+	}
+	u.sentAt = s.opts.now()
+	md := copyMetadata(&u.metadata)
+	md[DeliveryKey] = strconv.Itoa(u.deliveries)
+	u.timer = time.AfterFunc(s.opts.visibilityTimeout, func() {
+		_ = s.deliver(u)
+	})
+	u.mu.Unlock()
+
+	_, err := s.publishChunked(u.data, u.payloadType, &md, s.SessionInterface.Publish)
+	return err
+}
+
+// settle resolves the message with the given ID and wakes its waiters.
+func (s *Session) settle(id string, err error) {
+	s.acks.mu.Lock()
+	u, ok := s.acks.pending[id]
+	delete(s.acks.pending, id)
+	s.acks.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	u.mu.Lock()
+	u.settled = true
+	u.err = err
+	if u.timer != nil {
+		u.timer.Stop()
+	}
+	if err == nil {
+		s.counters.sample(s.opts.now().Sub(u.sentAt))
+	}
+	u.mu.Unlock()
+
+	s.demux.mu.Lock()
+	s.demux.broadcast()
+	s.demux.mu.Unlock()
+}
+
+// settlement consumes msg if it is a settlement for a message sent with
+// PublishWithAck.
+func (s *Session) settlement(msg slim_bindings.ReceivedMessage) bool {
+	id, ok := msg.Context.Metadata[AckForKey]
+	if !ok {
+		return false
+	}
+
+	switch msg.Context.Metadata[AckStatusKey] {
+	case ackStatusAck:
+		s.settle(id, nil)
+	case ackStatusReject:
+		s.settle(id, ErrMessageRejected)
+	case ackStatusRequeue:
+		s.acks.mu.Lock()
+		u, pending := s.acks.pending[id]
+		s.acks.mu.Unlock()
+		if pending {
+			u.mu.Lock()
+			if u.timer != nil {
+				u.timer.Stop()
+			}
+			u.mu.Unlock()
+			// A failed redelivery is retried when the visibility timer fires.
+			_ = s.deliver(u)
+		}
+	}
+	return true
+}
+
+// resettled consumes msg if it is a redelivered copy of a message that was
+// already settled, repeating the settlement in case it was lost.
+func (s *Session) resettled(msg slim_bindings.ReceivedMessage) bool {
+	id, ok := msg.Context.Metadata[AckIdKey]
+	if !ok {
+		return false
+	}
+	status, ok := s.settled.lookup(id)
+	if !ok {
+		return false
+	}
+	s.counters.duplicates.Add(1)
+	_ = s.sendSettlement(msg.Context, id, status)
+	return true
+}
+
+func (s *Session) sendSettlement(messageContext slim_bindings.MessageContext, id, status string) error {
+	md := map[string]string{AckForKey: id, AckStatusKey: status}
+	_, err := s.SessionInterface.PublishTo(messageContext, []byte{}, nil, &md)
+	return err
+}
+
+// Message is a received message that can be acknowledged.
+type Message struct {
+	slim_bindings.ReceivedMessage
+
+	session *Session
+	mu      sync.Mutex
+	settled bool
+}
+
+// Receive returns the next message, like GetMessage, wrapped so that it can
+// be settled with Ack or Nack.
+func (s *Session) Receive(ctx context.Context) (*Message, error) {
+	next, err := s.next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if next.err != nil {
+		return nil, next.err
+	}
+	return &Message{ReceivedMessage: next.msg, session: s}, nil
+}
+
+// AckId returns the acknowledgement ID of the message, or "" if the sender
+// did not request an acknowledgement.
+func (m *Message) AckId() string {
+	return m.Context.Metadata[AckIdKey]
+}
+
+// Delivery returns how many times the message has been delivered, starting
+// at 1. It is 0 for messages that do not need an acknowledgement.
+func (m *Message) Delivery() int {
+	n, _ := strconv.Atoi(m.Context.Metadata[DeliveryKey])
+	return n
+}
+
+// Ack tells the sender that the message was processed. It is a no-op for
+// messages that do not need an acknowledgement.
+func (m *Message) Ack() error {
+	return m.settle(ackStatusAck)
+}
+
+// Nack tells the sender that the message was not processed. With requeue the
+// sender delivers it again right away; otherwise the sender's Receipt.Wait
+// fails with ErrMessageRejected.
+func (m *Message) Nack(requeue bool) error {
+	if requeue {
+		return m.settle(ackStatusRequeue)
+	}
+	return m.settle(ackStatusReject)
+}
+
+func (m *Message) settle(status string) error {
+	id := m.AckId()
+	if id == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.settled {
+		return ErrAlreadySettled
+	}
+	if err := m.session.sendSettlement(m.Context, id, status); err != nil {
+		return err
+	}
+	m.settled = true
+	if status != ackStatusRequeue {
+		m.session.settled.remember(id, status)
+	}
+	return nil
+}
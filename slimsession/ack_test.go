@@ -0,0 +1,169 @@
+package slimsession
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAckConfirmsProcessing(t *testing.T) {
+	s := Wrap(newFakeSession())
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	receipt, err := s.PublishWithAck([]byte("job"), nil, nil)
+	if err != nil {
+		t.Fatalf("PublishWithAck: %v", err)
+	}
+	msg, err := s.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if msg.AckId() != receipt.Id() || msg.Delivery() != 1 {
+		t.Fatalf("AckId = %q, Delivery = %d; want %q, 1", msg.AckId(), msg.Delivery(), receipt.Id())
+	}
+	if err := msg.Ack(); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if err := msg.Ack(); !errors.Is(err, ErrAlreadySettled) {
+		t.Errorf("second Ack error = %v, want ErrAlreadySettled", err)
+	}
+	if err := receipt.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
+
+func TestUnackedMessageIsRedelivered(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake, WithVisibilityTimeout(20*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	receipt, err := s.PublishWithAck([]byte("job"), nil, nil)
+	if err != nil {
+		t.Fatalf("PublishWithAck: %v", err)
+	}
+	first, err := s.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	second, err := s.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if second.AckId() != first.AckId() || second.Delivery() != 2 {
+		t.Fatalf("redelivery AckId = %q, Delivery = %d", second.AckId(), second.Delivery())
+	}
+	if err := second.Ack(); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if err := receipt.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	// A copy that crosses the settlement is answered, not delivered again.
+	fake.frames <- second.ReceivedMessage
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if msg, err := s.Receive(short); err == nil {
+		t.Fatalf("settled message delivered again (delivery %d)", msg.Delivery())
+	}
+}
+
+func TestNack(t *testing.T) {
+	s := Wrap(newFakeSession())
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	receipt, err := s.PublishWithAck([]byte("job"), nil, nil)
+	if err != nil {
+		t.Fatalf("PublishWithAck: %v", err)
+	}
+	msg, err := s.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if err := msg.Nack(true); err != nil {
+		t.Fatalf("Nack(true): %v", err)
+	}
+
+	// The requeued copy arrives without waiting for the visibility timeout.
+	msg, err = s.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive after requeue: %v", err)
+	}
+	if msg.Delivery() != 2 {
+		t.Fatalf("Delivery = %d, want 2", msg.Delivery())
+	}
+	if err := msg.Nack(false); err != nil {
+		t.Fatalf("Nack(false): %v", err)
+	}
+	if err := receipt.Wait(ctx); !errors.Is(err, ErrMessageRejected) {
+		t.Fatalf("Wait error = %v, want ErrMessageRejected", err)
+	}
+}
+
+func TestMaxDeliveries(t *testing.T) {
+	s := Wrap(newFakeSession(), WithVisibilityTimeout(10*time.Millisecond), WithMaxDeliveries(2))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := s.PublishWithAckAndWait(ctx, []byte("job"), nil, nil)
+	if !errors.Is(err, ErrNotAcknowledged) {
+		t.Fatalf("PublishWithAckAndWait error = %v, want ErrNotAcknowledged", err)
+	}
+	for want := 1; want <= 2; want++ {
+		msg, err := s.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+		if msg.Delivery() != want {
+			t.Fatalf("Delivery = %d, want %d", msg.Delivery(), want)
+		}
+	}
+}
+
+func TestAckWithoutAckIdIsNoop(t *testing.T) {
+	s := Wrap(newFakeSession())
+	if _, err := s.Publish([]byte("plain"), nil, nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	msg, err := s.Receive(context.Background())
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if err := msg.Ack(); err != nil {
+		t.Errorf("Ack: %v", err)
+	}
+}
+
+func TestCloseStopsRedelivery(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake, WithVisibilityTimeout(10*time.Millisecond), WithMaxDeliveries(100))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	receipt, err := s.PublishWithAck([]byte("job"), nil, nil)
+	if err != nil {
+		t.Fatalf("PublishWithAck: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if err := receipt.Wait(ctx); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("Wait error = %v, want ErrSessionClosed", err)
+	}
+
+	sent := fake.sentFrames()
+	time.Sleep(50 * time.Millisecond)
+	if got := fake.sentFrames(); got != sent {
+		t.Errorf("sent %d frames after Close, want %d", got, sent)
+	}
+	if _, err := s.PublishWithAck([]byte("late"), nil, nil); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("PublishWithAck after Close error = %v, want ErrSessionClosed", err)
+	}
+}
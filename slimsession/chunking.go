@@ -0,0 +1,366 @@
+package slimsession
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// Metadata keys carried by every fragment of a chunked message. Messages
+// that fit in a single frame are published without them.
+const (
+	ChunkIdKey    = "slim-chunk-id"
+	ChunkIndexKey = "slim-chunk-index"
+	ChunkCountKey = "slim-chunk-count"
+	ChunkSizeKey  = "slim-chunk-size"
+)
+
+const (
+	// maxFragments bounds the fragment count a message may declare: a
+	// DefaultMaxMessageSize message in fragments of 1 KiB.
+	maxFragments = 1 << 16
+	// maxPartialMessages bounds the messages being reassembled at once.
+	maxPartialMessages = 1024
+)
+
+type publishFunc func(data []byte, payloadType *string, metadata *map[string]string) (*slim_bindings.CompletionHandle, error)
+
+func (s *Session) publishChunked(data []byte, payloadType *string, metadata *map[string]string, publish publishFunc) (*Completion, error) {
+	if len(data) > s.opts.maxMessageSize {
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrMessageTooLarge, len(data), s.opts.maxMessageSize)
+	}
+
+	if len(data) <= s.opts.maxFragmentSize {
+		handle, err := publish(data, payloadType, metadata)
+		if err != nil {
+			return nil, err
+		}
+		s.counters.sent(len(data))
+		return &Completion{handles: []*slim_bindings.CompletionHandle{handle}}, nil
+	}
+
+	id, err := newMessageId()
+	if err != nil {
+		return nil, err
+	}
+
+	fragments := splitFragments(data, s.opts.maxFragmentSize)
+	completion := &Completion{handles: make([]*slim_bindings.CompletionHandle, 0, len(fragments))}
+	for i, fragment := range fragments {
+		md := copyMetadata(metadata)
+		md[ChunkIdKey] = id
+		md[ChunkIndexKey] = strconv.Itoa(i)
+		md[ChunkCountKey] = strconv.Itoa(len(fragments))
+		md[ChunkSizeKey] = strconv.Itoa(len(data))
+
+		handle, err := publish(fragment, payloadType, &md)
+		if err != nil {
+			return nil, fmt.Errorf("publish fragment %d/%d: %w", i+1, len(fragments), err)
+		}
+		completion.handles = append(completion.handles, handle)
+	}
+	s.counters.sent(len(data))
+	return completion, nil
+}
+
+// receive reads the next message from the wrapped session, reassembling
+// fragmented messages. The timeout bounds the whole call.
+func (s *Session) receive(timeout *time.Duration) (slim_bindings.ReceivedMessage, error) {
+	var deadline time.Time
+	if timeout != nil {
+		deadline = s.opts.now().Add(*timeout)
+	}
+
+	for {
+		if err := s.chunks.expire(); err != nil {
+			return slim_bindings.ReceivedMessage{}, err
+		}
+
+		// Wake up for the earliest pending expiry even when the caller
+		// asked to block, so incomplete messages are reported on time.
+		wait, callerBound := s.chunks.nextWait(deadline)
+		if callerBound && wait <= 0 {
+			return slim_bindings.ReceivedMessage{}, slim_bindings.NewSlimErrorTimeout()
+		}
+		var waitPtr *time.Duration
+		if callerBound || wait > 0 {
+			waitPtr = &wait
+		}
+
+		msg, err := s.SessionInterface.GetMessage(waitPtr)
+		if err != nil {
+			if errors.Is(err, slim_bindings.ErrSlimErrorTimeout) && !callerBound {
+				continue
+			}
+			return slim_bindings.ReceivedMessage{}, err
+		}
+
+		complete, ok, err := s.chunks.add(msg)
+		if err != nil {
+			return slim_bindings.ReceivedMessage{}, err
+		}
+		if ok {
+			return complete, nil
+		}
+	}
+}
+
+type partialMessage struct {
+	// fragments holds the fragments received so far by index, so that
+	// nothing is allocated for those still missing.
+	fragments map[int][]byte
+	count     int
+	// bytes is the total size of the fragments received so far.
+	bytes   int
+	size    int
+	expires time.Time
+}
+
+// reassembler collects fragments keyed by message ID until every fragment
+// of a message has arrived.
+type reassembler struct {
+	mu      sync.Mutex
+	maxSize int
+	// maxBuffered bounds the bytes held across all partial messages, and
+	// buffered counts them.
+	maxBuffered int
+	buffered    int
+	timeout     time.Duration
+	now         func() time.Time
+	partials    map[string]*partialMessage
+	// rejected remembers dropped message IDs so their remaining fragments
+	// are discarded silently instead of starting a new partial message.
+	rejected map[string]time.Time
+}
+
+func newReassembler(maxSize, maxBuffered int, timeout time.Duration, now func() time.Time) *reassembler {
+	return &reassembler{
+		maxSize:     maxSize,
+		maxBuffered: max(maxBuffered, maxSize),
+		timeout:     timeout,
+		now:         now,
+		partials:    make(map[string]*partialMessage),
+		rejected:    make(map[string]time.Time),
+	}
+}
+
+// drop forgets the partial message id and remembers to discard the rest of
+// its fragments. r.mu must be held.
+func (r *reassembler) drop(id string, now time.Time) {
+	if p, ok := r.partials[id]; ok {
+		r.buffered -= p.bytes
+		delete(r.partials, id)
+	}
+	r.rejected[id] = now.Add(r.timeout)
+}
+
+// add records msg. It returns the reassembled message and true once the
+// last fragment arrives; messages that are not fragments are returned as is.
+func (r *reassembler) add(msg slim_bindings.ReceivedMessage) (slim_bindings.ReceivedMessage, bool, error) {
+	id, isFragment := msg.Context.Metadata[ChunkIdKey]
+	if !isFragment {
+		return msg, true, nil
+	}
+
+	index, count, size, err := parseFragmentHeader(msg.Context.Metadata)
+	if err != nil {
+		return slim_bindings.ReceivedMessage{}, false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if _, dropped := r.rejected[id]; dropped {
+		return slim_bindings.ReceivedMessage{}, false, nil
+	}
+
+	if size > r.maxSize {
+		r.drop(id, now)
+		return slim_bindings.ReceivedMessage{}, false, fmt.Errorf("%w: message %s declares %d bytes, limit is %d", ErrMessageTooLarge, id, size, r.maxSize)
+	}
+	// Every fragment but that of an empty message holds at least one byte,
+	// so the count is bounded by the size as well as by maxFragments.
+	if count > max(size, 1) || count > maxFragments {
+		r.drop(id, now)
+		return slim_bindings.ReceivedMessage{}, false, fmt.Errorf("%w: message %s declares %d fragments for %d bytes", ErrMalformedFragment, id, count, size)
+	}
+
+	p, ok := r.partials[id]
+	if !ok {
+		if len(r.partials) >= maxPartialMessages {
+			r.drop(id, now)
+			return slim_bindings.ReceivedMessage{}, false, fmt.Errorf("%w: %d messages are being reassembled", ErrReassemblyBufferFull, len(r.partials))
+		}
+		p = &partialMessage{
+			fragments: make(map[int][]byte),
+			count:     count,
+			size:      size,
+			expires:   now.Add(r.timeout),
+		}
+		r.partials[id] = p
+	}
+	if p.count != count || p.size != size {
+		r.drop(id, now)
+		return slim_bindings.ReceivedMessage{}, false, fmt.Errorf("%w: message %s changed its fragment count or size", ErrMalformedFragment, id)
+	}
+	if _, dup := p.fragments[index]; dup {
+		// Duplicate fragment, e.g. after a retransmission.
+		return slim_bindings.ReceivedMessage{}, false, nil
+	}
+	if p.bytes+len(msg.Payload) > p.size {
+		r.drop(id, now)
+		return slim_bindings.ReceivedMessage{}, false, fmt.Errorf("%w: message %s exceeds its declared %d bytes", ErrMalformedFragment, id, p.size)
+	}
+	if r.buffered+len(msg.Payload) > r.maxBuffered {
+		r.drop(id, now)
+		return slim_bindings.ReceivedMessage{}, false, fmt.Errorf("%w: message %s would exceed %d buffered bytes", ErrReassemblyBufferFull, id, r.maxBuffered)
+	}
+	p.fragments[index] = msg.Payload
+	p.bytes += len(msg.Payload)
+	r.buffered += len(msg.Payload)
+	if len(p.fragments) < count {
+		return slim_bindings.ReceivedMessage{}, false, nil
+	}
+
+	r.buffered -= p.bytes
+	delete(r.partials, id)
+	payload := make([]byte, 0, p.size)
+	for i := range count {
+		payload = append(payload, p.fragments[i]...)
+	}
+	if len(payload) != p.size {
+		return slim_bindings.ReceivedMessage{}, false, fmt.Errorf("%w: message %s reassembled to %d bytes, expected %d", ErrMalformedFragment, id, len(payload), p.size)
+	}
+
+	msg.Payload = payload
+	msg.Context.Metadata = stripChunkHeaders(msg.Context.Metadata)
+	return msg, true, nil
+}
+
+// expire drops incomplete messages whose timeout has elapsed and reports
+// the first one found.
+func (r *reassembler) expire() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for id, until := range r.rejected {
+		if now.After(until) {
+			delete(r.rejected, id)
+		}
+	}
+
+	var err error
+	for id, p := range r.partials {
+		if now.Before(p.expires) {
+			continue
+		}
+		r.drop(id, now)
+		if err == nil {
+			err = fmt.Errorf("%w: message %s has %d of %d fragments", ErrReassemblyTimeout, id, len(p.fragments), p.count)
+		}
+	}
+	return err
+}
+
+// nextWait returns how long the next receive may block. callerBound reports
+// whether the wait is limited by the caller's deadline rather than by a
+// pending expiry.
+func (r *reassembler) nextWait(deadline time.Time) (wait time.Duration, callerBound bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	var earliest time.Time
+	for _, p := range r.partials {
+		if earliest.IsZero() || p.expires.Before(earliest) {
+			earliest = p.expires
+		}
+	}
+
+	switch {
+	case deadline.IsZero() && earliest.IsZero():
+		return 0, false
+	case earliest.IsZero() || (!deadline.IsZero() && !deadline.After(earliest)):
+		return deadline.Sub(now), true
+	default:
+		return max(earliest.Sub(now), time.Millisecond), false
+	}
+}
+
+func parseFragmentHeader(metadata map[string]string) (index, count, size int, err error) {
+	index, err = strconv.Atoi(metadata[ChunkIndexKey])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("%w: bad %s: %v", ErrMalformedFragment, ChunkIndexKey, err)
+	}
+	count, err = strconv.Atoi(metadata[ChunkCountKey])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("%w: bad %s: %v", ErrMalformedFragment, ChunkCountKey, err)
+	}
+	size, err = strconv.Atoi(metadata[ChunkSizeKey])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("%w: bad %s: %v", ErrMalformedFragment, ChunkSizeKey, err)
+	}
+	if count <= 0 || index < 0 || index >= count || size < 0 {
+		return 0, 0, 0, fmt.Errorf("%w: fragment %d of %d, size %d", ErrMalformedFragment, index, count, size)
+	}
+	return index, count, size, nil
+}
+
+func splitFragments(data []byte, fragmentSize int) [][]byte {
+	fragments := make([][]byte, 0, (len(data)+fragmentSize-1)/fragmentSize)
+	for len(data) > 0 {
+		n := min(fragmentSize, len(data))
+		fragments = append(fragments, data[:n])
+		data = data[n:]
+	}
+	return fragments
+}
+
+func stripChunkHeaders(metadata map[string]string) map[string]string {
+	out := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		switch k {
+		case ChunkIdKey, ChunkIndexKey, ChunkCountKey, ChunkSizeKey:
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func copyMetadata(metadata *map[string]string) map[string]string {
+	out := make(map[string]string)
+	if metadata != nil {
+		for k, v := range *metadata {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func newMessageId() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// fallbackIds numbers the IDs made by fallbackId.
+var fallbackIds atomic.Uint64
+
+// fallbackId returns an ID unique within the process, for when the system
+// random source fails. It is made of the process ID, the time and a counter.
+func fallbackId() string {
+	return fmt.Sprintf("%x-%x-%x", os.Getpid(), time.Now().UnixNano(), fallbackIds.Add(1))
+}
@@ -0,0 +1,317 @@
+package slimsession
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// fakeSession loops published frames back to GetMessage.
+type fakeSession struct {
+	slim_bindings.SessionInterface
+
+	mu     sync.Mutex
+	frames chan slim_bindings.ReceivedMessage
+	sent   int
+	// err, when set, makes Publish fail as if the connection were down.
+	err error
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{frames: make(chan slim_bindings.ReceivedMessage, 1024)}
+}
+
+func (f *fakeSession) Publish(data []byte, payloadType *string, metadata *map[string]string) (*slim_bindings.CompletionHandle, error) {
+	f.mu.Lock()
+	if f.err != nil {
+		f.mu.Unlock()
+		return nil, f.err
+	}
+	f.sent++
+	f.mu.Unlock()
+
+	msg := slim_bindings.ReceivedMessage{Payload: append([]byte(nil), data...)}
+	if payloadType != nil {
+		msg.Context.PayloadType = *payloadType
+	}
+	if metadata != nil {
+		msg.Context.Metadata = copyMetadata(metadata)
+	}
+	f.frames <- msg
+	return nil, nil
+}
+
+func (f *fakeSession) PublishTo(_ slim_bindings.MessageContext, data []byte, payloadType *string, metadata *map[string]string) (*slim_bindings.CompletionHandle, error) {
+	return f.Publish(data, payloadType, metadata)
+}
+
+func (f *fakeSession) GetMessage(timeout *time.Duration) (slim_bindings.ReceivedMessage, error) {
+	if timeout == nil {
+		return <-f.frames, nil
+	}
+	select {
+	case msg := <-f.frames:
+		return msg, nil
+	case <-time.After(*timeout):
+		return slim_bindings.ReceivedMessage{}, slim_bindings.NewSlimErrorTimeout()
+	}
+}
+
+func (f *fakeSession) sentFrames() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sent
+}
+
+func TestPublishSmallMessageIsNotChunked(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake, WithMaxFragmentSize(16))
+
+	md := map[string]string{"k": "v"}
+	if _, err := s.Publish([]byte("hello"), nil, &md); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	msg, err := fake.GetMessage(nil)
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+	if _, ok := msg.Context.Metadata[ChunkIdKey]; ok {
+		t.Errorf("small message carries chunk headers: %v", msg.Context.Metadata)
+	}
+}
+
+func TestChunkedRoundTrip(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake, WithMaxFragmentSize(10))
+
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 7)
+	payloadType := "application/octet-stream"
+	md := map[string]string{"trace": "abc"}
+	if err := s.PublishAndWait(payload, &payloadType, &md); err != nil {
+		t.Fatalf("PublishAndWait: %v", err)
+	}
+	if got, want := fake.sentFrames(), 12; got != want {
+		t.Errorf("sent %d frames, want %d", got, want)
+	}
+
+	timeout := time.Second
+	msg, err := s.GetMessage(&timeout)
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+	if !bytes.Equal(msg.Payload, payload) {
+		t.Errorf("payload mismatch: got %d bytes, want %d", len(msg.Payload), len(payload))
+	}
+	if msg.Context.PayloadType != payloadType {
+		t.Errorf("PayloadType = %q, want %q", msg.Context.PayloadType, payloadType)
+	}
+	if len(msg.Context.Metadata) != 1 || msg.Context.Metadata["trace"] != "abc" {
+		t.Errorf("Metadata = %v, want only trace=abc", msg.Context.Metadata)
+	}
+}
+
+func TestReassemblyOutOfOrderAndDuplicates(t *testing.T) {
+	r := newReassembler(1024, 0, time.Minute, time.Now)
+	frame := func(i int, data string) slim_bindings.ReceivedMessage {
+		return slim_bindings.ReceivedMessage{
+			Payload: []byte(data),
+			Context: slim_bindings.MessageContext{Metadata: map[string]string{
+				ChunkIdKey:    "m1",
+				ChunkIndexKey: string(rune('0' + i)),
+				ChunkCountKey: "3",
+				ChunkSizeKey:  "9",
+			}},
+		}
+	}
+
+	for _, f := range []slim_bindings.ReceivedMessage{frame(2, "ghi"), frame(0, "abc"), frame(2, "ghi")} {
+		if _, ok, err := r.add(f); ok || err != nil {
+			t.Fatalf("add returned ok=%v err=%v before completion", ok, err)
+		}
+	}
+	msg, ok, err := r.add(frame(1, "def"))
+	if err != nil || !ok {
+		t.Fatalf("add returned ok=%v err=%v on last fragment", ok, err)
+	}
+	if string(msg.Payload) != "abcdefghi" {
+		t.Errorf("Payload = %q, want %q", msg.Payload, "abcdefghi")
+	}
+}
+
+func TestReassemblyRejectsOversizedMessage(t *testing.T) {
+	r := newReassembler(8, 0, time.Minute, time.Now)
+	msg := slim_bindings.ReceivedMessage{
+		Payload: []byte("abc"),
+		Context: slim_bindings.MessageContext{Metadata: map[string]string{
+			ChunkIdKey:    "big",
+			ChunkIndexKey: "0",
+			ChunkCountKey: "4",
+			ChunkSizeKey:  "12",
+		}},
+	}
+
+	if _, _, err := r.add(msg); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("add error = %v, want ErrMessageTooLarge", err)
+	}
+	// Remaining fragments of a rejected message are discarded silently.
+	msg.Context.Metadata[ChunkIndexKey] = "1"
+	if _, ok, err := r.add(msg); ok || err != nil {
+		t.Fatalf("add returned ok=%v err=%v for rejected message", ok, err)
+	}
+}
+
+func TestPublishRejectsOversizedMessage(t *testing.T) {
+	s := Wrap(newFakeSession(), WithMaxMessageSize(4))
+	if _, err := s.Publish([]byte("too long"), nil, nil); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("Publish error = %v, want ErrMessageTooLarge", err)
+	}
+}
+
+func TestReassemblyTimeout(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake, WithMaxFragmentSize(4), WithReassemblyTimeout(20*time.Millisecond))
+
+	// Deliver only the first fragment of a two-fragment message.
+	fake.frames <- slim_bindings.ReceivedMessage{
+		Payload: []byte("abcd"),
+		Context: slim_bindings.MessageContext{Metadata: map[string]string{
+			ChunkIdKey:    "lost",
+			ChunkIndexKey: "0",
+			ChunkCountKey: "2",
+			ChunkSizeKey:  "8",
+		}},
+	}
+
+	timeout := time.Second
+	start := time.Now()
+	if _, err := s.GetMessage(&timeout); !errors.Is(err, ErrReassemblyTimeout) {
+		t.Fatalf("GetMessage error = %v, want ErrReassemblyTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("GetMessage took %v, want it to return soon after the reassembly timeout", elapsed)
+	}
+}
+
+func TestGetMessageHonoursCallerTimeout(t *testing.T) {
+	s := Wrap(newFakeSession())
+
+	timeout := 10 * time.Millisecond
+	if _, err := s.GetMessage(&timeout); !errors.Is(err, slim_bindings.ErrSlimErrorTimeout) {
+		t.Fatalf("GetMessage error = %v, want timeout", err)
+	}
+}
+
+func TestReassemblyRejectsImplausibleHeaders(t *testing.T) {
+	r := newReassembler(1024, 0, time.Minute, time.Now)
+	frame := func(id, index, count, size, data string) slim_bindings.ReceivedMessage {
+		return slim_bindings.ReceivedMessage{
+			Payload: []byte(data),
+			Context: slim_bindings.MessageContext{Metadata: map[string]string{
+				ChunkIdKey:    id,
+				ChunkIndexKey: index,
+				ChunkCountKey: count,
+				ChunkSizeKey:  size,
+			}},
+		}
+	}
+
+	// A huge count is refused before anything is allocated for it.
+	if _, _, err := r.add(frame("many", "0", "1000000000000", "10", "a")); !errors.Is(err, ErrMalformedFragment) {
+		t.Fatalf("add error = %v, want ErrMalformedFragment", err)
+	}
+	// Fragments larger than the declared size are refused as they arrive.
+	if _, _, err := r.add(frame("grow", "0", "3", "6", "abcd")); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, _, err := r.add(frame("grow", "1", "3", "6", "efgh")); !errors.Is(err, ErrMalformedFragment) {
+		t.Fatalf("add error = %v, want ErrMalformedFragment", err)
+	}
+	if len(r.partials) != 0 || r.buffered != 0 {
+		t.Errorf("partials = %d holding %d bytes, want the message dropped", len(r.partials), r.buffered)
+	}
+	// So is a count above maxFragments, even if the size allows it.
+	if _, _, err := r.add(frame("split", "0", "100000", "1000", "a")); !errors.Is(err, ErrMalformedFragment) {
+		t.Fatalf("add error = %v, want ErrMalformedFragment", err)
+	}
+}
+
+func TestReassemblyBoundsBufferedMessages(t *testing.T) {
+	r := newReassembler(8, 12, time.Minute, time.Now)
+	frame := func(id, index, count, size, data string) slim_bindings.ReceivedMessage {
+		return slim_bindings.ReceivedMessage{
+			Payload: []byte(data),
+			Context: slim_bindings.MessageContext{Metadata: map[string]string{
+				ChunkIdKey:    id,
+				ChunkIndexKey: index,
+				ChunkCountKey: count,
+				ChunkSizeKey:  size,
+			}},
+		}
+	}
+
+	// Bytes are bounded across all partial messages.
+	for _, id := range []string{"a", "b"} {
+		if _, _, err := r.add(frame(id, "0", "2", "8", "abcd")); err != nil {
+			t.Fatalf("add %s: %v", id, err)
+		}
+	}
+	if _, _, err := r.add(frame("c", "0", "2", "8", "abcde")); !errors.Is(err, ErrReassemblyBufferFull) {
+		t.Fatalf("add error = %v, want ErrReassemblyBufferFull", err)
+	}
+	if msg, ok, err := r.add(frame("a", "1", "2", "8", "efgh")); !ok || err != nil || string(msg.Payload) != "abcdefgh" {
+		t.Fatalf("add = %q, %v, %v", msg.Payload, ok, err)
+	}
+	if r.buffered != 4 {
+		t.Errorf("buffered = %d, want 4 once a completes", r.buffered)
+	}
+
+	// So is the number of partial messages, even empty ones.
+	r = newReassembler(8, 0, time.Minute, time.Now)
+	for i := range maxPartialMessages {
+		if _, _, err := r.add(frame(strconv.Itoa(i), "0", "2", "2", "")); err != nil {
+			t.Fatalf("add %d: %v", i, err)
+		}
+	}
+	if _, _, err := r.add(frame("more", "0", "2", "2", "")); !errors.Is(err, ErrReassemblyBufferFull) {
+		t.Fatalf("add error = %v, want ErrReassemblyBufferFull", err)
+	}
+}
+
+func TestReassemblyDuplicateEmptyFragment(t *testing.T) {
+	r := newReassembler(8, 0, time.Minute, time.Now)
+	frame := func(index, data string) slim_bindings.ReceivedMessage {
+		return slim_bindings.ReceivedMessage{
+			Payload: []byte(data),
+			Context: slim_bindings.MessageContext{Metadata: map[string]string{
+				ChunkIdKey:    "m",
+				ChunkIndexKey: index,
+				ChunkCountKey: "2",
+				ChunkSizeKey:  "2",
+			}},
+		}
+	}
+
+	// An empty fragment received twice counts once, so the message is not
+	// completed early.
+	for range 2 {
+		if _, ok, err := r.add(frame("0", "")); ok || err != nil {
+			t.Fatalf("add returned ok=%v err=%v before completion", ok, err)
+		}
+	}
+	if _, ok, err := r.add(frame("1", "ab")); !ok || err != nil {
+		t.Fatalf("add returned ok=%v err=%v on last fragment", ok, err)
+	}
+}
+
+func TestWrapDefaultsReassemblyTimeout(t *testing.T) {
+	s := Wrap(newFakeSession(), WithReassemblyTimeout(0))
+	if s.opts.reassemblyTimeout != DefaultReassemblyTimeout {
+		t.Errorf("reassemblyTimeout = %v, want %v", s.opts.reassemblyTimeout, DefaultReassemblyTimeout)
+	}
+}
@@ -0,0 +1,206 @@
+package slimsession
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// Metadata keys of credit-based flow control. FlowWindowKey is stamped on
+// messages sent with Publish when flow control is enabled; CreditKey is
+// carried by the grants the receiver sends back with PublishTo.
+const (
+	FlowWindowKey = "slim-flow-window"
+	CreditKey     = "slim-credit"
+)
+
+// ErrReceiveBufferFull is returned once by GetMessage and Receive after
+// messages were dropped under OverflowError.
+var ErrReceiveBufferFull = errors.New("slimsession: receive buffer full")
+
+// OverflowPolicy decides what happens to a message that arrives while the
+// receive buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops receiving from the session until GetMessage or
+	// Receive makes room, leaving messages queued in the native layer.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest buffered message.
+	OverflowDropOldest
+	// OverflowDropNewest discards the incoming message.
+	OverflowDropNewest
+	// OverflowError discards the incoming message and makes the next
+	// GetMessage or Receive return ErrReceiveBufferFull.
+	OverflowError
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowError:
+		return "error"
+	default:
+		return "OverflowPolicy(" + strconv.Itoa(int(p)) + ")"
+	}
+}
+
+// WithReceiveBuffer bounds how many messages are buffered for GetMessage and
+// Receive. Stream frames are bounded separately by the stream window. A
+// limit of zero, the default, leaves the buffer unbounded.
+func WithReceiveBuffer(limit int, policy OverflowPolicy) Option {
+	return func(o *options) {
+		o.receiveBufferLimit = limit
+		o.overflowPolicy = policy
+	}
+}
+
+// WithFlowControl limits Publish to window messages that the receiver has
+// not consumed yet. PublishAndWait blocks until the receiver grants more
+// credit by reading messages; Publish never blocks but still consumes
+// credit. Streams are paced by their own window instead. The receiver needs
+// no configuration. Flow control is meant for point-to-point sessions, where
+// a single receiver grants credit.
+func WithFlowControl(window int) Option {
+	return func(o *options) {
+		o.flowWindow = window
+	}
+}
+
+// flow holds the credit accounting of both sides of flow control.
+type flow struct {
+	mu sync.Mutex
+	// credits is the sender's remaining window.
+	credits int
+	// owed counts, per sender, consumed messages not yet granted back.
+	owed map[string]int
+}
+
+func newFlow(window int) *flow {
+	return &flow{credits: window, owed: make(map[string]int)}
+}
+
+// takeCredit consumes one credit without waiting for it.
+func (s *Session) takeCredit() {
+	if s.opts.flowWindow <= 0 {
+		return
+	}
+	s.flow.mu.Lock()
+	s.flow.credits--
+	s.flow.mu.Unlock()
+}
+
+// acquireCredit waits until a credit is available and consumes it.
+func (s *Session) acquireCredit(ctx context.Context) error {
+	if s.opts.flowWindow <= 0 {
+		return nil
+	}
+	return s.wait(ctx, func() bool {
+		s.flow.mu.Lock()
+		defer s.flow.mu.Unlock()
+		if s.flow.credits <= 0 {
+			return false
+		}
+		s.flow.credits--
+		return true
+	})
+}
+
+// stampFlow marks metadata with the flow control window, if enabled. Stream
+// frames are left out: their reader grants credit per stream instead.
+func (s *Session) stampFlow(metadata *map[string]string) *map[string]string {
+	if s.opts.flowWindow <= 0 {
+		return metadata
+	}
+	if metadata != nil {
+		if _, isStream := (*metadata)[StreamIdKey]; isStream {
+			return metadata
+		}
+	}
+	md := copyMetadata(metadata)
+	md[FlowWindowKey] = strconv.Itoa(s.opts.flowWindow)
+	return &md
+}
+
+// credit consumes msg if it is a credit grant from a receiver.
+func (s *Session) credit(msg slim_bindings.ReceivedMessage) bool {
+	v, ok := msg.Context.Metadata[CreditKey]
+	if !ok {
+		return false
+	}
+	if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		s.flow.mu.Lock()
+		s.flow.credits += n
+		s.flow.mu.Unlock()
+	}
+	return true
+}
+
+// consumed grants credit back to the sender of a flow-controlled message
+// once half of its window has been consumed or dropped.
+func (s *Session) consumed(msg slim_bindings.ReceivedMessage) {
+	window, err := strconv.Atoi(msg.Context.Metadata[FlowWindowKey])
+	if err != nil || window <= 0 {
+		return
+	}
+	var sender string
+	if msg.Context.SourceName != nil {
+		sender = s.opts.nameKey(msg.Context.SourceName)
+	}
+
+	s.flow.mu.Lock()
+	s.flow.owed[sender]++
+	n := s.flow.owed[sender]
+	if n < max(1, window/2) {
+		s.flow.mu.Unlock()
+		return
+	}
+	delete(s.flow.owed, sender)
+	s.flow.mu.Unlock()
+
+	md := map[string]string{CreditKey: strconv.Itoa(n)}
+	if _, err := s.SessionInterface.PublishTo(msg.Context, []byte{}, nil, &md); err != nil {
+		// Keep the credit owed so that the next grant carries it.
+		s.flow.mu.Lock()
+		s.flow.owed[sender] += n
+		s.flow.mu.Unlock()
+	}
+}
+
+// enqueue buffers r for GetMessage according to the overflow policy and
+// returns any message it discarded. Must be called with d.mu held.
+func (d *demux) enqueue(r received) (dropped *received) {
+	if d.limit > 0 && len(d.pending) >= d.limit {
+		switch d.policy {
+		case OverflowDropOldest:
+			oldest := d.pending[0]
+			d.pending = d.pending[1:]
+			d.dropped++
+			dropped = &oldest
+		case OverflowDropNewest:
+			d.dropped++
+			return &r
+		case OverflowError:
+			d.dropped++
+			d.overflowed = true
+			return &r
+		}
+	}
+	d.pending = append(d.pending, r)
+	d.highWatermark = max(d.highWatermark, len(d.pending))
+	return dropped
+}
+
+// full reports whether OverflowBlock should stop the pump. Must be called
+// with d.mu held.
+func (d *demux) full() bool {
+	return d.limit > 0 && d.policy == OverflowBlock && len(d.pending) >= d.limit
+}
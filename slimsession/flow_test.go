@@ -0,0 +1,165 @@
+package slimsession
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+func plain(payloads ...string) []slim_bindings.ReceivedMessage {
+	msgs := make([]slim_bindings.ReceivedMessage, len(payloads))
+	for i, p := range payloads {
+		msgs[i] = slim_bindings.ReceivedMessage{Payload: []byte(p)}
+	}
+	return msgs
+}
+
+func drain(t *testing.T, s *Session, want ...string) {
+	t.Helper()
+	timeout := time.Second
+	for _, w := range want {
+		msg, err := s.GetMessage(&timeout)
+		if err != nil {
+			t.Fatalf("GetMessage: %v", err)
+		}
+		if string(msg.Payload) != w {
+			t.Fatalf("got %q, want %q", msg.Payload, w)
+		}
+	}
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy OverflowPolicy
+		want   []string
+	}{
+		{OverflowDropOldest, []string{"b", "c"}},
+		{OverflowDropNewest, []string{"a", "b"}},
+	} {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			s := Wrap(newFakeSession(), WithReceiveBuffer(2, tc.policy))
+			s.route(plain("a", "b", "c"))
+
+			stats := s.Stats()
+			if stats.Buffered != 2 || stats.BufferLimit != 2 || stats.HighWatermark != 2 || stats.Dropped != 1 {
+				t.Fatalf("Stats = %+v", stats)
+			}
+			drain(t, s, tc.want...)
+		})
+	}
+}
+
+func TestOverflowErrorIsReportedOnce(t *testing.T) {
+	s := Wrap(newFakeSession(), WithReceiveBuffer(2, OverflowError))
+	s.route(plain("a", "b", "c"))
+
+	timeout := time.Second
+	if _, err := s.GetMessage(&timeout); !errors.Is(err, ErrReceiveBufferFull) {
+		t.Fatalf("GetMessage error = %v, want ErrReceiveBufferFull", err)
+	}
+	drain(t, s, "a", "b")
+}
+
+func TestOverflowBlockStopsReceiving(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake, WithReceiveBuffer(1, OverflowBlock))
+	for _, p := range []string{"a", "b", "c"} {
+		fake.Publish([]byte(p), nil, nil)
+	}
+
+	// Pump on behalf of a waiter that is never satisfied.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.wait(ctx, func() bool { return false })
+
+	if got := s.Stats().Buffered; got != 1 {
+		t.Fatalf("Buffered = %d, want 1", got)
+	}
+	if got := len(fake.frames); got != 2 {
+		t.Fatalf("%d frames left in the session, want 2", got)
+	}
+	drain(t, s, "a", "b", "c")
+}
+
+func TestFlowControlBlocksPublishAndWait(t *testing.T) {
+	s := Wrap(newFakeSession(), WithFlowControl(2))
+
+	for i := 0; i < 2; i++ {
+		if err := s.PublishAndWait([]byte{byte('0' + i)}, nil, nil); err != nil {
+			t.Fatalf("PublishAndWait: %v", err)
+		}
+	}
+	if got := s.Stats().Credits; got != 0 {
+		t.Fatalf("Credits = %d, want 0", got)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.PublishAndWait([]byte("2"), nil, nil)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("PublishAndWait returned %v without credit", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Consuming one message grants half the window back.
+	drain(t, s, "0")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("PublishAndWait: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("PublishAndWait still blocked after credit was granted")
+	}
+	drain(t, s, "1", "2")
+}
+
+func TestFlowControlLeavesStreamsOut(t *testing.T) {
+	s := Wrap(newFakeSession(), WithFlowControl(2), WithMaxFragmentSize(4))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A stream longer than the flow window neither consumes its credit nor
+	// waits for it.
+	w := s.OpenWriter(ctx, nil, nil)
+	written := make(chan error, 1)
+	go func() {
+		if _, err := w.Write([]byte("aaaabbbbccccdddd")); err != nil {
+			written <- err
+			return
+		}
+		written <- w.Close()
+	}()
+	r, err := s.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream: %v", err)
+	}
+	if got, err := io.ReadAll(r); err != nil || len(got) != 16 {
+		t.Fatalf("ReadAll = %q, %v", got, err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got := s.Stats().Credits; got != 2 {
+		t.Errorf("Credits = %d after a stream, want 2", got)
+	}
+}
+
+func TestPublishAndWaitContextGivesUp(t *testing.T) {
+	s := Wrap(newFakeSession(), WithFlowControl(1))
+	if err := s.PublishAndWait([]byte("0"), nil, nil); err != nil {
+		t.Fatalf("PublishAndWait: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.PublishAndWaitContext(ctx, []byte("1"), nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("PublishAndWaitContext without credit error = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,368 @@
+package slimsession
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// DefaultMembershipPollInterval is how often the participant list is polled
+// while someone is listening for membership events.
+const DefaultMembershipPollInterval = time.Second
+
+// MembershipEventType is the kind of change reported by MembershipEvents.
+type MembershipEventType int
+
+const (
+	// MemberJoined reports a participant that was invited or showed up in
+	// the participant list.
+	MemberJoined MembershipEventType = iota
+	// MemberLeft reports a participant that disappeared from the participant
+	// list without being removed through this session.
+	MemberLeft
+	// MemberRemoved reports a participant removed through this session.
+	MemberRemoved
+)
+
+func (t MembershipEventType) String() string {
+	switch t {
+	case MemberJoined:
+		return "joined"
+	case MemberLeft:
+		return "left"
+	case MemberRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// MembershipEvent is a change in the session's group membership.
+type MembershipEvent struct {
+	Type        MembershipEventType
+	Participant *slim_bindings.Name
+	Time        time.Time
+}
+
+// WithMembershipPollInterval sets how often ParticipantsList is polled to
+// detect participants joining or leaving on their own.
+func WithMembershipPollInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.membershipPollInterval = d
+	}
+}
+
+// roster is the Go-side view of the session's participants.
+type roster struct {
+	mu      sync.Mutex
+	synced  bool
+	members map[string]*slim_bindings.Name
+	// removing holds participants with a RemoveAndWait in progress, so a
+	// poll racing with it reports them as removed rather than left.
+	removing map[string]struct{}
+	subs     map[*subscriber]struct{}
+	polling  bool
+	// version is bumped by every change made through this session, so a
+	// participant list fetched before the change is not applied after it.
+	version uint64
+}
+
+func newRoster() *roster {
+	return &roster{
+		members:  make(map[string]*slim_bindings.Name),
+		removing: make(map[string]struct{}),
+		subs:     make(map[*subscriber]struct{}),
+	}
+}
+
+// subscriber is a MembershipEvents caller. Events are queued under the
+// roster lock and delivered by the subscriber's own goroutine, so a slow
+// subscriber, or one calling Roster, delays nobody but itself.
+type subscriber struct {
+	ch  chan MembershipEvent
+	ctx context.Context
+	// queue is guarded by the roster lock.
+	queue []MembershipEvent
+	wake  chan struct{}
+}
+
+// deliver sends queued events to the subscriber until its context is done or
+// closed is.
+func (sub *subscriber) deliver(r *roster, closed <-chan struct{}) {
+	defer close(sub.ch)
+	defer func() {
+		r.mu.Lock()
+		delete(r.subs, sub)
+		r.mu.Unlock()
+	}()
+
+	for {
+		r.mu.Lock()
+		events := sub.queue
+		sub.queue = nil
+		r.mu.Unlock()
+
+		for _, ev := range events {
+			select {
+			case sub.ch <- ev:
+			case <-sub.ctx.Done():
+				return
+			case <-closed:
+				return
+			}
+		}
+		select {
+		case <-sub.wake:
+		case <-sub.ctx.Done():
+			return
+		case <-closed:
+			return
+		}
+	}
+}
+
+// MembershipEvents returns a stream of membership changes. The channel is
+// closed when ctx is done or the Session is closed. Participants already
+// present when the roster is first synchronised are not reported; use Roster
+// for the current state.
+func (s *Session) MembershipEvents(ctx context.Context) <-chan MembershipEvent {
+	sub := &subscriber{ch: make(chan MembershipEvent, 64), ctx: ctx, wake: make(chan struct{}, 1)}
+
+	r := s.roster
+	r.mu.Lock()
+	r.subs[sub] = struct{}{}
+	startPoller := !r.polling
+	r.polling = true
+	r.mu.Unlock()
+
+	if startPoller {
+		go s.pollMembership()
+	}
+	go sub.deliver(r, s.life.done)
+	return sub.ch
+}
+
+// Roster returns the participants currently known to be in the session,
+// synchronising with ParticipantsList first.
+func (s *Session) Roster() ([]*slim_bindings.Name, error) {
+	if err := s.syncMembership(); err != nil {
+		return nil, err
+	}
+
+	s.roster.mu.Lock()
+	defer s.roster.mu.Unlock()
+	out := make([]*slim_bindings.Name, 0, len(s.roster.members))
+	for _, name := range s.roster.members {
+		out = append(out, name)
+	}
+	return out, nil
+}
+
+// InviteAndWait invites a participant, waits for completion and reports a
+// MemberJoined event.
+func (s *Session) InviteAndWait(participant *slim_bindings.Name) error {
+	if err := s.SessionInterface.InviteAndWait(participant); err != nil {
+		return err
+	}
+	s.applyMembership(MemberJoined, participant)
+	return nil
+}
+
+// RemoveAndWait removes a participant, waits for completion and reports a
+// MemberRemoved event.
+func (s *Session) RemoveAndWait(participant *slim_bindings.Name) error {
+	key := s.opts.nameKey(participant)
+	s.roster.mu.Lock()
+	s.roster.removing[key] = struct{}{}
+	s.roster.mu.Unlock()
+	defer func() {
+		s.roster.mu.Lock()
+		delete(s.roster.removing, key)
+		s.roster.mu.Unlock()
+	}()
+
+	if err := s.SessionInterface.RemoveAndWait(participant); err != nil {
+		return err
+	}
+	s.applyMembership(MemberRemoved, participant)
+	return nil
+}
+
+// contextMembership is implemented by sessions whose membership changes can
+// be cancelled, such as *slim_bindings.Session.
+type contextMembership interface {
+	InviteAndWaitContext(ctx context.Context, participant *slim_bindings.Name) error
+	RemoveAndWaitContext(ctx context.Context, participant *slim_bindings.Name) error
+}
+
+// InviteAndWaitContext is InviteAndWait with cancellation, for sessions that
+// support it. It does not keep participant: the MemberJoined event carries
+// the name from ParticipantsList, so the caller may destroy participant once
+// the call returns.
+func (s *Session) InviteAndWaitContext(ctx context.Context, participant *slim_bindings.Name) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	if cm, ok := s.SessionInterface.(contextMembership); ok {
+		err = cm.InviteAndWaitContext(ctx, participant)
+	} else {
+		err = s.SessionInterface.InviteAndWait(participant)
+	}
+	if err != nil {
+		return err
+	}
+	// A failed sync is caught up by the next poll.
+	_ = s.syncMembership()
+	return nil
+}
+
+// RemoveAndWaitContext is RemoveAndWait with cancellation, for sessions that
+// support it. Like InviteAndWaitContext, it does not keep participant.
+func (s *Session) RemoveAndWaitContext(ctx context.Context, participant *slim_bindings.Name) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key := s.opts.nameKey(participant)
+	s.roster.mu.Lock()
+	s.roster.removing[key] = struct{}{}
+	s.roster.mu.Unlock()
+	defer func() {
+		s.roster.mu.Lock()
+		delete(s.roster.removing, key)
+		s.roster.mu.Unlock()
+	}()
+
+	var err error
+	if cm, ok := s.SessionInterface.(contextMembership); ok {
+		err = cm.RemoveAndWaitContext(ctx, participant)
+	} else {
+		err = s.SessionInterface.RemoveAndWait(participant)
+	}
+	if err != nil {
+		return err
+	}
+	// Sync while the participant is still marked as removing, so that it is
+	// reported as removed rather than left.
+	_ = s.syncMembership()
+	return nil
+}
+
+// pollMembership synchronises the roster every poll interval until there are
+// no subscribers left or the Session is closed.
+func (s *Session) pollMembership() {
+	ticker := time.NewTicker(s.opts.membershipPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.life.enter() {
+			// Transient errors are retried on the next tick.
+			_ = s.syncMembership()
+			s.life.leave()
+		}
+
+		var closed bool
+		select {
+		case <-ticker.C:
+		case <-s.life.done:
+			closed = true
+		}
+		s.roster.mu.Lock()
+		if closed || len(s.roster.subs) == 0 {
+			s.roster.polling = false
+			s.roster.mu.Unlock()
+			return
+		}
+		s.roster.mu.Unlock()
+	}
+}
+
+// syncMembership diffs ParticipantsList against the roster and reports the
+// differences.
+func (s *Session) syncMembership() error {
+	r := s.roster
+	r.mu.Lock()
+	version := r.version
+	r.mu.Unlock()
+
+	participants, err := s.SessionInterface.ParticipantsList()
+	if err != nil {
+		return err
+	}
+
+	now := s.opts.now()
+	current := make(map[string]*slim_bindings.Name, len(participants))
+	for _, p := range participants {
+		current[s.opts.nameKey(p)] = p
+	}
+
+	r.mu.Lock()
+	if r.version != version {
+		// Stale list; the next poll will catch up.
+		r.mu.Unlock()
+		return nil
+	}
+	var events []MembershipEvent
+	for key, name := range current {
+		if _, ok := r.members[key]; !ok && r.synced {
+			events = append(events, MembershipEvent{Type: MemberJoined, Participant: name, Time: now})
+		}
+	}
+	for key, name := range r.members {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		t := MemberLeft
+		if _, ok := r.removing[key]; ok {
+			t = MemberRemoved
+		}
+		events = append(events, MembershipEvent{Type: t, Participant: name, Time: now})
+	}
+	r.members = current
+	r.synced = true
+	r.mu.Unlock()
+
+	s.emitMembership(events)
+	return nil
+}
+
+// applyMembership records a change made through this session.
+func (s *Session) applyMembership(t MembershipEventType, participant *slim_bindings.Name) {
+	r := s.roster
+	key := s.opts.nameKey(participant)
+
+	r.mu.Lock()
+	_, present := r.members[key]
+	switch {
+	case t == MemberJoined && !present:
+		r.members[key] = participant
+	case t == MemberRemoved && present:
+		delete(r.members, key)
+	default:
+		r.mu.Unlock()
+		return
+	}
+	r.version++
+	r.mu.Unlock()
+
+	s.emitMembership([]MembershipEvent{{Type: t, Participant: participant, Time: s.opts.now()}})
+}
+
+func (s *Session) emitMembership(events []MembershipEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	r := s.roster
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for sub := range r.subs {
+		sub.queue = append(sub.queue, events...)
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package slimsession
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+type fakeGroup struct {
+	slim_bindings.SessionInterface
+
+	mu      sync.Mutex
+	members []*slim_bindings.Name
+	polls   int
+}
+
+func (f *fakeGroup) ParticipantsList() ([]*slim_bindings.Name, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.polls++
+	return append([]*slim_bindings.Name(nil), f.members...), nil
+}
+
+func (f *fakeGroup) set(members ...*slim_bindings.Name) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.members = members
+}
+
+func (f *fakeGroup) InviteAndWait(participant *slim_bindings.Name) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.members = append(f.members, participant)
+	return nil
+}
+
+func (f *fakeGroup) RemoveAndWait(participant *slim_bindings.Name) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, m := range f.members {
+		if m == participant {
+			f.members = append(f.members[:i], f.members[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func newTestGroup(members ...*slim_bindings.Name) (*fakeGroup, *Session) {
+	fake := &fakeGroup{members: members}
+	s := Wrap(fake, WithMembershipPollInterval(5*time.Millisecond))
+	// Names are native objects; key them by pointer in tests.
+	s.opts.nameKey = func(n *slim_bindings.Name) string { return fmt.Sprintf("%p", n) }
+	return fake, s
+}
+
+func nextEvent(t *testing.T, events <-chan MembershipEvent) MembershipEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for membership event")
+		return MembershipEvent{}
+	}
+}
+
+func TestMembershipEventsFromPolling(t *testing.T) {
+	alice, bob := &slim_bindings.Name{}, &slim_bindings.Name{}
+	fake, s := newTestGroup(alice)
+
+	if roster, err := s.Roster(); err != nil || len(roster) != 1 {
+		t.Fatalf("Roster() = %v, %v; want one member", roster, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := s.MembershipEvents(ctx)
+
+	fake.set(alice, bob)
+	if ev := nextEvent(t, events); ev.Type != MemberJoined || ev.Participant != bob {
+		t.Errorf("got %v for %p, want joined for bob", ev.Type, ev.Participant)
+	}
+
+	fake.set(bob)
+	if ev := nextEvent(t, events); ev.Type != MemberLeft || ev.Participant != alice {
+		t.Errorf("got %v for %p, want left for alice", ev.Type, ev.Participant)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestMembershipEventsFromInviteAndRemove(t *testing.T) {
+	carol := &slim_bindings.Name{}
+	_, s := newTestGroup()
+	if _, err := s.Roster(); err != nil {
+		t.Fatalf("Roster: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := s.MembershipEvents(ctx)
+
+	if err := s.InviteAndWait(carol); err != nil {
+		t.Fatalf("InviteAndWait: %v", err)
+	}
+	if ev := nextEvent(t, events); ev.Type != MemberJoined || ev.Participant != carol {
+		t.Errorf("got %v for %p, want joined for carol", ev.Type, ev.Participant)
+	}
+
+	if err := s.RemoveAndWait(carol); err != nil {
+		t.Fatalf("RemoveAndWait: %v", err)
+	}
+	if ev := nextEvent(t, events); ev.Type != MemberRemoved || ev.Participant != carol {
+		t.Errorf("got %v for %p, want removed for carol", ev.Type, ev.Participant)
+	}
+
+	// The poller must not report the removal a second time as a leave.
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %v", ev.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMembershipEventsSlowSubscriber(t *testing.T) {
+	_, s := newTestGroup()
+	if _, err := s.Roster(); err != nil {
+		t.Fatalf("Roster: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := s.MembershipEvents(ctx)
+
+	// Nobody reads while more events than the channel holds are emitted;
+	// the roster stays usable meanwhile.
+	names := make([]*slim_bindings.Name, 100)
+	for i := range names {
+		names[i] = &slim_bindings.Name{}
+		if err := s.InviteAndWait(names[i]); err != nil {
+			t.Fatalf("InviteAndWait: %v", err)
+		}
+	}
+	if roster, err := s.Roster(); err != nil || len(roster) != len(names) {
+		t.Fatalf("Roster() = %d members, %v; want %d", len(roster), err, len(names))
+	}
+
+	for i := range names {
+		if ev := nextEvent(t, events); ev.Participant != names[i] {
+			t.Fatalf("event %d for %p, want %p", i, ev.Participant, names[i])
+		}
+	}
+}
+
+func TestCloseStopsMembershipPolling(t *testing.T) {
+	fake, s := newTestGroup()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := s.MembershipEvents(ctx)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("unexpected event after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("events channel not closed by Close")
+	}
+
+	fake.mu.Lock()
+	polls := fake.polls
+	fake.mu.Unlock()
+	time.Sleep(30 * time.Millisecond)
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.polls != polls {
+		t.Errorf("ParticipantsList called %d times after Close", fake.polls-polls)
+	}
+}
+
+// copyingGroup lists its own copy of each participant, as the native
+// session does.
+type copyingGroup struct {
+	*fakeGroup
+	copies map[*slim_bindings.Name]*slim_bindings.Name
+}
+
+func (f *copyingGroup) InviteAndWait(participant *slim_bindings.Name) error {
+	return f.fakeGroup.InviteAndWait(f.copies[participant])
+}
+
+func (f *copyingGroup) RemoveAndWait(participant *slim_bindings.Name) error {
+	return f.fakeGroup.RemoveAndWait(f.copies[participant])
+}
+
+func TestMembershipContextDoesNotKeepParticipant(t *testing.T) {
+	carol, listed := &slim_bindings.Name{}, &slim_bindings.Name{}
+	fake := &copyingGroup{fakeGroup: &fakeGroup{}, copies: map[*slim_bindings.Name]*slim_bindings.Name{carol: listed}}
+	s := Wrap(fake, WithMembershipPollInterval(time.Hour))
+	keys := map[*slim_bindings.Name]string{carol: "carol", listed: "carol"}
+	s.opts.nameKey = func(n *slim_bindings.Name) string { return keys[n] }
+	if _, err := s.Roster(); err != nil {
+		t.Fatalf("Roster: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := s.MembershipEvents(ctx)
+
+	if err := s.InviteAndWaitContext(ctx, carol); err != nil {
+		t.Fatalf("InviteAndWaitContext: %v", err)
+	}
+	if ev := nextEvent(t, events); ev.Type != MemberJoined || ev.Participant != listed {
+		t.Errorf("got %v for %p, want joined for the listed name", ev.Type, ev.Participant)
+	}
+	if err := s.RemoveAndWaitContext(ctx, carol); err != nil {
+		t.Fatalf("RemoveAndWaitContext: %v", err)
+	}
+	if ev := nextEvent(t, events); ev.Type != MemberRemoved || ev.Participant != listed {
+		t.Errorf("got %v for %p, want removed for the listed name", ev.Type, ev.Participant)
+	}
+
+	cancel()
+	if err := s.InviteAndWaitContext(ctx, carol); err != context.Canceled {
+		t.Errorf("InviteAndWaitContext after cancel = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,230 @@
+package slimsession
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// Metadata keys stamped on messages sent with Publish when ordered delivery
+// is enabled. They are left on delivered messages.
+const (
+	PublisherIdKey = "slim-publisher-id"
+	SequenceKey    = "slim-seq"
+)
+
+const (
+	// DefaultGapTimeout is how long messages are held back waiting for a
+	// missing predecessor before the gap is skipped.
+	DefaultGapTimeout = 5 * time.Second
+	// DefaultMaxOutOfOrder is how many messages per publisher are held back
+	// before the oldest gap is skipped.
+	DefaultMaxOutOfOrder = 1024
+	// DefaultPublisherIdleTimeout is how long a publisher that sent nothing
+	// is remembered.
+	DefaultPublisherIdleTimeout = 10 * time.Minute
+)
+
+// Gap reports messages from a publisher that were never received. First and
+// Last are inclusive sequence numbers.
+type Gap struct {
+	Publisher string
+	First     uint64
+	Last      uint64
+}
+
+// WithOrderedDelivery stamps every Publish with a per-publisher sequence
+// number and makes GetMessage deliver each publisher's messages in order,
+// without duplicates. Messages sent with PublishTo are not sequenced, since
+// each recipient only sees part of them.
+func WithOrderedDelivery() Option {
+	return func(o *options) {
+		o.ordered = true
+	}
+}
+
+// WithGapTimeout sets how long out-of-order messages are held back waiting
+// for a missing one.
+func WithGapTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.gapTimeout = d
+	}
+}
+
+// WithMaxOutOfOrder sets how many messages per publisher are held back
+// waiting for a missing one.
+func WithMaxOutOfOrder(n int) Option {
+	return func(o *options) {
+		o.maxOutOfOrder = n
+	}
+}
+
+// WithPublisherIdleTimeout sets how long the sequence of a publisher that
+// sent nothing is remembered. Messages from a forgotten publisher are ordered
+// as if it had just joined, so the timeout should exceed the publishers'
+// longest silence.
+func WithPublisherIdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.publisherIdleTimeout = d
+	}
+}
+
+// WithGapHandler installs a callback invoked when a gap is skipped.
+func WithGapHandler(onGap func(Gap)) Option {
+	return func(o *options) {
+		o.onGap = onGap
+	}
+}
+
+// sequencer stamps outgoing messages. Its lock is held across the publish so
+// that sequence numbers hit the wire in order.
+type sequencer struct {
+	mu          sync.Mutex
+	publisherId string
+	next        uint64
+}
+
+func (q *sequencer) stamp(metadata *map[string]string) *map[string]string {
+	md := copyMetadata(metadata)
+	md[PublisherIdKey] = q.publisherId
+	md[SequenceKey] = strconv.FormatUint(q.next, 10)
+	q.next++
+	return &md
+}
+
+type publisherState struct {
+	next    uint64
+	pending map[uint64]slim_bindings.ReceivedMessage
+	// heldSince is when the oldest currently held message was buffered.
+	heldSince time.Time
+	// lastSeen is when the publisher's last message arrived.
+	lastSeen time.Time
+}
+
+// orderer restores per-publisher order on the receive side.
+type orderer struct {
+	mu         sync.Mutex
+	timeout    time.Duration
+	idle       time.Duration
+	maxPending int
+	now        func() time.Time
+	publishers map[string]*publisherState
+}
+
+func newOrderer(timeout, idle time.Duration, maxPending int, now func() time.Time) *orderer {
+	return &orderer{
+		timeout:    timeout,
+		idle:       idle,
+		maxPending: maxPending,
+		now:        now,
+		publishers: make(map[string]*publisherState),
+	}
+}
+
+// add accepts msg and returns the messages that are now deliverable, in
+// order, together with any gaps that had to be skipped.
+func (o *orderer) add(msg slim_bindings.ReceivedMessage) ([]slim_bindings.ReceivedMessage, []Gap) {
+	publisher, ok := msg.Context.Metadata[PublisherIdKey]
+	if !ok {
+		return []slim_bindings.ReceivedMessage{msg}, nil
+	}
+	seq, err := strconv.ParseUint(msg.Context.Metadata[SequenceKey], 10, 64)
+	if err != nil {
+		return []slim_bindings.ReceivedMessage{msg}, nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	p, ok := o.publishers[publisher]
+	if !ok {
+		// Publishers count from zero. A receiver that joined late holds the
+		// first messages back for the gap timeout and then reports the
+		// earlier ones as a gap.
+		p = &publisherState{pending: make(map[uint64]slim_bindings.ReceivedMessage)}
+		o.publishers[publisher] = p
+	}
+	p.lastSeen = o.now()
+	if _, dup := p.pending[seq]; dup || seq < p.next {
+		return nil, nil
+	}
+	p.pending[seq] = msg
+	start := p.next
+
+	ready := p.drain()
+	var gaps []Gap
+	for len(p.pending) > o.maxPending {
+		gap, more := p.skip(publisher)
+		gaps = append(gaps, gap)
+		ready = append(ready, more...)
+	}
+	if p.next != start {
+		// The wait starts over for whatever is still held back.
+		p.heldSince = time.Time{}
+	}
+	p.hold(o.now())
+	return ready, gaps
+}
+
+// expire skips gaps that have been waited on for longer than the timeout and
+// forgets idle publishers.
+func (o *orderer) expire() ([]slim_bindings.ReceivedMessage, []Gap) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := o.now()
+	var ready []slim_bindings.ReceivedMessage
+	var gaps []Gap
+	for publisher, p := range o.publishers {
+		for len(p.pending) > 0 && now.Sub(p.heldSince) >= o.timeout {
+			gap, more := p.skip(publisher)
+			gaps = append(gaps, gap)
+			ready = append(ready, more...)
+			p.heldSince = now
+		}
+		p.hold(now)
+		if len(p.pending) == 0 && now.Sub(p.lastSeen) >= o.idle {
+			delete(o.publishers, publisher)
+		}
+	}
+	return ready, gaps
+}
+
+// drain returns the contiguous run of messages starting at next.
+func (p *publisherState) drain() []slim_bindings.ReceivedMessage {
+	var ready []slim_bindings.ReceivedMessage
+	for {
+		msg, ok := p.pending[p.next]
+		if !ok {
+			return ready
+		}
+		delete(p.pending, p.next)
+		ready = append(ready, msg)
+		p.next++
+	}
+}
+
+// skip gives up on the missing messages before the oldest held one.
+func (p *publisherState) skip(publisher string) (Gap, []slim_bindings.ReceivedMessage) {
+	oldest := uint64(math.MaxUint64)
+	for seq := range p.pending {
+		oldest = min(oldest, seq)
+	}
+
+	gap := Gap{Publisher: publisher, First: p.next, Last: oldest - 1}
+	p.next = oldest
+	return gap, p.drain()
+}
+
+// hold keeps heldSince in step with whether anything is buffered.
+func (p *publisherState) hold(now time.Time) {
+	switch {
+	case len(p.pending) == 0:
+		p.heldSince = time.Time{}
+	case p.heldSince.IsZero():
+		p.heldSince = now
+	}
+}
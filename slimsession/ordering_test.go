@@ -0,0 +1,186 @@
+package slimsession
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+func sequenced(publisher string, seq uint64) slim_bindings.ReceivedMessage {
+	return slim_bindings.ReceivedMessage{
+		Payload: []byte(publisher + strconv.FormatUint(seq, 10)),
+		Context: slim_bindings.MessageContext{Metadata: map[string]string{
+			PublisherIdKey: publisher,
+			SequenceKey:    strconv.FormatUint(seq, 10),
+		}},
+	}
+}
+
+func payloads(msgs []slim_bindings.ReceivedMessage) []string {
+	out := make([]string, len(msgs))
+	for i, m := range msgs {
+		out[i] = string(m.Payload)
+	}
+	return out
+}
+
+func TestOrdererReordersAndSuppressesDuplicates(t *testing.T) {
+	o := newOrderer(time.Minute, time.Hour, 16, time.Now)
+
+	var delivered []slim_bindings.ReceivedMessage
+	for _, msg := range []slim_bindings.ReceivedMessage{
+		sequenced("a", 0), sequenced("a", 2), sequenced("b", 0), sequenced("a", 0),
+		sequenced("a", 1), sequenced("a", 2), sequenced("b", 1),
+	} {
+		ready, gaps := o.add(msg)
+		if len(gaps) != 0 {
+			t.Fatalf("unexpected gaps %v", gaps)
+		}
+		delivered = append(delivered, ready...)
+	}
+
+	want := []string{"a0", "b0", "a1", "a2", "b1"}
+	got := payloads(delivered)
+	if len(got) != len(want) {
+		t.Fatalf("delivered %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("delivered %v, want %v", got, want)
+		}
+	}
+}
+
+func TestOrdererSkipsGapAfterTimeout(t *testing.T) {
+	now := time.Unix(0, 0)
+	o := newOrderer(time.Second, time.Hour, 16, func() time.Time { return now })
+
+	o.add(sequenced("a", 0))
+	if ready, _ := o.add(sequenced("a", 3)); len(ready) != 0 {
+		t.Fatalf("delivered %v before the gap was filled", payloads(ready))
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ready, gaps := o.expire(); len(ready) != 0 || len(gaps) != 0 {
+		t.Fatalf("expired early: ready=%v gaps=%v", payloads(ready), gaps)
+	}
+
+	now = now.Add(time.Second)
+	ready, gaps := o.expire()
+	if len(gaps) != 1 || gaps[0] != (Gap{Publisher: "a", First: 1, Last: 2}) {
+		t.Fatalf("gaps = %v, want [{a 1 2}]", gaps)
+	}
+	if got := payloads(ready); len(got) != 1 || got[0] != "a3" {
+		t.Fatalf("delivered %v, want [a3]", got)
+	}
+
+	// A late arrival from the skipped range is now a duplicate.
+	if ready, _ := o.add(sequenced("a", 1)); len(ready) != 0 {
+		t.Fatalf("delivered late message %v", payloads(ready))
+	}
+}
+
+func TestOrdererLateJoinerReportsInitialGap(t *testing.T) {
+	now := time.Unix(0, 0)
+	o := newOrderer(time.Second, time.Hour, 16, func() time.Time { return now })
+
+	if ready, _ := o.add(sequenced("a", 40)); len(ready) != 0 {
+		t.Fatalf("delivered %v before the gap timeout", payloads(ready))
+	}
+	now = now.Add(2 * time.Second)
+	ready, gaps := o.expire()
+	if len(gaps) != 1 || gaps[0] != (Gap{Publisher: "a", First: 0, Last: 39}) {
+		t.Fatalf("gaps = %v, want [{a 0 39}]", gaps)
+	}
+	if got := payloads(ready); len(got) != 1 || got[0] != "a40" {
+		t.Fatalf("delivered %v, want [a40]", got)
+	}
+}
+
+func TestOrdererSkipsGapWhenBufferFull(t *testing.T) {
+	o := newOrderer(time.Minute, time.Hour, 2, time.Now)
+	o.add(sequenced("a", 0))
+	o.add(sequenced("a", 2))
+	o.add(sequenced("a", 3))
+
+	ready, gaps := o.add(sequenced("a", 5))
+	if len(gaps) != 1 || gaps[0].First != 1 || gaps[0].Last != 1 {
+		t.Fatalf("gaps = %v, want [{a 1 1}]", gaps)
+	}
+	if got := payloads(ready); len(got) != 2 || got[0] != "a2" || got[1] != "a3" {
+		t.Fatalf("delivered %v, want [a2 a3]", got)
+	}
+}
+
+func TestOrderedSessionRoundTrip(t *testing.T) {
+	fake := newFakeSession()
+	var mu sync.Mutex
+	var gaps []Gap
+	s := Wrap(fake, WithOrderedDelivery(), WithGapHandler(func(g Gap) {
+		mu.Lock()
+		gaps = append(gaps, g)
+		mu.Unlock()
+	}))
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Publish([]byte{byte('0' + i)}, nil, nil); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	// Swap the first two frames and duplicate the last one.
+	first, second, third := <-fake.frames, <-fake.frames, <-fake.frames
+	fake.frames <- second
+	fake.frames <- first
+	fake.frames <- third
+	fake.frames <- third
+
+	timeout := time.Second
+	for i := 0; i < 3; i++ {
+		msg, err := s.GetMessage(&timeout)
+		if err != nil {
+			t.Fatalf("GetMessage: %v", err)
+		}
+		if string(msg.Payload) != string(rune('0'+i)) {
+			t.Fatalf("message %d payload = %q", i, msg.Payload)
+		}
+	}
+	short := 50 * time.Millisecond
+	if msg, err := s.GetMessage(&short); err == nil {
+		t.Fatalf("duplicate delivered: %q", msg.Payload)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(gaps) != 0 {
+		t.Errorf("unexpected gaps %v", gaps)
+	}
+}
+
+func TestOrdererForgetsIdlePublishers(t *testing.T) {
+	now := time.Unix(0, 0)
+	o := newOrderer(time.Second, time.Minute, 16, func() time.Time { return now })
+
+	o.add(sequenced("a", 0))
+	o.add(sequenced("b", 0))
+	now = now.Add(30 * time.Second)
+	o.add(sequenced("b", 1))
+
+	now = now.Add(45 * time.Second)
+	o.expire()
+	if _, ok := o.publishers["a"]; ok {
+		t.Error("idle publisher a was kept")
+	}
+	if _, ok := o.publishers["b"]; !ok {
+		t.Error("active publisher b was forgotten")
+	}
+}
+
+func TestWrapDefaultsGapTimeout(t *testing.T) {
+	s := Wrap(newFakeSession(), WithOrderedDelivery(), WithGapTimeout(0), WithPublisherIdleTimeout(-1))
+	if s.order.timeout != DefaultGapTimeout || s.order.idle != DefaultPublisherIdleTimeout {
+		t.Errorf("timeouts = %v, %v, want the defaults", s.order.timeout, s.order.idle)
+	}
+}
@@ -0,0 +1,453 @@
+package slimsession
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MessageIdKey carries the unique ID of a message published through an
+// Outbox. Receivers use it to drop redelivered copies.
+const MessageIdKey = "slim-message-id"
+
+const (
+	// DefaultOutboxRetryInterval is how long the outbox waits before retrying
+	// a publish that failed on the current session.
+	DefaultOutboxRetryInterval = time.Second
+	// DefaultDedupWindow is how many message IDs a receiver remembers.
+	DefaultDedupWindow = 10000
+)
+
+// ErrOutboxClosed is returned for messages still pending when the outbox is
+// closed. They remain in the log and are replayed when it is reopened.
+var ErrOutboxClosed = errors.New("slimsession: outbox closed")
+
+// WithOutbox makes Publish durable: messages are appended to ob before they
+// are sent and replayed in order, through whichever session was most
+// recently wrapped with ob, until delivery is confirmed. While that session
+// is closed, messages wait for the next one. PublishTo is not
+// affected, since a reply is bound to the session it came from.
+func WithOutbox(ob *Outbox) Option {
+	return func(o *options) {
+		o.outbox = ob
+	}
+}
+
+// WithDedupWindow sets how many message IDs are remembered to drop
+// redelivered copies of outbox messages.
+func WithDedupWindow(n int) Option {
+	return func(o *options) {
+		o.dedupWindow = n
+	}
+}
+
+// outboxRecord is one line of the outbox log.
+type outboxRecord struct {
+	Op          string            `json:"op"`
+	Id          string            `json:"id"`
+	Payload     []byte            `json:"payload,omitempty"`
+	PayloadType *string           `json:"payloadType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+const (
+	opPut = "put"
+	opAck = "ack"
+)
+
+// Outbox is a file-backed queue of publishes awaiting delivery. It is an
+// append-only log of put and ack records, compacted when it is opened and
+// whenever it drains.
+type Outbox struct {
+	path          string
+	retryInterval time.Duration
+
+	mu      sync.Mutex
+	file    *os.File
+	pending []outboxRecord
+	waiters map[string]*delivery
+	session *Session
+	wake    chan struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+// OutboxOption configures an Outbox.
+type OutboxOption func(*Outbox)
+
+// WithRetryInterval sets how long the outbox waits before retrying a publish
+// that failed on the current session.
+func WithRetryInterval(d time.Duration) OutboxOption {
+	return func(ob *Outbox) {
+		ob.retryInterval = d
+	}
+}
+
+// OpenOutbox opens or creates the outbox log at path. Messages left over
+// from a previous run are replayed once a session is attached.
+func OpenOutbox(path string, opts ...OutboxOption) (*Outbox, error) {
+	pending, err := readOutboxLog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ob := &Outbox{
+		path:          path,
+		retryInterval: DefaultOutboxRetryInterval,
+		pending:       pending,
+		waiters:       make(map[string]*delivery),
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ob)
+	}
+	if err := ob.rewrite(); err != nil {
+		return nil, err
+	}
+
+	go ob.flush()
+	return ob, nil
+}
+
+// Len returns the number of messages awaiting delivery.
+func (ob *Outbox) Len() int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return len(ob.pending)
+}
+
+// Close stops replaying and closes the log. A delivery in progress is waited
+// for up to the retry interval; if it is confirmed later, the message is
+// replayed when the outbox is reopened and dropped by the receivers as a
+// duplicate.
+func (ob *Outbox) Close() error {
+	ob.mu.Lock()
+	if ob.closed {
+		ob.mu.Unlock()
+		return nil
+	}
+	ob.closed = true
+	for id, d := range ob.waiters {
+		d.resolve(ErrOutboxClosed)
+		delete(ob.waiters, id)
+	}
+	ob.mu.Unlock()
+
+	ob.signal()
+	timer := time.NewTimer(ob.retryInterval)
+	defer timer.Stop()
+	select {
+	case <-ob.done:
+	case <-timer.C:
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.file.Close()
+}
+
+// attach makes s the session used for replaying.
+func (ob *Outbox) attach(s *Session) {
+	ob.mu.Lock()
+	ob.session = s
+	ob.mu.Unlock()
+	ob.signal()
+}
+
+// detach stops replaying through s, unless another session was attached
+// since. Messages wait for the next session.
+func (ob *Outbox) detach(s *Session) {
+	ob.mu.Lock()
+	if ob.session == s {
+		ob.session = nil
+	}
+	ob.mu.Unlock()
+	ob.signal()
+}
+
+func (ob *Outbox) signal() {
+	select {
+	case ob.wake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue durably records a message and returns a Completion that resolves
+// once it is delivered.
+func (ob *Outbox) enqueue(data []byte, payloadType *string, metadata *map[string]string) (*Completion, error) {
+	id, err := newMessageId()
+	if err != nil {
+		return nil, err
+	}
+	md := copyMetadata(metadata)
+	md[MessageIdKey] = id
+	// The caller may reuse data once Publish returns.
+	rec := outboxRecord{Op: opPut, Id: id, Payload: bytes.Clone(data), PayloadType: payloadType, Metadata: md}
+
+	ob.mu.Lock()
+	if ob.closed {
+		ob.mu.Unlock()
+		return nil, ErrOutboxClosed
+	}
+	if err := ob.append(rec); err != nil {
+		ob.mu.Unlock()
+		return nil, err
+	}
+	ob.pending = append(ob.pending, rec)
+	d := &delivery{done: make(chan struct{})}
+	ob.waiters[id] = d
+	ob.mu.Unlock()
+
+	ob.signal()
+	return &Completion{delivery: d}, nil
+}
+
+// delivery is the outcome of a message queued in an Outbox.
+type delivery struct {
+	done chan struct{}
+	err  error
+}
+
+// resolve records err and wakes every waiter. It must be called once.
+func (d *delivery) resolve(err error) {
+	d.err = err
+	close(d.done)
+}
+
+// flush replays pending messages in order until the outbox is closed.
+func (ob *Outbox) flush() {
+	defer close(ob.done)
+
+	// failed is the ID of the last message that could not be sent, so that
+	// sending it again counts as a retransmission.
+	var failed string
+	for {
+		ob.mu.Lock()
+		if ob.closed {
+			ob.mu.Unlock()
+			return
+		}
+		var head outboxRecord
+		ready := len(ob.pending) > 0 && ob.session != nil
+		if ready {
+			head = ob.pending[0]
+		}
+		session := ob.session
+		ob.mu.Unlock()
+
+		if !ready {
+			<-ob.wake
+			continue
+		}
+
+		if head.Id == failed {
+			session.counters.retransmitted.Add(1)
+		}
+		err := ob.publish(session, head)
+		if err != nil {
+			failed = head.Id
+			// Retry after a pause, or sooner if a new session is attached.
+			select {
+			case <-ob.wake:
+			case <-time.After(ob.retryInterval):
+			}
+			continue
+		}
+
+		ob.mu.Lock()
+		if ob.closed {
+			// Close gave up waiting and may have closed the log.
+			ob.mu.Unlock()
+			return
+		}
+		if err := ob.append(outboxRecord{Op: opAck, Id: head.Id}); err == nil {
+			ob.pending = ob.pending[1:]
+			if d, ok := ob.waiters[head.Id]; ok {
+				d.resolve(nil)
+				delete(ob.waiters, head.Id)
+			}
+			if len(ob.pending) == 0 {
+				_ = ob.rewrite()
+			}
+		}
+		ob.mu.Unlock()
+	}
+}
+
+// publish sends rec through s and waits for delivery. It fails with
+// ErrSessionClosed if s was closed after it was picked.
+func (ob *Outbox) publish(s *Session, rec outboxRecord) error {
+	if !s.life.enter() {
+		return ErrSessionClosed
+	}
+	completion, err := s.publishChunked(rec.Payload, rec.PayloadType, &rec.Metadata, s.SessionInterface.Publish)
+	s.life.leave()
+	if err != nil {
+		return err
+	}
+	return completion.Wait()
+}
+
+// append writes rec to the log and syncs it. Must be called with ob.mu held.
+func (ob *Outbox) append(rec outboxRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := ob.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	return ob.file.Sync()
+}
+
+// rewrite replaces the log with the pending messages only. Must be called
+// with ob.mu held, or before the outbox is shared.
+func (ob *Outbox) rewrite() error {
+	tmp := ob.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("compact outbox: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, rec := range ob.pending {
+		line, err := json.Marshal(rec)
+		if err == nil {
+			_, err = w.Write(append(line, '\n'))
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("compact outbox: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("compact outbox: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("compact outbox: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("compact outbox: %w", err)
+	}
+	if err := os.Rename(tmp, ob.path); err != nil {
+		return fmt.Errorf("compact outbox: %w", err)
+	}
+
+	file, err := os.OpenFile(ob.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open outbox: %w", err)
+	}
+	if ob.file != nil {
+		ob.file.Close()
+	}
+	ob.file = file
+	return nil
+}
+
+// readOutboxLog returns the messages put but not acked in the log at path.
+// A torn last line, left by a crash mid-write, is ignored.
+func readOutboxLog(path string) ([]outboxRecord, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("open outbox: %w", err)
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open outbox: %w", err)
+	}
+	defer f.Close()
+
+	var pending []outboxRecord
+	r := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Anything without a trailing newline is a torn write.
+			return pending, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read outbox: %w", err)
+		}
+
+		var rec outboxRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("read outbox %s line %d: %w", path, lineNo, err)
+		}
+		switch rec.Op {
+		case opPut:
+			pending = append(pending, rec)
+		case opAck:
+			for i := range pending {
+				if pending[i].Id == rec.Id {
+					pending = append(pending[:i], pending[i+1:]...)
+					break
+				}
+			}
+		default:
+			return nil, fmt.Errorf("read outbox %s line %d: unknown op %q", path, lineNo, rec.Op)
+		}
+	}
+}
+
+// dedup remembers the most recent message IDs, optionally with a value
+// attached to each.
+type dedup struct {
+	mu   sync.Mutex
+	seen map[string]string
+	ring []string
+	next int
+}
+
+func newDedup(size int) *dedup {
+	return &dedup{seen: make(map[string]string, size), ring: make([]string, size)}
+}
+
+// duplicate records id and reports whether it was already seen.
+func (d *dedup) duplicate(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.seen[id]; ok {
+		return true
+	}
+	d.rememberLocked(id, "")
+	return false
+}
+
+// lookup returns the value remembered for id.
+func (d *dedup) lookup(id string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, ok := d.seen[id]
+	return v, ok
+}
+
+// remember records id with value v, evicting the oldest ID if full.
+func (d *dedup) remember(id, v string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.seen[id]; ok {
+		d.seen[id] = v
+		return
+	}
+	d.rememberLocked(id, v)
+}
+
+func (d *dedup) rememberLocked(id, v string) {
+	if old := d.ring[d.next]; old != "" {
+		delete(d.seen, old)
+	}
+	d.ring[d.next] = id
+	d.next = (d.next + 1) % len(d.ring)
+	d.seen[id] = v
+}
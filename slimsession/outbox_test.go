@@ -0,0 +1,227 @@
+package slimsession
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+func TestOutboxReplaysAfterReconnect(t *testing.T) {
+	ob, err := OpenOutbox(filepath.Join(t.TempDir(), "outbox.log"), WithRetryInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	defer ob.Close()
+
+	down := newFakeSession()
+	down.err = errors.New("connection lost")
+	s := Wrap(down, WithOutbox(ob))
+
+	var completions []*Completion
+	for _, payload := range []string{"one", "two", "three"} {
+		c, err := s.Publish([]byte(payload), nil, nil)
+		if err != nil {
+			t.Fatalf("Publish(%q): %v", payload, err)
+		}
+		completions = append(completions, c)
+	}
+	if err := completions[0].WaitFor(20 * time.Millisecond); err == nil {
+		t.Fatal("message delivered while the session was down")
+	}
+	if ob.Len() != 3 {
+		t.Fatalf("outbox holds %d messages, want 3", ob.Len())
+	}
+
+	up := newFakeSession()
+	receiver := Wrap(up, WithOutbox(ob))
+	for i, c := range completions {
+		if err := c.WaitFor(2 * time.Second); err != nil {
+			t.Fatalf("completion %d: %v", i, err)
+		}
+	}
+
+	timeout := time.Second
+	for _, want := range []string{"one", "two", "three"} {
+		msg, err := receiver.GetMessage(&timeout)
+		if err != nil {
+			t.Fatalf("GetMessage: %v", err)
+		}
+		if string(msg.Payload) != want {
+			t.Fatalf("got %q, want %q", msg.Payload, want)
+		}
+		if msg.Context.Metadata[MessageIdKey] == "" {
+			t.Errorf("message %q has no %s", want, MessageIdKey)
+		}
+	}
+	if ob.Len() != 0 {
+		t.Errorf("outbox holds %d messages after delivery, want 0", ob.Len())
+	}
+}
+
+func TestOutboxWaitsWhileSessionClosed(t *testing.T) {
+	ob, err := OpenOutbox(filepath.Join(t.TempDir(), "outbox.log"), WithRetryInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	defer ob.Close()
+
+	down := newFakeSession()
+	down.err = errors.New("connection lost")
+	s := Wrap(down, WithOutbox(ob))
+	c, err := s.Publish([]byte("one"), nil, nil)
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The closed session is not used again, even once it could publish.
+	down.mu.Lock()
+	down.err = nil
+	down.mu.Unlock()
+	if err := c.WaitFor(30 * time.Millisecond); err == nil {
+		t.Fatal("message delivered through a closed session")
+	}
+	if n := down.sentFrames(); n != 0 {
+		t.Fatalf("closed session sent %d frames, want 0", n)
+	}
+
+	up := newFakeSession()
+	Wrap(up, WithOutbox(ob))
+	if err := c.WaitFor(2 * time.Second); err != nil {
+		t.Fatalf("completion: %v", err)
+	}
+	if n := up.sentFrames(); n != 1 {
+		t.Errorf("new session sent %d frames, want 1", n)
+	}
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	ob, err := OpenOutbox(path)
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	down := newFakeSession()
+	down.err = errors.New("connection lost")
+	s := Wrap(down, WithOutbox(ob))
+	for _, payload := range []string{"a", "b"} {
+		if _, err := s.Publish([]byte(payload), nil, nil); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	if err := ob.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Simulate a crash in the middle of writing a record.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"put","id":"torn"`)
+	f.Close()
+
+	ob, err = OpenOutbox(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer ob.Close()
+	if ob.Len() != 2 {
+		t.Fatalf("reopened outbox holds %d messages, want 2", ob.Len())
+	}
+
+	up := newFakeSession()
+	Wrap(up, WithOutbox(ob))
+	for _, want := range []string{"a", "b"} {
+		select {
+		case msg := <-up.frames:
+			if string(msg.Payload) != want {
+				t.Fatalf("replayed %q, want %q", msg.Payload, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message %q was not replayed", want)
+		}
+	}
+}
+
+func TestRedeliveredMessagesAreDropped(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake)
+
+	md := map[string]string{MessageIdKey: "m1"}
+	fake.Publish([]byte("first"), nil, &md)
+	fake.Publish([]byte("first again"), nil, &md)
+	fake.Publish([]byte("second"), nil, nil)
+
+	timeout := time.Second
+	for _, want := range []string{"first", "second"} {
+		msg, err := s.GetMessage(&timeout)
+		if err != nil {
+			t.Fatalf("GetMessage: %v", err)
+		}
+		if string(msg.Payload) != want {
+			t.Fatalf("got %q, want %q", msg.Payload, want)
+		}
+	}
+}
+
+// stuckSession never returns from Publish, like a session whose peer went
+// away mid-delivery.
+type stuckSession struct {
+	*fakeSession
+	release chan struct{}
+}
+
+func (s *stuckSession) Publish(data []byte, payloadType *string, metadata *map[string]string) (*slim_bindings.CompletionHandle, error) {
+	<-s.release
+	return nil, errors.New("connection lost")
+}
+
+func TestOutboxCopiesPayloadAndCachesResult(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	ob, err := OpenOutbox(path, WithRetryInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	stuck := &stuckSession{fakeSession: newFakeSession(), release: make(chan struct{})}
+	defer close(stuck.release)
+	s := Wrap(stuck, WithOutbox(ob))
+
+	buf := []byte("original")
+	c, err := s.Publish(buf, nil, nil)
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	copy(buf, "reused!!")
+
+	closed := make(chan error, 1)
+	go func() { closed <- ob.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close waited for a stuck delivery")
+	}
+
+	if err := c.WaitFor(time.Second); !errors.Is(err, ErrOutboxClosed) {
+		t.Fatalf("WaitFor error = %v, want ErrOutboxClosed", err)
+	}
+	for range 2 {
+		if err := c.Wait(); !errors.Is(err, ErrOutboxClosed) {
+			t.Fatalf("Wait error = %v, want ErrOutboxClosed", err)
+		}
+	}
+
+	// The replayed copy is the one in memory, not the log.
+	if len(ob.pending) != 1 || string(ob.pending[0].Payload) != "original" {
+		t.Fatalf("pending = %+v, want the original payload", ob.pending)
+	}
+}
@@ -0,0 +1,242 @@
+package slimsession
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// pollInterval bounds each blocking receive on the wrapped session so that
+// context cancellation is observed promptly.
+const pollInterval = 100 * time.Millisecond
+
+// received is a message, or a per-message error, queued for GetMessage.
+type received struct {
+	msg slim_bindings.ReceivedMessage
+	err error
+}
+
+// demux routes incoming messages to GetMessage callers and stream readers.
+//
+// There is no background goroutine: whichever caller is waiting takes the
+// pump lock and receives the next message on behalf of everybody, and the
+// others wait to be notified.
+type demux struct {
+	pumpMu sync.Mutex
+
+	mu       sync.Mutex
+	notify   chan struct{}
+	pending  []received
+	streams  map[string]*StreamReader
+	accepted []*StreamReader
+	// closed holds IDs of streams the reader gave up on, so late frames are
+	// discarded instead of opening a new stream, until they expire.
+	closed map[string]time.Time
+	// writers holds the open stream writers, which receive credit.
+	writers map[string]*StreamWriter
+
+	// Receive buffer bounds and gauges; see WithReceiveBuffer.
+	limit         int
+	policy        OverflowPolicy
+	highWatermark int
+	dropped       uint64
+	overflowed    bool
+}
+
+func newDemux(limit int, policy OverflowPolicy) *demux {
+	return &demux{
+		notify:  make(chan struct{}),
+		streams: make(map[string]*StreamReader),
+		closed:  make(map[string]time.Time),
+		writers: make(map[string]*StreamWriter),
+		limit:   limit,
+		policy:  policy,
+	}
+}
+
+// broadcast wakes every waiter. Must be called with d.mu held.
+func (d *demux) broadcast() {
+	close(d.notify)
+	d.notify = make(chan struct{})
+}
+
+// wait blocks until ready reports true, pumping the session while no one
+// else does. ready is called with d.mu held.
+func (s *Session) wait(ctx context.Context, ready func() bool) error {
+	d := s.demux
+	for {
+		d.mu.Lock()
+		if ready() {
+			d.mu.Unlock()
+			return nil
+		}
+		notify := d.notify
+		// A full buffer under OverflowBlock leaves messages in the native
+		// queue until a reader makes room.
+		blocked := d.full()
+		d.mu.Unlock()
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !blocked && d.pumpMu.TryLock() {
+			err := s.pump(ctx)
+			d.pumpMu.Unlock()
+
+			d.mu.Lock()
+			d.broadcast()
+			d.mu.Unlock()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// pump receives at most one message and routes it. It returns only
+// transport errors; per-message errors are queued for GetMessage.
+func (s *Session) pump(ctx context.Context) error {
+	timeout := pollInterval
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	if timeout <= 0 {
+		return ctx.Err()
+	}
+
+	var ready []slim_bindings.ReceivedMessage
+	var gaps []Gap
+	if s.order != nil {
+		ready, gaps = s.order.expire()
+	}
+
+	msg, err := s.receive(&timeout)
+	switch {
+	case err == nil && s.redelivered(msg):
+	case err == nil && s.settlement(msg):
+	case err == nil && s.resettled(msg):
+	case err == nil && s.credit(msg):
+	case err == nil && s.streamCredit(msg):
+	case err == nil && s.order != nil:
+		more, moreGaps := s.order.add(msg)
+		ready = append(ready, more...)
+		gaps = append(gaps, moreGaps...)
+	case err == nil:
+		ready = append(ready, msg)
+	case errors.Is(err, slim_bindings.ErrSlimErrorTimeout):
+	case errors.Is(err, ErrReassemblyTimeout),
+		errors.Is(err, ErrMessageTooLarge),
+		errors.Is(err, ErrMalformedFragment):
+		s.demux.mu.Lock()
+		s.demux.pending = append(s.demux.pending, received{err: err})
+		s.demux.mu.Unlock()
+	default:
+		// Messages released by expire are still delivered.
+		s.route(ready)
+		return err
+	}
+
+	if s.opts.onGap != nil {
+		for _, gap := range gaps {
+			s.opts.onGap(gap)
+		}
+	}
+	s.route(ready)
+	return nil
+}
+
+// redelivered reports whether msg is a copy of an outbox message that was
+// already received.
+func (s *Session) redelivered(msg slim_bindings.ReceivedMessage) bool {
+	id, ok := msg.Context.Metadata[MessageIdKey]
+	if !ok || !s.dedup.duplicate(id) {
+		return false
+	}
+	s.counters.duplicates.Add(1)
+	return true
+}
+
+// route hands messages to their stream or to GetMessage.
+func (s *Session) route(msgs []slim_bindings.ReceivedMessage) {
+	var dropped []slim_bindings.ReceivedMessage
+	var refused []streamGrant
+	s.demux.mu.Lock()
+	for _, msg := range msgs {
+		if _, isStream := msg.Context.Metadata[StreamIdKey]; isStream {
+			if g := s.routeStreamFrame(msg); g != nil {
+				refused = append(refused, *g)
+			}
+			continue
+		}
+		if r := s.demux.enqueue(received{msg: msg}); r != nil {
+			dropped = append(dropped, r.msg)
+		}
+	}
+	s.demux.mu.Unlock()
+
+	// Dropped messages still return their flow control credit.
+	for _, msg := range dropped {
+		s.consumed(msg)
+	}
+	for _, g := range refused {
+		s.grant(g, nil)
+	}
+}
+
+// getMessage returns the next message that is not part of a stream.
+func (s *Session) getMessage(timeout *time.Duration) (slim_bindings.ReceivedMessage, error) {
+	ctx := context.Background()
+	if timeout != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	next, err := s.next(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return slim_bindings.ReceivedMessage{}, slim_bindings.NewSlimErrorTimeout()
+	}
+	if err != nil {
+		return slim_bindings.ReceivedMessage{}, err
+	}
+	return next.msg, next.err
+}
+
+// next pops the next message queued for GetMessage and Receive.
+func (s *Session) next(ctx context.Context) (received, error) {
+	d := s.demux
+	var next received
+	err := s.wait(ctx, func() bool {
+		if d.overflowed {
+			d.overflowed = false
+			next = received{err: ErrReceiveBufferFull}
+			return true
+		}
+		if len(d.pending) == 0 {
+			return false
+		}
+		if d.full() {
+			// Let blocked waiters resume pumping.
+			d.broadcast()
+		}
+		next = d.pending[0]
+		d.pending = d.pending[1:]
+		return true
+	})
+	if err == nil && next.err == nil {
+		s.counters.delivered(len(next.msg.Payload))
+		s.consumed(next.msg)
+	}
+	return next, err
+}
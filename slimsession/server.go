@@ -0,0 +1,358 @@
+package slimsession
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// ErrServerClosed is returned by Server.Serve after Shutdown.
+var ErrServerClosed = errors.New("slimsession: server closed")
+
+// ErrNoRoute is reported when an incoming session matches no handler.
+var ErrNoRoute = errors.New("slimsession: no handler for session")
+
+// SessionInfo describes an incoming session for routing and admission.
+type SessionInfo struct {
+	SessionId uint32
+	Type      slim_bindings.SessionType
+	Metadata  map[string]string
+	Source    *slim_bindings.Name
+	// SourceName is the string form of Source.
+	SourceName string
+}
+
+// Handler serves one session. The session is deleted when the handler
+// returns, or panics: the panic is recovered and reported to the error
+// handler. ctx is cancelled when the context passed to Serve is done, or
+// when Shutdown stops waiting for handlers to drain.
+type Handler func(ctx context.Context, session *Session)
+
+// Matcher selects the sessions a handler is registered for.
+type Matcher func(info SessionInfo) bool
+
+// MatchType matches sessions of the given type.
+func MatchType(t slim_bindings.SessionType) Matcher {
+	return func(info SessionInfo) bool {
+		return info.Type == t
+	}
+}
+
+// MatchMetadata matches sessions whose metadata has key set to value.
+func MatchMetadata(key, value string) Matcher {
+	return func(info SessionInfo) bool {
+		v, ok := info.Metadata[key]
+		return ok && v == value
+	}
+}
+
+// MatchSource matches sessions initiated by the named application, in the
+// form returned by Name.String.
+func MatchSource(name string) Matcher {
+	return func(info SessionInfo) bool {
+		return info.SourceName == name
+	}
+}
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// WithMaxConcurrentSessions limits how many sessions are handled at once.
+// When the limit is reached the server stops accepting until a handler
+// returns. Zero means no limit.
+func WithMaxConcurrentSessions(n int) ServerOption {
+	return func(s *Server) {
+		s.maxSessions = n
+	}
+}
+
+// WithAdmission installs a hook called before a session is routed. Returning
+// an error rejects and deletes the session.
+func WithAdmission(admit func(ctx context.Context, info SessionInfo) error) ServerOption {
+	return func(s *Server) {
+		s.admit = admit
+	}
+}
+
+// WithErrorHandler installs a callback for errors that do not stop the
+// server, such as rejected sessions or failed deletions.
+func WithErrorHandler(onError func(info SessionInfo, err error)) ServerOption {
+	return func(s *Server) {
+		s.onError = onError
+	}
+}
+
+// WithSessionOptions sets the options used to wrap every accepted session.
+func WithSessionOptions(opts ...Option) ServerOption {
+	return func(s *Server) {
+		s.sessionOpts = opts
+	}
+}
+
+type route struct {
+	match   Matcher
+	handler Handler
+}
+
+// Server accepts incoming sessions on an App and dispatches each one to a
+// handler in its own goroutine.
+type Server struct {
+	maxSessions int
+	admit       func(ctx context.Context, info SessionInfo) error
+	onError     func(info SessionInfo, err error)
+	sessionOpts []Option
+
+	// accept and release default to the App's ListenForSession and
+	// DeleteSessionAndWait.
+	accept  func(timeout *time.Duration) (slim_bindings.SessionInterface, error)
+	release func(session slim_bindings.SessionInterface) error
+	nameKey func(*slim_bindings.Name) string
+
+	mu       sync.Mutex
+	routes   []route
+	fallback Handler
+	closed   bool
+	done     chan struct{}
+
+	handlers      sync.WaitGroup
+	handlerCtx    context.Context
+	cancelHandler context.CancelFunc
+}
+
+// NewServer returns a Server that accepts sessions on app.
+func NewServer(app *slim_bindings.App, opts ...ServerOption) *Server {
+	s := newServer(opts...)
+	s.accept = func(timeout *time.Duration) (slim_bindings.SessionInterface, error) {
+		return app.ListenForSession(timeout)
+	}
+	s.release = func(session slim_bindings.SessionInterface) error {
+		return app.DeleteSessionAndWait(session.(*slim_bindings.Session))
+	}
+	return s
+}
+
+func newServer(opts ...ServerOption) *Server {
+	s := &Server{
+		nameKey: (*slim_bindings.Name).String,
+		done:    make(chan struct{}),
+	}
+	s.handlerCtx, s.cancelHandler = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Handle registers handler for sessions selected by match. Routes are tried
+// in registration order; a nil match registers the fallback handler.
+func (s *Server) Handle(match Matcher, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if match == nil {
+		s.fallback = handler
+		return
+	}
+	s.routes = append(s.routes, route{match: match, handler: handler})
+}
+
+// Serve accepts sessions until ctx is done or Shutdown is called. It returns
+// ErrServerClosed after Shutdown, ctx.Err() when ctx is done, or the error
+// returned by ListenForSession. Unless Shutdown was called, in which case
+// Shutdown drains them, Serve cancels the handlers it started and waits for
+// them to return first.
+func (s *Server) Serve(ctx context.Context) (err error) {
+	handlerCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(s.handlerCtx, cancel)
+	var running sync.WaitGroup
+	defer func() {
+		if errors.Is(err, ErrServerClosed) {
+			// Shutdown cancels the handlers once they drained or it gave up.
+			return
+		}
+		stop()
+		cancel()
+		running.Wait()
+	}()
+
+	var slots chan struct{}
+	if s.maxSessions > 0 {
+		slots = make(chan struct{}, s.maxSessions)
+	}
+
+	for {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-s.done:
+				return ErrServerClosed
+			}
+		}
+
+		session, err := s.acceptOne(ctx)
+		if err != nil || session == nil {
+			if slots != nil {
+				<-slots
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			defer s.handlers.Done()
+			if slots != nil {
+				defer func() { <-slots }()
+			}
+			s.dispatch(handlerCtx, session)
+		}()
+	}
+}
+
+// acceptOne waits up to pollInterval for a session, so that ctx and
+// Shutdown are observed promptly. It returns nil, nil on timeout. An
+// accepted session is counted as a running handler.
+func (s *Server) acceptOne(ctx context.Context) (slim_bindings.SessionInterface, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.done:
+		return nil, ErrServerClosed
+	default:
+	}
+
+	timeout := pollInterval
+	session, err := s.accept(&timeout)
+	if errors.Is(err, slim_bindings.ErrSlimErrorTimeout) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	closed := s.closed
+	if !closed {
+		s.handlers.Add(1)
+	}
+	s.mu.Unlock()
+	if closed {
+		s.reject(session, SessionInfo{}, ErrServerClosed)
+		return nil, ErrServerClosed
+	}
+	return session, nil
+}
+
+func (s *Server) dispatch(ctx context.Context, session slim_bindings.SessionInterface) {
+	info, err := s.describe(session)
+	if err != nil {
+		s.reject(session, info, err)
+		return
+	}
+
+	if s.admit != nil {
+		if err := s.admit(ctx, info); err != nil {
+			s.reject(session, info, err)
+			return
+		}
+	}
+
+	handler := s.route(info)
+	if handler == nil {
+		s.reject(session, info, ErrNoRoute)
+		return
+	}
+
+	s.serve(ctx, handler, info, Wrap(session, s.sessionOpts...))
+	if err := s.release(session); err != nil {
+		s.report(info, fmt.Errorf("delete session: %w", err))
+	}
+}
+
+// serve runs handler, recovering and reporting a panic.
+func (s *Server) serve(ctx context.Context, handler Handler, info SessionInfo, session *Session) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.report(info, fmt.Errorf("handler panic: %v", r))
+		}
+	}()
+	handler(ctx, session)
+}
+
+func (s *Server) describe(session slim_bindings.SessionInterface) (SessionInfo, error) {
+	var info SessionInfo
+	var err error
+	if info.SessionId, err = session.SessionId(); err != nil {
+		return info, err
+	}
+	if info.Type, err = session.SessionType(); err != nil {
+		return info, err
+	}
+	if info.Metadata, err = session.Metadata(); err != nil {
+		return info, err
+	}
+	if info.Source, err = session.Source(); err != nil {
+		return info, err
+	}
+	info.SourceName = s.nameKey(info.Source)
+	return info, nil
+}
+
+func (s *Server) route(info SessionInfo) Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.routes {
+		if r.match(info) {
+			return r.handler
+		}
+	}
+	return s.fallback
+}
+
+func (s *Server) reject(session slim_bindings.SessionInterface, info SessionInfo, reason error) {
+	s.report(info, reason)
+	if err := s.release(session); err != nil {
+		s.report(info, fmt.Errorf("delete session: %w", err))
+	}
+}
+
+func (s *Server) report(info SessionInfo, err error) {
+	if s.onError != nil {
+		s.onError(info, err)
+	}
+}
+
+// Shutdown stops accepting sessions and waits for running handlers to
+// return. If ctx is done first, the handlers' context is cancelled and
+// Shutdown returns ctx.Err() without waiting further.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		s.cancelHandler()
+		return nil
+	case <-ctx.Done():
+		s.cancelHandler()
+		return ctx.Err()
+	}
+}
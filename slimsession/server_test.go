@@ -0,0 +1,230 @@
+package slimsession
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+type fakeIncoming struct {
+	slim_bindings.SessionInterface
+
+	id          uint32
+	sessionType slim_bindings.SessionType
+	metadata    map[string]string
+	source      *slim_bindings.Name
+}
+
+func (f *fakeIncoming) SessionId() (uint32, error) { return f.id, nil }
+
+func (f *fakeIncoming) SessionType() (slim_bindings.SessionType, error) { return f.sessionType, nil }
+
+func (f *fakeIncoming) Metadata() (map[string]string, error) { return f.metadata, nil }
+
+func (f *fakeIncoming) Source() (*slim_bindings.Name, error) { return f.source, nil }
+
+type fakeApp struct {
+	incoming chan slim_bindings.SessionInterface
+
+	mu       sync.Mutex
+	released []uint32
+}
+
+func (a *fakeApp) listen(timeout *time.Duration) (slim_bindings.SessionInterface, error) {
+	select {
+	case s := <-a.incoming:
+		return s, nil
+	case <-time.After(*timeout):
+		return nil, slim_bindings.NewSlimErrorTimeout()
+	}
+}
+
+func (a *fakeApp) delete(session slim_bindings.SessionInterface) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.released = append(a.released, session.(*fakeIncoming).id)
+	return nil
+}
+
+func (a *fakeApp) releasedCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.released)
+}
+
+func newTestServer(opts ...ServerOption) (*fakeApp, *Server) {
+	app := &fakeApp{incoming: make(chan slim_bindings.SessionInterface, 16)}
+	s := newServer(opts...)
+	s.accept = app.listen
+	s.release = app.delete
+	sources := map[*slim_bindings.Name]string{}
+	s.nameKey = func(n *slim_bindings.Name) string { return sources[n] }
+	return app, s
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServerRoutesSessions(t *testing.T) {
+	var rejected atomic.Int32
+	app, srv := newTestServer(
+		WithAdmission(func(_ context.Context, info SessionInfo) error {
+			if info.Metadata["token"] == "bad" {
+				return errors.New("unauthorised")
+			}
+			return nil
+		}),
+		WithErrorHandler(func(SessionInfo, error) { rejected.Add(1) }),
+	)
+
+	var groups, tagged, fallback atomic.Int32
+	srv.Handle(MatchMetadata("role", "worker"), func(context.Context, *Session) { tagged.Add(1) })
+	srv.Handle(MatchType(slim_bindings.SessionTypeGroup), func(context.Context, *Session) { groups.Add(1) })
+	srv.Handle(nil, func(context.Context, *Session) { fallback.Add(1) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx)
+
+	app.incoming <- &fakeIncoming{id: 1, sessionType: slim_bindings.SessionTypeGroup}
+	app.incoming <- &fakeIncoming{id: 2, sessionType: slim_bindings.SessionTypeGroup, metadata: map[string]string{"role": "worker"}}
+	app.incoming <- &fakeIncoming{id: 3, sessionType: slim_bindings.SessionTypePointToPoint}
+	app.incoming <- &fakeIncoming{id: 4, sessionType: slim_bindings.SessionTypePointToPoint, metadata: map[string]string{"token": "bad"}}
+
+	waitFor(t, func() bool { return app.releasedCount() == 4 })
+	if groups.Load() != 1 || tagged.Load() != 1 || fallback.Load() != 1 {
+		t.Errorf("groups=%d tagged=%d fallback=%d, want 1 each", groups.Load(), tagged.Load(), fallback.Load())
+	}
+	if rejected.Load() != 1 {
+		t.Errorf("rejected %d sessions, want 1", rejected.Load())
+	}
+}
+
+func TestServerConcurrencyLimitAndDrain(t *testing.T) {
+	app, srv := newTestServer(WithMaxConcurrentSessions(2))
+
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	srv.Handle(nil, func(context.Context, *Session) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		running.Add(-1)
+	})
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(context.Background()) }()
+
+	for i := uint32(1); i <= 4; i++ {
+		app.incoming <- &fakeIncoming{id: i}
+	}
+	waitFor(t, func() bool { return running.Load() == 2 })
+	time.Sleep(20 * time.Millisecond)
+	if peak.Load() != 2 {
+		t.Fatalf("peak concurrency %d, want 2", peak.Load())
+	}
+
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- srv.Shutdown(context.Background()) }()
+
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve returned %v, want ErrServerClosed", err)
+	}
+	select {
+	case err := <-shutdownDone:
+		t.Fatalf("Shutdown returned %v before handlers drained", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-shutdownDone; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if got := app.releasedCount(); got != 2 {
+		t.Errorf("released %d sessions, want the 2 that were handled", got)
+	}
+}
+
+func TestServerShutdownTimeoutCancelsHandlers(t *testing.T) {
+	app, srv := newTestServer()
+	started := make(chan struct{})
+	srv.Handle(nil, func(ctx context.Context, _ *Session) {
+		close(started)
+		<-ctx.Done()
+	})
+	go srv.Serve(context.Background())
+	app.incoming <- &fakeIncoming{id: 1}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown error = %v, want context.DeadlineExceeded", err)
+	}
+	waitFor(t, func() bool { return app.releasedCount() == 1 })
+}
+
+func TestServeCancelDrainsHandlers(t *testing.T) {
+	var mu sync.Mutex
+	var reported []error
+	app, srv := newTestServer(WithErrorHandler(func(_ SessionInfo, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	}))
+	started := make(chan struct{}, 2)
+	var cancelled atomic.Bool
+	srv.Handle(MatchMetadata("panic", "true"), func(context.Context, *Session) {
+		started <- struct{}{}
+		panic("boom")
+	})
+	srv.Handle(nil, func(ctx context.Context, _ *Session) {
+		started <- struct{}{}
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		cancelled.Store(true)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx) }()
+	app.incoming <- &fakeIncoming{id: 1, metadata: map[string]string{"panic": "true"}}
+	app.incoming <- &fakeIncoming{id: 2}
+	<-started
+	<-started
+
+	cancel()
+	if err := <-served; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Serve error = %v, want context.Canceled", err)
+	}
+	// Serve returned only after the handler saw the cancellation.
+	if !cancelled.Load() {
+		t.Error("Serve returned before its handlers")
+	}
+	if got := app.releasedCount(); got != 2 {
+		t.Errorf("released %d sessions, want 2", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 || reported[0].Error() != "handler panic: boom" {
+		t.Errorf("reported %v, want the handler panic", reported)
+	}
+}
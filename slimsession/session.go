@@ -0,0 +1,510 @@
+// Package slimsession layers Go-side delivery features on top of
+// slim_bindings sessions.
+//
+// A Session wraps any slim_bindings.SessionInterface (usually a
+// *slim_bindings.Session) and transparently replaces Publish, PublishTo and
+// GetMessage. All other session methods are passed through unchanged.
+package slimsession
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+const (
+	// DefaultMaxFragmentSize is the largest payload sent in a single frame
+	// before a message is split into fragments.
+	DefaultMaxFragmentSize = 1 << 20
+	// DefaultMaxMessageSize is the largest message that will be reassembled.
+	DefaultMaxMessageSize = 64 << 20
+	// DefaultReassemblyTimeout is how long an incomplete message is kept
+	// waiting for its missing fragments.
+	DefaultReassemblyTimeout = 30 * time.Second
+	// DefaultMaxReassemblyBuffer is how many bytes of incomplete messages are
+	// kept at most, across all of them.
+	DefaultMaxReassemblyBuffer = 2 * DefaultMaxMessageSize
+)
+
+var (
+	// ErrMessageTooLarge is returned when a message exceeds the configured
+	// maximum message size, either when publishing or when reassembling.
+	ErrMessageTooLarge = errors.New("slimsession: message too large")
+	// ErrReassemblyTimeout is returned by GetMessage when an incomplete
+	// message is dropped because its fragments did not arrive in time.
+	ErrReassemblyTimeout = errors.New("slimsession: reassembly timed out")
+	// ErrMalformedFragment is returned by GetMessage when a fragment carries
+	// inconsistent chunking metadata.
+	ErrMalformedFragment = errors.New("slimsession: malformed fragment")
+	// ErrReassemblyBufferFull is returned by GetMessage when a fragment is
+	// dropped, with the rest of its message, because too many messages or
+	// bytes are already waiting for their missing fragments.
+	ErrReassemblyBufferFull = errors.New("slimsession: reassembly buffer full")
+	// ErrSessionClosed is returned for work cut short by Session.Close, such
+	// as waiting on the Receipt of a message that was never settled.
+	ErrSessionClosed = errors.New("slimsession: session closed")
+)
+
+// Session is a slim_bindings session with Go-side delivery features.
+//
+// Methods that are not redefined here (Invite, Remove, ParticipantsList,
+// the *Async variants, PublishWithParams, ...) go straight to the wrapped
+// session and bypass chunking and membership tracking.
+type Session struct {
+	slim_bindings.SessionInterface
+
+	opts   options
+	chunks *reassembler
+	demux  *demux
+	roster *roster
+	seq    *sequencer
+	order  *orderer
+	outbox *Outbox
+	dedup  *dedup
+	acks   *acks
+	flow   *flow
+	// settled remembers how received messages were settled, so that
+	// redelivered copies are answered instead of processed again.
+	settled  *dedup
+	counters *counters
+	life     life
+}
+
+// life tracks the work a Session does on the wrapped session in the
+// background, so that Close can stop it and wait for calls in progress.
+type life struct {
+	mu      sync.Mutex
+	closed  bool
+	running sync.WaitGroup
+	done    chan struct{}
+}
+
+// enter reports whether background work may use the wrapped session. Each
+// successful enter must be paired with leave.
+func (l *life) enter() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.running.Add(1)
+	return true
+}
+
+func (l *life) leave() {
+	l.running.Done()
+}
+
+// close refuses further work and waits for work in progress. It reports
+// false if the Session was already closed.
+func (l *life) close() bool {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return false
+	}
+	l.closed = true
+	close(l.done)
+	l.mu.Unlock()
+	l.running.Wait()
+	return true
+}
+
+// Option configures a Session.
+type Option func(*options)
+
+type options struct {
+	maxFragmentSize   int
+	maxMessageSize    int
+	maxReassembly     int
+	reassemblyTimeout time.Duration
+	streamWindow      int
+	now               func() time.Time
+
+	membershipPollInterval time.Duration
+	// nameKey identifies a participant in the roster.
+	nameKey func(*slim_bindings.Name) string
+
+	ordered              bool
+	gapTimeout           time.Duration
+	maxOutOfOrder        int
+	publisherIdleTimeout time.Duration
+	onGap                func(Gap)
+
+	outbox      *Outbox
+	dedupWindow int
+
+	visibilityTimeout time.Duration
+	maxDeliveries     int
+
+	receiveBufferLimit int
+	overflowPolicy     OverflowPolicy
+	flowWindow         int
+
+	completionHook func(time.Duration, error)
+}
+
+// WithMaxFragmentSize sets the largest payload published in a single frame.
+// It should stay below the server's MaxFrameSize minus room for metadata.
+func WithMaxFragmentSize(n int) Option {
+	return func(o *options) {
+		o.maxFragmentSize = n
+	}
+}
+
+// WithMaxMessageSize sets the largest message that can be published or
+// reassembled.
+func WithMaxMessageSize(n int) Option {
+	return func(o *options) {
+		o.maxMessageSize = n
+	}
+}
+
+// WithMaxReassemblyBuffer sets how many bytes of incomplete messages are kept
+// at most, across all of them. It is raised to the maximum message size if
+// below it.
+func WithMaxReassemblyBuffer(n int) Option {
+	return func(o *options) {
+		o.maxReassembly = n
+	}
+}
+
+// WithReassemblyTimeout sets how long an incomplete message is kept before
+// it is dropped.
+func WithReassemblyTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.reassemblyTimeout = d
+	}
+}
+
+// Wrap returns a Session layered on top of session.
+func Wrap(session slim_bindings.SessionInterface, opts ...Option) *Session {
+	o := options{
+		maxFragmentSize:   DefaultMaxFragmentSize,
+		maxMessageSize:    DefaultMaxMessageSize,
+		maxReassembly:     DefaultMaxReassemblyBuffer,
+		reassemblyTimeout: DefaultReassemblyTimeout,
+		streamWindow:      DefaultStreamWindow,
+		now:               time.Now,
+
+		membershipPollInterval: DefaultMembershipPollInterval,
+		nameKey:                (*slim_bindings.Name).String,
+
+		gapTimeout:           DefaultGapTimeout,
+		maxOutOfOrder:        DefaultMaxOutOfOrder,
+		publisherIdleTimeout: DefaultPublisherIdleTimeout,
+
+		dedupWindow: DefaultDedupWindow,
+
+		visibilityTimeout: DefaultVisibilityTimeout,
+		maxDeliveries:     DefaultMaxDeliveries,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.maxFragmentSize <= 0 {
+		o.maxFragmentSize = DefaultMaxFragmentSize
+	}
+	if o.maxMessageSize <= 0 {
+		o.maxMessageSize = DefaultMaxMessageSize
+	}
+	if o.maxReassembly <= 0 {
+		o.maxReassembly = DefaultMaxReassemblyBuffer
+	}
+	if o.reassemblyTimeout <= 0 {
+		o.reassemblyTimeout = DefaultReassemblyTimeout
+	}
+	if o.streamWindow <= 0 {
+		o.streamWindow = DefaultStreamWindow
+	}
+	if o.membershipPollInterval <= 0 {
+		o.membershipPollInterval = DefaultMembershipPollInterval
+	}
+	if o.gapTimeout <= 0 {
+		o.gapTimeout = DefaultGapTimeout
+	}
+	if o.maxOutOfOrder <= 0 {
+		o.maxOutOfOrder = DefaultMaxOutOfOrder
+	}
+	if o.publisherIdleTimeout <= 0 {
+		o.publisherIdleTimeout = DefaultPublisherIdleTimeout
+	}
+	if o.dedupWindow <= 0 {
+		o.dedupWindow = DefaultDedupWindow
+	}
+	if o.visibilityTimeout <= 0 {
+		o.visibilityTimeout = DefaultVisibilityTimeout
+	}
+	if o.maxDeliveries <= 0 {
+		o.maxDeliveries = DefaultMaxDeliveries
+	}
+	if o.receiveBufferLimit < 0 {
+		o.receiveBufferLimit = 0
+	}
+
+	s := &Session{
+		SessionInterface: session,
+		opts:             o,
+		chunks:           newReassembler(o.maxMessageSize, o.maxReassembly, o.reassemblyTimeout, o.now),
+		demux:            newDemux(o.receiveBufferLimit, o.overflowPolicy),
+		roster:           newRoster(),
+		outbox:           o.outbox,
+		dedup:            newDedup(o.dedupWindow),
+		acks:             newAcks(),
+		flow:             newFlow(o.flowWindow),
+		settled:          newDedup(o.dedupWindow),
+		counters:         &counters{},
+		life:             life{done: make(chan struct{})},
+	}
+	if o.ordered {
+		id, err := newMessageId()
+		if err != nil {
+			id = fallbackId()
+		}
+		s.seq = &sequencer{publisherId: id}
+		s.order = newOrderer(o.gapTimeout, o.publisherIdleTimeout, o.maxOutOfOrder, o.now)
+	}
+	if s.outbox != nil {
+		s.outbox.attach(s)
+	}
+	return s
+}
+
+// Close stops the work the Session does in the background: messages sent
+// with PublishWithAck are no longer redelivered, and their Receipts fail
+// with ErrSessionClosed; membership polling stops and MembershipEvents
+// channels are closed; an outbox stops replaying through the Session and
+// keeps its messages for the next one. It waits for calls in progress.
+// Close does not end the wrapped session; call it before deleting or
+// destroying that. Closing twice is a no-op.
+func (s *Session) Close() error {
+	if s.outbox != nil {
+		s.outbox.detach(s)
+	}
+	if !s.life.close() {
+		return nil
+	}
+	s.acks.mu.Lock()
+	ids := make([]string, 0, len(s.acks.pending))
+	for id := range s.acks.pending {
+		ids = append(ids, id)
+	}
+	s.acks.mu.Unlock()
+	for _, id := range ids {
+		s.settle(id, ErrSessionClosed)
+	}
+	return nil
+}
+
+// Unwrap returns the underlying session.
+func (s *Session) Unwrap() slim_bindings.SessionInterface {
+	return s.SessionInterface
+}
+
+// Publish publishes data to the session's destination, splitting it into
+// fragments if it exceeds the maximum fragment size. With an outbox, the
+// message is persisted first and the returned Completion resolves once it
+// has been delivered, possibly through a later session.
+func (s *Session) Publish(data []byte, payloadType *string, metadata *map[string]string) (*Completion, error) {
+	s.takeCredit()
+	return s.publish(data, payloadType, metadata)
+}
+
+func (s *Session) publish(data []byte, payloadType *string, metadata *map[string]string) (*Completion, error) {
+	start := s.opts.now()
+	metadata = s.stampFlow(metadata)
+	if s.seq != nil {
+		s.seq.mu.Lock()
+		defer s.seq.mu.Unlock()
+		metadata = s.seq.stamp(metadata)
+	}
+	if s.outbox != nil {
+		return s.track(start)(s.outbox.enqueue(data, payloadType, metadata))
+	}
+	return s.track(start)(s.publishChunked(data, payloadType, metadata, s.SessionInterface.Publish))
+}
+
+// WithCompletionHook calls hook each time a Completion returned by Publish or
+// PublishTo resolves, with the time since the publish and the outcome.
+func WithCompletionHook(hook func(elapsed time.Duration, err error)) Option {
+	return func(o *options) {
+		o.completionHook = hook
+	}
+}
+
+// track returns a function that arms the completion hook on a Completion
+// published at start.
+func (s *Session) track(start time.Time) func(*Completion, error) (*Completion, error) {
+	return func(c *Completion, err error) (*Completion, error) {
+		if err == nil && s.opts.completionHook != nil {
+			c.start, c.now, c.hook = start, s.opts.now, s.opts.completionHook
+		}
+		return c, err
+	}
+}
+
+// PublishAndWait publishes data and waits until every fragment is delivered.
+// With flow control it first waits for the receiver to grant credit, for as
+// long as it takes; use PublishAndWaitContext to bound the wait.
+func (s *Session) PublishAndWait(data []byte, payloadType *string, metadata *map[string]string) error {
+	return s.PublishAndWaitContext(context.Background(), data, payloadType, metadata)
+}
+
+// PublishAndWaitContext is like PublishAndWait but gives up waiting for
+// credit when ctx is done, and for delivery when its deadline passes.
+func (s *Session) PublishAndWaitContext(ctx context.Context, data []byte, payloadType *string, metadata *map[string]string) error {
+	if err := s.acquireCredit(ctx); err != nil {
+		return err
+	}
+	completion, err := s.publish(data, payloadType, metadata)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		return completion.WaitFor(time.Until(deadline))
+	}
+	return completion.Wait()
+}
+
+// PublishTo publishes a reply to the originator of a received message,
+// splitting it into fragments if it exceeds the maximum fragment size.
+func (s *Session) PublishTo(messageContext slim_bindings.MessageContext, data []byte, payloadType *string, metadata *map[string]string) (*Completion, error) {
+	return s.track(s.opts.now())(s.publishChunked(data, payloadType, metadata, func(data []byte, payloadType *string, metadata *map[string]string) (*slim_bindings.CompletionHandle, error) {
+		return s.SessionInterface.PublishTo(messageContext, data, payloadType, metadata)
+	}))
+}
+
+// PublishToAndWait publishes a reply and waits until every fragment is
+// delivered.
+func (s *Session) PublishToAndWait(messageContext slim_bindings.MessageContext, data []byte, payloadType *string, metadata *map[string]string) error {
+	completion, err := s.PublishTo(messageContext, data, payloadType, metadata)
+	if err != nil {
+		return err
+	}
+	return completion.Wait()
+}
+
+// GetMessage receives the next complete message from the session,
+// reassembling fragmented messages. Frames belonging to streams opened with
+// OpenWriter are routed to their StreamReader instead. The timeout bounds
+// the whole call, not each fragment.
+func (s *Session) GetMessage(timeout *time.Duration) (slim_bindings.ReceivedMessage, error) {
+	return s.getMessage(timeout)
+}
+
+// Completion tracks delivery of every frame produced by a single publish.
+type Completion struct {
+	handles []*slim_bindings.CompletionHandle
+	// delivery, if set, reports delivery of a message queued in an Outbox.
+	delivery *delivery
+
+	// result caches the outcome once resolved, so that waiting again
+	// returns it.
+	mu       sync.Mutex
+	resolved bool
+	result   error
+
+	// hook, if set, is reported the outcome once, with the time since start.
+	hook     func(time.Duration, error)
+	start    time.Time
+	now      func() time.Time
+	observed sync.Once
+}
+
+// observe reports err to the completion hook and returns it.
+func (c *Completion) observe(err error) error {
+	if c.hook != nil {
+		c.observed.Do(func() {
+			c.hook(c.now().Sub(c.start), err)
+		})
+	}
+	return err
+}
+
+// Wait blocks until every frame is delivered and returns the first error.
+// Waiting again returns the same result.
+func (c *Completion) Wait() error {
+	if ok, err := c.cached(); ok {
+		return err
+	}
+	return c.observe(c.settle(c.wait()))
+}
+
+// cached returns the result if the completion already resolved.
+func (c *Completion) cached() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resolved, c.result
+}
+
+// settle caches err unless a result already was, and returns the result.
+func (c *Completion) settle(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.resolved {
+		c.resolved, c.result = true, err
+	}
+	return c.result
+}
+
+func (c *Completion) wait() error {
+	var firstErr error
+	for _, h := range c.handles {
+		if h == nil {
+			continue
+		}
+		if err := h.Wait(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if c.delivery != nil {
+		<-c.delivery.done
+		if err := c.delivery.err; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// WaitFor is like Wait but gives up once timeout has elapsed across all
+// frames. Giving up is not reported to the completion hook.
+func (c *Completion) WaitFor(timeout time.Duration) error {
+	if ok, err := c.cached(); ok {
+		return err
+	}
+	err := c.waitFor(timeout)
+	if errors.Is(err, slim_bindings.ErrSlimErrorTimeout) {
+		return err
+	}
+	return c.observe(c.settle(err))
+}
+
+func (c *Completion) waitFor(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, h := range c.handles {
+		if h == nil {
+			continue
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return slim_bindings.NewSlimErrorTimeout()
+		}
+		if err := h.WaitFor(remaining); err != nil {
+			return err
+		}
+	}
+	if c.delivery != nil {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		select {
+		case <-c.delivery.done:
+			return c.delivery.err
+		case <-timer.C:
+			return slim_bindings.NewSlimErrorTimeout()
+		}
+	}
+	return nil
+}
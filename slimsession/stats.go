@@ -0,0 +1,118 @@
+package slimsession
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of a session's queues and traffic counters.
+type Stats struct {
+	// Buffered is how many messages are waiting for GetMessage or Receive.
+	Buffered int
+	// BufferLimit is the configured receive buffer limit, or 0 if unbounded.
+	BufferLimit int
+	// HighWatermark is the largest Buffered value seen so far.
+	HighWatermark int
+	// Dropped counts messages discarded by the overflow policy.
+	Dropped uint64
+	// Credits is how many more messages Publish may send before the
+	// receiver grants more credit. It is 0 without flow control.
+	Credits int
+
+	// Published counts messages handed to the wrapped session, including
+	// retransmissions, and PublishedBytes their payload size.
+	Published      uint64
+	PublishedBytes uint64
+	// Received counts messages returned by GetMessage or Receive, and
+	// ReceivedBytes their payload size.
+	Received      uint64
+	ReceivedBytes uint64
+	// Retransmitted counts messages published again: PublishWithAck
+	// redeliveries and outbox retries.
+	Retransmitted uint64
+	// Duplicates counts received copies discarded because the message was
+	// already delivered.
+	Duplicates uint64
+	// RTT is the smoothed time between publishing a message with
+	// PublishWithAck and receiving its acknowledgement. It is 0 until the
+	// first acknowledgement.
+	RTT time.Duration
+}
+
+// Stats returns the current queue depths and counters. It is cheap enough to
+// poll.
+func (s *Session) Stats() Stats {
+	s.demux.mu.Lock()
+	stats := Stats{
+		Buffered:      len(s.demux.pending),
+		BufferLimit:   s.demux.limit,
+		HighWatermark: s.demux.highWatermark,
+		Dropped:       s.demux.dropped,
+	}
+	s.demux.mu.Unlock()
+
+	if s.opts.flowWindow > 0 {
+		s.flow.mu.Lock()
+		stats.Credits = s.flow.credits
+		s.flow.mu.Unlock()
+	}
+
+	c := s.counters
+	stats.Published = c.published.Load()
+	stats.PublishedBytes = c.publishedBytes.Load()
+	stats.Received = c.received.Load()
+	stats.ReceivedBytes = c.receivedBytes.Load()
+	stats.Retransmitted = c.retransmitted.Load()
+	stats.Duplicates = c.duplicates.Load()
+	stats.RTT = time.Duration(c.rtt.Load())
+	return stats
+}
+
+// Add adds the traffic counters of o to s, for totals over several
+// sessions. The queue depths, Credits and RTT are left as they are.
+func (s *Stats) Add(o Stats) {
+	s.Published += o.Published
+	s.PublishedBytes += o.PublishedBytes
+	s.Received += o.Received
+	s.ReceivedBytes += o.ReceivedBytes
+	s.Retransmitted += o.Retransmitted
+	s.Dropped += o.Dropped
+	s.Duplicates += o.Duplicates
+}
+
+// counters accumulates the traffic reported by Stats.
+type counters struct {
+	published      atomic.Uint64
+	publishedBytes atomic.Uint64
+	received       atomic.Uint64
+	receivedBytes  atomic.Uint64
+	retransmitted  atomic.Uint64
+	duplicates     atomic.Uint64
+	// rtt is the smoothed round-trip time in nanoseconds.
+	rtt atomic.Int64
+}
+
+func (c *counters) sent(n int) {
+	c.published.Add(1)
+	c.publishedBytes.Add(uint64(n))
+}
+
+func (c *counters) delivered(n int) {
+	c.received.Add(1)
+	c.receivedBytes.Add(uint64(n))
+}
+
+// sample folds a round-trip measurement into the smoothed RTT, weighting it
+// by 1/8 as TCP does.
+func (c *counters) sample(rtt time.Duration) {
+	for {
+		old := c.rtt.Load()
+		next := int64(rtt)
+		if old != 0 {
+			next = old + (int64(rtt)-old)/8
+		}
+		if c.rtt.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package slimsession
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStatsCountTraffic(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake, WithVisibilityTimeout(20*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if _, err := s.Publish([]byte("hello"), nil, nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if _, err := s.Receive(ctx); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+
+	receipt, err := s.PublishWithAck([]byte("job"), nil, nil)
+	if err != nil {
+		t.Fatalf("PublishWithAck: %v", err)
+	}
+	if _, err := s.Receive(ctx); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	// Leave the first delivery unsettled so that it is retransmitted.
+	second, err := s.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if err := second.Ack(); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if err := receipt.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	fake.frames <- second.ReceivedMessage
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	_, _ = s.Receive(short)
+
+	stats := s.Stats()
+	if stats.Retransmitted < 1 {
+		t.Errorf("Retransmitted = %d, want at least 1", stats.Retransmitted)
+	}
+	if stats.Published != 2+stats.Retransmitted {
+		t.Errorf("Published = %d, want 2 + %d retransmissions", stats.Published, stats.Retransmitted)
+	}
+	if stats.PublishedBytes != 5+3*(stats.Published-1) {
+		t.Errorf("PublishedBytes = %d for %d messages", stats.PublishedBytes, stats.Published)
+	}
+	if stats.Received != 3 || stats.ReceivedBytes != 5+3+3 {
+		t.Errorf("Received = %d (%d bytes), want 3 (11 bytes)", stats.Received, stats.ReceivedBytes)
+	}
+	if stats.Duplicates < 1 {
+		t.Errorf("Duplicates = %d, want at least 1", stats.Duplicates)
+	}
+	if stats.RTT <= 0 {
+		t.Errorf("RTT = %v, want a sample from the acknowledgement", stats.RTT)
+	}
+}
+
+func TestSmoothedRTT(t *testing.T) {
+	var c counters
+	c.sample(80 * time.Millisecond)
+	if got := time.Duration(c.rtt.Load()); got != 80*time.Millisecond {
+		t.Fatalf("first sample = %v, want 80ms", got)
+	}
+	c.sample(160 * time.Millisecond)
+	if got := time.Duration(c.rtt.Load()); got != 90*time.Millisecond {
+		t.Fatalf("smoothed = %v, want 90ms", got)
+	}
+}
+
+func TestStatsAdd(t *testing.T) {
+	total := Stats{Published: 1, Duplicates: 2, Buffered: 3}
+	total.Add(Stats{Published: 1, PublishedBytes: 2, Received: 3, ReceivedBytes: 4, Retransmitted: 5, Dropped: 6, Duplicates: 7, Buffered: 8, RTT: time.Second})
+	want := Stats{Published: 2, PublishedBytes: 2, Received: 3, ReceivedBytes: 4, Retransmitted: 5, Dropped: 6, Duplicates: 9, Buffered: 3}
+	if total != want {
+		t.Errorf("total = %+v, want %+v", total, want)
+	}
+}
+
+func TestCompletionHookReportsOnce(t *testing.T) {
+	var calls []error
+	s := Wrap(newFakeSession(), WithCompletionHook(func(elapsed time.Duration, err error) {
+		if elapsed < 0 {
+			t.Errorf("elapsed = %v", elapsed)
+		}
+		calls = append(calls, err)
+	}))
+
+	completion, err := s.Publish([]byte("hello"), nil, nil)
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if err := completion.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if err := completion.WaitFor(time.Second); err != nil {
+		t.Fatalf("WaitFor: %v", err)
+	}
+	if len(calls) != 1 || calls[0] != nil {
+		t.Fatalf("hook calls = %v, want one successful completion", calls)
+	}
+}
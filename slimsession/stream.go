@@ -0,0 +1,537 @@
+package slimsession
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// Metadata keys carried by every frame of a stream opened with OpenWriter.
+// The first frame also carries the metadata passed to OpenWriter.
+// StreamCreditKey is carried instead by the grants a StreamReader sends back
+// to the writer; a grant that also carries StreamEndKey refuses the stream.
+const (
+	StreamIdKey     = "slim-stream-id"
+	StreamSeqKey    = "slim-stream-seq"
+	StreamEndKey    = "slim-stream-end"
+	StreamErrorKey  = "slim-stream-error"
+	StreamWindowKey = "slim-stream-window"
+	StreamCreditKey = "slim-stream-credit"
+)
+
+// DefaultStreamWindow is the number of frames a StreamWriter may send before
+// the reader grants more credit by reading them.
+const DefaultStreamWindow = 16
+
+// streamBacklog bounds how many streams wait for AcceptStream. Further
+// streams are refused.
+const streamBacklog = 64
+
+var (
+	// ErrStreamClosed is returned when using a stream after Close.
+	ErrStreamClosed = errors.New("slimsession: stream closed")
+	// ErrStreamAborted is returned by a StreamReader when the writer closed
+	// the stream with CloseWithError.
+	ErrStreamAborted = errors.New("slimsession: stream aborted by writer")
+	// ErrStreamRefused is returned by a StreamWriter when the reader closed
+	// the stream before its end, or refused it because too many streams were
+	// waiting for AcceptStream.
+	ErrStreamRefused = errors.New("slimsession: stream refused by reader")
+)
+
+// WithStreamWindow sets the number of frames a StreamWriter may send before
+// Write blocks until the reader reads them.
+func WithStreamWindow(n int) Option {
+	return func(o *options) {
+		o.streamWindow = n
+	}
+}
+
+// StreamWriter sends a logical byte stream over a session. Writes are
+// buffered into frames of the session's maximum fragment size.
+//
+// The reader grants credit back as it reads, so a writer is never more than
+// the stream window ahead of it. Like WithFlowControl, credit is meant for
+// point-to-point sessions, where a single reader grants it.
+type StreamWriter struct {
+	s           *Session
+	ctx         context.Context
+	id          string
+	payloadType *string
+	metadata    map[string]string
+
+	mu       sync.Mutex
+	seq      uint64
+	buf      []byte
+	inflight []*Completion
+	err      error
+	closed   bool
+
+	// The fields below are guarded by the session's demux lock.
+	credits int
+	refused bool
+}
+
+// OpenWriter starts a new stream on the session. The payload type and
+// metadata are delivered with the first frame and exposed by the receiving
+// StreamReader. ctx bounds every Write and the final Close.
+func (s *Session) OpenWriter(ctx context.Context, payloadType *string, metadata *map[string]string) *StreamWriter {
+	w := &StreamWriter{
+		s:           s,
+		ctx:         ctx,
+		payloadType: payloadType,
+		metadata:    copyMetadata(metadata),
+		buf:         make([]byte, 0, s.opts.maxFragmentSize),
+		credits:     s.opts.streamWindow,
+	}
+	w.id, w.err = newMessageId()
+	if w.err == nil {
+		s.demux.mu.Lock()
+		s.demux.writers[w.id] = w
+		s.demux.mu.Unlock()
+	}
+	return w
+}
+
+// Write buffers p and publishes every full frame.
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrStreamClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), cap(w.buf)-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(false, ""); err != nil {
+				w.err = err
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close publishes any buffered data, marks the end of the stream and waits
+// until every frame is delivered. Close is idempotent.
+func (w *StreamWriter) Close() error {
+	return w.close("")
+}
+
+// CloseWithError ends the stream and makes the reader fail with
+// ErrStreamAborted carrying err's message.
+func (w *StreamWriter) CloseWithError(err error) error {
+	if err == nil {
+		return w.Close()
+	}
+	return w.close(err.Error())
+}
+
+func (w *StreamWriter) close(abort string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer func() {
+		w.s.demux.mu.Lock()
+		delete(w.s.demux.writers, w.id)
+		w.s.demux.mu.Unlock()
+	}()
+	if w.err != nil {
+		return w.err
+	}
+
+	if err := w.flush(true, abort); err != nil {
+		return err
+	}
+	for len(w.inflight) > 0 {
+		if err := w.waitOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush publishes the buffered data as the next frame once the reader has
+// granted credit for it. Must be called with w.mu held.
+func (w *StreamWriter) flush(end bool, abort string) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if err := w.acquireCredit(); err != nil {
+		return err
+	}
+
+	md := map[string]string{}
+	if w.seq == 0 {
+		md = copyMetadata(&w.metadata)
+	}
+	md[StreamIdKey] = w.id
+	md[StreamSeqKey] = strconv.FormatUint(w.seq, 10)
+	md[StreamWindowKey] = strconv.Itoa(w.s.opts.streamWindow)
+	if end {
+		md[StreamEndKey] = "true"
+	}
+	if abort != "" {
+		md[StreamErrorKey] = abort
+	}
+
+	completion, err := w.s.publish(w.buf, w.payloadType, &md)
+	if err != nil {
+		return err
+	}
+	w.seq++
+	w.buf = w.buf[:0]
+
+	w.inflight = append(w.inflight, completion)
+	for len(w.inflight) > w.s.opts.streamWindow {
+		if err := w.waitOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acquireCredit waits until the reader grants a credit and consumes it.
+func (w *StreamWriter) acquireCredit() error {
+	var refused bool
+	err := w.s.wait(w.ctx, func() bool {
+		switch {
+		case w.refused:
+			refused = true
+		case w.credits > 0:
+			w.credits--
+		default:
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if refused {
+		return ErrStreamRefused
+	}
+	return nil
+}
+
+func (w *StreamWriter) waitOldest() error {
+	oldest := w.inflight[0]
+	w.inflight = w.inflight[1:]
+
+	if deadline, ok := w.ctx.Deadline(); ok {
+		return oldest.WaitFor(time.Until(deadline))
+	}
+	return oldest.Wait()
+}
+
+// streamCredit consumes msg if it is a grant from a stream reader.
+func (s *Session) streamCredit(msg slim_bindings.ReceivedMessage) bool {
+	v, ok := msg.Context.Metadata[StreamCreditKey]
+	if !ok {
+		return false
+	}
+	d := s.demux
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w, ok := d.writers[msg.Context.Metadata[StreamIdKey]]
+	if !ok {
+		return true
+	}
+	if _, end := msg.Context.Metadata[StreamEndKey]; end {
+		w.refused = true
+	} else if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		w.credits += n
+	}
+	return true
+}
+
+// streamGrant is credit, or a refusal, to be sent back to a stream writer
+// once the demux lock is released.
+type streamGrant struct {
+	context slim_bindings.MessageContext
+	id      string
+	credit  int
+	refuse  bool
+}
+
+// grant sends g to the writer. Lost credit is kept owed by r, if set, so
+// that its next grant carries it.
+func (s *Session) grant(g streamGrant, r *StreamReader) {
+	md := map[string]string{StreamIdKey: g.id, StreamCreditKey: strconv.Itoa(g.credit)}
+	if g.refuse {
+		md[StreamEndKey] = "true"
+	}
+	if _, err := s.SessionInterface.PublishTo(g.context, []byte{}, nil, &md); err != nil && r != nil {
+		s.demux.mu.Lock()
+		r.owed += g.credit
+		s.demux.mu.Unlock()
+	}
+}
+
+// StreamReader receives a logical byte stream sent with OpenWriter.
+// Frames are reordered by sequence number before being exposed.
+type StreamReader struct {
+	s       *Session
+	id      string
+	context slim_bindings.MessageContext
+
+	// The fields below are guarded by the session's demux lock.
+	next uint64
+	// expires is when the stream is dropped if its first frame is still
+	// missing.
+	expires time.Time
+	early   map[uint64]slim_bindings.ReceivedMessage
+	// frames holds the payloads not read yet, the first one partly read.
+	frames [][]byte
+	// window is the writer's stream window, and owed the number of frames
+	// read but not granted back yet.
+	window int
+	owed   int
+	ended  bool
+	abort  string
+	closed bool
+}
+
+// AcceptStream waits for the next stream opened by a peer. Up to 64 streams
+// wait to be accepted; the writers of further streams fail with
+// ErrStreamRefused.
+func (s *Session) AcceptStream(ctx context.Context) (*StreamReader, error) {
+	var r *StreamReader
+	err := s.wait(ctx, func() bool {
+		if len(s.demux.accepted) == 0 {
+			return false
+		}
+		r = s.demux.accepted[0]
+		s.demux.accepted = s.demux.accepted[1:]
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Context returns the message context of the first frame, which can be used
+// with PublishTo or OpenWriter to reply to the sender.
+func (r *StreamReader) Context() slim_bindings.MessageContext {
+	return r.context
+}
+
+// Metadata returns the metadata passed to OpenWriter by the sender.
+func (r *StreamReader) Metadata() map[string]string {
+	return r.context.Metadata
+}
+
+// PayloadType returns the payload type passed to OpenWriter by the sender.
+func (r *StreamReader) PayloadType() string {
+	return r.context.PayloadType
+}
+
+// Read reads stream data, blocking until some is available. It returns
+// io.EOF once the writer has closed the stream and all data was read.
+func (r *StreamReader) Read(p []byte) (int, error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+// ReadContext is like Read but gives up when ctx is done. Frames read are
+// granted back to the writer once half of its window was read.
+func (r *StreamReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	var n, credit int
+	var readErr error
+	err := r.s.wait(ctx, func() bool {
+		if r.closed {
+			readErr = ErrStreamClosed
+			return true
+		}
+		for n < len(p) && len(r.frames) > 0 {
+			c := copy(p[n:], r.frames[0])
+			n += c
+			r.frames[0] = r.frames[0][c:]
+			if len(r.frames[0]) == 0 {
+				r.frames = r.frames[1:]
+				r.owed++
+			}
+		}
+		if r.window > 0 && !r.ended && r.owed >= max(1, r.window/2) {
+			credit += r.owed
+			r.owed = 0
+		}
+		switch {
+		case n > 0:
+		case r.abort != "":
+			readErr = fmt.Errorf("%w: %s", ErrStreamAborted, r.abort)
+		case r.ended:
+			readErr = io.EOF
+		default:
+			return false
+		}
+		return true
+	})
+	if credit > 0 {
+		r.s.grant(streamGrant{context: r.context, id: r.id, credit: credit}, r)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, readErr
+}
+
+// Close stops receiving the stream. Frames that arrive later are discarded,
+// and the writer fails with ErrStreamRefused if it has not ended the stream.
+func (r *StreamReader) Close() error {
+	d := r.s.demux
+	d.mu.Lock()
+	if r.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.frames = nil
+	r.early = nil
+	ended := r.ended
+	if !ended {
+		delete(d.streams, r.id)
+		d.closed[r.id] = r.s.opts.now().Add(r.s.opts.reassemblyTimeout)
+	}
+	d.mu.Unlock()
+
+	if !ended {
+		r.s.grant(streamGrant{context: r.context, id: r.id, refuse: true}, nil)
+	}
+	return nil
+}
+
+// routeStreamFrame delivers msg to its stream, creating the stream on its
+// first frame. It returns a refusal to send to the writer if the stream was
+// dropped. Must be called with the demux lock held.
+func (s *Session) routeStreamFrame(msg slim_bindings.ReceivedMessage) *streamGrant {
+	d := s.demux
+	id := msg.Context.Metadata[StreamIdKey]
+	_, end := msg.Context.Metadata[StreamEndKey]
+	now := s.opts.now()
+	d.expireStreams(now)
+
+	if _, gone := d.closed[id]; gone {
+		if end {
+			delete(d.closed, id)
+		}
+		return nil
+	}
+
+	seq, err := strconv.ParseUint(msg.Context.Metadata[StreamSeqKey], 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	r, ok := d.streams[id]
+	if !ok {
+		r = &StreamReader{
+			s:       s,
+			id:      id,
+			expires: now.Add(s.opts.reassemblyTimeout),
+			early:   make(map[uint64]slim_bindings.ReceivedMessage),
+		}
+		d.streams[id] = r
+	}
+	if seq < r.next {
+		return nil
+	}
+	if window, err := strconv.Atoi(msg.Context.Metadata[StreamWindowKey]); err == nil && window > 0 {
+		r.window = window
+	}
+	if _, dup := r.early[seq]; !dup && r.window > 0 && len(r.frames)+len(r.early)+r.owed >= r.window {
+		// The writer ignores the credit it was granted.
+		r.ended = true
+		r.abort = "slimsession: stream window exceeded"
+		return d.drop(r, msg.Context, now)
+	}
+	r.early[seq] = msg
+
+	for {
+		frame, ok := r.early[r.next]
+		if !ok {
+			return nil
+		}
+		delete(r.early, r.next)
+
+		if r.next == 0 {
+			r.context = frame.Context
+			r.context.Metadata = stripStreamHeaders(frame.Context.Metadata)
+			if len(d.accepted) >= streamBacklog {
+				return d.drop(r, frame.Context, now)
+			}
+			d.accepted = append(d.accepted, r)
+		}
+		r.next++
+		r.frames = append(r.frames, frame.Payload)
+
+		if _, last := frame.Context.Metadata[StreamEndKey]; last {
+			r.ended = true
+			r.abort = frame.Context.Metadata[StreamErrorKey]
+			r.early = nil
+			delete(d.streams, id)
+			return nil
+		}
+	}
+}
+
+// drop stops receiving r, discarding frames that arrive later, and returns
+// the refusal to send to its writer. Must be called with d.mu held.
+func (d *demux) drop(r *StreamReader, context slim_bindings.MessageContext, now time.Time) *streamGrant {
+	r.early = nil
+	delete(d.streams, r.id)
+	d.closed[r.id] = now.Add(r.s.opts.reassemblyTimeout)
+	return &streamGrant{context: context, id: r.id, refuse: true}
+}
+
+// expireStreams forgets closed streams whose end frame never arrived and
+// drops streams whose first frame is still missing, once their timeout has
+// elapsed. Must be called with d.mu held.
+func (d *demux) expireStreams(now time.Time) {
+	for id, expires := range d.closed {
+		if now.After(expires) {
+			delete(d.closed, id)
+		}
+	}
+	for id, r := range d.streams {
+		if r.next == 0 && now.After(r.expires) {
+			delete(d.streams, id)
+		}
+	}
+}
+
+func stripStreamHeaders(metadata map[string]string) map[string]string {
+	out := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		switch k {
+		case StreamIdKey, StreamSeqKey, StreamEndKey, StreamErrorKey, StreamWindowKey:
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
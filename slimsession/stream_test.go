@@ -0,0 +1,271 @@
+package slimsession
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake, WithMaxFragmentSize(7), WithStreamWindow(2))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	payload := bytes.Repeat([]byte("stream data "), 50)
+	payloadType := "text/plain"
+	md := map[string]string{"file": "notes.txt"}
+
+	// The writer is only a window ahead of the reader, so it runs alongside.
+	w := s.OpenWriter(ctx, &payloadType, &md)
+	written := make(chan error, 1)
+	go func() {
+		if _, err := io.Copy(w, bytes.NewReader(payload)); err != nil {
+			written <- err
+			return
+		}
+		written <- w.Close()
+	}()
+
+	r, err := s.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream: %v", err)
+	}
+	if r.PayloadType() != payloadType {
+		t.Errorf("PayloadType = %q, want %q", r.PayloadType(), payloadType)
+	}
+	if r.Metadata()["file"] != "notes.txt" || len(r.Metadata()) != 1 {
+		t.Errorf("Metadata = %v, want only file=notes.txt", r.Metadata())
+	}
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("read %d bytes, want %d", len(got), len(payload))
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestStreamWriterWaitsForReader(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake, WithMaxFragmentSize(4), WithStreamWindow(2))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	short, cancelShort := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancelShort()
+	w := s.OpenWriter(short, nil, nil)
+	if _, err := w.Write([]byte("aaaabbbb")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	// The window is spent until the reader reads.
+	if _, err := w.Write([]byte("cccc")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Write past the window error = %v, want context.DeadlineExceeded", err)
+	}
+	if sent := fake.sentFrames(); sent != 2 {
+		t.Errorf("sent %d frames, want 2", sent)
+	}
+
+	r, err := s.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream: %v", err)
+	}
+	buf := make([]byte, 8)
+	if n, err := io.ReadFull(r, buf); err != nil || string(buf[:n]) != "aaaabbbb" {
+		t.Fatalf("Read = %q, %v", buf[:n], err)
+	}
+	// Reading the window granted it back.
+	if sent := fake.sentFrames(); sent != 3 {
+		t.Errorf("sent %d frames after reading, want 2 and a grant", sent)
+	}
+}
+
+func TestStreamReaderCloseRefusesWriter(t *testing.T) {
+	s := Wrap(newFakeSession(), WithMaxFragmentSize(4), WithStreamWindow(2))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w := s.OpenWriter(ctx, nil, nil)
+	if _, err := w.Write([]byte("aaaa")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	r, err := s.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// The refusal arrives while the writer waits for credit.
+	_, err = w.Write([]byte("bbbbccccdddd"))
+	if !errors.Is(err, ErrStreamRefused) {
+		t.Fatalf("Write after reader Close error = %v, want ErrStreamRefused", err)
+	}
+}
+
+func TestStreamReaderEnforcesWindow(t *testing.T) {
+	s := Wrap(newFakeSession())
+
+	// The writer sends a third frame before any was read.
+	s.demux.mu.Lock()
+	for seq := range 3 {
+		s.routeStreamFrame(slim_bindings.ReceivedMessage{Payload: []byte("x"), Context: slim_bindings.MessageContext{Metadata: map[string]string{
+			StreamIdKey: "s1", StreamSeqKey: strconv.Itoa(seq), StreamWindowKey: "2",
+		}}})
+	}
+	s.demux.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := s.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if !errors.Is(err, ErrStreamAborted) || string(got) != "xx" {
+		t.Fatalf("ReadAll = %q, %v, want the window then ErrStreamAborted", got, err)
+	}
+}
+
+func TestStreamStateExpires(t *testing.T) {
+	clock := time.Unix(0, 0)
+	s := Wrap(newFakeSession(), WithReassemblyTimeout(time.Second), func(o *options) {
+		o.now = func() time.Time { return clock }
+	})
+	frame := func(id, seq string) slim_bindings.ReceivedMessage {
+		return slim_bindings.ReceivedMessage{Context: slim_bindings.MessageContext{Metadata: map[string]string{StreamIdKey: id, StreamSeqKey: seq}}}
+	}
+
+	d := s.demux
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// A stream whose first frame is missing, and one closed before its end.
+	s.routeStreamFrame(frame("orphan", "1"))
+	d.closed["gone"] = clock.Add(time.Second)
+
+	clock = clock.Add(2 * time.Second)
+	s.routeStreamFrame(frame("other", "1"))
+	if _, ok := d.streams["orphan"]; ok {
+		t.Error("stream without its first frame was kept")
+	}
+	if _, ok := d.closed["gone"]; ok {
+		t.Error("closed stream was kept")
+	}
+}
+
+func TestStreamReordersFrames(t *testing.T) {
+	fake := newFakeSession()
+	s := Wrap(fake)
+
+	frame := func(seq, data string, end bool) slim_bindings.ReceivedMessage {
+		md := map[string]string{StreamIdKey: "s1", StreamSeqKey: seq}
+		if end {
+			md[StreamEndKey] = "true"
+		}
+		return slim_bindings.ReceivedMessage{Payload: []byte(data), Context: slim_bindings.MessageContext{Metadata: md}}
+	}
+	fake.frames <- frame("2", "baz", true)
+	fake.frames <- frame("1", "bar", false)
+	fake.frames <- frame("0", "foo", false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := s.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != "foobarbaz" {
+		t.Errorf("read %q, want %q", got, "foobarbaz")
+	}
+}
+
+func TestStreamAbort(t *testing.T) {
+	s := Wrap(newFakeSession())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w := s.OpenWriter(ctx, nil, nil)
+	if _, err := w.Write([]byte("partial")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.CloseWithError(errors.New("disk full")); err != nil {
+		t.Fatalf("CloseWithError: %v", err)
+	}
+	if _, err := w.Write([]byte("more")); !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("Write after close error = %v, want ErrStreamClosed", err)
+	}
+
+	r, err := s.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if !errors.Is(err, ErrStreamAborted) {
+		t.Fatalf("ReadAll error = %v, want ErrStreamAborted", err)
+	}
+	if string(got) != "partial" {
+		t.Errorf("read %q before abort, want %q", got, "partial")
+	}
+}
+
+func TestStreamsAndMessagesAreDemultiplexed(t *testing.T) {
+	s := Wrap(newFakeSession())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w := s.OpenWriter(ctx, nil, nil)
+	if _, err := w.Write([]byte("streamed")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := s.PublishAndWait([]byte("plain"), nil, nil); err != nil {
+		t.Fatalf("PublishAndWait: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	timeout := time.Second
+	msg, err := s.GetMessage(&timeout)
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+	if string(msg.Payload) != "plain" {
+		t.Errorf("GetMessage payload = %q, want %q", msg.Payload, "plain")
+	}
+
+	r, err := s.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != "streamed" {
+		t.Errorf("read %q, want %q", got, "streamed")
+	}
+}
+
+func TestAcceptStreamHonoursContext(t *testing.T) {
+	s := Wrap(newFakeSession())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := s.AcceptStream(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AcceptStream error = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,247 @@
+package slimtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// DefaultValidity is how long the certificates of a PKI are valid.
+const DefaultValidity = 365 * 24 * time.Hour
+
+// WithValidity sets how long the certificates of a PKI are valid.
+func WithValidity(d time.Duration) Option {
+	return func(o *options) {
+		o.validity = d
+	}
+}
+
+// PKI is a throwaway certificate authority with a server and a client
+// certificate it signed, for mutual TLS in development and tests. It is not
+// meant for production: nothing revokes its certificates.
+type PKI struct {
+	CA     tls.Certificate
+	Server tls.Certificate
+	Client tls.Certificate
+}
+
+// NewPKI generates a CA, a server certificate for the hosts of endpoints and
+// a client certificate. Endpoints are server or client endpoints such as
+// "0.0.0.0:46357" or "https://slim.example.com:46357", or plain host names;
+// the server certificate also names localhost, 127.0.0.1 and ::1. Keys are
+// ECDSA P-256.
+func NewPKI(endpoints []string, opts ...Option) (*PKI, error) {
+	o := newOptions(opts)
+	var dnsNames []string
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	for _, host := range append([]string{"localhost"}, hosts(endpoints)...) {
+		ip := net.ParseIP(host)
+		switch {
+		case ip == nil:
+			if !slices.Contains(dnsNames, host) {
+				dnsNames = append(dnsNames, host)
+			}
+		case ip.IsUnspecified():
+			// A listen address such as 0.0.0.0 is not dialed.
+		case !slices.ContainsFunc(ips, ip.Equal):
+			ips = append(ips, ip)
+		}
+	}
+
+	notBefore := time.Now().Add(-time.Minute)
+	notAfter := notBefore.Add(o.validity)
+	ca, err := newCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "SLIM development CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	server, err := newCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: dnsNames[len(dnsNames)-1]},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "slim-client"},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+	if err != nil {
+		return nil, err
+	}
+	return &PKI{CA: ca, Server: server, Client: client}, nil
+}
+
+// hosts returns the hosts of endpoints.
+func hosts(endpoints []string) []string {
+	var result []string
+	for _, endpoint := range endpoints {
+		host := endpoint
+		if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+			host = u.Hostname()
+		} else if h, _, err := net.SplitHostPort(endpoint); err == nil {
+			host = h
+		}
+		if host != "" {
+			result = append(result, host)
+		}
+	}
+	return result
+}
+
+// newCertificate signs template with the key of parent, or self-signs it
+// without a parent.
+func newCertificate(template *x509.Certificate, parent *tls.Certificate) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("slimtls: %w", err)
+	}
+	if template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)); err != nil {
+		return tls.Certificate{}, fmt.Errorf("slimtls: %w", err)
+	}
+	issuer, signer := template, any(key)
+	if parent != nil {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("slimtls: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("slimtls: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// ServerConfig returns server settings with the server certificate that
+// require client certificates signed by the CA, all inlined as PEM.
+func (p *PKI) ServerConfig() slim_bindings.TlsServerConfig {
+	source, _ := Source(p.Server)
+	return serverConfig(source, CaSource(p.CA.Leaf))
+}
+
+// ClientConfig returns client settings with the client certificate that
+// trust only the CA, all inlined as PEM.
+func (p *PKI) ClientConfig() slim_bindings.TlsClientConfig {
+	source, _ := Source(p.Client)
+	return clientConfig(source, CaSource(p.CA.Leaf))
+}
+
+// The names of the files PKI.WriteFiles writes in its directory.
+const (
+	CAFile         = "ca.pem"
+	ServerCertFile = "server.pem"
+	ServerKeyFile  = "server-key.pem"
+	ClientCertFile = "client.pem"
+	ClientKeyFile  = "client-key.pem"
+)
+
+// PKIFiles are the files of a PKI written by PKI.WriteFiles.
+type PKIFiles struct {
+	CA         string
+	ServerCert string
+	ServerKey  string
+	ClientCert string
+	ClientKey  string
+}
+
+// WriteFiles writes the CA certificate and the server and client
+// certificates and keys as PEM files in dir, which is created if needed.
+// Only the owner can read them. The key of the CA is not written.
+func (p *PKI) WriteFiles(dir string) (PKIFiles, error) {
+	files := PKIFiles{
+		CA:         filepath.Join(dir, CAFile),
+		ServerCert: filepath.Join(dir, ServerCertFile),
+		ServerKey:  filepath.Join(dir, ServerKeyFile),
+		ClientCert: filepath.Join(dir, ClientCertFile),
+		ClientKey:  filepath.Join(dir, ClientKeyFile),
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return files, fmt.Errorf("slimtls: %w", err)
+	}
+	serverCert, serverKey, err := encode(p.Server)
+	if err != nil {
+		return files, err
+	}
+	clientCert, clientKey, err := encode(p.Client)
+	if err != nil {
+		return files, err
+	}
+	for name, data := range map[string][]byte{
+		files.CA:         []byte(CaSource(p.CA.Leaf).(slim_bindings.CaSourcePem).Data),
+		files.ServerCert: serverCert,
+		files.ServerKey:  serverKey,
+		files.ClientCert: clientCert,
+		files.ClientKey:  clientKey,
+	} {
+		if err := writeFile(name, data); err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+// ServerConfig returns the settings of PKI.ServerConfig with the files in
+// place of inlined PEM.
+func (f PKIFiles) ServerConfig() slim_bindings.TlsServerConfig {
+	return serverConfig(
+		slim_bindings.TlsSourceFile{Cert: f.ServerCert, Key: f.ServerKey},
+		slim_bindings.CaSourceFile{Path: f.CA},
+	)
+}
+
+// ClientConfig returns the settings of PKI.ClientConfig with the files in
+// place of inlined PEM.
+func (f PKIFiles) ClientConfig() slim_bindings.TlsClientConfig {
+	return clientConfig(
+		slim_bindings.TlsSourceFile{Cert: f.ClientCert, Key: f.ClientKey},
+		slim_bindings.CaSourceFile{Path: f.CA},
+	)
+}
+
+func serverConfig(source slim_bindings.TlsSource, ca slim_bindings.CaSource) slim_bindings.TlsServerConfig {
+	includeSystem := false
+	tlsVersion := "tls1.3"
+	return slim_bindings.TlsServerConfig{
+		Source:                   source,
+		ClientCa:                 ca,
+		IncludeSystemCaCertsPool: &includeSystem,
+		TlsVersion:               &tlsVersion,
+	}
+}
+
+func clientConfig(source slim_bindings.TlsSource, ca slim_bindings.CaSource) slim_bindings.TlsClientConfig {
+	return slim_bindings.TlsClientConfig{
+		Source:     source,
+		CaSource:   ca,
+		TlsVersion: "tls1.3",
+	}
+}
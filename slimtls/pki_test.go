@@ -0,0 +1,117 @@
+package slimtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+func TestPKI(t *testing.T) {
+	pki, err := NewPKI([]string{"0.0.0.0:46357", "https://slim.example.com:46357", "10.0.0.1"}, WithValidity(time.Hour))
+	if err != nil {
+		t.Fatalf("NewPKI: %v", err)
+	}
+	server := pki.Server.Leaf
+	if !slices.Equal(server.DNSNames, []string{"localhost", "slim.example.com"}) {
+		t.Errorf("DNSNames = %q", server.DNSNames)
+	}
+	if len(server.IPAddresses) != 3 || !server.IPAddresses[2].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("IPAddresses = %v", server.IPAddresses)
+	}
+	if d := server.NotAfter.Sub(server.NotBefore); d != time.Hour {
+		t.Errorf("validity = %v", d)
+	}
+
+	// The certificates work for mutual TLS with the CA as the only root.
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.CA.Leaf)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{pki.Server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    roots,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+		Certificates: []tls.Certificate{pki.Client},
+		RootCAs:      roots,
+		ServerName:   "slim.example.com",
+	})
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	// The client certificate is checked by the server on the first read.
+	if _, err := conn.Read(make([]byte, 1)); err != nil && !errors.Is(err, io.EOF) {
+		t.Errorf("server refused the client: %v", err)
+	}
+	conn.Close()
+	if _, err := pki.Client.Leaf.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		t.Errorf("client certificate: %v", err)
+	}
+	if _, err := server.Verify(x509.VerifyOptions{Roots: roots, DNSName: "localhost"}); err != nil {
+		t.Errorf("server certificate: %v", err)
+	}
+
+	serverConfig, clientConfig := pki.ServerConfig(), pki.ClientConfig()
+	if err := serverConfig.Validate(); err != nil {
+		t.Errorf("ServerConfig: %v", err)
+	}
+	if err := clientConfig.Validate(); err != nil {
+		t.Errorf("ClientConfig: %v", err)
+	}
+	if !pemLeaf(t, clientConfig.CaSource.(slim_bindings.CaSourcePem).Data).Equal(pki.CA.Leaf) {
+		t.Error("the client does not trust the CA")
+	}
+}
+
+func TestPKIWriteFiles(t *testing.T) {
+	pki, err := NewPKI(nil)
+	if err != nil {
+		t.Fatalf("NewPKI: %v", err)
+	}
+	files, err := pki.WriteFiles(t.TempDir() + "/pki")
+	if err != nil {
+		t.Fatalf("WriteFiles: %v", err)
+	}
+	cert, err := tls.LoadX509KeyPair(files.ServerCert, files.ServerKey)
+	if err != nil || !cert.Leaf.Equal(pki.Server.Leaf) {
+		t.Errorf("server files: %v", err)
+	}
+	if cert, err = tls.LoadX509KeyPair(files.ClientCert, files.ClientKey); err != nil || !cert.Leaf.Equal(pki.Client.Leaf) {
+		t.Errorf("client files: %v", err)
+	}
+	if info, err := os.Stat(files.ClientKey); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, %v", info.Mode(), err)
+	}
+
+	serverConfig, clientConfig := files.ServerConfig(), files.ClientConfig()
+	if err := serverConfig.Validate(); err != nil {
+		t.Errorf("ServerConfig: %v", err)
+	}
+	if err := clientConfig.Validate(); err != nil {
+		t.Errorf("ClientConfig: %v", err)
+	}
+	if source := clientConfig.CaSource.(slim_bindings.CaSourceFile); source.Path != files.CA {
+		t.Errorf("CaSource = %+v", source)
+	}
+}
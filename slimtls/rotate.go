@@ -0,0 +1,210 @@
+package slimtls
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// DefaultRotateInterval is how often a Rotator asks for the certificate.
+const DefaultRotateInterval = time.Minute
+
+// The names of the files a Rotator writes in its directory.
+const (
+	CertFile = "cert.pem"
+	KeyFile  = "key.pem"
+)
+
+// dataLink is the symbolic link to the directory of the current pair.
+// CertFile and KeyFile are links through it.
+const dataLink = "..data"
+
+// WithRotateInterval sets how often a Rotator asks for the certificate.
+func WithRotateInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// WithRotateHandler calls handler with every new certificate a Rotator
+// writes. Connections and servers set up before keep their certificate, so
+// the handler is the place to reconnect or restart them if needed.
+func WithRotateHandler(handler func(tls.Certificate)) Option {
+	return func(o *options) {
+		o.onRotate = handler
+	}
+}
+
+// Rotator keeps the certificate returned by a GetCertificate-style callback,
+// such as the GetCertificate of a tls.Config or of an ACME client, in the
+// files of a TlsSourceFile. The native library reads them whenever it sets
+// up TLS, so new connections and restarted servers use the current
+// certificate.
+//
+// Each pair is written to a fresh directory, and CertFile and KeyFile are
+// symbolic links through a single link to it, which is swapped atomically.
+// A reader that opens both files always gets a matching pair, unless a
+// rotation lands between its two opens; a Watcher then refuses the pair and
+// takes it on its next check.
+type Rotator struct {
+	dir            string
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	o              options
+
+	mu   sync.Mutex
+	cert []byte
+}
+
+// NewRotator asks getCertificate for the certificate and writes it to dir,
+// which is created if needed. Only the owner can read the key file.
+func NewRotator(dir string, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error), opts ...Option) (*Rotator, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("slimtls: %w", err)
+	}
+	r := &Rotator{dir: dir, getCertificate: getCertificate, o: newOptions(opts)}
+	if _, err := r.Rotate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Source returns the TlsSourceFile of the files.
+func (r *Rotator) Source() slim_bindings.TlsSource {
+	return slim_bindings.TlsSourceFile{
+		Cert: filepath.Join(r.dir, CertFile),
+		Key:  filepath.Join(r.dir, KeyFile),
+	}
+}
+
+// Rotate asks for the certificate and writes it if it changed. It reports
+// whether it did.
+func (r *Rotator) Rotate() (bool, error) {
+	cert, err := r.getCertificate(&tls.ClientHelloInfo{ServerName: r.o.serverName})
+	if err != nil {
+		return false, fmt.Errorf("slimtls: get certificate: %w", err)
+	}
+	if cert == nil {
+		return false, errors.New("slimtls: get certificate returned no certificate")
+	}
+	certPEM, keyPEM, err := encode(*cert)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if bytes.Equal(certPEM, r.cert) {
+		return false, nil
+	}
+	if err := r.write(certPEM, keyPEM); err != nil {
+		return false, err
+	}
+	r.cert = certPEM
+	if r.o.onRotate != nil {
+		r.o.onRotate(*cert)
+	}
+	return true, nil
+}
+
+// write puts the pair in a fresh directory, points the data link at it and
+// removes the previous directory.
+func (r *Rotator) write(certPEM, keyPEM []byte) error {
+	version, err := os.MkdirTemp(r.dir, "..pair-")
+	if err != nil {
+		return fmt.Errorf("slimtls: %w", err)
+	}
+	if err := writeKeyPair(version, certPEM, keyPEM); err != nil {
+		os.RemoveAll(version)
+		return err
+	}
+
+	previous, _ := os.Readlink(filepath.Join(r.dir, dataLink))
+	if err := relink(r.dir, dataLink, filepath.Base(version)); err != nil {
+		os.RemoveAll(version)
+		return err
+	}
+	for _, name := range []string{CertFile, KeyFile} {
+		target := filepath.Join(dataLink, name)
+		if current, err := os.Readlink(filepath.Join(r.dir, name)); err == nil && current == target {
+			continue
+		}
+		// Replaces the regular files of older versions too.
+		if err := relink(r.dir, name, target); err != nil {
+			return err
+		}
+	}
+	if previous != "" && previous != filepath.Base(version) {
+		os.RemoveAll(filepath.Join(r.dir, previous))
+	}
+	return nil
+}
+
+// Run rotates at the rotate interval until ctx is done. Failures are
+// retried at the next interval; the files keep the last certificate.
+func (r *Rotator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.o.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			_, _ = r.Rotate()
+		}
+	}
+}
+
+// writeKeyPair writes the pair into dir. Only the owner can read the files.
+func writeKeyPair(dir string, certPEM, keyPEM []byte) error {
+	if err := os.WriteFile(filepath.Join(dir, KeyFile), keyPEM, 0o600); err != nil {
+		return fmt.Errorf("slimtls: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, CertFile), certPEM, 0o600); err != nil {
+		return fmt.Errorf("slimtls: %w", err)
+	}
+	return nil
+}
+
+// relink points the symbolic link name in dir at target, replacing whatever
+// name was atomically.
+func relink(dir, name, target string) error {
+	tmp := filepath.Join(dir, "."+name+".tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return fmt.Errorf("slimtls: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("slimtls: %w", err)
+	}
+	return nil
+}
+
+// writeFile replaces the file at name atomically, so that readers never see
+// a partial file.
+func writeFile(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("slimtls: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("slimtls: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("slimtls: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("slimtls: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package slimtls
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+func TestRotator(t *testing.T) {
+	var mu sync.Mutex
+	current := certificate(t, "first")
+	var failure error
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		cert := current
+		return &cert, failure
+	}
+	rotated := make(chan tls.Certificate, 4)
+
+	dir := filepath.Join(t.TempDir(), "certs")
+	rotator, err := NewRotator(dir, getCertificate, WithRotateHandler(func(cert tls.Certificate) { rotated <- cert }))
+	if err != nil {
+		t.Fatalf("NewRotator: %v", err)
+	}
+	<-rotated
+
+	source := rotator.Source().(slim_bindings.TlsSourceFile)
+	if source.Cert != filepath.Join(dir, CertFile) || source.Key != filepath.Join(dir, KeyFile) {
+		t.Errorf("Source = %+v", source)
+	}
+	loaded := func() tls.Certificate {
+		t.Helper()
+		cert, err := tls.LoadX509KeyPair(source.Cert, source.Key)
+		if err != nil {
+			t.Fatalf("LoadX509KeyPair: %v", err)
+		}
+		return cert
+	}
+	if !loaded().Leaf.Equal(current.Leaf) {
+		t.Error("the files hold another certificate")
+	}
+	if info, err := os.Stat(source.Key); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, %v", info.Mode(), err)
+	}
+
+	if changed, err := rotator.Rotate(); changed || err != nil {
+		t.Errorf("Rotate of the same certificate = %v, %v", changed, err)
+	}
+
+	mu.Lock()
+	failure = errors.New("unavailable")
+	mu.Unlock()
+	if _, err := rotator.Rotate(); err == nil {
+		t.Error("Rotate succeeded despite the failure")
+	}
+	if !loaded().Leaf.Equal(current.Leaf) {
+		t.Error("a failed rotation changed the files")
+	}
+
+	mu.Lock()
+	failure = nil
+	current = certificate(t, "second")
+	next := current
+	mu.Unlock()
+	if changed, err := rotator.Rotate(); !changed || err != nil {
+		t.Fatalf("Rotate = %v, %v", changed, err)
+	}
+	if cert := <-rotated; !cert.Leaf.Equal(next.Leaf) {
+		t.Error("the handler got another certificate")
+	}
+	if !loaded().Leaf.Equal(next.Leaf) {
+		t.Error("the files were not rotated")
+	}
+}
+
+func TestRotatorRun(t *testing.T) {
+	var mu sync.Mutex
+	current := certificate(t, "first")
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		cert := current
+		return &cert, nil
+	}
+	rotated := make(chan tls.Certificate, 4)
+	rotator, err := NewRotator(t.TempDir(), getCertificate, WithRotateInterval(10*time.Millisecond),
+		WithRotateHandler(func(cert tls.Certificate) { rotated <- cert }))
+	if err != nil {
+		t.Fatalf("NewRotator: %v", err)
+	}
+	<-rotated
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- rotator.Run(ctx) }()
+
+	mu.Lock()
+	current = certificate(t, "second")
+	mu.Unlock()
+	select {
+	case cert := <-rotated:
+		if cert.Leaf.Subject.CommonName != "second" {
+			t.Errorf("rotated to %s", cert.Leaf.Subject.CommonName)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no rotation")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+}
+
+func TestRotatorSwapsPairDirectory(t *testing.T) {
+	var mu sync.Mutex
+	current := certificate(t, "first")
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		cert := current
+		return &cert, nil
+	}
+
+	// Regular files left by an older version are replaced by links.
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, CertFile), []byte("old"))
+	writeTestFile(t, filepath.Join(dir, KeyFile), []byte("old"))
+	rotator, err := NewRotator(dir, getCertificate)
+	if err != nil {
+		t.Fatalf("NewRotator: %v", err)
+	}
+	for _, name := range []string{CertFile, KeyFile} {
+		if info, err := os.Lstat(filepath.Join(dir, name)); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%s is not a link: %v, %v", name, info.Mode(), err)
+		}
+	}
+
+	mu.Lock()
+	current = certificate(t, "second")
+	mu.Unlock()
+	if changed, err := rotator.Rotate(); !changed || err != nil {
+		t.Fatalf("Rotate = %v, %v", changed, err)
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, CertFile), filepath.Join(dir, KeyFile))
+	if err != nil || cert.Leaf.Subject.CommonName != "second" {
+		t.Fatalf("LoadX509KeyPair after rotation: %v", err)
+	}
+	pairs, _ := filepath.Glob(filepath.Join(dir, "..pair-*"))
+	if len(pairs) != 1 {
+		t.Errorf("%d pair directories left, want 1", len(pairs))
+	}
+}
@@ -0,0 +1,217 @@
+// Package slimtls builds the TLS settings of slim_bindings from crypto/tls
+// and crypto/x509 values.
+//
+// TlsSource and CaSource take PEM, file paths or SPIRE. Certificates held as
+// a tls.Certificate or *x509.Certificate, for example from a secrets manager
+// or cert-manager, are converted to PEM sources here:
+//
+//	tlsConfig, err := slimtls.ClientConfig(config, slimtls.WithCA(caCerts...))
+//	clientConfig := slim_bindings.NewSecureClientConfig(endpoint)
+//	clientConfig.Tls = tlsConfig
+//
+// A Rotator keeps a certificate returned by a GetCertificate-style callback
+// current in files, for certificates that are renewed while running, and a
+// Watcher reloads the certificate, key and CA files of TLS settings when they
+// change. NewPKI generates a CA with server and client certificates for
+// mutual TLS in development and tests.
+package slimtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// Option configures the conversions, a Rotator, a Watcher and a PKI.
+type Option func(*options)
+
+type options struct {
+	cas        []*x509.Certificate
+	caSet      bool
+	serverName string
+	interval   time.Duration
+	onRotate   func(tls.Certificate)
+
+	reloadInterval time.Duration
+	onReload       func(Event)
+
+	validity time.Duration
+}
+
+// WithCA sets the CA certificates: those that verify the server for
+// ClientConfig, and those that verify clients for ServerConfig. An
+// *x509.CertPool cannot be listed, so the RootCAs or ClientCAs of a
+// tls.Config must be passed again with WithCA.
+func WithCA(certs ...*x509.Certificate) Option {
+	return func(o *options) {
+		o.cas = certs
+		o.caSet = true
+	}
+}
+
+// WithServerName sets the server name passed to a GetCertificate callback.
+func WithServerName(name string) Option {
+	return func(o *options) {
+		o.serverName = name
+	}
+}
+
+// Source returns the certificate chain and private key of cert as a PEM
+// TlsSource. The key must be exportable: RSA, ECDSA, Ed25519 or ECDH.
+func Source(cert tls.Certificate) (slim_bindings.TlsSource, error) {
+	certPEM, keyPEM, err := encode(cert)
+	if err != nil {
+		return nil, err
+	}
+	return slim_bindings.TlsSourcePem{Cert: string(certPEM), Key: string(keyPEM)}, nil
+}
+
+// CaSource returns certs as a PEM CaSource, or CaSourceNone without certs.
+func CaSource(certs ...*x509.Certificate) slim_bindings.CaSource {
+	if len(certs) == 0 {
+		return slim_bindings.CaSourceNone{}
+	}
+	var b strings.Builder
+	for _, cert := range certs {
+		_ = pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return slim_bindings.CaSourcePem{Data: b.String()}
+}
+
+// ClientConfig converts the client side of config:
+//
+//   - The first of Certificates, or else the result of GetClientCertificate,
+//     becomes the client certificate.
+//   - The CAs of WithCA verify the server. Without them, a nil RootCAs means
+//     the system pool; a set RootCAs is an error, as it cannot be read.
+//   - InsecureSkipVerify is kept.
+//   - A MinVersion of TLS 1.3 becomes "tls1.3", anything lower "tls1.2".
+//
+// Other settings, such as ServerName, have no TlsClientConfig equivalent;
+// ServerName goes in ClientConfig.ServerName.
+func ClientConfig(config *tls.Config, opts ...Option) (slim_bindings.TlsClientConfig, error) {
+	o := newOptions(opts)
+	result := slim_bindings.TlsClientConfig{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		Source:             slim_bindings.TlsSourceNone{},
+		CaSource:           CaSource(o.cas...),
+		TlsVersion:         version(config.MinVersion),
+	}
+
+	var cert *tls.Certificate
+	switch {
+	case len(config.Certificates) > 0:
+		cert = &config.Certificates[0]
+	case config.GetClientCertificate != nil:
+		var err error
+		if cert, err = config.GetClientCertificate(&tls.CertificateRequestInfo{Version: tls.VersionTLS13}); err != nil {
+			return result, fmt.Errorf("slimtls: client certificate: %w", err)
+		}
+	}
+	if cert != nil && len(cert.Certificate) > 0 {
+		source, err := Source(*cert)
+		if err != nil {
+			return result, err
+		}
+		result.Source = source
+	}
+
+	switch {
+	case o.caSet:
+		result.IncludeSystemCaCertsPool = false
+	case config.RootCAs != nil:
+		return result, errors.New("slimtls: RootCAs cannot be read from a tls.Config; pass the certificates with WithCA")
+	default:
+		result.IncludeSystemCaCertsPool = true
+	}
+	return result, nil
+}
+
+// ServerConfig converts the server side of config:
+//
+//   - The first of Certificates, or else the result of GetCertificate, is
+//     the server certificate, which is required.
+//   - The CAs of WithCA verify client certificates. A ClientAuth that
+//     verifies client certificates requires them, as ClientCAs cannot be
+//     read.
+//   - A MinVersion of TLS 1.3 becomes "tls1.3", anything lower "tls1.2".
+func ServerConfig(config *tls.Config, opts ...Option) (slim_bindings.TlsServerConfig, error) {
+	o := newOptions(opts)
+	tlsVersion := version(config.MinVersion)
+	includeSystem := false
+	result := slim_bindings.TlsServerConfig{
+		ClientCa:                 CaSource(o.cas...),
+		IncludeSystemCaCertsPool: &includeSystem,
+		TlsVersion:               &tlsVersion,
+	}
+
+	cert, err := serverCertificate(config, o.serverName)
+	if err != nil {
+		return result, err
+	}
+	if result.Source, err = Source(*cert); err != nil {
+		return result, err
+	}
+
+	if config.ClientAuth >= tls.VerifyClientCertIfGiven && !o.caSet {
+		return result, fmt.Errorf("slimtls: ClientAuth %s needs the client CAs; pass them with WithCA", config.ClientAuth)
+	}
+	return result, nil
+}
+
+func serverCertificate(config *tls.Config, serverName string) (*tls.Certificate, error) {
+	switch {
+	case len(config.Certificates) > 0:
+		return &config.Certificates[0], nil
+	case config.GetCertificate != nil:
+		cert, err := config.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		if err != nil {
+			return nil, fmt.Errorf("slimtls: server certificate: %w", err)
+		}
+		if cert == nil {
+			return nil, errors.New("slimtls: GetCertificate returned no certificate")
+		}
+		return cert, nil
+	}
+	return nil, errors.New("slimtls: a TLS server needs Certificates or GetCertificate")
+}
+
+func version(minVersion uint16) string {
+	if minVersion >= tls.VersionTLS13 {
+		return "tls1.3"
+	}
+	return "tls1.2"
+}
+
+// encode returns the certificate chain and private key of cert in PEM.
+func encode(cert tls.Certificate) (certPEM, keyPEM []byte, err error) {
+	if len(cert.Certificate) == 0 {
+		return nil, nil, errors.New("slimtls: certificate has no chain")
+	}
+	for _, der := range cert.Certificate {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	if cert.PrivateKey == nil {
+		return nil, nil, errors.New("slimtls: certificate has no private key")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("slimtls: private key cannot be exported: %w", err)
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return certPEM, keyPEM, nil
+}
+
+func newOptions(opts []Option) options {
+	o := options{interval: DefaultRotateInterval, reloadInterval: DefaultReloadInterval, validity: DefaultValidity}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
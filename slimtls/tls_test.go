@@ -0,0 +1,186 @@
+package slimtls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// certificate returns a self-signed certificate for name, valid for an hour.
+func certificate(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	return issue(t, name, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+}
+
+// issue returns a self-signed certificate for name, valid from notBefore to
+// notAfter.
+func issue(t *testing.T, name string, notBefore, notAfter time.Time) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestSource(t *testing.T) {
+	cert := certificate(t, "slim.example.com")
+	source, err := Source(cert)
+	if err != nil {
+		t.Fatalf("Source: %v", err)
+	}
+	pemSource, ok := source.(slim_bindings.TlsSourcePem)
+	if !ok {
+		t.Fatalf("Source = %#v, want TlsSourcePem", source)
+	}
+	parsed, err := tls.X509KeyPair([]byte(pemSource.Cert), []byte(pemSource.Key))
+	if err != nil {
+		t.Fatalf("X509KeyPair: %v", err)
+	}
+	if !parsed.Leaf.Equal(cert.Leaf) {
+		t.Error("the PEM certificate differs")
+	}
+
+	// Keys held by a signer that cannot export them are refused.
+	cert.PrivateKey = opaqueSigner{cert.PrivateKey.(crypto.Signer)}
+	if _, err := Source(cert); err == nil || !strings.Contains(err.Error(), "cannot be exported") {
+		t.Errorf("Source error = %v", err)
+	}
+	if _, err := Source(tls.Certificate{}); err == nil {
+		t.Error("Source of an empty certificate succeeded")
+	}
+}
+
+type opaqueSigner struct{ crypto.Signer }
+
+func TestCaSource(t *testing.T) {
+	if _, ok := CaSource().(slim_bindings.CaSourceNone); !ok {
+		t.Error("CaSource() is not CaSourceNone")
+	}
+	a, b := certificate(t, "a"), certificate(t, "b")
+	source := CaSource(a.Leaf, b.Leaf).(slim_bindings.CaSourcePem)
+	rest := []byte(source.Data)
+	for _, want := range []*x509.Certificate{a.Leaf, b.Leaf} {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil || block.Type != "CERTIFICATE" {
+			t.Fatalf("missing certificate in %q", source.Data)
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err != nil || !cert.Equal(want) {
+			t.Errorf("certificate = %v, %v", cert, err)
+		}
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	client, ca := certificate(t, "client"), certificate(t, "ca")
+
+	config, err := ClientConfig(&tls.Config{Certificates: []tls.Certificate{client}, MinVersion: tls.VersionTLS13}, WithCA(ca.Leaf))
+	if err != nil {
+		t.Fatalf("ClientConfig: %v", err)
+	}
+	if _, ok := config.Source.(slim_bindings.TlsSourcePem); !ok {
+		t.Errorf("Source = %#v", config.Source)
+	}
+	if _, ok := config.CaSource.(slim_bindings.CaSourcePem); !ok || config.IncludeSystemCaCertsPool {
+		t.Errorf("CaSource = %#v, IncludeSystemCaCertsPool = %v", config.CaSource, config.IncludeSystemCaCertsPool)
+	}
+	if config.TlsVersion != "tls1.3" || config.Insecure {
+		t.Errorf("config = %+v", config)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	config, err = ClientConfig(&tls.Config{
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &client, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("ClientConfig: %v", err)
+	}
+	if _, ok := config.Source.(slim_bindings.TlsSourcePem); !ok {
+		t.Errorf("Source = %#v", config.Source)
+	}
+	if !config.InsecureSkipVerify || !config.IncludeSystemCaCertsPool || config.TlsVersion != "tls1.2" {
+		t.Errorf("config = %+v", config)
+	}
+
+	if _, err := ClientConfig(&tls.Config{RootCAs: x509.NewCertPool()}); err == nil || !strings.Contains(err.Error(), "WithCA") {
+		t.Errorf("ClientConfig error = %v, want a hint to WithCA", err)
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	server, ca := certificate(t, "server"), certificate(t, "ca")
+
+	config, err := ServerConfig(&tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "server" {
+				t.Errorf("ServerName = %q", hello.ServerName)
+			}
+			return &server, nil
+		},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}, WithCA(ca.Leaf), WithServerName("server"))
+	if err != nil {
+		t.Fatalf("ServerConfig: %v", err)
+	}
+	if _, ok := config.Source.(slim_bindings.TlsSourcePem); !ok {
+		t.Errorf("Source = %#v", config.Source)
+	}
+	if _, ok := config.ClientCa.(slim_bindings.CaSourcePem); !ok {
+		t.Errorf("ClientCa = %#v", config.ClientCa)
+	}
+	if *config.TlsVersion != "tls1.2" || config.Insecure {
+		t.Errorf("config = %+v", config)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	if _, err := ServerConfig(&tls.Config{Certificates: []tls.Certificate{server}, ClientAuth: tls.RequireAndVerifyClientCert}); err == nil {
+		t.Error("ServerConfig without client CAs succeeded")
+	}
+	if _, err := ServerConfig(&tls.Config{}); err == nil {
+		t.Error("ServerConfig without a certificate succeeded")
+	}
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	server.PrivateKey = key
+	if _, err := ServerConfig(&tls.Config{Certificates: []tls.Certificate{server}}); err != nil {
+		t.Errorf("ServerConfig with an Ed25519 key: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package slimtls
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// DefaultReloadInterval is how often a Watcher checks its files.
+const DefaultReloadInterval = 10 * time.Second
+
+// Event reports a reload of the files of a Watcher.
+type Event struct {
+	// Files lists the files that changed.
+	Files []string
+	// Err is the reason the new files were refused, if they were. The
+	// Watcher then keeps the previous material.
+	Err error
+}
+
+// WithReloadInterval sets how often a Watcher checks its files.
+func WithReloadInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.reloadInterval = d
+	}
+}
+
+// WithReloadHandler calls handler for every change of the files of a
+// Watcher, whether the new material was taken or refused. Calls are made one
+// at a time. After a successful reload, the handler applies the settings of
+// Watcher.ClientConfig or Watcher.ServerConfig, for example by reconnecting
+// the client or restarting the server.
+func WithReloadHandler(handler func(Event)) Option {
+	return func(o *options) {
+		o.onReload = handler
+	}
+}
+
+// Watcher watches the certificate, key and CA files of TLS settings.
+//
+// The native library reads the files of a TlsSourceFile or CaSourceFile
+// once, when it sets up TLS. A Watcher instead reads them itself and hands
+// out the settings with their content inlined as PEM. When the files change,
+// it checks the new material first: the certificate must match its key and
+// be valid now, and CA files must hold certificates. Material that fails the
+// checks, such as a certificate written before its key, is refused and the
+// previous material kept, until the files change again.
+type Watcher struct {
+	o      options
+	client *slim_bindings.TlsClientConfig
+	server *slim_bindings.TlsServerConfig
+	files  []string
+
+	// reloading serializes reloads; mu guards the fields below.
+	reloading sync.Mutex
+	mu        sync.Mutex
+	seen      map[string][]byte
+	source    slim_bindings.TlsSource
+	ca        slim_bindings.CaSource
+}
+
+// NewClientWatcher watches the files of config.
+func NewClientWatcher(config slim_bindings.TlsClientConfig, opts ...Option) (*Watcher, error) {
+	w := &Watcher{o: newOptions(opts), client: &config}
+	if err := w.init(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewServerWatcher watches the files of config. With ReloadClientCaFile set,
+// the native library reloads the client CA file, so the Watcher only
+// watches the certificate and key and leaves ClientCa as it is.
+func NewServerWatcher(config slim_bindings.TlsServerConfig, opts ...Option) (*Watcher, error) {
+	w := &Watcher{o: newOptions(opts), server: &config}
+	if err := w.init(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Watcher) init() error {
+	source, ca := w.sources()
+	if file, ok := source.(slim_bindings.TlsSourceFile); ok {
+		w.files = append(w.files, file.Cert, file.Key)
+	}
+	if file, ok := ca.(slim_bindings.CaSourceFile); ok {
+		w.files = append(w.files, file.Path)
+	}
+	w.seen = read(w.files)
+	var err error
+	w.source, w.ca, err = w.load(w.seen)
+	return err
+}
+
+// Files returns the files the Watcher watches.
+func (w *Watcher) Files() []string {
+	return w.files
+}
+
+// ClientConfig returns the client settings with the current material. It
+// must only be called on a Watcher of NewClientWatcher.
+func (w *Watcher) ClientConfig() slim_bindings.TlsClientConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	config := *w.client
+	config.Source, config.CaSource = w.source, w.ca
+	return config
+}
+
+// ServerConfig returns the server settings with the current material. It
+// must only be called on a Watcher of NewServerWatcher.
+func (w *Watcher) ServerConfig() slim_bindings.TlsServerConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	config := *w.server
+	config.Source = w.source
+	if w.ca != nil {
+		config.ClientCa = w.ca
+	}
+	return config
+}
+
+// Reload checks the files and takes their new material. It reports whether
+// the material changed; the error is the reason new material was refused.
+func (w *Watcher) Reload() (bool, error) {
+	w.reloading.Lock()
+	defer w.reloading.Unlock()
+
+	contents := read(w.files)
+	w.mu.Lock()
+	var changed []string
+	for _, file := range w.files {
+		if !bytes.Equal(contents[file], w.seen[file]) {
+			changed = append(changed, file)
+		}
+	}
+	if len(changed) == 0 {
+		w.mu.Unlock()
+		return false, nil
+	}
+	w.seen = contents
+	source, ca, err := w.load(contents)
+	if err == nil {
+		w.source, w.ca = source, ca
+	}
+	w.mu.Unlock()
+
+	if w.o.onReload != nil {
+		w.o.onReload(Event{Files: changed, Err: err})
+	}
+	return err == nil, err
+}
+
+// Run reloads at the reload interval until ctx is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.o.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			_, _ = w.Reload()
+		}
+	}
+}
+
+// missing stands for the content of a file that cannot be read.
+var missing = []byte("\x00missing")
+
+func read(files []string) map[string][]byte {
+	contents := make(map[string][]byte, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			data = missing
+		}
+		contents[file] = data
+	}
+	return contents
+}
+
+// load returns the sources of the Watcher with the file variants replaced by
+// the given contents, once they pass the checks.
+func (w *Watcher) load(contents map[string][]byte) (slim_bindings.TlsSource, slim_bindings.CaSource, error) {
+	source, ca := w.sources()
+	if file, ok := source.(slim_bindings.TlsSourceFile); ok {
+		certPEM, keyPEM := contents[file.Cert], contents[file.Key]
+		if err := checkKeyPair(file, certPEM, keyPEM, time.Now()); err != nil {
+			return nil, nil, err
+		}
+		source = slim_bindings.TlsSourcePem{Cert: string(certPEM), Key: string(keyPEM)}
+	}
+	if file, ok := ca.(slim_bindings.CaSourceFile); ok {
+		data := contents[file.Path]
+		if err := checkCA(file.Path, data); err != nil {
+			return nil, nil, err
+		}
+		ca = slim_bindings.CaSourcePem{Data: string(data)}
+	}
+	return source, ca, nil
+}
+
+func (w *Watcher) sources() (slim_bindings.TlsSource, slim_bindings.CaSource) {
+	if w.client != nil {
+		return w.client.Source, w.client.CaSource
+	}
+	if w.server.ReloadClientCaFile != nil && *w.server.ReloadClientCaFile {
+		// The native library reloads the client CA file itself.
+		return w.server.Source, nil
+	}
+	return w.server.Source, w.server.ClientCa
+}
+
+func checkKeyPair(file slim_bindings.TlsSourceFile, certPEM, keyPEM []byte, now time.Time) error {
+	if bytes.Equal(certPEM, missing) {
+		return fmt.Errorf("slimtls: cannot read %s", file.Cert)
+	}
+	if bytes.Equal(keyPEM, missing) {
+		return fmt.Errorf("slimtls: cannot read %s", file.Key)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("slimtls: %s and %s: %w", file.Cert, file.Key, err)
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("slimtls: %s: %w", file.Cert, err)
+		}
+	}
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("slimtls: %s: certificate is not valid before %s", file.Cert, leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("slimtls: %s: certificate expired at %s", file.Cert, leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func checkCA(path string, data []byte) error {
+	if bytes.Equal(data, missing) {
+		return fmt.Errorf("slimtls: cannot read %s", path)
+	}
+	found := false
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("slimtls: %s: %w", path, err)
+		}
+		found = true
+	}
+	if !found {
+		return errors.New("slimtls: " + path + " holds no certificate")
+	}
+	return nil
+}
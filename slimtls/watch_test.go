@@ -0,0 +1,192 @@
+package slimtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	slim_bindings "github.com/agntcy/slim-bindings-go"
+)
+
+// writePair writes cert and its key as PEM files in dir.
+func writePair(t *testing.T, dir string, cert tls.Certificate) slim_bindings.TlsSourceFile {
+	t.Helper()
+	certPEM, keyPEM, err := encode(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := slim_bindings.TlsSourceFile{Cert: filepath.Join(dir, "cert.pem"), Key: filepath.Join(dir, "key.pem")}
+	writeTestFile(t, source.Cert, certPEM)
+	writeTestFile(t, source.Key, keyPEM)
+	return source
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func pemLeaf(t *testing.T, data string) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		t.Fatalf("no PEM in %q", data)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestClientWatcher(t *testing.T) {
+	dir := t.TempDir()
+	first := issue(t, "first", time.Now().Add(-time.Minute), time.Now().Add(2*time.Second))
+	source := writePair(t, dir, first)
+	caPath := filepath.Join(dir, "ca.pem")
+	ca := certificate(t, "ca")
+	writeTestFile(t, caPath, []byte(CaSource(ca.Leaf).(slim_bindings.CaSourcePem).Data))
+
+	var events []Event
+	watcher, err := NewClientWatcher(slim_bindings.TlsClientConfig{
+		Source:     source,
+		CaSource:   slim_bindings.CaSourceFile{Path: caPath},
+		TlsVersion: "tls1.3",
+	}, WithReloadHandler(func(event Event) { events = append(events, event) }))
+	if err != nil {
+		t.Fatalf("NewClientWatcher: %v", err)
+	}
+	if files := watcher.Files(); len(files) != 3 {
+		t.Errorf("Files = %q", files)
+	}
+	config := watcher.ClientConfig()
+	if !pemLeaf(t, config.Source.(slim_bindings.TlsSourcePem).Cert).Equal(first.Leaf) {
+		t.Error("Source holds another certificate")
+	}
+	if !pemLeaf(t, config.CaSource.(slim_bindings.CaSourcePem).Data).Equal(ca.Leaf) {
+		t.Error("CaSource holds another certificate")
+	}
+	if config.TlsVersion != "tls1.3" {
+		t.Errorf("TlsVersion = %q", config.TlsVersion)
+	}
+
+	if changed, err := watcher.Reload(); changed || err != nil || len(events) != 0 {
+		t.Errorf("Reload without changes = %v, %v, events %v", changed, err, events)
+	}
+
+	// A certificate written before its key is refused, keeping the first.
+	second := certificate(t, "second")
+	certPEM, keyPEM, _ := encode(second)
+	writeTestFile(t, source.Cert, certPEM)
+	if changed, err := watcher.Reload(); changed || err == nil {
+		t.Fatalf("Reload of a mismatched pair = %v, %v", changed, err)
+	}
+	if len(events) != 1 || events[0].Err == nil || events[0].Files[0] != source.Cert {
+		t.Errorf("events = %+v", events)
+	}
+	if !pemLeaf(t, watcher.ClientConfig().Source.(slim_bindings.TlsSourcePem).Cert).Equal(first.Leaf) {
+		t.Error("the refused certificate was taken")
+	}
+
+	// Once the key follows, the pair is taken.
+	writeTestFile(t, source.Key, keyPEM)
+	if changed, err := watcher.Reload(); !changed || err != nil {
+		t.Fatalf("Reload = %v, %v", changed, err)
+	}
+	if len(events) != 2 || events[1].Err != nil || events[1].Files[0] != source.Key {
+		t.Errorf("events = %+v", events)
+	}
+	if !pemLeaf(t, watcher.ClientConfig().Source.(slim_bindings.TlsSourcePem).Cert).Equal(second.Leaf) {
+		t.Error("the new certificate was not taken")
+	}
+
+	// An expired certificate is refused.
+	expired := issue(t, "expired", time.Now().Add(-time.Hour), time.Now().Add(-time.Minute))
+	writePair(t, dir, expired)
+	if _, err := watcher.Reload(); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Reload error = %v, want expired", err)
+	}
+
+	// So is a CA file without certificates.
+	writePair(t, dir, second)
+	writeTestFile(t, caPath, []byte("garbage"))
+	if _, err := watcher.Reload(); err == nil || !strings.Contains(err.Error(), "no certificate") {
+		t.Errorf("Reload error = %v, want no certificate", err)
+	}
+	if !pemLeaf(t, watcher.ClientConfig().CaSource.(slim_bindings.CaSourcePem).Data).Equal(ca.Leaf) {
+		t.Error("the refused CA was taken")
+	}
+}
+
+func TestServerWatcherRun(t *testing.T) {
+	dir := t.TempDir()
+	// A short-lived certificate, replaced before it expires.
+	source := writePair(t, dir, issue(t, "first", time.Now().Add(-time.Minute), time.Now().Add(3*time.Second)))
+	caPath := filepath.Join(dir, "ca.pem")
+	writeTestFile(t, caPath, []byte(CaSource(certificate(t, "ca").Leaf).(slim_bindings.CaSourcePem).Data))
+	reload := true
+	events := make(chan Event, 4)
+	watcher, err := NewServerWatcher(slim_bindings.TlsServerConfig{
+		Source:             source,
+		ClientCa:           slim_bindings.CaSourceFile{Path: caPath},
+		ReloadClientCaFile: &reload,
+	}, WithReloadInterval(10*time.Millisecond), WithReloadHandler(func(event Event) { events <- event }))
+	if err != nil {
+		t.Fatalf("NewServerWatcher: %v", err)
+	}
+	config := watcher.ServerConfig()
+	if config.ReloadClientCaFile == nil || !*config.ReloadClientCaFile {
+		t.Error("ReloadClientCaFile dropped")
+	}
+	if ca, ok := config.ClientCa.(slim_bindings.CaSourceFile); !ok || ca.Path != caPath {
+		t.Errorf("ClientCa = %#v, want the file left to the native reload", config.ClientCa)
+	}
+	if files := watcher.Files(); len(files) != 2 || files[0] != source.Cert || files[1] != source.Key {
+		t.Errorf("Files = %v, want the certificate and key only", files)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- watcher.Run(ctx) }()
+
+	next := issue(t, "next", time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+	writePair(t, dir, next)
+	deadline := time.After(5 * time.Second)
+	for taken := false; !taken; {
+		select {
+		case event := <-events:
+			// The two files may be seen one at a time.
+			taken = event.Err == nil
+		case <-deadline:
+			t.Fatal("no reload")
+		}
+	}
+	config = watcher.ServerConfig()
+	if !pemLeaf(t, config.Source.(slim_bindings.TlsSourcePem).Cert).Equal(next.Leaf) {
+		t.Error("the new certificate was not taken")
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+}
+
+func TestWatcherRefusesInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	source := slim_bindings.TlsSourceFile{Cert: filepath.Join(dir, "cert.pem"), Key: filepath.Join(dir, "key.pem")}
+	if _, err := NewServerWatcher(slim_bindings.TlsServerConfig{Source: source, ClientCa: slim_bindings.CaSourceNone{}}); err == nil {
+		t.Error("NewServerWatcher with missing files succeeded")
+	}
+}
@@ -0,0 +1,481 @@
+package slim_bindings
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError is a problem with one field of a configuration.
+type FieldError struct {
+	// Path locates the field, such as "tls.source.file.cert".
+	Path string
+	// Message describes the problem.
+	Message string
+	// Hint, if set, suggests a fix.
+	Hint string
+}
+
+func (e *FieldError) Error() string {
+	msg := e.Message
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	if e.Hint != "" {
+		msg += " (" + e.Hint + ")"
+	}
+	return msg
+}
+
+// ValidationErrors lists every problem a Validate method found. Use
+// errors.As to inspect the individual FieldErrors.
+type ValidationErrors []*FieldError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	if len(lines) == 1 {
+		return "invalid configuration: " + lines[0]
+	}
+	return fmt.Sprintf("invalid configuration: %d problems:\n  %s", len(lines), strings.Join(lines, "\n  "))
+}
+
+// Unwrap returns the individual errors.
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// The Validate methods below check a configuration on the Go side before it
+// is handed to the native library, which reports most mistakes as a generic
+// SlimErrorConfigError once the connection or server is being set up. They
+// report every problem at once, with paths in the snake_case field names of
+// configuration files. Files named by the configuration must exist.
+
+// Validate reports the problems of the client configuration.
+func (r *ClientConfig) Validate() error {
+	var v validator
+	r.validate(&v, "")
+	return v.err()
+}
+
+// Validate reports the problems of the server configuration.
+func (r *ServerConfig) Validate() error {
+	var v validator
+	r.validate(&v, "")
+	return v.err()
+}
+
+// Validate reports the problems of the client TLS configuration.
+func (r *TlsClientConfig) Validate() error {
+	var v validator
+	r.validate(&v, "")
+	return v.err()
+}
+
+// Validate reports the problems of the server TLS configuration.
+func (r *TlsServerConfig) Validate() error {
+	var v validator
+	r.validate(&v, "")
+	return v.err()
+}
+
+// Validate reports the problems of the JWT verification configuration.
+func (r *JwtAuth) Validate() error {
+	var v validator
+	r.validate(&v, "")
+	return v.err()
+}
+
+// Validate reports the problems of the SPIRE configuration.
+func (r *SpireConfig) Validate() error {
+	var v validator
+	r.validate(&v, "")
+	return v.err()
+}
+
+// validator accumulates the problems of a configuration.
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(path, hint, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...), Hint: hint})
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func at(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (v *validator) file(path, name string) {
+	if name == "" {
+		v.add(path, "", "missing file name")
+		return
+	}
+	info, err := os.Stat(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		v.add(path, "", "file %s does not exist", name)
+	case err != nil:
+		v.add(path, "", "%v", err)
+	case info.IsDir():
+		v.add(path, "", "%s is a directory", name)
+	}
+}
+
+func (v *validator) pem(path, data string) {
+	if data == "" {
+		v.add(path, "", "missing PEM data")
+		return
+	}
+	if block, _ := pem.Decode([]byte(data)); block == nil {
+		v.add(path, `the data starts with "-----BEGIN"`, "not PEM data")
+	}
+}
+
+func (v *validator) duration(path string, d *time.Duration) {
+	if d != nil && *d < 0 {
+		v.add(path, "", "negative duration %s", *d)
+	}
+}
+
+func (v *validator) metadata(path string, metadata *string) {
+	if metadata != nil && !json.Valid([]byte(*metadata)) {
+		v.add(path, "", "metadata is not valid JSON")
+	}
+}
+
+func (v *validator) tlsVersion(path, version string) {
+	if version != "tls1.2" && version != "tls1.3" {
+		v.add(path, `use "tls1.2" or "tls1.3"`, "unknown TLS version %q", version)
+	}
+}
+
+func (v *validator) transport(path string, transport *TransportProtocol) {
+	if transport != nil && (*transport < TransportProtocolGrpc || *transport > TransportProtocolWebsocket) {
+		v.add(path, "use grpc or websocket", "unknown transport %d", *transport)
+	}
+}
+
+func (r *ClientConfig) validate(v *validator, path string) {
+	if r.Endpoint == "" {
+		v.add(at(path, "endpoint"), `such as "http://localhost:46357"`, "missing endpoint")
+	} else if u, err := url.Parse(r.Endpoint); err != nil || u.Host == "" {
+		v.add(at(path, "endpoint"), `include the scheme, such as "http://localhost:46357"`, "invalid endpoint %q", r.Endpoint)
+	}
+	v.transport(at(path, "transport"), r.Transport)
+	r.Tls.validate(v, at(path, "tls"))
+	if r.Compression != nil && (*r.Compression < CompressionTypeGzip || *r.Compression > CompressionTypeEmpty) {
+		v.add(at(path, "compression"), "", "unknown compression %d", *r.Compression)
+	}
+	if r.RateLimit != nil {
+		validateRateLimit(v, at(path, "rate_limit"), *r.RateLimit)
+	}
+	if r.Proxy != nil {
+		r.Proxy.validate(v, at(path, "proxy"))
+	}
+	v.duration(at(path, "connect_timeout"), r.ConnectTimeout)
+	v.duration(at(path, "request_timeout"), r.RequestTimeout)
+	if r.Headers != nil {
+		validateHeaders(v, at(path, "headers"), *r.Headers)
+	}
+	if r.Auth != nil {
+		validateClientAuth(v, at(path, "auth"), *r.Auth)
+	}
+	if r.Backoff != nil {
+		validateBackoff(v, at(path, "backoff"), *r.Backoff)
+	}
+	v.metadata(at(path, "metadata"), r.Metadata)
+}
+
+// validateRateLimit checks a limit in the native form "<requests>/<period>",
+// such as "100/s", where the period is one of s, m and h.
+func validateRateLimit(v *validator, path, limit string) {
+	const hint = `use "<requests>/<period>" with a period of s, m or h, such as "100/s"`
+	requests, period, ok := strings.Cut(limit, "/")
+	if !ok {
+		v.add(path, hint, "invalid rate limit %q", limit)
+		return
+	}
+	n, err := strconv.ParseUint(requests, 10, 64)
+	if err != nil || n == 0 {
+		v.add(path, hint, "invalid number of requests %q in rate limit %q", requests, limit)
+	}
+	if _, ok := ratePeriod(period); !ok {
+		v.add(path, hint, "invalid period %q in rate limit %q", period, limit)
+	}
+}
+
+// ratePeriod parses the period of a rate limit, one of the units s, m and h.
+func ratePeriod(period string) (time.Duration, bool) {
+	switch period {
+	case "s":
+		return time.Second, true
+	case "m":
+		return time.Minute, true
+	case "h":
+		return time.Hour, true
+	}
+	return 0, false
+}
+
+func validateHeaders(v *validator, path string, headers map[string]string) {
+	for name := range headers {
+		if name == "" || strings.ContainsFunc(name, func(r rune) bool {
+			return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
+		}) {
+			v.add(at(path, name), "", "invalid header name %q", name)
+		}
+	}
+}
+
+func (r *ProxyConfig) validate(v *validator, path string) {
+	if r.Url == nil || *r.Url == "" {
+		v.add(at(path, "url"), `such as "http://proxy.example.com:8080"`, "missing proxy URL")
+	} else if u, err := url.Parse(*r.Url); err != nil || u.Host == "" {
+		v.add(at(path, "url"), `such as "http://proxy.example.com:8080"`, "invalid proxy URL %q", *r.Url)
+	}
+	r.Tls.validate(v, at(path, "tls"))
+	if r.Password != nil && r.Username == nil {
+		v.add(at(path, "password"), "set username too", "password without username")
+	}
+	validateHeaders(v, at(path, "headers"), r.Headers)
+}
+
+func validateClientAuth(v *validator, path string, auth ClientAuthenticationConfig) {
+	switch auth := auth.(type) {
+	case nil:
+		v.add(path, "use ClientAuthenticationConfigNone for no authentication", "missing authentication")
+	case ClientAuthenticationConfigBasic:
+		auth.Config.validate(v, at(path, "basic"))
+	case ClientAuthenticationConfigStaticJwt:
+		v.file(at(path, "static_jwt.token_file"), auth.Config.TokenFile)
+		if auth.Config.Duration < 0 {
+			v.add(at(path, "static_jwt.duration"), "", "negative duration %s", auth.Config.Duration)
+		}
+	case ClientAuthenticationConfigJwt:
+		validateJwtKeyType(v, at(path, "jwt.key"), auth.Config.Key, auth.Config.Issuer)
+		if auth.Config.Duration < 0 {
+			v.add(at(path, "jwt.duration"), "", "negative duration %s", auth.Config.Duration)
+		}
+	case ClientAuthenticationConfigSpire:
+		auth.Config.validate(v, at(path, "spire"))
+	}
+}
+
+func (r *BasicAuth) validate(v *validator, path string) {
+	if r.Username == "" {
+		v.add(at(path, "username"), "", "missing username")
+	}
+	if r.Password == "" {
+		v.add(at(path, "password"), "", "missing password")
+	}
+}
+
+func validateBackoff(v *validator, path string, backoff BackoffConfig) {
+	switch backoff := backoff.(type) {
+	case nil:
+		v.add(path, "use BackoffConfigExponential or BackoffConfigFixedInterval", "missing backoff")
+	case BackoffConfigExponential:
+		if backoff.Config.Base <= 0 {
+			v.add(at(path, "exponential.base"), "", "base must be positive")
+		}
+		if backoff.Config.Factor == 0 {
+			v.add(at(path, "exponential.factor"), "", "factor must be positive")
+		}
+		if backoff.Config.MaxDelay < backoff.Config.Base {
+			v.add(at(path, "exponential.max_delay"), "", "max delay %s is below the base %s", backoff.Config.MaxDelay, backoff.Config.Base)
+		}
+	case BackoffConfigFixedInterval:
+		if backoff.Config.Interval <= 0 {
+			v.add(at(path, "fixed_interval.interval"), "", "interval must be positive")
+		}
+	}
+}
+
+func (r *ServerConfig) validate(v *validator, path string) {
+	if r.Endpoint == "" {
+		v.add(at(path, "endpoint"), `such as "0.0.0.0:46357"`, "missing endpoint")
+	} else if _, port, err := net.SplitHostPort(r.Endpoint); err != nil {
+		v.add(at(path, "endpoint"), `use host:port, such as "0.0.0.0:46357"`, "invalid endpoint %q", r.Endpoint)
+	} else if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		v.add(at(path, "endpoint"), "", "invalid port %q", port)
+	}
+	v.transport(at(path, "transport"), r.Transport)
+	r.Tls.validate(v, at(path, "tls"))
+	// HTTP/2 bounds the frame size (RFC 9113, section 6.5.2).
+	if r.MaxFrameSize != nil && (*r.MaxFrameSize < 1<<14 || *r.MaxFrameSize > 1<<24-1) {
+		v.add(at(path, "max_frame_size"), "between 16384 and 16777215", "invalid frame size %d", *r.MaxFrameSize)
+	}
+	if r.Auth != nil {
+		switch auth := (*r.Auth).(type) {
+		case nil:
+			v.add(at(path, "auth"), "use ServerAuthenticationConfigNone for no authentication", "missing authentication")
+		case ServerAuthenticationConfigBasic:
+			auth.Config.validate(v, at(path, "auth.basic"))
+		case ServerAuthenticationConfigJwt:
+			auth.Config.validate(v, at(path, "auth.jwt"))
+		case ServerAuthenticationConfigSpire:
+			auth.Config.validate(v, at(path, "auth.spire"))
+		}
+	}
+	v.metadata(at(path, "metadata"), r.Metadata)
+}
+
+func (r *TlsClientConfig) validate(v *validator, path string) {
+	v.tlsVersion(at(path, "tls_version"), r.TlsVersion)
+	validateTlsSource(v, at(path, "source"), r.Source)
+	validateCaSource(v, at(path, "ca_source"), r.CaSource)
+	if !r.Insecure {
+		return
+	}
+	const hint = "insecure disables TLS; remove it or set insecure to false"
+	if _, ok := r.Source.(TlsSourceNone); !ok && r.Source != nil {
+		v.add(at(path, "source"), hint, "a certificate is set on an insecure connection")
+	}
+	if _, ok := r.CaSource.(CaSourceNone); !ok && r.CaSource != nil {
+		v.add(at(path, "ca_source"), hint, "a CA is set on an insecure connection")
+	}
+	if r.InsecureSkipVerify {
+		v.add(at(path, "insecure_skip_verify"), hint, "certificate verification is skipped on an insecure connection")
+	}
+}
+
+func (r *TlsServerConfig) validate(v *validator, path string) {
+	if r.TlsVersion != nil {
+		v.tlsVersion(at(path, "tls_version"), *r.TlsVersion)
+	}
+	validateTlsSource(v, at(path, "source"), r.Source)
+	validateCaSource(v, at(path, "client_ca"), r.ClientCa)
+	_, noSource := r.Source.(TlsSourceNone)
+	_, noClientCa := r.ClientCa.(CaSourceNone)
+	if r.Insecure {
+		const hint = "insecure disables TLS; remove it or set insecure to false"
+		if !noSource && r.Source != nil {
+			v.add(at(path, "source"), hint, "a certificate is set on an insecure server")
+		}
+		if !noClientCa && r.ClientCa != nil {
+			v.add(at(path, "client_ca"), hint, "a client CA is set on an insecure server")
+		}
+	} else if noSource {
+		v.add(at(path, "source"), "set a certificate, or insecure to true for plain text", "a TLS server needs a certificate")
+	}
+	if _, file := r.ClientCa.(CaSourceFile); r.ReloadClientCaFile != nil && *r.ReloadClientCaFile && !file {
+		v.add(at(path, "reload_client_ca_file"), "", "only a client CA file can be reloaded")
+	}
+}
+
+func validateTlsSource(v *validator, path string, source TlsSource) {
+	switch source := source.(type) {
+	case nil:
+		v.add(path, "use TlsSourceNone for no certificate", "missing TLS source")
+	case TlsSourcePem:
+		v.pem(at(path, "pem.cert"), source.Cert)
+		v.pem(at(path, "pem.key"), source.Key)
+	case TlsSourceFile:
+		v.file(at(path, "file.cert"), source.Cert)
+		v.file(at(path, "file.key"), source.Key)
+	case TlsSourceSpire:
+		source.Config.validate(v, at(path, "spire"))
+	}
+}
+
+func validateCaSource(v *validator, path string, source CaSource) {
+	switch source := source.(type) {
+	case nil:
+		v.add(path, "use CaSourceNone for no CA", "missing CA source")
+	case CaSourceFile:
+		v.file(at(path, "file"), source.Path)
+	case CaSourcePem:
+		v.pem(at(path, "pem"), source.Data)
+	case CaSourceSpire:
+		source.Config.validate(v, at(path, "spire"))
+	}
+}
+
+func (r *JwtAuth) validate(v *validator, path string) {
+	validateJwtKeyType(v, at(path, "key"), r.Key, r.Issuer)
+	if r.Duration < 0 {
+		v.add(at(path, "duration"), "", "negative duration %s", r.Duration)
+	}
+}
+
+func validateJwtKeyType(v *validator, path string, key JwtKeyType, issuer *string) {
+	switch key := key.(type) {
+	case nil:
+		v.add(path, "use JwtKeyTypeEncoding, JwtKeyTypeDecoding or JwtKeyTypeAutoresolve", "missing JWT key")
+	case JwtKeyTypeEncoding:
+		key.Key.validate(v, at(path, "encoding"))
+	case JwtKeyTypeDecoding:
+		key.Key.validate(v, at(path, "decoding"))
+	case JwtKeyTypeAutoresolve:
+		if issuer == nil || *issuer == "" {
+			v.add(at(path, "autoresolve"), "set the issuer", "resolving keys needs the issuer to fetch them from")
+		}
+	}
+}
+
+func (r *JwtKeyConfig) validate(v *validator, path string) {
+	if r.Algorithm < JwtAlgorithmHs256 || r.Algorithm > JwtAlgorithmEdDsa {
+		v.add(at(path, "algorithm"), "", "unknown algorithm %d", r.Algorithm)
+	}
+	if r.Format < JwtKeyFormatPem || r.Format > JwtKeyFormatJwks {
+		v.add(at(path, "format"), "use pem, jwk or jwks", "unknown key format %d", r.Format)
+	}
+	switch key := r.Key.(type) {
+	case nil:
+		v.add(at(path, "key"), "use JwtKeyDataData or JwtKeyDataFile", "missing key")
+	case JwtKeyDataData:
+		if key.Value == "" {
+			v.add(at(path, "key.data"), "", "missing key data")
+		} else if r.Format == JwtKeyFormatPem && r.Algorithm > JwtAlgorithmHs512 {
+			v.pem(at(path, "key.data"), key.Value)
+		}
+	case JwtKeyDataFile:
+		v.file(at(path, "key.file"), key.Path)
+	}
+}
+
+func (r *SpireConfig) validate(v *validator, path string) {
+	if r.SocketPath != nil && *r.SocketPath == "" {
+		v.add(at(path, "socket_path"), "omit it to use SPIFFE_ENDPOINT_SOCKET", "empty socket path")
+	}
+	if r.TargetSpiffeId != nil {
+		if u, err := url.Parse(*r.TargetSpiffeId); err != nil || u.Scheme != "spiffe" || u.Host == "" {
+			v.add(at(path, "target_spiffe_id"), `such as "spiffe://example.org/service"`, "invalid SPIFFE ID %q", *r.TargetSpiffeId)
+		}
+	}
+	for i, audience := range r.JwtAudiences {
+		if audience == "" {
+			v.add(fmt.Sprintf("%s[%d]", at(path, "jwt_audiences"), i), "", "empty audience")
+		}
+	}
+	for i, domain := range r.TrustDomains {
+		if domain == "" || strings.ContainsAny(domain, ":/") {
+			v.add(fmt.Sprintf("%s[%d]", at(path, "trust_domains"), i), `a name such as "example.org", without spiffe://`, "invalid trust domain %q", domain)
+		}
+	}
+}
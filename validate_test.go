@@ -0,0 +1,207 @@
+package slim_bindings
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func problems(t *testing.T, err error) map[string]*FieldError {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error = %v, want ValidationErrors", err)
+	}
+	byPath := make(map[string]*FieldError, len(errs))
+	for _, err := range errs {
+		byPath[err.Path] = err
+	}
+	return byPath
+}
+
+func expectProblems(t *testing.T, err error, want map[string]string) {
+	t.Helper()
+	got := problems(t, err)
+	for path, message := range want {
+		if got[path] == nil {
+			t.Errorf("no problem at %s in %v", path, err)
+		} else if !strings.Contains(got[path].Message, message) {
+			t.Errorf("%s: message = %q, want %q", path, got[path].Message, message)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("problems = %v", err)
+	}
+}
+
+func TestValidateClientConfig(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	limit := "100/s"
+	timeout := 5 * time.Second
+	config := ClientConfig{
+		Endpoint:       "https://slim.example.com:46357",
+		Tls:            TlsClientConfig{Source: TlsSourceNone{}, CaSource: CaSourceFile{Path: ca}, TlsVersion: "tls1.3"},
+		RateLimit:      &limit,
+		ConnectTimeout: &timeout,
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	limit = "100/week"
+	metadata := "{"
+	headers := map[string]string{"x-tenant": "acme", "bad header": "x"}
+	config.Endpoint = "localhost"
+	config.Tls = TlsClientConfig{
+		Insecure:   true,
+		Source:     TlsSourceFile{Cert: ca, Key: filepath.Join(t.TempDir(), "missing.pem")},
+		CaSource:   CaSourceNone{},
+		TlsVersion: "1.3",
+	}
+	config.Metadata = &metadata
+	config.Headers = &headers
+	var auth ClientAuthenticationConfig = ClientAuthenticationConfigBasic{Config: BasicAuth{Username: "app"}}
+	config.Auth = &auth
+	var backoff BackoffConfig = BackoffConfigExponential{Config: ExponentialBackoff{Base: time.Second, MaxDelay: time.Millisecond}}
+	config.Backoff = &backoff
+
+	err := config.Validate()
+	expectProblems(t, err, map[string]string{
+		"endpoint":                      "invalid endpoint",
+		"rate_limit":                    `invalid period "week"`,
+		"tls.tls_version":               `unknown TLS version "1.3"`,
+		"tls.source":                    "insecure connection",
+		"tls.source.file.key":           "does not exist",
+		"headers.bad header":            "invalid header name",
+		"auth.basic.password":           "missing password",
+		"backoff.exponential.factor":    "factor must be positive",
+		"backoff.exponential.max_delay": "below the base",
+		"metadata":                      "not valid JSON",
+	})
+	if hint := problems(t, err)["rate_limit"].Hint; !strings.Contains(hint, "<requests>/<period>") {
+		t.Errorf("rate_limit hint = %q", hint)
+	}
+	if !strings.HasPrefix(err.Error(), "invalid configuration: 10 problems:") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	for limit, valid := range map[string]bool{
+		"100/s":     true,
+		"100/m":     true,
+		"100/h":     true,
+		"100/1":     false,
+		"100/10s":   false,
+		"100/250ms": false,
+		"100/1h30m": false,
+		"100":       false,
+		"0/s":       false,
+		"100/0":     false,
+		"100/-1s":   false,
+		"100/d":     false,
+		"x/s":       false,
+	} {
+		v := &validator{}
+		validateRateLimit(v, "rate_limit", limit)
+		if got := v.err() == nil; got != valid {
+			t.Errorf("rate limit %q valid = %v, want %v: %v", limit, got, valid, v.err())
+		}
+	}
+}
+
+func TestValidateTlsClientConfigMissingSources(t *testing.T) {
+	config := TlsClientConfig{TlsVersion: "tls1.2"}
+	expectProblems(t, config.Validate(), map[string]string{
+		"source":    "missing TLS source",
+		"ca_source": "missing CA source",
+	})
+}
+
+func TestValidateServerConfig(t *testing.T) {
+	config := ServerConfig{
+		Endpoint: "0.0.0.0:46357",
+		Tls:      TlsServerConfig{Insecure: true, Source: TlsSourceNone{}, ClientCa: CaSourceNone{}},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	version := "tls1.1"
+	reload := true
+	frame := uint32(1024)
+	var auth ServerAuthenticationConfig = ServerAuthenticationConfigJwt{Config: JwtAuth{
+		Key: JwtKeyTypeDecoding{Key: JwtKeyConfig{
+			Algorithm: JwtAlgorithmEs256,
+			Format:    JwtKeyFormatPem,
+			Key:       JwtKeyDataFile{Path: filepath.Join(t.TempDir(), "jwt.pub")},
+		}},
+	}}
+	config = ServerConfig{
+		Endpoint:     "46357",
+		Tls:          TlsServerConfig{Source: TlsSourceNone{}, ClientCa: CaSourcePem{Data: "cert"}, TlsVersion: &version, ReloadClientCaFile: &reload},
+		MaxFrameSize: &frame,
+		Auth:         &auth,
+	}
+	expectProblems(t, config.Validate(), map[string]string{
+		"endpoint":                       "invalid endpoint",
+		"tls.tls_version":                `unknown TLS version "tls1.1"`,
+		"tls.source":                     "needs a certificate",
+		"tls.client_ca.pem":              "not PEM data",
+		"tls.reload_client_ca_file":      "only a client CA file",
+		"max_frame_size":                 "invalid frame size 1024",
+		"auth.jwt.key.decoding.key.file": "does not exist",
+	})
+}
+
+func TestValidateJwtAuth(t *testing.T) {
+	config := JwtAuth{Key: JwtKeyTypeAutoresolve{}, Duration: time.Hour}
+	expectProblems(t, config.Validate(), map[string]string{
+		"key.autoresolve": "needs the issuer",
+	})
+
+	issuer := "https://issuer.example.com"
+	config.Issuer = &issuer
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	config = JwtAuth{Key: JwtKeyTypeDecoding{Key: JwtKeyConfig{Key: JwtKeyDataData{}}}}
+	expectProblems(t, config.Validate(), map[string]string{
+		"key.decoding.algorithm": "unknown algorithm 0",
+		"key.decoding.format":    "unknown key format 0",
+		"key.decoding.key.data":  "missing key data",
+	})
+}
+
+func TestValidateSpireConfig(t *testing.T) {
+	socket := ""
+	id := "example.org/service"
+	config := SpireConfig{
+		SocketPath:     &socket,
+		TargetSpiffeId: &id,
+		JwtAudiences:   []string{"slim", ""},
+		TrustDomains:   []string{"example.org", "spiffe://other.org"},
+	}
+	expectProblems(t, config.Validate(), map[string]string{
+		"socket_path":      "empty socket path",
+		"target_spiffe_id": "invalid SPIFFE ID",
+		"jwt_audiences[1]": "empty audience",
+		"trust_domains[1]": "invalid trust domain",
+	})
+
+	id = "spiffe://example.org/service"
+	config = SpireConfig{TargetSpiffeId: &id, TrustDomains: []string{"example.org"}}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}